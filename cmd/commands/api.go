@@ -4,7 +4,10 @@ import (
 	"context"
 	"go-ldap-sso/config"
 	"go-ldap-sso/db"
+	"go-ldap-sso/db/employees"
+	"go-ldap-sso/internal/dirsync"
 	"go-ldap-sso/internal/handler"
+	ldapauth "go-ldap-sso/internal/ldap"
 	"log"
 	"net/http"
 	"os/signal"
@@ -26,6 +29,30 @@ func RunAPI(cfg *config.Config) error {
 
 	server := handler.SetupRoutes(authHandler)
 
+	if interval := cfg.LDAPConfig.SyncIntervalMins; interval > 0 {
+		// Own LDAP connection so a long paged search doesn't hold up logins
+		syncClient, err := ldapauth.NewLDAPClient(&cfg.LDAPConfig)
+		if err != nil {
+			log.Fatalf("Failed to initialize LDAP sync client: %v", err)
+		}
+		defer syncClient.Close()
+
+		syncer := dirsync.NewSyncer(syncClient, employees.NewRepository(dbConn.Pool))
+		go syncer.RunEvery(ctx, time.Duration(interval)*time.Minute)
+		log.Printf("🔄 LDAP sync scheduled every %d minute(s)", interval)
+	}
+
+	if cfg.LDAPConfig.IncrementalSync {
+		watchClient, err := ldapauth.NewLDAPClient(&cfg.LDAPConfig)
+		if err != nil {
+			log.Fatalf("Failed to initialize LDAP watch client: %v", err)
+		}
+		defer watchClient.Close()
+
+		incremental := dirsync.NewIncremental(watchClient, dbConn.Pool, time.Duration(cfg.LDAPConfig.SyncPollSeconds)*time.Second)
+		go incremental.Run(ctx)
+	}
+
 	go func() {
 		log.Println("🚀 Server running on :8080")
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
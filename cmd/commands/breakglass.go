@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db"
+	"go-ldap-sso/db/breakglass"
+)
+
+func BreakGlassHistory(cfg *config.Config, limit int) error {
+	dbConn := db.NewDatabase(cfg)
+	defer dbConn.Close()
+
+	list, err := breakglass.NewRepository(dbConn.Pool).List(context.Background(), limit)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Break-glass elevations:")
+	fmt.Println("------------------------------------------------------------")
+	fmt.Printf("%-5s | %-19s | %-12s | %-16s | %-8s | %s\n", "ID", "Created", "Employee", "Role", "Notified", "Justification")
+	fmt.Println("------------------------------------------------------------")
+
+	for _, e := range list {
+		notified := "no"
+		if e.NotifiedAt != nil {
+			notified = "yes"
+		}
+		fmt.Printf("%-5d | %-19s | %-12s | %-16s | %-8s | %s\n",
+			e.ID, e.CreatedAt.Format("2006-01-02 15:04:05"), e.Employee, e.RoleName, notified, e.Justification)
+	}
+	return nil
+}
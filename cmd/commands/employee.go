@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db"
+	"go-ldap-sso/db/employees"
+)
+
+// SetEmailLogin sets whether an employee (uid or email) may log in with a
+// mailed code or magic link, "on" or "off".
+func SetEmailLogin(cfg *config.Config, employee, setting string) error {
+	if setting != "on" && setting != "off" {
+		return fmt.Errorf("invalid email-login setting %q, want on or off", setting)
+	}
+
+	dbConn := db.NewDatabase(cfg)
+	defer dbConn.Close()
+	ctx := context.Background()
+
+	repo := employees.NewRepository(dbConn.Pool)
+	e, err := repo.Find(ctx, employee)
+	if err != nil {
+		return fmt.Errorf("%s: %w", employee, err)
+	}
+	if err := repo.SetEmailLogin(ctx, e.ID, setting == "on"); err != nil {
+		return err
+	}
+	fmt.Printf("Updated employee %s: email login %s\n", e.UID, setting)
+	return nil
+}
@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"go-ldap-sso/internal/ldapproxy"
+	"go-ldap-sso/internal/ldapserver"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ServeLDAP runs the embedded in-memory LDAP server seeded from ldifDir,
+// using the configured base DN and bind credentials as its root account.
+func ServeLDAP(cfg *config.Config, addr, ldifDir string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	backend := ldapserver.NewMemory(ldapserver.Options{
+		BaseDN:       cfg.LDAPConfig.BaseDN,
+		RootDN:       cfg.LDAPConfig.BindDN,
+		RootPassword: cfg.LDAPConfig.BindPass,
+	})
+	if err := backend.LoadLDIFDir(ldifDir); err != nil {
+		return fmt.Errorf("failed to load LDIF: %w", err)
+	}
+
+	srv := ldapserver.NewServer(backend)
+	if err := srv.Listen(addr); err != nil {
+		return fmt.Errorf("LDAP server failed to start: %w", err)
+	}
+	defer srv.Close()
+
+	log.Printf("📒 Embedded LDAP server on %s with %d entries (base %s)", srv.Addr(), backend.Dir.Len(), cfg.LDAPConfig.BaseDN)
+	<-ctx.Done()
+	log.Println("🛑 Stopping LDAP server")
+	return nil
+}
+
+// ProxyLDAP serves the virtual tree of internal/ldapproxy: binds are checked
+// against the configured LDAP server, searches answered from Postgres.
+func ProxyLDAP(cfg *config.Config, addr string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	dbConn := db.NewDatabase(cfg)
+	defer dbConn.Close()
+
+	ldapClient, err := ldapauth.NewLDAPClient(&cfg.LDAPConfig)
+	if err != nil {
+		return fmt.Errorf("LDAP init failed: %w", err)
+	}
+	defer ldapClient.Close()
+
+	backend := ldapproxy.NewBackend(ldapproxy.Options{
+		BaseDN:       cfg.LDAPConfig.ProxyBaseDN,
+		BindDN:       cfg.LDAPConfig.ProxyBindDN,
+		BindPassword: cfg.LDAPConfig.ProxyBindPass,
+		CacheTTL:     time.Duration(cfg.LDAPConfig.ProxyCacheSeconds) * time.Second,
+	}, ldapClient, dbConn.Pool)
+
+	srv := ldapserver.NewServer(backend)
+	if err := srv.Listen(addr); err != nil {
+		return fmt.Errorf("LDAP proxy failed to start: %w", err)
+	}
+	defer srv.Close()
+
+	log.Printf("🔀 LDAP proxy on %s (base %s)", srv.Addr(), cfg.LDAPConfig.ProxyBaseDN)
+	<-ctx.Done()
+	log.Println("🛑 Stopping LDAP proxy")
+	return nil
+}
@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db"
+	"go-ldap-sso/db/ldifhistory"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"go-ldap-sso/internal/ldifapply"
+	"log"
+)
+
+// ApplyLDIF applies the pending LDIF files of dir through the configured LDAP connection.
+func ApplyLDIF(cfg *config.Config, dir string, reset bool) error {
+	ctx := context.Background()
+
+	dbConn := db.NewDatabase(cfg)
+	defer dbConn.Close()
+
+	ldapClient, err := ldapauth.NewLDAPClient(&cfg.LDAPConfig)
+	if err != nil {
+		return fmt.Errorf("LDAP init failed: %w", err)
+	}
+	defer ldapClient.Close()
+
+	runner := ldifapply.NewRunner(ldapClient, ldifhistory.NewRepository(dbConn.Pool), dir)
+	if reset {
+		if err := runner.Reset(ctx); err != nil {
+			return fmt.Errorf("failed to reset ldif history: %w", err)
+		}
+		log.Println("🧹 LDIF history cleared")
+	}
+
+	if err := runner.Run(ctx); err != nil {
+		return fmt.Errorf("ldif apply failed: %w", err)
+	}
+	return nil
+}
+
+func LDIFHistory(cfg *config.Config) error {
+	ctx := context.Background()
+
+	dbConn := db.NewDatabase(cfg)
+	defer dbConn.Close()
+
+	repo := ldifhistory.NewRepository(dbConn.Pool)
+	if err := repo.Initialize(ctx); err != nil {
+		return fmt.Errorf("failed to initialize ldif history: %w", err)
+	}
+
+	history, err := repo.GetHistory(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get history: %w", err)
+	}
+
+	fmt.Println("LDIF History:")
+	fmt.Println("------------------------------------------------------------")
+	fmt.Printf("%-32s | %-6s | %-19s\n", "Name", "Batch", "Applied At")
+	fmt.Println("------------------------------------------------------------")
+
+	for _, h := range history {
+		fmt.Printf("%-32s | %-6d | %-19s\n", h.Name, h.Batch, h.AppliedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db"
+	"go-ldap-sso/db/employees"
+	"go-ldap-sso/db/mfa"
+	"go-ldap-sso/db/passkeys"
+)
+
+// ResetMFA removes the authenticator, recovery codes and passkeys of an
+// employee (uid or email) who lost them. If their scopes require a second factor they
+// enroll again at the next login.
+func ResetMFA(cfg *config.Config, employee string) error {
+	dbConn := db.NewDatabase(cfg)
+	defer dbConn.Close()
+	ctx := context.Background()
+
+	e, err := employees.NewRepository(dbConn.Pool).Find(ctx, employee)
+	if err != nil {
+		return fmt.Errorf("%s: %w", employee, err)
+	}
+	if err := mfa.NewRepository(dbConn.Pool).DeleteTOTP(ctx, e.ID); err != nil {
+		return err
+	}
+	removed, err := passkeys.NewRepository(dbConn.Pool).DeleteAll(ctx, e.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reset second factor of %s, %d passkeys removed\n", e.UID, removed)
+	return nil
+}
@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db"
+	"go-ldap-sso/db/policies"
+	"go-ldap-sso/internal/policy"
+	"strings"
+)
+
+// ApplyPolicies stores the policies of a YAML file in Postgres. Every policy
+// is compiled first, so a file with one bad policy changes nothing.
+func ApplyPolicies(cfg *config.Config, path string) error {
+	list, err := policy.LoadFile(path)
+	if err != nil {
+		return err
+	}
+	engine, err := policy.NewEngine()
+	if err != nil {
+		return err
+	}
+	for _, p := range list {
+		if err := engine.Compile(p); err != nil {
+			return err
+		}
+	}
+
+	dbConn := db.NewDatabase(cfg)
+	defer dbConn.Close()
+	repo := policies.NewRepository(dbConn.Pool)
+
+	for _, p := range list {
+		if err := repo.Upsert(context.Background(), p); err != nil {
+			return err
+		}
+		fmt.Printf("Applied policy: %s\n", p.Name)
+	}
+	return nil
+}
+
+func ListPolicies(cfg *config.Config) error {
+	files, err := policy.LoadDir(cfg.AuthConfig.PolicyDir)
+	if err != nil {
+		return err
+	}
+
+	dbConn := db.NewDatabase(cfg)
+	defer dbConn.Close()
+	stored, err := policies.NewRepository(dbConn.Pool).ListEnabled(context.Background())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Policies:")
+	fmt.Println("------------------------------------------------------------")
+	fmt.Printf("%-28s | %-6s | %-24s | %s\n", "Name", "Effect", "Actions", "Source")
+	fmt.Println("------------------------------------------------------------")
+
+	for _, p := range append(files, stored...) {
+		fmt.Printf("%-28s | %-6s | %-24s | %s\n", p.Name, p.Effect, strings.Join(p.Actions, ","), p.Source)
+	}
+	return nil
+}
+
+func DeletePolicy(cfg *config.Config, name string) error {
+	dbConn := db.NewDatabase(cfg)
+	defer dbConn.Close()
+
+	if err := policies.NewRepository(dbConn.Pool).Delete(context.Background(), name); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted policy: %s\n", name)
+	return nil
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db"
+	"go-ldap-sso/db/roles"
+	"strings"
+)
+
+// withRoles runs fn with a roles repository on a fresh database connection.
+func withRoles(cfg *config.Config, fn func(ctx context.Context, repo *roles.Repository) error) error {
+	dbConn := db.NewDatabase(cfg)
+	defer dbConn.Close()
+
+	return fn(context.Background(), roles.NewRepository(dbConn.Pool))
+}
+
+func CreateRole(cfg *config.Config, name, description string, parents []string) error {
+	return withRoles(cfg, func(ctx context.Context, repo *roles.Repository) error {
+		if _, err := repo.Create(ctx, name, description); err != nil {
+			return err
+		}
+		for _, parent := range parents {
+			if err := repo.Inherit(ctx, name, parent); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Created role: %s\n", name)
+		return nil
+	})
+}
+
+func DeleteRole(cfg *config.Config, name string) error {
+	return withRoles(cfg, func(ctx context.Context, repo *roles.Repository) error {
+		if err := repo.Delete(ctx, name); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted role: %s\n", name)
+		return nil
+	})
+}
+
+func InheritRole(cfg *config.Config, role, parent string, remove bool) error {
+	return withRoles(cfg, func(ctx context.Context, repo *roles.Repository) error {
+		if remove {
+			return repo.Disinherit(ctx, role, parent)
+		}
+		return repo.Inherit(ctx, role, parent)
+	})
+}
+
+func GrantRoleScopes(cfg *config.Config, role string, scopeNames []string) error {
+	return withRoles(cfg, func(ctx context.Context, repo *roles.Repository) error {
+		for _, scope := range scopeNames {
+			if err := repo.GrantScope(ctx, role, scope); err != nil {
+				return err
+			}
+			fmt.Printf("Granted %s to role %s\n", scope, role)
+		}
+		return nil
+	})
+}
+
+func RevokeRoleScopes(cfg *config.Config, role string, scopeNames []string) error {
+	return withRoles(cfg, func(ctx context.Context, repo *roles.Repository) error {
+		for _, scope := range scopeNames {
+			if err := repo.RevokeScope(ctx, role, scope); err != nil {
+				return err
+			}
+			fmt.Printf("Revoked %s from role %s\n", scope, role)
+		}
+		return nil
+	})
+}
+
+func AssignRole(cfg *config.Config, employee, role string, remove bool) error {
+	return withRoles(cfg, func(ctx context.Context, repo *roles.Repository) error {
+		if remove {
+			if err := repo.Unassign(ctx, employee, role); err != nil {
+				return err
+			}
+			fmt.Printf("Removed role %s from %s\n", role, employee)
+			return nil
+		}
+		if err := repo.Assign(ctx, employee, role); err != nil {
+			return err
+		}
+		fmt.Printf("Assigned role %s to %s\n", role, employee)
+		return nil
+	})
+}
+
+func ListRoles(cfg *config.Config) error {
+	return withRoles(cfg, func(ctx context.Context, repo *roles.Repository) error {
+		list, err := repo.List(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Roles:")
+		fmt.Println("------------------------------------------------------------")
+		fmt.Printf("%-24s | %-20s | %s\n", "Name", "Inherits", "Scopes")
+		fmt.Println("------------------------------------------------------------")
+
+		for _, r := range list {
+			fmt.Printf("%-24s | %-20s | %s\n", r.Name, strings.Join(r.Parents, ","), strings.Join(r.Scopes, ","))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db"
+	"go-ldap-sso/db/scopes"
+	"strconv"
+	"time"
+)
+
+// withScopes runs fn with a scopes repository on a fresh database connection.
+func withScopes(cfg *config.Config, fn func(ctx context.Context, repo *scopes.Repository) error) error {
+	dbConn := db.NewDatabase(cfg)
+	defer dbConn.Close()
+
+	return fn(context.Background(), scopes.NewRepository(dbConn.Pool))
+}
+
+// GrantScope gives an employee a scope directly; a zero duration grants it
+// permanently.
+func GrantScope(cfg *config.Config, employee, scope, grantedBy, reason string, startsIn, duration time.Duration) error {
+	return withScopes(cfg, func(ctx context.Context, repo *scopes.Repository) error {
+		if err := repo.Grant(ctx, employee, scope, grantedBy, reason, startsIn, duration); err != nil {
+			return err
+		}
+		until := "permanently"
+		if duration > 0 {
+			until = "until " + time.Now().Add(startsIn+duration).Format(time.RFC3339)
+		}
+		fmt.Printf("Granted %s to %s %s\n", scope, employee, until)
+		return nil
+	})
+}
+
+func RevokeScope(cfg *config.Config, employee, scope string) error {
+	return withScopes(cfg, func(ctx context.Context, repo *scopes.Repository) error {
+		if err := repo.Revoke(ctx, employee, scope); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked %s from %s\n", scope, employee)
+		return nil
+	})
+}
+
+func SetScopePolicy(cfg *config.Config, scope, ownerRole string, maxGrantHours int) error {
+	return withScopes(cfg, func(ctx context.Context, repo *scopes.Repository) error {
+		if err := repo.SetPolicy(ctx, scope, ownerRole, maxGrantHours); err != nil {
+			return err
+		}
+		fmt.Printf("Updated scope %s\n", scope)
+		return nil
+	})
+}
+
+// SetScopeMFA sets whether holders of scope must use a second factor:
+// "required", "optional" or "default".
+func SetScopeMFA(cfg *config.Config, scope, setting string) error {
+	var required *bool
+	switch setting {
+	case "required", "optional":
+		v := setting == "required"
+		required = &v
+	case "default":
+	default:
+		return fmt.Errorf("invalid mfa setting %q, want required, optional or default", setting)
+	}
+
+	return withScopes(cfg, func(ctx context.Context, repo *scopes.Repository) error {
+		if err := repo.SetMFARequired(ctx, scope, required); err != nil {
+			return err
+		}
+		fmt.Printf("Updated scope %s: mfa %s\n", scope, setting)
+		return nil
+	})
+}
+
+func ListScopes(cfg *config.Config) error {
+	return withScopes(cfg, func(ctx context.Context, repo *scopes.Repository) error {
+		list, err := repo.List(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Scopes:")
+		fmt.Println("------------------------------------------------------------")
+		fmt.Printf("%-24s | %-20s | %-9s | %-8s | %s\n", "Name", "Owner role", "Max hours", "MFA", "Description")
+		fmt.Println("------------------------------------------------------------")
+
+		for _, s := range list {
+			maxHours := "-"
+			if s.MaxGrantHours != nil {
+				maxHours = strconv.Itoa(*s.MaxGrantHours)
+			}
+			mfa := "default"
+			if s.MFARequired != nil && *s.MFARequired {
+				mfa = "required"
+			} else if s.MFARequired != nil {
+				mfa = "optional"
+			}
+			fmt.Printf("%-24s | %-20s | %-9s | %-8s | %s\n", s.Name, s.OwnerRole, maxHours, mfa, s.Description)
+		}
+		return nil
+	})
+}
+
+func ListScopeGrants(cfg *config.Config, employee string) error {
+	return withScopes(cfg, func(ctx context.Context, repo *scopes.Repository) error {
+		list, err := repo.Grants(ctx, employee)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Direct grants of %s:\n", employee)
+		fmt.Println("------------------------------------------------------------")
+		fmt.Printf("%-20s | %-19s | %-19s | %-12s | %s\n", "Scope", "Starts", "Expires", "Granted by", "Reason")
+		fmt.Println("------------------------------------------------------------")
+
+		for _, g := range list {
+			expires := "never"
+			if g.ExpiresAt != nil {
+				expires = g.ExpiresAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-20s | %-19s | %-19s | %-12s | %s\n",
+				g.Scope, g.StartsAt.Format("2006-01-02 15:04:05"), expires, g.GrantedBy, g.Reason)
+		}
+		return nil
+	})
+}
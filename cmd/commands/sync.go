@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db"
+	"go-ldap-sso/db/employees"
+	"go-ldap-sso/internal/dirsync"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"log"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func SyncLDAP(cfg *config.Config, dryRun bool) error {
+	ctx := context.Background()
+
+	dbConn := db.NewDatabase(cfg)
+	defer dbConn.Close()
+
+	ldapClient, err := ldapauth.NewLDAPClient(&cfg.LDAPConfig)
+	if err != nil {
+		return fmt.Errorf("LDAP init failed: %w", err)
+	}
+	defer ldapClient.Close()
+
+	syncer := dirsync.NewSyncer(ldapClient, employees.NewRepository(dbConn.Pool))
+	summary, err := syncer.Run(ctx, dryRun)
+	if err != nil {
+		return fmt.Errorf("sync failed: %w", err)
+	}
+
+	printSyncSummary(summary)
+	return nil
+}
+
+// WatchLDAP follows directory changes until interrupted.
+func WatchLDAP(cfg *config.Config, reset bool) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	dbConn := db.NewDatabase(cfg)
+	defer dbConn.Close()
+
+	ldapClient, err := ldapauth.NewLDAPClient(&cfg.LDAPConfig)
+	if err != nil {
+		return fmt.Errorf("LDAP init failed: %w", err)
+	}
+	defer ldapClient.Close()
+
+	incremental := dirsync.NewIncremental(ldapClient, dbConn.Pool, time.Duration(cfg.LDAPConfig.SyncPollSeconds)*time.Second)
+	if reset {
+		if err := incremental.Reset(ctx); err != nil {
+			return fmt.Errorf("failed to reset sync state: %w", err)
+		}
+		log.Println("🧹 Sync state cleared, starting from scratch")
+	}
+
+	incremental.Run(ctx)
+	log.Println("🛑 Incremental sync stopped")
+	return nil
+}
+
+func printSyncSummary(summary *dirsync.Summary) {
+	if summary.DryRun {
+		fmt.Println("LDAP Sync (dry run, nothing written):")
+	} else {
+		fmt.Println("LDAP Sync:")
+	}
+	fmt.Println("----------------------------------------")
+	fmt.Printf("%-12s | %-20s | %s\n", "Action", "UID", "Details")
+	fmt.Println("----------------------------------------")
+
+	for _, c := range summary.Changes {
+		details := strings.Join(c.Fields, ", ")
+		if c.Err != nil {
+			details = "FAILED: " + c.Err.Error()
+		}
+		fmt.Printf("%-12s | %-20s | %s\n", c.Action, c.UID, details)
+	}
+	for _, c := range summary.Skipped {
+		fmt.Printf("%-12s | %-20s | %s\n", "skip", c.UID, c.Err)
+	}
+
+	fmt.Println("----------------------------------------")
+	fmt.Printf("%s (%s)\n", summary, summary.Duration.Round(time.Millisecond))
+}
@@ -67,6 +67,364 @@ func main() {
 					},
 				},
 			},
+			{
+				Name:  "ldap",
+				Usage: "Embedded LDAP server and proxy",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "serve",
+						Usage: "Run an in-memory LDAP server seeded from LDIF files",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "addr",
+								Value: "127.0.0.1:3389",
+								Usage: "Listen address",
+							},
+							&cli.StringFlag{
+								Name:  "ldif-dir",
+								Value: "ldif",
+								Usage: "Directory with *.ldif files applied at startup",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return commands.ServeLDAP(cfg, c.String("addr"), c.String("ldif-dir"))
+						},
+					},
+					{
+						Name:  "proxy",
+						Usage: "Run an LDAP front-end exposing employees with their scopes",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "addr",
+								Value: "127.0.0.1:1389",
+								Usage: "Listen address",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return commands.ProxyLDAP(cfg, c.String("addr"))
+						},
+					},
+				},
+			},
+			{
+				Name:  "ldif",
+				Usage: "Apply LDIF files to the configured LDAP server",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "apply",
+						Usage: "Apply pending LDIF files",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "dir",
+								Value: "ldif",
+								Usage: "Directory with *.ldif files, applied in name order",
+							},
+							&cli.BoolFlag{
+								Name:  "reset",
+								Usage: "Forget the history first (after recreating the LDAP server)",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return commands.ApplyLDIF(cfg, c.String("dir"), c.Bool("reset"))
+						},
+					},
+					{
+						Name:  "history",
+						Usage: "Show applied LDIF files",
+						Action: func(c *cli.Context) error {
+							return commands.LDIFHistory(cfg)
+						},
+					},
+				},
+			},
+			{
+				Name:  "sync",
+				Usage: "Directory synchronisation",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "ldap",
+						Usage: "Sync LDAP users into the employees table",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "dry-run",
+								Usage: "Only print the diff, don't write to the database",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return commands.SyncLDAP(cfg, c.Bool("dry-run"))
+						},
+					},
+					{
+						Name:  "watch",
+						Usage: "Follow LDAP changes incrementally (syncrepl or modifyTimestamp polling)",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "reset",
+								Usage: "Forget the stored cookie/high-water mark first",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return commands.WatchLDAP(cfg, c.Bool("reset"))
+						},
+					},
+				},
+			},
+			{
+				Name:  "role",
+				Usage: "Manage roles (bundles of scopes) and their assignment",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "create",
+						Usage:     "Create a role",
+						UsageText: "role create [--description text] [--inherits parent] <name>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{Name: "description"},
+							&cli.StringSliceFlag{
+								Name:  "inherits",
+								Usage: "Parent role whose scopes this role includes (repeatable)",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								return cli.Exit("Role name is required", 1)
+							}
+							return commands.CreateRole(cfg, c.Args().First(), c.String("description"), c.StringSlice("inherits"))
+						},
+					},
+					{
+						Name:      "delete",
+						Usage:     "Delete a role",
+						UsageText: "role delete <name>",
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								return cli.Exit("Role name is required", 1)
+							}
+							return commands.DeleteRole(cfg, c.Args().First())
+						},
+					},
+					{
+						Name:      "inherit",
+						Usage:     "Make a role inherit the scopes of another",
+						UsageText: "role inherit [--remove] <role> <parent>",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{Name: "remove", Usage: "Remove the inheritance instead"},
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 2 {
+								return cli.Exit("Role and parent are required", 1)
+							}
+							return commands.InheritRole(cfg, c.Args().Get(0), c.Args().Get(1), c.Bool("remove"))
+						},
+					},
+					{
+						Name:      "grant",
+						Usage:     "Add scopes to a role",
+						UsageText: "role grant <role> <scope>...",
+						Action: func(c *cli.Context) error {
+							if c.NArg() < 2 {
+								return cli.Exit("Role and at least one scope are required", 1)
+							}
+							return commands.GrantRoleScopes(cfg, c.Args().First(), c.Args().Tail())
+						},
+					},
+					{
+						Name:      "revoke",
+						Usage:     "Remove scopes from a role",
+						UsageText: "role revoke <role> <scope>...",
+						Action: func(c *cli.Context) error {
+							if c.NArg() < 2 {
+								return cli.Exit("Role and at least one scope are required", 1)
+							}
+							return commands.RevokeRoleScopes(cfg, c.Args().First(), c.Args().Tail())
+						},
+					},
+					{
+						Name:      "assign",
+						Usage:     "Give an employee (uid or email) a role",
+						UsageText: "role assign [--remove] <employee> <role>",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{Name: "remove", Usage: "Take the role away instead"},
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 2 {
+								return cli.Exit("Employee and role are required", 1)
+							}
+							return commands.AssignRole(cfg, c.Args().Get(0), c.Args().Get(1), c.Bool("remove"))
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "List roles with their parents and scopes",
+						Action: func(c *cli.Context) error {
+							return commands.ListRoles(cfg)
+						},
+					},
+				},
+			},
+			{
+				Name:  "scope",
+				Usage: "Manage direct scope grants and who approves scope requests",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "grant",
+						Usage:     "Give an employee (uid or email) a scope directly",
+						UsageText: "scope grant [--for 8h] [--starts-in 1h] [--by admin] [--reason text] <employee> <scope>",
+						Flags: []cli.Flag{
+							&cli.DurationFlag{Name: "for", Usage: "Grant lifetime, permanent when omitted"},
+							&cli.DurationFlag{Name: "starts-in", Usage: "Delay before the grant takes effect"},
+							&cli.StringFlag{Name: "by", Usage: "Granting admin (uid or email)"},
+							&cli.StringFlag{Name: "reason"},
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 2 {
+								return cli.Exit("Employee and scope are required", 1)
+							}
+							return commands.GrantScope(cfg, c.Args().Get(0), c.Args().Get(1),
+								c.String("by"), c.String("reason"), c.Duration("starts-in"), c.Duration("for"))
+						},
+					},
+					{
+						Name:      "revoke",
+						Usage:     "Remove a direct scope grant",
+						UsageText: "scope revoke <employee> <scope>",
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 2 {
+								return cli.Exit("Employee and scope are required", 1)
+							}
+							return commands.RevokeScope(cfg, c.Args().Get(0), c.Args().Get(1))
+						},
+					},
+					{
+						Name:      "policy",
+						Usage:     "Set the role approving requests for a scope and the longest grant",
+						UsageText: "scope policy [--owner role] [--max-hours n] <scope>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{Name: "owner", Usage: "Owning role, empty to disable requests"},
+							&cli.IntFlag{Name: "max-hours", Usage: "Longest grant a request may ask for, 0 for no limit"},
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								return cli.Exit("Scope is required", 1)
+							}
+							return commands.SetScopePolicy(cfg, c.Args().First(), c.String("owner"), c.Int("max-hours"))
+						},
+					},
+					{
+						Name:      "mfa",
+						Usage:     "Set whether holders of a scope must use a second factor at LDAP login",
+						UsageText: "scope mfa <scope> required|optional|default",
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 2 {
+								return cli.Exit("Scope and setting are required", 1)
+							}
+							return commands.SetScopeMFA(cfg, c.Args().Get(0), c.Args().Get(1))
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "List scopes with their owning role",
+						Action: func(c *cli.Context) error {
+							return commands.ListScopes(cfg)
+						},
+					},
+					{
+						Name:      "grants",
+						Usage:     "List the direct grants of an employee",
+						UsageText: "scope grants <employee>",
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								return cli.Exit("Employee is required", 1)
+							}
+							return commands.ListScopeGrants(cfg, c.Args().First())
+						},
+					},
+				},
+			},
+			{
+				Name:  "mfa",
+				Usage: "Manage second factors of LDAP logins",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "reset",
+						Usage:     "Remove the authenticator, recovery codes and passkeys of an employee",
+						UsageText: "mfa reset <employee>",
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								return cli.Exit("Employee is required", 1)
+							}
+							return commands.ResetMFA(cfg, c.Args().First())
+						},
+					},
+				},
+			},
+			{
+				Name:  "employee",
+				Usage: "Manage how employees may log in",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "email-login",
+						Usage:     "Set whether an employee may log in with a mailed code or magic link",
+						UsageText: "employee email-login <employee> on|off",
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 2 {
+								return cli.Exit("Employee and setting are required", 1)
+							}
+							return commands.SetEmailLogin(cfg, c.Args().Get(0), c.Args().Get(1))
+						},
+					},
+				},
+			},
+			{
+				Name:  "break-glass",
+				Usage: "Emergency elevation audit",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "history",
+						Usage: "Show the latest break-glass elevations",
+						Flags: []cli.Flag{
+							&cli.IntFlag{Name: "limit", Value: 50},
+						},
+						Action: func(c *cli.Context) error {
+							return commands.BreakGlassHistory(cfg, c.Int("limit"))
+						},
+					},
+				},
+			},
+			{
+				Name:  "policy",
+				Usage: "Manage authorization policies evaluated by /authz/check",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "apply",
+						Usage:     "Store the policies of a YAML file in the database",
+						UsageText: "policy apply <file>",
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								return cli.Exit("Policy file is required", 1)
+							}
+							return commands.ApplyPolicies(cfg, c.Args().First())
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "List policies from POLICY_DIR and the database",
+						Action: func(c *cli.Context) error {
+							return commands.ListPolicies(cfg)
+						},
+					},
+					{
+						Name:      "delete",
+						Usage:     "Delete a policy from the database",
+						UsageText: "policy delete <name>",
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								return cli.Exit("Policy name is required", 1)
+							}
+							return commands.DeletePolicy(cfg, c.Args().First())
+						},
+					},
+				},
+			},
 			{
 				Name:  "seed",
 				Usage: "Database seeding operations",
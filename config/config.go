@@ -2,18 +2,23 @@ package config
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
+	// Env is EnvDevelopment or EnvProduction. Development relaxes checks
+	// meant for deployments, like the session key requirements.
+	Env        string
 	Host       string
 	Port       string
 	SAMLConfig SAMLConfig
 	LDAPConfig LDAPConfig
 	DBConfig   DBConfig
 	AuthConfig AuthConfig
+	MailConfig MailConfig
 }
 
 type SAMLConfig struct {
@@ -31,6 +36,33 @@ type LDAPConfig struct {
 	BindDN   string
 	BindPass string
 	UseSSL   bool
+	// ServerType selects directory specific behaviour: "openldap" (default) or "ad"
+	ServerType string
+	// UserFilter selects the entries synced into the employees table
+	UserFilter       string
+	SyncPageSize     int
+	SyncIntervalMins int
+	// IncrementalSync follows directory changes (syncrepl or modifyTimestamp polling)
+	IncrementalSync bool
+	SyncPollSeconds int
+	// DirectoryCacheSeconds is how long /api/directory lookups are cached
+	DirectoryCacheSeconds int
+	// ProxyBaseDN is the naming context of the virtual tree served by "ldap proxy"
+	ProxyBaseDN string
+	// ProxyBindDN/ProxyBindPass is the service account appliances search with
+	ProxyBindDN   string
+	ProxyBindPass string
+	// ProxyCacheSeconds is how long the proxy reuses its virtual tree
+	ProxyCacheSeconds int
+	// TimeoutSeconds bounds every request on the shared connection
+	TimeoutSeconds int
+	// BreakerThreshold consecutive directory failures open the circuit
+	// breaker for BreakerCooldownSecs; 0 disables it
+	BreakerThreshold    int
+	BreakerCooldownSecs int
+	// UserCacheSeconds is how long uid to DN and policy attribute lookups are
+	// cached; 0 disables it
+	UserCacheSeconds int
 }
 
 type DBConfig struct {
@@ -42,18 +74,182 @@ type DBConfig struct {
 }
 
 type AuthConfig struct {
-	JWTSecret      string
-	JWTExpiryHours int
+	JWTSecret            string
+	JWTExpiryHours       int
+	PasswordResetTTLMins int
+	// At most PasswordResetMaxPerHour reset links are mailed for an account,
+	// and PasswordResetMaxPerIPHour requested from an address, per hour
+	PasswordResetMaxPerHour   int
+	PasswordResetMaxPerIPHour int
+	// Password changes with the old password are limited the same way, to
+	// PasswordChangeMaxPerHour attempts per account and
+	// PasswordChangeMaxPerIPHour per address
+	PasswordChangeMaxPerHour   int
+	PasswordChangeMaxPerIPHour int
+	// BreakGlassRole is the emergency role holders of BreakGlassScope may
+	// elevate to for BreakGlassMinutes
+	BreakGlassRole     string
+	BreakGlassScope    string
+	BreakGlassMinutes  int
+	SecurityWebhookURL string
+	// Policies for /authz/check come from PolicyDir and the policies table
+	PolicyDir           string
+	PolicyReloadSeconds int
+	// PolicyLDAPAttributes are fetched from LDAP into principal.attributes
+	PolicyLDAPAttributes []string
+	// RelationSchemaFile describes the relations of /api/relations
+	RelationSchemaFile string
+	// Login sessions end after SessionIdleMinutes without requests or
+	// SessionAbsoluteHours after login; expired rows are removed every
+	// SessionCleanupMinutes
+	SessionIdleMinutes    int
+	SessionAbsoluteHours  int
+	SessionCleanupMinutes int
+	// SessionLimit caps the active sessions of an employee (0 = no limit).
+	// A login over the limit is refused, or with SessionLimitMode
+	// "evict-oldest" the oldest sessions are revoked instead.
+	// SessionLimitOverrides gives holders of a scope a stricter limit.
+	SessionLimit          int
+	SessionLimitMode      string
+	SessionLimitOverrides map[string]int
+	// Session cookies are signed with SessionHashKey and encrypted with
+	// SessionEncryptionKey. After a rotation the previous keys, in the same
+	// order, keep decoding cookies issued before it.
+	SessionHashKey                string
+	SessionEncryptionKey          string
+	SessionPreviousHashKeys       []string
+	SessionPreviousEncryptionKeys []string
+	// TOTP secrets are encrypted with MFAEncryptionKey and shown under
+	// MFAIssuer in authenticator apps. The second login step must be done
+	// within MFAChallengeMinutes and MFAMaxAttempts tries.
+	MFAEncryptionKey    string
+	MFAIssuer           string
+	MFAChallengeMinutes int
+	MFAMaxAttempts      int
+	MFARecoveryCodes    int
+	// Passkeys are bound to WebAuthnRPID, the site domain, and only accepted
+	// from WebAuthnOrigins. A ceremony must finish within
+	// WebAuthnCeremonyMinutes; at most WebAuthnLoginMaxPerIP passwordless
+	// logins may be pending from one address.
+	WebAuthnRPID            string
+	WebAuthnRPName          string
+	WebAuthnOrigins         []string
+	WebAuthnCeremonyMinutes int
+	WebAuthnLoginMaxPerIP   int
+	// Sensitive routes ask to authenticate again when the last login is
+	// older than StepUpMaxAgeMinutes
+	StepUpMaxAgeMinutes int
+	// Employees allowed to log in by email get a code and magic link valid
+	// for EmailLoginCodeMinutes and EmailLoginMaxAttempts tries. At most
+	// EmailLoginMaxPerHour codes are mailed to an employee, and
+	// EmailLoginMaxPerIPHour requested from an address, per hour.
+	EmailLoginCodeMinutes  int
+	EmailLoginMaxAttempts  int
+	EmailLoginMaxPerHour   int
+	EmailLoginMaxPerIPHour int
 }
 
+type MailConfig struct {
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+	// Sink is where mails go: MailSinkSMTP, MailSinkLog, or MailSinkFile
+	// writing them to SinkDir. Empty picks SMTP when SMTPHost is set.
+	Sink    string
+	SinkDir string
+}
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// Mail sinks
+const (
+	MailSinkSMTP = "smtp"
+	MailSinkLog  = "log"
+	MailSinkFile = "file"
+)
+
+// Session limit modes
+const (
+	SessionLimitReject      = "reject"
+	SessionLimitEvictOldest = "evict-oldest"
+)
+
 func Load() (*Config, error) {
 	viper.SetConfigFile(".env")
 	viper.AutomaticEnv()
+	viper.SetDefault("APP_ENV", EnvProduction)
+	viper.SetDefault("LDAP_SERVER_TYPE", "openldap")
+	viper.SetDefault("LDAP_USER_FILTER", "(objectClass=inetOrgPerson)")
+	viper.SetDefault("LDAP_SYNC_PAGE_SIZE", 500)
+	viper.SetDefault("LDAP_SYNC_POLL_SECONDS", 10)
+	viper.SetDefault("LDAP_DIRECTORY_CACHE_SECONDS", 60)
+	viper.SetDefault("LDAP_PROXY_BASEDN", "dc=sso,dc=local")
+	viper.SetDefault("LDAP_PROXY_CACHE_SECONDS", 5)
+	viper.SetDefault("LDAP_TIMEOUT_SECONDS", 10)
+	viper.SetDefault("LDAP_BREAKER_THRESHOLD", 5)
+	viper.SetDefault("LDAP_BREAKER_COOLDOWN_SECONDS", 30)
+	viper.SetDefault("LDAP_USER_CACHE_SECONDS", 60)
+	viper.SetDefault("PASSWORD_RESET_TTL_MINUTES", 30)
+	viper.SetDefault("PASSWORD_RESET_MAX_PER_HOUR", 3)
+	viper.SetDefault("PASSWORD_RESET_MAX_PER_IP_HOUR", 20)
+	viper.SetDefault("PASSWORD_CHANGE_MAX_PER_HOUR", 5)
+	viper.SetDefault("PASSWORD_CHANGE_MAX_PER_IP_HOUR", 20)
+	viper.SetDefault("BREAK_GLASS_ROLE", "break-glass")
+	viper.SetDefault("BREAK_GLASS_SCOPE", "breakglass:elevate")
+	viper.SetDefault("BREAK_GLASS_MINUTES", 30)
+	viper.SetDefault("POLICY_DIR", "policies")
+	viper.SetDefault("POLICY_RELOAD_SECONDS", 30)
+	viper.SetDefault("POLICY_LDAP_ATTRIBUTES", "ou,l,st,departmentNumber,title,employeeType")
+	viper.SetDefault("RELATION_SCHEMA", "schema/relations.yaml")
+	viper.SetDefault("SESSION_IDLE_MINUTES", 30)
+	viper.SetDefault("SESSION_ABSOLUTE_HOURS", 12)
+	viper.SetDefault("SESSION_CLEANUP_MINUTES", 15)
+	viper.SetDefault("SESSION_LIMIT", 0)
+	viper.SetDefault("SESSION_LIMIT_MODE", SessionLimitReject)
+	viper.SetDefault("MFA_ISSUER", "go-ldap-sso")
+	viper.SetDefault("MFA_CHALLENGE_MINUTES", 5)
+	viper.SetDefault("MFA_MAX_ATTEMPTS", 5)
+	viper.SetDefault("MFA_RECOVERY_CODES", 10)
+	viper.SetDefault("WEBAUTHN_RP_ID", "localhost")
+	viper.SetDefault("WEBAUTHN_RP_NAME", "go-ldap-sso")
+	viper.SetDefault("WEBAUTHN_ORIGINS", "http://localhost:8080")
+	viper.SetDefault("WEBAUTHN_CEREMONY_MINUTES", 5)
+	viper.SetDefault("WEBAUTHN_LOGIN_MAX_PER_IP", 20)
+	viper.SetDefault("STEP_UP_MAX_AGE_MINUTES", 10)
+	viper.SetDefault("EMAIL_LOGIN_CODE_MINUTES", 10)
+	viper.SetDefault("EMAIL_LOGIN_MAX_ATTEMPTS", 5)
+	viper.SetDefault("EMAIL_LOGIN_MAX_PER_HOUR", 5)
+	viper.SetDefault("EMAIL_LOGIN_MAX_PER_IP_HOUR", 20)
+	viper.SetDefault("SMTP_PORT", 587)
+	viper.SetDefault("MAIL_SINK_DIR", "tmp/mail")
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, err
 	}
 
+	sessionLimitMode := viper.GetString("SESSION_LIMIT_MODE")
+	if sessionLimitMode != SessionLimitReject && sessionLimitMode != SessionLimitEvictOldest {
+		return nil, fmt.Errorf("SESSION_LIMIT_MODE must be %q or %q, got %q",
+			SessionLimitReject, SessionLimitEvictOldest, sessionLimitMode)
+	}
+	mailSink := viper.GetString("MAIL_SINK")
+	switch mailSink {
+	case "", MailSinkSMTP, MailSinkLog, MailSinkFile:
+	default:
+		return nil, fmt.Errorf("MAIL_SINK must be %q, %q or %q, got %q",
+			MailSinkSMTP, MailSinkLog, MailSinkFile, mailSink)
+	}
+	sessionLimitOverrides, err := parseLimits(viper.GetString("SESSION_LIMIT_OVERRIDES"))
+	if err != nil {
+		return nil, fmt.Errorf("SESSION_LIMIT_OVERRIDES: %w", err)
+	}
+
 	return &Config{
+		Env:  viper.GetString("APP_ENV"),
 		Host: viper.GetString("HOST"),
 		Port: viper.GetString("PORT"),
 		SAMLConfig: SAMLConfig{
@@ -64,12 +260,27 @@ func Load() (*Config, error) {
 			ACSUrl:      viper.GetString("SAML_ACS_URL"),
 		},
 		LDAPConfig: LDAPConfig{
-			Host:     viper.GetString("LDAP_HOST"),
-			Port:     viper.GetInt("LDAP_PORT"),
-			BaseDN:   viper.GetString("LDAP_BASEDN"),
-			BindDN:   viper.GetString("LDAP_BIND_DN"),
-			BindPass: viper.GetString("LDAP_BIND_PASS"),
-			UseSSL:   viper.GetBool("LDAP_USE_SSL"),
+			Host:                  viper.GetString("LDAP_HOST"),
+			Port:                  viper.GetInt("LDAP_PORT"),
+			BaseDN:                viper.GetString("LDAP_BASEDN"),
+			BindDN:                viper.GetString("LDAP_BIND_DN"),
+			BindPass:              viper.GetString("LDAP_BIND_PASS"),
+			UseSSL:                viper.GetBool("LDAP_USE_SSL"),
+			ServerType:            viper.GetString("LDAP_SERVER_TYPE"),
+			UserFilter:            viper.GetString("LDAP_USER_FILTER"),
+			SyncPageSize:          viper.GetInt("LDAP_SYNC_PAGE_SIZE"),
+			SyncIntervalMins:      viper.GetInt("LDAP_SYNC_INTERVAL_MINUTES"),
+			IncrementalSync:       viper.GetBool("LDAP_INCREMENTAL_SYNC"),
+			SyncPollSeconds:       viper.GetInt("LDAP_SYNC_POLL_SECONDS"),
+			DirectoryCacheSeconds: viper.GetInt("LDAP_DIRECTORY_CACHE_SECONDS"),
+			ProxyBaseDN:           viper.GetString("LDAP_PROXY_BASEDN"),
+			ProxyBindDN:           viper.GetString("LDAP_PROXY_BIND_DN"),
+			ProxyBindPass:         viper.GetString("LDAP_PROXY_BIND_PASS"),
+			ProxyCacheSeconds:     viper.GetInt("LDAP_PROXY_CACHE_SECONDS"),
+			TimeoutSeconds:        viper.GetInt("LDAP_TIMEOUT_SECONDS"),
+			BreakerThreshold:      viper.GetInt("LDAP_BREAKER_THRESHOLD"),
+			BreakerCooldownSecs:   viper.GetInt("LDAP_BREAKER_COOLDOWN_SECONDS"),
+			UserCacheSeconds:      viper.GetInt("LDAP_USER_CACHE_SECONDS"),
 		},
 		DBConfig: DBConfig{
 			DBHost:     viper.GetString("DB_HOST"),
@@ -79,12 +290,89 @@ func Load() (*Config, error) {
 			DBName:     viper.GetString("DB_NAME"),
 		},
 		AuthConfig: AuthConfig{
-			JWTSecret:      viper.GetString("JWT_SECRET"),
-			JWTExpiryHours: viper.GetInt("JWT_EXPIRY_HOURS"),
+			JWTSecret:                     viper.GetString("JWT_SECRET"),
+			JWTExpiryHours:                viper.GetInt("JWT_EXPIRY_HOURS"),
+			PasswordResetTTLMins:          viper.GetInt("PASSWORD_RESET_TTL_MINUTES"),
+			PasswordResetMaxPerHour:       viper.GetInt("PASSWORD_RESET_MAX_PER_HOUR"),
+			PasswordResetMaxPerIPHour:     viper.GetInt("PASSWORD_RESET_MAX_PER_IP_HOUR"),
+			PasswordChangeMaxPerHour:      viper.GetInt("PASSWORD_CHANGE_MAX_PER_HOUR"),
+			PasswordChangeMaxPerIPHour:    viper.GetInt("PASSWORD_CHANGE_MAX_PER_IP_HOUR"),
+			BreakGlassRole:                viper.GetString("BREAK_GLASS_ROLE"),
+			BreakGlassScope:               viper.GetString("BREAK_GLASS_SCOPE"),
+			BreakGlassMinutes:             viper.GetInt("BREAK_GLASS_MINUTES"),
+			SecurityWebhookURL:            viper.GetString("SECURITY_WEBHOOK_URL"),
+			PolicyDir:                     viper.GetString("POLICY_DIR"),
+			PolicyReloadSeconds:           viper.GetInt("POLICY_RELOAD_SECONDS"),
+			PolicyLDAPAttributes:          splitList(viper.GetString("POLICY_LDAP_ATTRIBUTES")),
+			RelationSchemaFile:            viper.GetString("RELATION_SCHEMA"),
+			SessionIdleMinutes:            viper.GetInt("SESSION_IDLE_MINUTES"),
+			SessionAbsoluteHours:          viper.GetInt("SESSION_ABSOLUTE_HOURS"),
+			SessionCleanupMinutes:         viper.GetInt("SESSION_CLEANUP_MINUTES"),
+			SessionLimit:                  viper.GetInt("SESSION_LIMIT"),
+			SessionLimitMode:              sessionLimitMode,
+			SessionLimitOverrides:         sessionLimitOverrides,
+			SessionHashKey:                viper.GetString("SESSION_HASH_KEY"),
+			SessionEncryptionKey:          viper.GetString("SESSION_ENCRYPTION_KEY"),
+			SessionPreviousHashKeys:       splitList(viper.GetString("SESSION_PREVIOUS_HASH_KEYS")),
+			SessionPreviousEncryptionKeys: splitList(viper.GetString("SESSION_PREVIOUS_ENCRYPTION_KEYS")),
+			MFAEncryptionKey:              viper.GetString("MFA_ENCRYPTION_KEY"),
+			MFAIssuer:                     viper.GetString("MFA_ISSUER"),
+			MFAChallengeMinutes:           viper.GetInt("MFA_CHALLENGE_MINUTES"),
+			MFAMaxAttempts:                viper.GetInt("MFA_MAX_ATTEMPTS"),
+			MFARecoveryCodes:              viper.GetInt("MFA_RECOVERY_CODES"),
+			WebAuthnRPID:                  viper.GetString("WEBAUTHN_RP_ID"),
+			WebAuthnRPName:                viper.GetString("WEBAUTHN_RP_NAME"),
+			WebAuthnOrigins:               splitList(viper.GetString("WEBAUTHN_ORIGINS")),
+			WebAuthnCeremonyMinutes:       viper.GetInt("WEBAUTHN_CEREMONY_MINUTES"),
+			WebAuthnLoginMaxPerIP:         viper.GetInt("WEBAUTHN_LOGIN_MAX_PER_IP"),
+			StepUpMaxAgeMinutes:           viper.GetInt("STEP_UP_MAX_AGE_MINUTES"),
+			EmailLoginCodeMinutes:         viper.GetInt("EMAIL_LOGIN_CODE_MINUTES"),
+			EmailLoginMaxAttempts:         viper.GetInt("EMAIL_LOGIN_MAX_ATTEMPTS"),
+			EmailLoginMaxPerHour:          viper.GetInt("EMAIL_LOGIN_MAX_PER_HOUR"),
+			EmailLoginMaxPerIPHour:        viper.GetInt("EMAIL_LOGIN_MAX_PER_IP_HOUR"),
+		},
+		MailConfig: MailConfig{
+			SMTPHost:     viper.GetString("SMTP_HOST"),
+			SMTPPort:     viper.GetInt("SMTP_PORT"),
+			SMTPUsername: viper.GetString("SMTP_USERNAME"),
+			SMTPPassword: viper.GetString("SMTP_PASSWORD"),
+			From:         viper.GetString("SMTP_FROM"),
+			Sink:         mailSink,
+			SinkDir:      viper.GetString("MAIL_SINK_DIR"),
 		},
 	}, nil
 }
 
+// IsDevelopment reports whether the app runs in development mode.
+func (c *Config) IsDevelopment() bool {
+	return c.Env == EnvDevelopment
+}
+
+// parseLimits parses "scope=N" items of a comma separated setting.
+func parseLimits(s string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, item := range splitList(s) {
+		scope, n, ok := strings.Cut(item, "=")
+		limit, err := strconv.Atoi(strings.TrimSpace(n))
+		if !ok || err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid limit %q, want scope=N with N >= 1", item)
+		}
+		limits[strings.TrimSpace(scope)] = limit
+	}
+	return limits, nil
+}
+
+// splitList splits a comma separated setting, dropping empty items.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func (c *Config) GetDBUrl() string {
 	url := fmt.Sprintf("postgres://%s:%s@%s:%d/%s",
 		c.DBConfig.DBUser,
@@ -0,0 +1,29 @@
+package authsessions
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for sessions that don't exist or have timed out.
+	ErrNotFound = errors.New("session not found")
+	// ErrRevoked is returned for sessions ended by their owner or an admin.
+	ErrRevoked = errors.New("session revoked")
+	// ErrLimitReached is returned for a login over the session limit.
+	ErrLimitReached = errors.New("too many active sessions")
+)
+
+// Session is one login, kept server-side so it can be listed and ended.
+type Session struct {
+	ID         string     `db:"id"`
+	EmployeeID *int       `db:"employee_id"`
+	Method     string     `db:"method"`
+	IPAddress  string     `db:"ip_address"`
+	UserAgent  string     `db:"user_agent"`
+	Data       []byte     `db:"data"`
+	CreatedAt  time.Time  `db:"created_at"`
+	LastSeenAt time.Time  `db:"last_seen_at"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+}
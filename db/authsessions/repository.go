@@ -0,0 +1,226 @@
+package authsessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+// Create stores s, ending at the latest lifetime from now, and fills in its
+// timestamps.
+func (r *Repository) Create(ctx context.Context, s *Session, lifetime time.Duration) error {
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO auth_sessions (id, employee_id, method, ip_address, user_agent, data, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, now() + $7::float8 * interval '1 second')
+		RETURNING created_at, last_seen_at, expires_at`,
+		s.ID, s.EmployeeID, s.Method, s.IPAddress, s.UserAgent, s.Data, lifetime.Seconds(),
+	).Scan(&s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// Touch returns session id and marks it seen now, unless it has been idle for
+// longer than idle or is past its absolute expiry (ErrNotFound) or has been
+// revoked (ErrRevoked).
+func (r *Repository) Touch(ctx context.Context, id string, idle time.Duration) (*Session, error) {
+	var s Session
+	err := r.pool.QueryRow(ctx, `
+		UPDATE auth_sessions SET last_seen_at = now()
+		WHERE id = $1 AND revoked_at IS NULL
+		  AND expires_at > now() AND last_seen_at > now() - $2::float8 * interval '1 second'
+		RETURNING id, employee_id, method, COALESCE(ip_address, ''), COALESCE(user_agent, ''),
+			data, created_at, last_seen_at, expires_at`,
+		id, idle.Seconds(),
+	).Scan(&s.ID, &s.EmployeeID, &s.Method, &s.IPAddress, &s.UserAgent,
+		&s.Data, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, r.missing(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to touch session: %w", err)
+	}
+	return &s, nil
+}
+
+// missing tells apart why session id can't be used.
+func (r *Repository) missing(ctx context.Context, id string) error {
+	var revoked bool
+	err := r.pool.QueryRow(ctx,
+		"SELECT revoked_at IS NOT NULL FROM auth_sessions WHERE id = $1", id,
+	).Scan(&revoked)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to query session: %w", err)
+	}
+	if revoked {
+		return ErrRevoked
+	}
+	return ErrNotFound
+}
+
+// Update replaces the stored values of session id.
+func (r *Repository) Update(ctx context.Context, id string, employeeID *int, method string, data []byte) error {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE auth_sessions SET employee_id = $2, method = $3, data = $4
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > now()`,
+		id, employeeID, method, data,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return r.missing(ctx, id)
+	}
+	return nil
+}
+
+// ListActive returns the sessions of an employee that are still usable,
+// newest first.
+func (r *Repository) ListActive(ctx context.Context, employeeID int, idle time.Duration) ([]Session, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, employee_id, method, COALESCE(ip_address, ''), COALESCE(user_agent, ''),
+			created_at, last_seen_at, expires_at
+		FROM auth_sessions
+		WHERE employee_id = $1 AND revoked_at IS NULL
+		  AND expires_at > now() AND last_seen_at > now() - $2::float8 * interval '1 second'
+		ORDER BY last_seen_at DESC, created_at DESC`,
+		employeeID, idle.Seconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Session
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.EmployeeID, &s.Method, &s.IPAddress, &s.UserAgent,
+			&s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// Revoke ends session id of employeeID, recording revokedBy (0 for none).
+func (r *Repository) Revoke(ctx context.Context, employeeID int, id string, revokedBy int) error {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE auth_sessions SET revoked_at = now(), revoked_by = NULLIF($3, 0)
+		WHERE id = $1 AND employee_id = $2 AND revoked_at IS NULL AND expires_at > now()`,
+		id, employeeID, revokedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeAll ends every session of an employee (uid or email), returning how
+// many were ended.
+func (r *Repository) RevokeAll(ctx context.Context, employee string, revokedBy int) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE auth_sessions SET revoked_at = now(), revoked_by = NULLIF($2, 0)
+		WHERE employee_id IN (SELECT id FROM employees WHERE uid = $1 OR email = $1)
+		  AND revoked_at IS NULL AND expires_at > now()`,
+		employee, revokedBy,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// EnforceLimit keeps employeeID at no more than limit active sessions after
+// session newID was created. With evict the oldest other sessions are
+// revoked and their number returned; otherwise newID is deleted and
+// ErrLimitReached returned. Checks for one employee run one at a time, so
+// simultaneous logins can't both slip through.
+func (r *Repository) EnforceLimit(ctx context.Context, employeeID int, newID string, limit int, idle time.Duration, evict bool) (int64, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('auth_sessions'), $1)", employeeID); err != nil {
+		return 0, fmt.Errorf("failed to lock sessions: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id FROM auth_sessions
+		WHERE employee_id = $1 AND id <> $2 AND revoked_at IS NULL
+		  AND expires_at > now() AND last_seen_at > now() - $3::float8 * interval '1 second'
+		ORDER BY created_at DESC, id`,
+		employeeID, newID, idle.Seconds(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	others, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan session: %w", err)
+	}
+	if len(others) < limit {
+		return 0, nil
+	}
+
+	if !evict {
+		if _, err := tx.Exec(ctx, "DELETE FROM auth_sessions WHERE id = $1", newID); err != nil {
+			return 0, fmt.Errorf("failed to delete session: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return 0, err
+		}
+		return 0, ErrLimitReached
+	}
+
+	// Keep the newest limit-1 others next to the new session
+	tag, err := tx.Exec(ctx,
+		"UPDATE auth_sessions SET revoked_at = now() WHERE id = ANY($1)",
+		others[limit-1:],
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Delete ends session id.
+func (r *Repository) Delete(ctx context.Context, id string) error {
+	_, err := r.pool.Exec(ctx, "DELETE FROM auth_sessions WHERE id = $1", id)
+	return err
+}
+
+// DeleteExpired removes sessions past their absolute expiry or idle for
+// longer than idle, returning how many were removed.
+func (r *Repository) DeleteExpired(ctx context.Context, idle time.Duration) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `
+		DELETE FROM auth_sessions
+		WHERE expires_at <= now() OR last_seen_at <= now() - $1::float8 * interval '1 second'`,
+		idle.Seconds(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,153 @@
+package authsessions
+
+import (
+	"context"
+	"errors"
+	"go-ldap-sso/db/dbtest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const idle = 30 * time.Minute
+
+// newTestRepository returns a repository over the test database and the
+// pool behind it.
+func newTestRepository(t *testing.T) (*Repository, *pgxpool.Pool) {
+	t.Helper()
+	database := dbtest.Open(t)
+	return NewRepository(database.Pool), database.Pool
+}
+
+// create stores a session with no employee, lasting lifetime.
+func create(t *testing.T, r *Repository, id string, lifetime time.Duration) {
+	t.Helper()
+	if err := r.Create(context.Background(), &Session{ID: id, Method: "ldap"}, lifetime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(t *testing.T, pool *pgxpool.Pool, id string) bool {
+	t.Helper()
+	var ok bool
+	if err := pool.QueryRow(context.Background(),
+		"SELECT EXISTS (SELECT 1 FROM auth_sessions WHERE id = $1)", id).Scan(&ok); err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func TestDeleteExpired(t *testing.T) {
+	r, pool := newTestRepository(t)
+	ctx := context.Background()
+
+	create(t, r, "active", time.Hour)
+	create(t, r, "expired", time.Hour)
+	create(t, r, "idle", time.Hour)
+	create(t, r, "nearly-idle", time.Hour)
+	_, err := pool.Exec(ctx, `
+		UPDATE auth_sessions SET expires_at = now() - interval '1 second' WHERE id = 'expired';
+		UPDATE auth_sessions SET last_seen_at = now() - interval '31 minutes' WHERE id = 'idle';
+		UPDATE auth_sessions SET last_seen_at = now() - interval '29 minutes' WHERE id = 'nearly-idle'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := r.DeleteExpired(ctx, idle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("DeleteExpired() = %d, want 2", n)
+	}
+	for id, want := range map[string]bool{"active": true, "expired": false, "idle": false, "nearly-idle": true} {
+		if got := exists(t, pool, id); got != want {
+			t.Errorf("%s kept = %t, want %t", id, got, want)
+		}
+	}
+}
+
+// createFor stores a session of employeeID, created age ago.
+func createFor(t *testing.T, r *Repository, pool *pgxpool.Pool, employeeID int, id string, age time.Duration) {
+	t.Helper()
+	if err := r.Create(context.Background(), &Session{ID: id, EmployeeID: &employeeID, Method: "ldap"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(context.Background(),
+		"UPDATE auth_sessions SET created_at = now() - $2::float8 * interval '1 second' WHERE id = $1",
+		id, age.Seconds()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createEmployee(t *testing.T, pool *pgxpool.Pool, uid string) int {
+	t.Helper()
+	var id int
+	if err := pool.QueryRow(context.Background(),
+		"INSERT INTO employees (uid, name, email) VALUES ($1, $1, $1 || '@example.org') RETURNING id", uid,
+	).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestEnforceLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		evict   bool
+		err     error
+		evicted int64
+		kept    map[string]bool
+	}{
+		{"under the limit", 4, false, nil, 0,
+			map[string]bool{"new": true, "old": true, "older": true, "oldest": true}},
+		{"reject", 3, false, ErrLimitReached, 0,
+			map[string]bool{"new": false, "old": true, "older": true, "oldest": true}},
+		{"evict oldest", 2, true, nil, 2,
+			map[string]bool{"new": true, "old": true, "older": false, "oldest": false}},
+		{"evict all others", 1, true, nil, 3,
+			map[string]bool{"new": true, "old": false, "older": false, "oldest": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, pool := newTestRepository(t)
+			ctx := context.Background()
+			alice := createEmployee(t, pool, "alice")
+			bob := createEmployee(t, pool, "bob")
+
+			createFor(t, r, pool, alice, "oldest", 3*time.Minute)
+			createFor(t, r, pool, alice, "older", 2*time.Minute)
+			createFor(t, r, pool, alice, "old", time.Minute)
+			createFor(t, r, pool, alice, "new", 0)
+			// Neither idle sessions nor other employees' count
+			createFor(t, r, pool, alice, "idle", 4*time.Minute)
+			createFor(t, r, pool, bob, "bob", 0)
+			if _, err := pool.Exec(ctx, "UPDATE auth_sessions SET last_seen_at = now() - interval '1 hour' WHERE id = 'idle'"); err != nil {
+				t.Fatal(err)
+			}
+
+			evicted, err := r.EnforceLimit(ctx, alice, "new", tt.limit, idle, tt.evict)
+			if !errors.Is(err, tt.err) || evicted != tt.evicted {
+				t.Fatalf("EnforceLimit() = %d, %v, want %d, %v", evicted, err, tt.evicted, tt.err)
+			}
+			active := map[string]bool{}
+			list, err := r.ListActive(ctx, alice, idle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range list {
+				active[s.ID] = true
+			}
+			for id, want := range tt.kept {
+				if active[id] != want {
+					t.Errorf("%s active = %t, want %t", id, active[id], want)
+				}
+			}
+			if list, _ := r.ListActive(ctx, bob, idle); len(list) != 1 {
+				t.Errorf("bob has %d active sessions, want 1", len(list))
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package breakglass
+
+import "time"
+
+// Elevation records one break-glass self-elevation.
+type Elevation struct {
+	ID            int        `db:"id"`
+	EmployeeID    int        `db:"employee_id"`
+	Employee      string     `db:"employee"`
+	RoleName      string     `db:"role_name"`
+	Justification string     `db:"justification"`
+	Scopes        []string   `db:"scopes"`
+	SessionID     string     `db:"session_id"`
+	IPAddress     string     `db:"ip_address"`
+	UserAgent     string     `db:"user_agent"`
+	CreatedAt     time.Time  `db:"created_at"`
+	ExpiresAt     time.Time  `db:"expires_at"`
+	NotifiedAt    *time.Time `db:"notified_at"`
+	// Email is the employee's, for notifications; List leaves it empty
+	Email string `db:"email"`
+}
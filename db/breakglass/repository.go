@@ -0,0 +1,94 @@
+package breakglass
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+// Record stores e, lasting ttl from now, and fills in its id and timestamps.
+func (r *Repository) Record(ctx context.Context, e *Elevation, ttl time.Duration) error {
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO break_glass_elevations
+			(employee_id, role_name, justification, scopes, session_id, ip_address, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), now() + $8::float8 * interval '1 second')
+		RETURNING id, created_at, expires_at`,
+		e.EmployeeID, e.RoleName, e.Justification, e.Scopes, e.SessionID, e.IPAddress, e.UserAgent, ttl.Seconds(),
+	).Scan(&e.ID, &e.CreatedAt, &e.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record elevation: %w", err)
+	}
+	return nil
+}
+
+// MarkNotified records that security has been told about elevation id.
+func (r *Repository) MarkNotified(ctx context.Context, id int) error {
+	_, err := r.pool.Exec(ctx, "UPDATE break_glass_elevations SET notified_at = now() WHERE id = $1", id)
+	return err
+}
+
+// ListUnnotified returns up to limit elevations created more than olderThan
+// ago that security has not been told about yet, oldest first.
+func (r *Repository) ListUnnotified(ctx context.Context, olderThan time.Duration, limit int) ([]Elevation, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT b.id, b.employee_id, e.uid, e.email, b.role_name, b.justification, b.scopes,
+			COALESCE(b.session_id, ''), COALESCE(b.ip_address, ''), COALESCE(b.user_agent, ''),
+			b.created_at, b.expires_at
+		FROM break_glass_elevations b JOIN employees e ON e.id = b.employee_id
+		WHERE b.notified_at IS NULL AND b.created_at < now() - $1::float8 * interval '1 second'
+		ORDER BY b.created_at, b.id LIMIT $2`,
+		olderThan.Seconds(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unnotified elevations: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Elevation
+	for rows.Next() {
+		var e Elevation
+		if err := rows.Scan(&e.ID, &e.EmployeeID, &e.Employee, &e.Email, &e.RoleName, &e.Justification, &e.Scopes,
+			&e.SessionID, &e.IPAddress, &e.UserAgent, &e.CreatedAt, &e.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan elevation: %w", err)
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// List returns the latest elevations, newest first.
+func (r *Repository) List(ctx context.Context, limit int) ([]Elevation, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT b.id, b.employee_id, e.uid, b.role_name, b.justification, b.scopes,
+			COALESCE(b.session_id, ''), COALESCE(b.ip_address, ''), COALESCE(b.user_agent, ''),
+			b.created_at, b.expires_at, b.notified_at
+		FROM break_glass_elevations b JOIN employees e ON e.id = b.employee_id
+		ORDER BY b.created_at DESC, b.id DESC LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query elevations: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Elevation
+	for rows.Next() {
+		var e Elevation
+		if err := rows.Scan(&e.ID, &e.EmployeeID, &e.Employee, &e.RoleName, &e.Justification, &e.Scopes,
+			&e.SessionID, &e.IPAddress, &e.UserAgent, &e.CreatedAt, &e.ExpiresAt, &e.NotifiedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan elevation: %w", err)
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,72 @@
+// Package dbtest gives tests a migrated and empty database.
+package dbtest
+
+import (
+	"context"
+	"go-ldap-sso/db"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/lib/pq"
+)
+
+// lockKey is the advisory lock serializing tests of all packages, which go
+// test runs in parallel against the same database.
+const lockKey = 4242
+
+// Open connects to the database of TEST_DATABASE_URL, migrated and emptied,
+// and skips the test when it isn't set. The database is wiped, so never
+// point it at one holding real data. It stays locked for the test until it
+// ends.
+func Open(t testing.TB) *db.Database {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+
+	lock, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lock.Close(ctx) })
+	if _, err := lock.Exec(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		t.Fatalf("failed to lock database: %v", err)
+	}
+
+	_, file, _, _ := runtime.Caller(0)
+	migrations := filepath.Join(filepath.Dir(file), "..", "migrations")
+	m, err := migrate.New("file://"+migrations, url)
+	if err != nil {
+		t.Fatalf("failed to initialize migrator: %v", err)
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	m.Close()
+
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	_, err = pool.Exec(ctx, `
+		DO $$ DECLARE tables TEXT; BEGIN
+			SELECT string_agg(quote_ident(tablename), ', ') INTO tables
+			FROM pg_tables WHERE schemaname = 'public' AND tablename <> 'schema_migrations';
+			EXECUTE 'TRUNCATE ' || tables || ' RESTART IDENTITY CASCADE';
+		END $$`)
+	if err != nil {
+		t.Fatalf("failed to empty database: %v", err)
+	}
+	return &db.Database{Pool: pool}
+}
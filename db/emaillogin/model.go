@@ -0,0 +1,30 @@
+package emaillogin
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidCode is returned for wrong, expired or used codes and links,
+// and for codes out of attempts.
+var ErrInvalidCode = errors.New("invalid or expired login code")
+
+// Code is a one-time login code mailed to an employee, together with the
+// magic link that redeems it.
+type Code struct {
+	ID         int        `db:"id"`
+	EmployeeID int        `db:"employee_id"`
+	TokenHash  string     `db:"token_hash"`
+	CodeHash   string     `db:"code_hash"`
+	Attempts   int        `db:"attempts"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	UsedAt     *time.Time `db:"used_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+// Requests counts the code requests made recently by an employee and from
+// an address.
+type Requests struct {
+	Employee int
+	IP       int
+}
@@ -0,0 +1,192 @@
+package emaillogin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+// RecordRequest logs a code request for employeeID, nil for an unknown
+// email, from ip and returns how many were made by both within window
+// before it. Requests older than window are pruned.
+func (r *Repository) RecordRequest(ctx context.Context, employeeID *int, ip string, window time.Duration) (Requests, error) {
+	var n Requests
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return n, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	since := time.Now().Add(-window)
+	if _, err := tx.Exec(ctx, "DELETE FROM email_login_requests WHERE created_at < $1", since); err != nil {
+		return n, fmt.Errorf("failed to prune requests: %w", err)
+	}
+	err = tx.QueryRow(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE employee_id = $1),
+			COUNT(*) FILTER (WHERE ip_address = $2)
+		FROM email_login_requests WHERE created_at >= $3`,
+		employeeID, ip, since,
+	).Scan(&n.Employee, &n.IP)
+	if err != nil {
+		return n, fmt.Errorf("failed to count requests: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		"INSERT INTO email_login_requests (employee_id, ip_address) VALUES ($1, $2)",
+		employeeID, ip,
+	); err != nil {
+		return n, fmt.Errorf("failed to record request: %w", err)
+	}
+	return n, tx.Commit(ctx)
+}
+
+// Create stores a new code for the employee and returns the plain code and
+// magic link token to mail out. Earlier unused codes of the employee are
+// invalidated.
+func (r *Repository) Create(ctx context.Context, employeeID int, ttl time.Duration) (code, token string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(raw)
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate code: %w", err)
+	}
+	code = fmt.Sprintf("%06d", n.Int64())
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		"UPDATE email_login_codes SET used_at = now() WHERE employee_id = $1 AND used_at IS NULL",
+		employeeID,
+	); err != nil {
+		return "", "", fmt.Errorf("failed to invalidate old codes: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		"DELETE FROM email_login_codes WHERE expires_at < now() - interval '1 day'",
+	); err != nil {
+		return "", "", fmt.Errorf("failed to drop old codes: %w", err)
+	}
+
+	tokenHash := hashToken(token)
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO email_login_codes (employee_id, token_hash, code_hash, expires_at)
+		VALUES ($1, $2, $3, now() + $4::float8 * interval '1 second')`,
+		employeeID, tokenHash, hashCode(tokenHash, code), ttl.Seconds(),
+	); err != nil {
+		return "", "", fmt.Errorf("failed to store code: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", "", fmt.Errorf("failed to commit code: %w", err)
+	}
+	return code, token, nil
+}
+
+// RedeemCode checks code against the live code of the employee, counting
+// an attempt, and marks it used when it matches. Codes with maxAttempts
+// attempts are no longer accepted.
+func (r *Repository) RedeemCode(ctx context.Context, employeeID int, code string, maxAttempts int) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var c Code
+	err = tx.QueryRow(ctx, `
+		SELECT id, token_hash, code_hash
+		FROM email_login_codes
+		WHERE employee_id = $1
+		  AND used_at IS NULL
+		  AND expires_at > now()
+		  AND attempts < $2
+		ORDER BY created_at DESC
+		LIMIT 1
+		FOR UPDATE`,
+		employeeID, maxAttempts,
+	).Scan(&c.ID, &c.TokenHash, &c.CodeHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidCode
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up code: %w", err)
+	}
+
+	match := subtle.ConstantTimeCompare([]byte(hashCode(c.TokenHash, code)), []byte(c.CodeHash)) == 1
+	if _, err := tx.Exec(ctx, `
+		UPDATE email_login_codes SET attempts = attempts + 1,
+			used_at = CASE WHEN $2 THEN now() END
+		WHERE id = $1`,
+		c.ID, match,
+	); err != nil {
+		return fmt.Errorf("failed to update code: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit code: %w", err)
+	}
+	if !match {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// RedeemLink marks the code of a magic link token used and returns its
+// employee, who must still be active and allowed to log in by email.
+func (r *Repository) RedeemLink(ctx context.Context, token string) (int, error) {
+	var employeeID int
+	err := r.pool.QueryRow(ctx, `
+		UPDATE email_login_codes c SET used_at = now()
+		FROM employees e
+		WHERE c.token_hash = $1
+		  AND c.used_at IS NULL
+		  AND c.expires_at > now()
+		  AND e.id = c.employee_id
+		  AND e.status = 'active'
+		  AND e.email_login_allowed
+		RETURNING c.employee_id`,
+		hashToken(token),
+	).Scan(&employeeID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrInvalidCode
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to redeem link: %w", err)
+	}
+	return employeeID, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashCode salts a code with the token hash of its row, so equal codes of
+// different rows hash differently.
+func hashCode(tokenHash, code string) string {
+	sum := sha256.Sum256([]byte(tokenHash + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,29 @@
+package employees
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("employee not found")
+
+const (
+	StatusActive   = "active"
+	StatusDisabled = "disabled"
+	// StatusRemoved marks employees whose LDAP entry no longer exists
+	StatusRemoved = "removed"
+)
+
+type Employee struct {
+	ID    int    `db:"id"`
+	UID   string `db:"uid"`
+	Name  string `db:"name"`
+	Email string `db:"email"`
+	DN    string `db:"dn"`
+	// EntryUUID is the entryUUID of the LDAP entry, empty until synced
+	EntryUUID string     `db:"entry_uuid"`
+	Status    string     `db:"status"`
+	SyncedAt  *time.Time `db:"synced_at"`
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at"`
+}
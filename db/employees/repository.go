@@ -0,0 +1,170 @@
+package employees
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Execer is satisfied by both *pgxpool.Pool and pgx.Tx.
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+func (r *Repository) List(ctx context.Context) ([]Employee, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, uid, name, email, COALESCE(dn, ''), status, synced_at, created_at, updated_at
+		FROM employees ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query employees: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Employee
+	for rows.Next() {
+		var e Employee
+		if err := rows.Scan(&e.ID, &e.UID, &e.Name, &e.Email, &e.DN, &e.Status, &e.SyncedAt, &e.CreatedAt, &e.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan employee: %w", err)
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+// FindActive returns the active employee with the given uid or email,
+// ErrNotFound otherwise.
+func (r *Repository) FindActive(ctx context.Context, uidOrEmail string) (*Employee, error) {
+	return r.find(ctx, "(uid = $1 OR email = $1) AND status = 'active'", uidOrEmail)
+}
+
+// Find returns the employee with the given uid or email whatever their
+// status, ErrNotFound otherwise.
+func (r *Repository) Find(ctx context.Context, uidOrEmail string) (*Employee, error) {
+	return r.find(ctx, "uid = $1 OR email = $1", uidOrEmail)
+}
+
+// FindActiveByID returns the active employee with the given id, ErrNotFound
+// otherwise.
+func (r *Repository) FindActiveByID(ctx context.Context, id int) (*Employee, error) {
+	return r.find(ctx, "id = $1 AND status = 'active'", id)
+}
+
+// FindEmailLogin returns the active employee with the given email who may
+// log in with a mailed code, ErrNotFound otherwise.
+func (r *Repository) FindEmailLogin(ctx context.Context, email string) (*Employee, error) {
+	return r.find(ctx, "lower(email) = lower($1) AND status = 'active' AND email_login_allowed", email)
+}
+
+// SetEmailLogin sets whether employee id may log in with a mailed code.
+func (r *Repository) SetEmailLogin(ctx context.Context, id int, allowed bool) error {
+	_, err := r.pool.Exec(ctx,
+		"UPDATE employees SET email_login_allowed = $2, updated_at = now() WHERE id = $1",
+		id, allowed,
+	)
+	return err
+}
+
+func (r *Repository) find(ctx context.Context, where string, arg any) (*Employee, error) {
+	var e Employee
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, uid, name, email, COALESCE(dn, ''), status, synced_at, created_at, updated_at
+		FROM employees WHERE `+where,
+		arg,
+	).Scan(&e.ID, &e.UID, &e.Name, &e.Email, &e.DN, &e.Status, &e.SyncedAt, &e.CreatedAt, &e.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query employee: %w", err)
+	}
+	return &e, nil
+}
+
+func (r *Repository) Begin(ctx context.Context) (pgx.Tx, error) {
+	return r.pool.Begin(ctx)
+}
+
+// Upsert inserts or updates the employee identified by uid. An empty
+// EntryUUID keeps the stored one.
+func (r *Repository) Upsert(ctx context.Context, tx Execer, e Employee) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO employees (uid, name, email, dn, entry_uuid, status, synced_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, $6, now(), now(), now())
+		ON CONFLICT (uid) DO UPDATE SET
+			name = EXCLUDED.name,
+			email = EXCLUDED.email,
+			dn = EXCLUDED.dn,
+			entry_uuid = COALESCE(EXCLUDED.entry_uuid, employees.entry_uuid),
+			status = EXCLUDED.status,
+			synced_at = now(),
+			updated_at = now()`,
+		e.UID, e.Name, e.Email, e.DN, e.EntryUUID, e.Status,
+	)
+	return err
+}
+
+// Touch records that the given uids were seen during a sync.
+func (r *Repository) Touch(ctx context.Context, tx Execer, uids []string) error {
+	_, err := tx.Exec(ctx, "UPDATE employees SET synced_at = now() WHERE uid = ANY($1)", uids)
+	return err
+}
+
+func (r *Repository) SetStatus(ctx context.Context, tx Execer, uid, status string) error {
+	_, err := tx.Exec(ctx,
+		"UPDATE employees SET status = $2, synced_at = now(), updated_at = now() WHERE uid = $1",
+		uid, status,
+	)
+	return err
+}
+
+// SetStatusByDN is used when the directory only reports the DN, e.g. syncrepl deletes.
+func (r *Repository) SetStatusByDN(ctx context.Context, tx Execer, dn, status string) (int64, error) {
+	tag, err := tx.Exec(ctx,
+		"UPDATE employees SET status = $2, synced_at = now(), updated_at = now() WHERE dn = $1",
+		dn, status,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// SetStatusByEntryUUIDs is used for syncrepl deletes only reported by entryUUID.
+func (r *Repository) SetStatusByEntryUUIDs(ctx context.Context, tx Execer, uuids []string, status string) (int64, error) {
+	tag, err := tx.Exec(ctx,
+		"UPDATE employees SET status = $2, synced_at = now(), updated_at = now() WHERE entry_uuid = ANY($1::uuid[])",
+		uuids, status,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// RemoveUnseen marks removed every employee whose entry is neither among
+// uuids nor dns, the entries a syncrepl present phase reported.
+func (r *Repository) RemoveUnseen(ctx context.Context, tx Execer, uuids, dns []string) (int64, error) {
+	tag, err := tx.Exec(ctx, `
+		UPDATE employees SET status = 'removed', synced_at = now(), updated_at = now()
+		WHERE status <> 'removed'
+			AND (entry_uuid IS NULL OR NOT entry_uuid = ANY($1::uuid[]))
+			AND (dn IS NULL OR NOT dn = ANY($2))`,
+		uuids, dns,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,12 @@
+package ldifhistory
+
+import "time"
+
+type LDIFHistory struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+	// Checksum is the sha256 of the file when it was applied
+	Checksum  string    `db:"checksum"`
+	Batch     int       `db:"batch"`
+	AppliedAt time.Time `db:"applied_at"`
+}
@@ -0,0 +1,93 @@
+package ldifhistory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+func (r *Repository) Initialize(ctx context.Context) error {
+	_, err := r.pool.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS ldif_history (
+            id SERIAL PRIMARY KEY,
+            name VARCHAR(255) UNIQUE NOT NULL,
+            checksum VARCHAR(64) NOT NULL,
+            batch INTEGER NOT NULL,
+            applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        )
+    `)
+	return err
+}
+
+// GetApplied maps the names of applied files to their checksum.
+func (r *Repository) GetApplied(ctx context.Context) (map[string]string, error) {
+	rows, err := r.pool.Query(ctx, "SELECT name, checksum FROM ldif_history")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query applied files: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[string]string)
+	for rows.Next() {
+		var name, checksum string
+		if err := rows.Scan(&name, &checksum); err != nil {
+			return nil, fmt.Errorf("failed to scan name: %w", err)
+		}
+		applied[name] = checksum
+	}
+	return applied, rows.Err()
+}
+
+func (r *Repository) RecordApply(ctx context.Context, name, checksum string, batch int) error {
+	_, err := r.pool.Exec(
+		ctx,
+		"INSERT INTO ldif_history (name, checksum, batch) VALUES ($1, $2, $3)",
+		name, checksum, batch,
+	)
+	return err
+}
+
+func (r *Repository) GetLastBatch(ctx context.Context) (int, error) {
+	var batch int
+	err := r.pool.QueryRow(
+		ctx,
+		"SELECT COALESCE(MAX(batch), 0) FROM ldif_history",
+	).Scan(&batch)
+	return batch, err
+}
+
+// Reset forgets every applied file, for when the directory was recreated.
+func (r *Repository) Reset(ctx context.Context) error {
+	_, err := r.pool.Exec(ctx, "DELETE FROM ldif_history")
+	return err
+}
+
+func (r *Repository) GetHistory(ctx context.Context) ([]LDIFHistory, error) {
+	rows, err := r.pool.Query(
+		ctx,
+		"SELECT id, name, checksum, batch, applied_at FROM ldif_history ORDER BY batch DESC, applied_at DESC",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []LDIFHistory
+	for rows.Next() {
+		var h LDIFHistory
+		if err := rows.Scan(&h.ID, &h.Name, &h.Checksum, &h.Batch, &h.AppliedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, nil
+}
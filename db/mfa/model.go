@@ -0,0 +1,41 @@
+package mfa
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotEnrolled is returned for employees without a TOTP secret.
+	ErrNotEnrolled = errors.New("totp not enrolled")
+	// ErrAlreadyEnrolled is returned when starting an enrollment over a
+	// confirmed one.
+	ErrAlreadyEnrolled = errors.New("totp already enrolled")
+	// ErrCodeUsed is returned for a TOTP step or recovery code used before.
+	ErrCodeUsed = errors.New("code already used")
+	// ErrInvalidChallenge is returned for unknown, expired or exhausted
+	// login challenges.
+	ErrInvalidChallenge = errors.New("invalid or expired mfa challenge")
+)
+
+// TOTP is the authenticator app enrollment of an employee.
+type TOTP struct {
+	EmployeeID      int        `db:"employee_id"`
+	SecretEncrypted []byte     `db:"secret_encrypted"`
+	ConfirmedAt     *time.Time `db:"confirmed_at"`
+	LastUsedStep    *int64     `db:"last_used_step"`
+	CreatedAt       time.Time  `db:"created_at"`
+}
+
+// Confirmed reports whether the enrollment has been completed with a code.
+func (t *TOTP) Confirmed() bool {
+	return t.ConfirmedAt != nil
+}
+
+// Challenge is the pending second step of a login whose password was right.
+type Challenge struct {
+	ID         int       `db:"id"`
+	EmployeeID int       `db:"employee_id"`
+	Attempts   int       `db:"attempts"`
+	ExpiresAt  time.Time `db:"expires_at"`
+}
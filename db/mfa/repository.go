@@ -0,0 +1,213 @@
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+// TOTP returns the enrollment of an employee, confirmed or not.
+func (r *Repository) TOTP(ctx context.Context, employeeID int) (*TOTP, error) {
+	var t TOTP
+	err := r.pool.QueryRow(ctx, `
+		SELECT employee_id, secret_encrypted, confirmed_at, last_used_step, created_at
+		FROM employee_totp WHERE employee_id = $1`,
+		employeeID,
+	).Scan(&t.EmployeeID, &t.SecretEncrypted, &t.ConfirmedAt, &t.LastUsedStep, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotEnrolled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query totp: %w", err)
+	}
+	return &t, nil
+}
+
+// StartTOTP stores a new, unconfirmed secret, replacing an earlier
+// unconfirmed one. A confirmed enrollment must be removed first.
+func (r *Repository) StartTOTP(ctx context.Context, employeeID int, secretEncrypted []byte) error {
+	tag, err := r.pool.Exec(ctx, `
+		INSERT INTO employee_totp (employee_id, secret_encrypted) VALUES ($1, $2)
+		ON CONFLICT (employee_id) DO UPDATE SET
+			secret_encrypted = EXCLUDED.secret_encrypted,
+			last_used_step = NULL,
+			created_at = now()
+		WHERE employee_totp.confirmed_at IS NULL`,
+		employeeID, secretEncrypted,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store totp: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAlreadyEnrolled
+	}
+	return nil
+}
+
+// UseTOTPStep records step as used, failing with ErrCodeUsed for a step at
+// or before the last one used. The first use confirms the enrollment.
+func (r *Repository) UseTOTPStep(ctx context.Context, employeeID int, step int64) error {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE employee_totp SET last_used_step = $2, confirmed_at = COALESCE(confirmed_at, now())
+		WHERE employee_id = $1 AND (last_used_step IS NULL OR last_used_step < $2)`,
+		employeeID, step,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update totp: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCodeUsed
+	}
+	return nil
+}
+
+// DeleteTOTP removes the enrollment and the recovery codes of an employee.
+func (r *Repository) DeleteTOTP(ctx context.Context, employeeID int) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM mfa_recovery_codes WHERE employee_id = $1", employeeID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM employee_totp WHERE employee_id = $1", employeeID); err != nil {
+		return fmt.Errorf("failed to delete totp: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// ReplaceRecoveryCodes stores hashes as the only recovery codes of an
+// employee.
+func (r *Repository) ReplaceRecoveryCodes(ctx context.Context, employeeID int, hashes []string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM mfa_recovery_codes WHERE employee_id = $1", employeeID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, h := range hashes {
+		if _, err := tx.Exec(ctx,
+			"INSERT INTO mfa_recovery_codes (employee_id, code_hash) VALUES ($1, $2)",
+			employeeID, h,
+		); err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// UseRecoveryCode spends the code with the given hash, ErrCodeUsed if it is
+// unknown or spent already.
+func (r *Repository) UseRecoveryCode(ctx context.Context, employeeID int, hash string) error {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE mfa_recovery_codes SET used_at = now()
+		WHERE employee_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		employeeID, hash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCodeUsed
+	}
+	return nil
+}
+
+// RecoveryCodesLeft counts the unused recovery codes of an employee.
+func (r *Repository) RecoveryCodesLeft(ctx context.Context, employeeID int) (int, error) {
+	var n int
+	err := r.pool.QueryRow(ctx,
+		"SELECT count(*) FROM mfa_recovery_codes WHERE employee_id = $1 AND used_at IS NULL",
+		employeeID,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return n, nil
+}
+
+// CreateChallenge starts the second login step of an employee and returns
+// the plain token to hand to the client. Earlier challenges of the employee
+// are dropped.
+func (r *Repository) CreateChallenge(ctx context.Context, employeeID int, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		"DELETE FROM mfa_challenges WHERE employee_id = $1 OR expires_at <= now()",
+		employeeID,
+	); err != nil {
+		return "", fmt.Errorf("failed to drop old challenges: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO mfa_challenges (employee_id, token_hash, expires_at)
+		VALUES ($1, $2, now() + $3::float8 * interval '1 second')`,
+		employeeID, hashToken(token), ttl.Seconds(),
+	); err != nil {
+		return "", fmt.Errorf("failed to store challenge: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Challenge returns the live challenge for token, counting an attempt
+// against it. Challenges with maxAttempts attempts are no longer returned.
+func (r *Repository) Challenge(ctx context.Context, token string, maxAttempts int) (*Challenge, error) {
+	var c Challenge
+	err := r.pool.QueryRow(ctx, `
+		UPDATE mfa_challenges SET attempts = attempts + 1
+		WHERE token_hash = $1 AND expires_at > now() AND attempts < $2
+		RETURNING id, employee_id, attempts, expires_at`,
+		hashToken(token), maxAttempts,
+	).Scan(&c.ID, &c.EmployeeID, &c.Attempts, &c.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidChallenge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query challenge: %w", err)
+	}
+	return &c, nil
+}
+
+// DeleteChallenge ends challenge id once the login is complete.
+func (r *Repository) DeleteChallenge(ctx context.Context, id int) error {
+	_, err := r.pool.Exec(ctx, "DELETE FROM mfa_challenges WHERE id = $1", id)
+	return err
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,11 @@
+-- Tabel password_reset_tokens (single-use, hanya hash token yang disimpan)
+CREATE TABLE password_reset_tokens (
+    id SERIAL PRIMARY KEY,
+    employee_id INT NOT NULL REFERENCES employees(id) ON DELETE CASCADE,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_password_reset_tokens_employee ON password_reset_tokens (employee_id);
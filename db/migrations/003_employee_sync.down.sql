@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_employees_status;
+
+ALTER TABLE employees
+    DROP COLUMN IF EXISTS dn,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS synced_at;
@@ -0,0 +1,7 @@
+-- Kolom untuk sinkronisasi employees dari LDAP
+ALTER TABLE employees
+    ADD COLUMN dn TEXT,
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active',
+    ADD COLUMN synced_at TIMESTAMP;
+
+CREATE INDEX idx_employees_status ON employees (status);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_employees_dn;
+DROP TABLE IF EXISTS ldap_sync_state;
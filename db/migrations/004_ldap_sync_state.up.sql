@@ -0,0 +1,9 @@
+-- Tabel ldap_sync_state (cookie syncrepl / high-water mark modifyTimestamp)
+CREATE TABLE ldap_sync_state (
+    name VARCHAR(100) PRIMARY KEY,
+    cookie BYTEA,
+    high_water TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_employees_dn ON employees (dn);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS employee_roles;
+DROP TABLE IF EXISTS role_scopes;
+DROP TABLE IF EXISTS role_parents;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,32 @@
+-- Tabel roles
+CREATE TABLE roles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+-- Tabel role_parents (role mewarisi semua scope dari parent-nya)
+CREATE TABLE role_parents (
+    role_id INT REFERENCES roles(id) ON DELETE CASCADE,
+    parent_id INT REFERENCES roles(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, parent_id),
+    CHECK (role_id <> parent_id)
+);
+
+-- Tabel role_scopes (many-to-many)
+CREATE TABLE role_scopes (
+    role_id INT REFERENCES roles(id) ON DELETE CASCADE,
+    scope_id INT REFERENCES scopes(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, scope_id)
+);
+
+-- Tabel employee_roles (many-to-many)
+CREATE TABLE employee_roles (
+    employee_id INT REFERENCES employees(id) ON DELETE CASCADE,
+    role_id INT REFERENCES roles(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT now(),
+    PRIMARY KEY (employee_id, role_id)
+);
+
+CREATE INDEX idx_employee_roles_role ON employee_roles (role_id);
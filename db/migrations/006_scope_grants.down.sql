@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS scope_requests;
+
+ALTER TABLE scopes
+    DROP COLUMN IF EXISTS max_grant_hours,
+    DROP COLUMN IF EXISTS owner_role_id;
+
+ALTER TABLE employee_scopes
+    DROP COLUMN IF EXISTS reason,
+    DROP COLUMN IF EXISTS granted_by,
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS starts_at;
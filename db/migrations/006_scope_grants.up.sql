@@ -0,0 +1,31 @@
+-- Grant scope langsung bisa dibatasi waktu, dengan pemberi dan alasannya
+ALTER TABLE employee_scopes
+    ADD COLUMN starts_at TIMESTAMP NOT NULL DEFAULT now(),
+    ADD COLUMN expires_at TIMESTAMP,
+    ADD COLUMN granted_by INT REFERENCES employees(id) ON DELETE SET NULL,
+    ADD COLUMN reason TEXT;
+
+-- Role pemilik scope menyetujui permintaan scope tersebut;
+-- max_grant_hours membatasi lama grant lewat permintaan
+ALTER TABLE scopes
+    ADD COLUMN owner_role_id INT REFERENCES roles(id) ON DELETE SET NULL,
+    ADD COLUMN max_grant_hours INT CHECK (max_grant_hours > 0);
+
+-- Tabel scope_requests
+CREATE TABLE scope_requests (
+    id SERIAL PRIMARY KEY,
+    employee_id INT NOT NULL REFERENCES employees(id) ON DELETE CASCADE,
+    scope_id INT NOT NULL REFERENCES scopes(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    -- NULL berarti permanen
+    duration_hours INT CHECK (duration_hours > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'rejected', 'cancelled')),
+    decided_by INT REFERENCES employees(id) ON DELETE SET NULL,
+    decided_at TIMESTAMP,
+    decision_note TEXT,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+-- Satu permintaan pending per karyawan dan scope
+CREATE UNIQUE INDEX idx_scope_requests_pending ON scope_requests (employee_id, scope_id) WHERE status = 'pending';
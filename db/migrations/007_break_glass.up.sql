@@ -0,0 +1,17 @@
+-- Tabel break_glass_elevations (audit elevasi darurat)
+CREATE TABLE break_glass_elevations (
+    id SERIAL PRIMARY KEY,
+    employee_id INT NOT NULL REFERENCES employees(id) ON DELETE CASCADE,
+    -- nama role disimpan agar audit tetap terbaca setelah role dihapus
+    role_name VARCHAR(100) NOT NULL,
+    justification TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    session_id VARCHAR(64),
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    created_at TIMESTAMP DEFAULT now(),
+    expires_at TIMESTAMP NOT NULL,
+    notified_at TIMESTAMP
+);
+
+CREATE INDEX idx_break_glass_elevations_employee ON break_glass_elevations (employee_id, created_at);
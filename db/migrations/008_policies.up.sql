@@ -0,0 +1,12 @@
+-- Tabel policies (kebijakan CEL, dievaluasi oleh /authz/check)
+CREATE TABLE policies (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    description TEXT,
+    effect VARCHAR(10) NOT NULL CHECK (effect IN ('allow', 'deny')),
+    actions TEXT[] NOT NULL,
+    condition TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT now(),
+    updated_at TIMESTAMP DEFAULT now()
+);
@@ -0,0 +1,14 @@
+-- Tabel relation_tuples (object#relation@subject, gaya Zanzibar)
+-- subject_relation kosong untuk subject tunggal, terisi untuk userset (group:eng#member)
+CREATE TABLE relation_tuples (
+    namespace VARCHAR(64) NOT NULL,
+    object_id VARCHAR(255) NOT NULL,
+    relation VARCHAR(64) NOT NULL,
+    subject_namespace VARCHAR(64) NOT NULL,
+    subject_id VARCHAR(255) NOT NULL,
+    subject_relation VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT now(),
+    PRIMARY KEY (namespace, object_id, relation, subject_namespace, subject_id, subject_relation)
+);
+
+CREATE INDEX idx_relation_tuples_subject ON relation_tuples (subject_namespace, subject_id, subject_relation);
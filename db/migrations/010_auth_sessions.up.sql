@@ -0,0 +1,18 @@
+-- Tabel auth_sessions (sesi login di server, satu baris per login)
+CREATE TABLE auth_sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    employee_id INT REFERENCES employees(id) ON DELETE CASCADE,
+    -- ldap atau saml
+    method VARCHAR(16) NOT NULL,
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    -- nilai sesi gorilla (gob)
+    data BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT now(),
+    -- batas absolut, idle timeout dihitung dari last_seen_at
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_auth_sessions_employee ON auth_sessions (employee_id, created_at);
+CREATE INDEX idx_auth_sessions_expires ON auth_sessions (expires_at);
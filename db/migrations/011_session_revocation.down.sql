@@ -0,0 +1,3 @@
+ALTER TABLE auth_sessions
+    DROP COLUMN IF EXISTS revoked_by,
+    DROP COLUMN IF EXISTS revoked_at;
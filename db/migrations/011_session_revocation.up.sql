@@ -0,0 +1,4 @@
+-- Pencabutan sesi oleh pemilik atau admin
+ALTER TABLE auth_sessions
+    ADD COLUMN revoked_at TIMESTAMP,
+    ADD COLUMN revoked_by INT REFERENCES employees(id) ON DELETE SET NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE scopes DROP COLUMN IF EXISTS mfa_required;
+
+DROP TABLE IF EXISTS mfa_challenges;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS employee_totp;
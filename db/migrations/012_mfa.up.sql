@@ -0,0 +1,35 @@
+-- TOTP per karyawan, secret dienkripsi AES-GCM (MFA_ENCRYPTION_KEY)
+CREATE TABLE employee_totp (
+    employee_id INT PRIMARY KEY REFERENCES employees(id) ON DELETE CASCADE,
+    secret_encrypted BYTEA NOT NULL,
+    -- NULL sampai kode pertama diverifikasi
+    confirmed_at TIMESTAMP,
+    -- time step terakhir yang dipakai, mencegah kode dipakai ulang
+    last_used_step BIGINT,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+-- Recovery code sekali pakai, hanya hash yang disimpan
+CREATE TABLE mfa_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    employee_id INT NOT NULL REFERENCES employees(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT now(),
+    UNIQUE (employee_id, code_hash)
+);
+
+-- Langkah kedua login LDAP: dibuat setelah password benar
+CREATE TABLE mfa_challenges (
+    id SERIAL PRIMARY KEY,
+    employee_id INT NOT NULL REFERENCES employees(id) ON DELETE CASCADE,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_mfa_challenges_expires ON mfa_challenges (expires_at);
+
+-- NULL = bawaan: wajib MFA untuk scope write dan wildcard
+ALTER TABLE scopes ADD COLUMN mfa_required BOOLEAN;
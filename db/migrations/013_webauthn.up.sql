@@ -0,0 +1,30 @@
+-- Passkey (kredensial WebAuthn) milik karyawan
+CREATE TABLE webauthn_credentials (
+    id SERIAL PRIMARY KEY,
+    employee_id INT NOT NULL REFERENCES employees(id) ON DELETE CASCADE,
+    credential_id BYTEA UNIQUE NOT NULL,
+    -- nama yang diberikan pemilik, mis. "Laptop kantor"
+    name VARCHAR(100) NOT NULL,
+    -- webauthn.Credential (public key, sign count, flags) dalam JSON
+    credential JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT now(),
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX idx_webauthn_credentials_employee ON webauthn_credentials (employee_id);
+
+-- Challenge registrasi/login passkey yang sedang berjalan, sekali pakai
+CREATE TABLE webauthn_ceremonies (
+    id SERIAL PRIMARY KEY,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    -- NULL untuk login tanpa password (karyawan belum diketahui)
+    employee_id INT REFERENCES employees(id) ON DELETE CASCADE,
+    -- register, login atau mfa
+    kind VARCHAR(16) NOT NULL,
+    -- webauthn.SessionData dalam JSON
+    data JSONB NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_webauthn_ceremonies_expires ON webauthn_ceremonies (expires_at);
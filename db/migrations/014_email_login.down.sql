@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS email_login_requests;
+DROP TABLE IF EXISTS email_login_codes;
+ALTER TABLE employees DROP COLUMN IF EXISTS email_login_allowed;
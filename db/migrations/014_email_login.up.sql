@@ -0,0 +1,29 @@
+-- Karyawan yang boleh login dengan kode email / magic link (mis. kontraktor tanpa password LDAP)
+ALTER TABLE employees ADD COLUMN email_login_allowed BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Kode login email sekali pakai, hanya hash kode dan hash token link yang disimpan
+CREATE TABLE email_login_codes (
+    id SERIAL PRIMARY KEY,
+    employee_id INT NOT NULL REFERENCES employees(id) ON DELETE CASCADE,
+    -- hash token magic link, juga dipakai sebagai salt hash kode
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_email_login_codes_employee ON email_login_codes (employee_id, created_at);
+
+-- Catatan setiap permintaan kode untuk rate limit per karyawan dan per IP;
+-- employee_id NULL jika email tidak dikenal
+CREATE TABLE email_login_requests (
+    id SERIAL PRIMARY KEY,
+    employee_id INT REFERENCES employees(id) ON DELETE CASCADE,
+    ip_address VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_email_login_requests_employee ON email_login_requests (employee_id, created_at);
+CREATE INDEX idx_email_login_requests_ip ON email_login_requests (ip_address, created_at);
@@ -0,0 +1,11 @@
+-- Catatan setiap permintaan reset password untuk rate limit per akun dan per IP;
+-- username disimpan apa adanya, juga jika akun tidak ada
+CREATE TABLE password_reset_requests (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_password_reset_requests_username ON password_reset_requests (lower(username), created_at);
+CREATE INDEX idx_password_reset_requests_ip ON password_reset_requests (ip_address, created_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_webauthn_ceremonies_ip;
+ALTER TABLE webauthn_ceremonies DROP COLUMN IF EXISTS ip_address;
@@ -0,0 +1,5 @@
+-- IP yang memulai ceremony, untuk membatasi login passkey tanpa password yang
+-- tertunda per IP
+ALTER TABLE webauthn_ceremonies ADD COLUMN ip_address VARCHAR(64);
+
+CREATE INDEX idx_webauthn_ceremonies_ip ON webauthn_ceremonies (ip_address, kind);
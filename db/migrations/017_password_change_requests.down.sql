@@ -0,0 +1,2 @@
+DELETE FROM password_reset_requests WHERE kind <> 'reset';
+ALTER TABLE password_reset_requests DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,3 @@
+-- Percobaan ganti password juga dicatat untuk rate limit, terpisah dari
+-- permintaan reset: reset atau change
+ALTER TABLE password_reset_requests ADD COLUMN kind VARCHAR(16) NOT NULL DEFAULT 'reset';
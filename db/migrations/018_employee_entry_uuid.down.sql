@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_employees_entry_uuid;
+ALTER TABLE employees DROP COLUMN IF EXISTS entry_uuid;
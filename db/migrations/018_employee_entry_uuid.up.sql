@@ -0,0 +1,8 @@
+-- entryUUID entry LDAP, karena syncrepl melaporkan entry yang dihapus atau
+-- tidak berubah hanya lewat UUID-nya
+ALTER TABLE employees ADD COLUMN entry_uuid UUID;
+
+CREATE INDEX idx_employees_entry_uuid ON employees (entry_uuid);
+
+-- Cookie lama dibuang supaya sync berikutnya refresh penuh dan mengisi entry_uuid
+UPDATE ldap_sync_state SET cookie = NULL, updated_at = now() WHERE name = 'employees';
@@ -0,0 +1,50 @@
+package passkeys
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned for unknown credentials.
+	ErrNotFound = errors.New("passkey not found")
+	// ErrDuplicate is returned when registering a credential twice.
+	ErrDuplicate = errors.New("passkey already registered")
+	// ErrInvalidCeremony is returned for unknown, expired or used
+	// ceremonies.
+	ErrInvalidCeremony = errors.New("invalid or expired passkey ceremony")
+)
+
+// Ceremony kinds
+const (
+	CeremonyRegister = "register"
+	// CeremonyLogin is a passwordless login, its employee is only known
+	// from the passkey used
+	CeremonyLogin = "login"
+	// CeremonyMFA is the second step of an LDAP login
+	CeremonyMFA = "mfa"
+)
+
+// Credential is a passkey registered by an employee.
+type Credential struct {
+	ID           int    `db:"id"`
+	EmployeeID   int    `db:"employee_id"`
+	CredentialID []byte `db:"credential_id"`
+	Name         string `db:"name"`
+	// Data is the webauthn.Credential as JSON, with the public key and
+	// sign count
+	Data       json.RawMessage `db:"credential"`
+	CreatedAt  time.Time       `db:"created_at"`
+	LastUsedAt *time.Time      `db:"last_used_at"`
+}
+
+// Ceremony is a registration or login waiting for the authenticator's
+// answer.
+type Ceremony struct {
+	// EmployeeID is nil for passwordless logins
+	EmployeeID *int   `db:"employee_id"`
+	Kind       string `db:"kind"`
+	// Data is the webauthn.SessionData as JSON
+	Data json.RawMessage `db:"data"`
+}
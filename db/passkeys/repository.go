@@ -0,0 +1,203 @@
+package passkeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+const credentialColumns = "id, employee_id, credential_id, name, credential, created_at, last_used_at"
+
+func scanCredential(row pgx.Row) (*Credential, error) {
+	var c Credential
+	err := row.Scan(&c.ID, &c.EmployeeID, &c.CredentialID, &c.Name, &c.Data, &c.CreatedAt, &c.LastUsedAt)
+	return &c, err
+}
+
+// List returns the passkeys of an employee, oldest first.
+func (r *Repository) List(ctx context.Context, employeeID int) ([]Credential, error) {
+	rows, err := r.pool.Query(ctx,
+		"SELECT "+credentialColumns+" FROM webauthn_credentials WHERE employee_id = $1 ORDER BY created_at, id",
+		employeeID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Credential
+	for rows.Next() {
+		c, err := scanCredential(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan passkey: %w", err)
+		}
+		list = append(list, *c)
+	}
+	return list, rows.Err()
+}
+
+// Count returns how many passkeys an employee has.
+func (r *Repository) Count(ctx context.Context, employeeID int) (int, error) {
+	var n int
+	err := r.pool.QueryRow(ctx,
+		"SELECT count(*) FROM webauthn_credentials WHERE employee_id = $1",
+		employeeID,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count passkeys: %w", err)
+	}
+	return n, nil
+}
+
+// FindByCredentialID returns the passkey with the authenticator's
+// credential id.
+func (r *Repository) FindByCredentialID(ctx context.Context, credentialID []byte) (*Credential, error) {
+	c, err := scanCredential(r.pool.QueryRow(ctx,
+		"SELECT "+credentialColumns+" FROM webauthn_credentials WHERE credential_id = $1",
+		credentialID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query passkey: %w", err)
+	}
+	return c, nil
+}
+
+// Add stores a new passkey and fills in its id and creation time.
+func (r *Repository) Add(ctx context.Context, c *Credential) error {
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO webauthn_credentials (employee_id, credential_id, name, credential)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		c.EmployeeID, c.CredentialID, c.Name, c.Data,
+	).Scan(&c.ID, &c.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store passkey: %w", err)
+	}
+	return nil
+}
+
+// Use stores the credential data after a login, with its new sign count,
+// and marks the passkey used now.
+func (r *Repository) Use(ctx context.Context, credentialID []byte, data json.RawMessage) error {
+	tag, err := r.pool.Exec(ctx,
+		"UPDATE webauthn_credentials SET credential = $2, last_used_at = now() WHERE credential_id = $1",
+		credentialID, data,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update passkey: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes passkey id of an employee.
+func (r *Repository) Delete(ctx context.Context, employeeID, id int) error {
+	tag, err := r.pool.Exec(ctx,
+		"DELETE FROM webauthn_credentials WHERE id = $1 AND employee_id = $2",
+		id, employeeID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteAll removes every passkey of an employee, returning how many.
+func (r *Repository) DeleteAll(ctx context.Context, employeeID int) (int64, error) {
+	tag, err := r.pool.Exec(ctx, "DELETE FROM webauthn_credentials WHERE employee_id = $1", employeeID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete passkeys: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// CreateCeremony stores the state of a registration or login started from
+// ip and returns the plain token the client sends back to finish it.
+func (r *Repository) CreateCeremony(ctx context.Context, employeeID *int, kind, ip string, data json.RawMessage, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate ceremony token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if _, err := r.pool.Exec(ctx, "DELETE FROM webauthn_ceremonies WHERE expires_at <= now()"); err != nil {
+		return "", fmt.Errorf("failed to drop old ceremonies: %w", err)
+	}
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO webauthn_ceremonies (token_hash, employee_id, kind, ip_address, data, expires_at)
+		VALUES ($1, $2, $3, $4, $5, now() + $6::float8 * interval '1 second')`,
+		hashToken(token), employeeID, kind, ip, data, ttl.Seconds(),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to store ceremony: %w", err)
+	}
+	return token, nil
+}
+
+// PendingCeremonies counts the live ceremonies of kind started from ip.
+func (r *Repository) PendingCeremonies(ctx context.Context, kind, ip string) (int, error) {
+	var n int
+	err := r.pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM webauthn_ceremonies
+		WHERE ip_address = $1 AND kind = $2 AND expires_at > now()`,
+		ip, kind,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count ceremonies: %w", err)
+	}
+	return n, nil
+}
+
+// TakeCeremony returns and removes the live ceremony of the given kind for
+// token; each ceremony can be finished once.
+func (r *Repository) TakeCeremony(ctx context.Context, token, kind string) (*Ceremony, error) {
+	var c Ceremony
+	err := r.pool.QueryRow(ctx, `
+		DELETE FROM webauthn_ceremonies
+		WHERE token_hash = $1 AND kind = $2 AND expires_at > now()
+		RETURNING employee_id, kind, data`,
+		hashToken(token), kind,
+	).Scan(&c.EmployeeID, &c.Kind, &c.Data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidCeremony
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ceremony: %w", err)
+	}
+	return &c, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
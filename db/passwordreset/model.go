@@ -0,0 +1,33 @@
+package passwordreset
+
+import "time"
+
+type Token struct {
+	ID         int        `db:"id"`
+	EmployeeID int        `db:"employee_id"`
+	TokenHash  string     `db:"token_hash"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	UsedAt     *time.Time `db:"used_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+// Employee is the owner of a consumed token, enough to reset the LDAP password.
+type Employee struct {
+	ID  int    `db:"id"`
+	UID string `db:"uid"`
+}
+
+// Kinds of recorded requests
+const (
+	// RequestReset is a request for a reset link
+	RequestReset = "reset"
+	// RequestChange is an attempt to change a password with the old one
+	RequestChange = "change"
+)
+
+// Requests counts the requests of a kind made recently for an account and
+// from an address.
+type Requests struct {
+	Account int
+	IP      int
+}
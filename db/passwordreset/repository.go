@@ -0,0 +1,147 @@
+package passwordreset
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrInvalidToken is returned for unknown, expired or already used tokens.
+var ErrInvalidToken = errors.New("invalid or expired reset token")
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+// Create stores a new token for the employee and returns the plain value to
+// mail out. Earlier unused tokens of the same employee are invalidated.
+func (r *Repository) Create(ctx context.Context, employeeID int, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		"UPDATE password_reset_tokens SET used_at = now() WHERE employee_id = $1 AND used_at IS NULL",
+		employeeID,
+	); err != nil {
+		return "", fmt.Errorf("failed to invalidate old tokens: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx,
+		"INSERT INTO password_reset_tokens (employee_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		employeeID, HashToken(token), time.Now().Add(ttl),
+	); err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit token: %w", err)
+	}
+	return token, nil
+}
+
+// Redeem locks a valid token, runs apply for its owner and marks the token as
+// used only when apply succeeds, so a rejected new password doesn't burn the link.
+func (r *Repository) Redeem(ctx context.Context, token string, apply func(*Employee) error) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var tokenID int
+	var e Employee
+	err = tx.QueryRow(ctx, `
+		SELECT t.id, e.id, e.uid
+		FROM password_reset_tokens t
+		JOIN employees e ON e.id = t.employee_id
+		WHERE t.token_hash = $1
+		  AND t.used_at IS NULL
+		  AND t.expires_at > now()
+		FOR UPDATE OF t`, HashToken(token)).Scan(&tokenID, &e.ID, &e.UID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up token: %w", err)
+	}
+
+	if err := apply(&e); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE password_reset_tokens SET used_at = now() WHERE id = $1", tokenID); err != nil {
+		return fmt.Errorf("failed to mark token used: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// RecordRequest logs a request of kind for username from ip and returns how
+// many of that kind were made for both within window before it. Requests
+// older than window are pruned.
+func (r *Repository) RecordRequest(ctx context.Context, kind, username, ip string, window time.Duration) (Requests, error) {
+	var n Requests
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return n, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	since := time.Now().Add(-window)
+	if _, err := tx.Exec(ctx, "DELETE FROM password_reset_requests WHERE created_at < $1", since); err != nil {
+		return n, fmt.Errorf("failed to prune requests: %w", err)
+	}
+	err = tx.QueryRow(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE lower(username) = lower($1)),
+			COUNT(*) FILTER (WHERE ip_address = $2)
+		FROM password_reset_requests WHERE kind = $4 AND created_at >= $3`,
+		username, ip, since, kind,
+	).Scan(&n.Account, &n.IP)
+	if err != nil {
+		return n, fmt.Errorf("failed to count requests: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		"INSERT INTO password_reset_requests (username, ip_address, kind) VALUES ($1, $2, $3)",
+		username, ip, kind,
+	); err != nil {
+		return n, fmt.Errorf("failed to record request: %w", err)
+	}
+	return n, tx.Commit(ctx)
+}
+
+// DeleteExpired removes tokens that can no longer be used.
+func (r *Repository) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := r.pool.Exec(ctx,
+		"DELETE FROM password_reset_tokens WHERE expires_at < now() OR used_at IS NOT NULL",
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
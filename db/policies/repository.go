@@ -0,0 +1,104 @@
+package policies
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-ldap-sso/internal/policy"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+// ListEnabled returns the enabled policies, ready for policy.Engine.Load.
+func (r *Repository) ListEnabled(ctx context.Context) ([]policy.Policy, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT name, COALESCE(description, ''), effect, actions, condition
+		FROM policies WHERE enabled ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query policies: %w", err)
+	}
+	defer rows.Close()
+
+	var list []policy.Policy
+	for rows.Next() {
+		p := policy.Policy{Source: "db"}
+		if err := rows.Scan(&p.Name, &p.Description, &p.Effect, &p.Actions, &p.Condition); err != nil {
+			return nil, fmt.Errorf("failed to scan policy: %w", err)
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// Upsert stores p, replacing a policy of the same name, and enables it.
+// Policies that don't compile are refused, since one invalid policy keeps
+// the engine from loading any change.
+func (r *Repository) Upsert(ctx context.Context, p policy.Policy) error {
+	if err := policy.Validate(p); err != nil {
+		return err
+	}
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO policies (name, description, effect, actions, condition)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE SET
+			description = EXCLUDED.description,
+			effect = EXCLUDED.effect,
+			actions = EXCLUDED.actions,
+			condition = EXCLUDED.condition,
+			enabled = true,
+			updated_at = now()`,
+		p.Name, p.Description, p.Effect, p.Actions, p.Condition,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store policy: %w", err)
+	}
+	return nil
+}
+
+// SetEnabled switches a policy on or off without deleting it. Like Upsert,
+// it refuses to enable a policy that doesn't compile.
+func (r *Repository) SetEnabled(ctx context.Context, name string, enabled bool) error {
+	if enabled {
+		p := policy.Policy{Name: name, Source: "db"}
+		err := r.pool.QueryRow(ctx, "SELECT effect, actions, condition FROM policies WHERE name = $1", name).
+			Scan(&p.Effect, &p.Actions, &p.Condition)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("policy not found: %s", name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch policy: %w", err)
+		}
+		if err := policy.Validate(p); err != nil {
+			return err
+		}
+	}
+
+	tag, err := r.pool.Exec(ctx, "UPDATE policies SET enabled = $2, updated_at = now() WHERE name = $1", name, enabled)
+	if err != nil {
+		return fmt.Errorf("failed to update policy: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("policy not found: %s", name)
+	}
+	return nil
+}
+
+func (r *Repository) Delete(ctx context.Context, name string) error {
+	tag, err := r.pool.Exec(ctx, "DELETE FROM policies WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete policy: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("policy not found: %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package relationtuples
+
+import (
+	"context"
+	"fmt"
+	"go-ldap-sso/internal/rebac"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Repository stores relation tuples and implements rebac.TupleReader.
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+func (r *Repository) Subjects(ctx context.Context, object rebac.Object, relation string) ([]rebac.Subject, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT subject_namespace, subject_id, subject_relation FROM relation_tuples
+		WHERE namespace = $1 AND object_id = $2 AND relation = $3`,
+		object.Namespace, object.ID, relation,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query relation tuples: %w", err)
+	}
+	defer rows.Close()
+
+	var list []rebac.Subject
+	for rows.Next() {
+		var s rebac.Subject
+		if err := rows.Scan(&s.Namespace, &s.ID, &s.Relation); err != nil {
+			return nil, fmt.Errorf("failed to scan relation tuple: %w", err)
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+func (r *Repository) ObjectIDs(ctx context.Context, namespace string) ([]string, error) {
+	rows, err := r.pool.Query(ctx,
+		"SELECT DISTINCT object_id FROM relation_tuples WHERE namespace = $1", namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query relation objects: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan relation object: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Apply deletes and then writes tuples in one transaction. Writing an
+// existing tuple or deleting a missing one is not an error.
+func (r *Repository) Apply(ctx context.Context, writes, deletes []rebac.Tuple) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, t := range deletes {
+		_, err := tx.Exec(ctx, `
+			DELETE FROM relation_tuples
+			WHERE namespace = $1 AND object_id = $2 AND relation = $3
+			  AND subject_namespace = $4 AND subject_id = $5 AND subject_relation = $6`,
+			t.Object.Namespace, t.Object.ID, t.Relation, t.Subject.Namespace, t.Subject.ID, t.Subject.Relation)
+		if err != nil {
+			return fmt.Errorf("failed to delete relation tuple %s: %w", t, err)
+		}
+	}
+	for _, t := range writes {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO relation_tuples (namespace, object_id, relation, subject_namespace, subject_id, subject_relation)
+			VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING`,
+			t.Object.Namespace, t.Object.ID, t.Relation, t.Subject.Namespace, t.Subject.ID, t.Subject.Relation)
+		if err != nil {
+			return fmt.Errorf("failed to write relation tuple %s: %w", t, err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// Filter selects tuples by any combination of its fields; empty fields match all.
+type Filter struct {
+	Namespace string
+	ObjectID  string
+	Relation  string
+	Subject   *rebac.Subject
+}
+
+// Read returns the tuples matching f, at most limit of them.
+func (r *Repository) Read(ctx context.Context, f Filter, limit int) ([]rebac.Tuple, error) {
+	var where []string
+	var args []any
+	add := func(column, value string) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if f.Namespace != "" {
+		add("namespace", f.Namespace)
+	}
+	if f.ObjectID != "" {
+		add("object_id", f.ObjectID)
+	}
+	if f.Relation != "" {
+		add("relation", f.Relation)
+	}
+	if f.Subject != nil {
+		add("subject_namespace", f.Subject.Namespace)
+		add("subject_id", f.Subject.ID)
+		add("subject_relation", f.Subject.Relation)
+	}
+
+	query := "SELECT namespace, object_id, relation, subject_namespace, subject_id, subject_relation FROM relation_tuples"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY namespace, object_id, relation, subject_namespace, subject_id, subject_relation LIMIT $%d", len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query relation tuples: %w", err)
+	}
+	defer rows.Close()
+
+	list := []rebac.Tuple{}
+	for rows.Next() {
+		var t rebac.Tuple
+		if err := rows.Scan(&t.Object.Namespace, &t.Object.ID, &t.Relation, &t.Subject.Namespace, &t.Subject.ID, &t.Subject.Relation); err != nil {
+			return nil, fmt.Errorf("failed to scan relation tuple: %w", err)
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,23 @@
+package roles
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("role not found")
+	// ErrCycle is returned when an inheritance would make a role its own ancestor
+	ErrCycle = errors.New("role inheritance cycle")
+)
+
+type Role struct {
+	ID          int       `db:"id"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	CreatedAt   time.Time `db:"created_at"`
+	// Parents are the names of the roles this one inherits from
+	Parents []string
+	// Scopes are granted directly, without the inherited ones
+	Scopes []string
+}
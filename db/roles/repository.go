@@ -0,0 +1,260 @@
+package roles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+func (r *Repository) Create(ctx context.Context, name, description string) (*Role, error) {
+	role := Role{Name: name, Description: description}
+	err := r.pool.QueryRow(ctx,
+		"INSERT INTO roles (name, description) VALUES ($1, $2) RETURNING id, created_at",
+		name, description,
+	).Scan(&role.ID, &role.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+	return &role, nil
+}
+
+func (r *Repository) Delete(ctx context.Context, name string) error {
+	tag, err := r.pool.Exec(ctx, "DELETE FROM roles WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *Repository) id(ctx context.Context, name string) (int, error) {
+	var id int
+	err := r.pool.QueryRow(ctx, "SELECT id FROM roles WHERE name = $1", name).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return id, err
+}
+
+// Inherit makes role inherit every scope of parent, directly or through
+// the parent's own parents.
+func (r *Repository) Inherit(ctx context.Context, role, parent string) error {
+	roleID, err := r.id(ctx, role)
+	if err != nil {
+		return err
+	}
+	parentID, err := r.id(ctx, parent)
+	if err != nil {
+		return err
+	}
+
+	// parent must not already inherit from role, or resolution would loop
+	var cycle bool
+	err = r.pool.QueryRow(ctx, `
+		WITH RECURSIVE ancestors AS (
+			SELECT $1::int AS id
+			UNION
+			SELECT rp.parent_id FROM role_parents rp JOIN ancestors a ON rp.role_id = a.id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`,
+		parentID, roleID,
+	).Scan(&cycle)
+	if err != nil {
+		return fmt.Errorf("failed to check role inheritance: %w", err)
+	}
+	if cycle {
+		return fmt.Errorf("%w: %s already inherits from %s", ErrCycle, parent, role)
+	}
+
+	_, err = r.pool.Exec(ctx,
+		"INSERT INTO role_parents (role_id, parent_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		roleID, parentID,
+	)
+	return err
+}
+
+func (r *Repository) Disinherit(ctx context.Context, role, parent string) error {
+	_, err := r.pool.Exec(ctx, `
+		DELETE FROM role_parents
+		WHERE role_id = (SELECT id FROM roles WHERE name = $1)
+		  AND parent_id = (SELECT id FROM roles WHERE name = $2)`,
+		role, parent,
+	)
+	return err
+}
+
+func (r *Repository) GrantScope(ctx context.Context, role, scope string) error {
+	tag, err := r.pool.Exec(ctx, `
+		INSERT INTO role_scopes (role_id, scope_id)
+		SELECT r.id, s.id FROM roles r, scopes s WHERE r.name = $1 AND s.name = $2
+		ON CONFLICT DO NOTHING`,
+		role, scope,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to grant scope: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return r.explainMissing(ctx, role, "scopes", scope)
+	}
+	return nil
+}
+
+func (r *Repository) RevokeScope(ctx context.Context, role, scope string) error {
+	_, err := r.pool.Exec(ctx, `
+		DELETE FROM role_scopes
+		WHERE role_id = (SELECT id FROM roles WHERE name = $1)
+		  AND scope_id = (SELECT id FROM scopes WHERE name = $2)`,
+		role, scope,
+	)
+	return err
+}
+
+// Assign gives the employee identified by uid or email the role.
+func (r *Repository) Assign(ctx context.Context, employee, role string) error {
+	tag, err := r.pool.Exec(ctx, `
+		INSERT INTO employee_roles (employee_id, role_id)
+		SELECT e.id, r.id FROM employees e, roles r
+		WHERE (e.uid = $1 OR e.email = $1) AND r.name = $2
+		ON CONFLICT DO NOTHING`,
+		employee, role,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return r.explainMissing(ctx, role, "employees", employee)
+	}
+	return nil
+}
+
+func (r *Repository) Unassign(ctx context.Context, employee, role string) error {
+	_, err := r.pool.Exec(ctx, `
+		DELETE FROM employee_roles
+		WHERE employee_id = (SELECT id FROM employees WHERE uid = $1 OR email = $1)
+		  AND role_id = (SELECT id FROM roles WHERE name = $2)`,
+		employee, role,
+	)
+	return err
+}
+
+// explainMissing tells apart "role or other side doesn't exist" from
+// "already there" after an insert that affected no rows.
+func (r *Repository) explainMissing(ctx context.Context, role, table, other string) error {
+	if _, err := r.id(ctx, role); err != nil {
+		return err
+	}
+
+	query := "SELECT EXISTS (SELECT 1 FROM scopes WHERE name = $1)"
+	if table == "employees" {
+		query = "SELECT EXISTS (SELECT 1 FROM employees WHERE uid = $1 OR email = $1)"
+	}
+	var exists bool
+	if err := r.pool.QueryRow(ctx, query, other).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%s not found: %s", table, other)
+	}
+	return nil
+}
+
+// List returns every role with its direct parents and scopes.
+func (r *Repository) List(ctx context.Context) ([]Role, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT r.id, r.name, COALESCE(r.description, ''), r.created_at,
+			COALESCE(ARRAY(
+				SELECT p.name FROM role_parents rp JOIN roles p ON p.id = rp.parent_id
+				WHERE rp.role_id = r.id ORDER BY p.name), '{}'),
+			COALESCE(ARRAY(
+				SELECT s.name FROM role_scopes rs JOIN scopes s ON s.id = rs.scope_id
+				WHERE rs.role_id = r.id ORDER BY s.name), '{}')
+		FROM roles r ORDER BY r.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query roles: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Role
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, &role.Parents, &role.Scopes); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		list = append(list, role)
+	}
+	return list, rows.Err()
+}
+
+// ForEmployee returns the names of the roles assigned to the employee.
+func (r *Repository) ForEmployee(ctx context.Context, employee string) ([]string, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT r.name FROM roles r
+		JOIN employee_roles er ON er.role_id = r.id
+		JOIN employees e ON e.id = er.employee_id
+		WHERE e.uid = $1 OR e.email = $1
+		ORDER BY r.name`,
+		employee,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query employee roles: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Scopes returns the scope names a role grants, inherited ones included.
+func (r *Repository) Scopes(ctx context.Context, role string) ([]string, error) {
+	roleID, err := r.id(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		WITH RECURSIVE role_tree AS (
+			SELECT $1::int AS id
+			UNION
+			SELECT rp.parent_id FROM role_parents rp JOIN role_tree t ON rp.role_id = t.id
+		)
+		SELECT DISTINCT s.name FROM role_tree t
+		JOIN role_scopes rs ON rs.role_id = t.id
+		JOIN scopes s ON s.id = rs.scope_id
+		ORDER BY s.name`,
+		roleID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query role scopes: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,103 @@
+package roles
+
+import (
+	"context"
+	"errors"
+	"go-ldap-sso/db/dbtest"
+	"reflect"
+	"testing"
+)
+
+// newTestRepository returns a repository over the test database with the
+// roles viewer, editor and admin, and the scopes they are granted.
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	database := dbtest.Open(t)
+	ctx := context.Background()
+	if _, err := database.Pool.Exec(ctx,
+		"INSERT INTO scopes (name) VALUES ('directory:read'), ('merchant:read'), ('merchant:write'), ('sessions:revoke')",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRepository(database.Pool)
+	grants := map[string][]string{
+		"viewer": {"directory:read", "merchant:read"},
+		"editor": {"merchant:write"},
+		"admin":  {"sessions:revoke"},
+	}
+	for _, role := range []string{"viewer", "editor", "admin"} {
+		if _, err := r.Create(ctx, role, ""); err != nil {
+			t.Fatal(err)
+		}
+		for _, scope := range grants[role] {
+			if err := r.GrantScope(ctx, role, scope); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return r
+}
+
+func TestInheritCycle(t *testing.T) {
+	r := newTestRepository(t)
+	ctx := context.Background()
+
+	if err := r.Inherit(ctx, "editor", "viewer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Inherit(ctx, "admin", "editor"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		role, parent string
+	}{
+		{"itself", "viewer", "viewer"},
+		{"direct", "viewer", "editor"},
+		{"through a parent", "viewer", "admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.Inherit(ctx, tt.role, tt.parent); !errors.Is(err, ErrCycle) {
+				t.Errorf("Inherit(%s, %s) error = %v, want ErrCycle", tt.role, tt.parent, err)
+			}
+		})
+	}
+
+	if err := r.Inherit(ctx, "viewer", "nobody"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Inherit() from an unknown role error = %v, want ErrNotFound", err)
+	}
+	// Once broken up the inheritance may go the other way
+	if err := r.Disinherit(ctx, "admin", "editor"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Inherit(ctx, "editor", "admin"); err != nil {
+		t.Errorf("Inherit() after Disinherit error = %v", err)
+	}
+}
+
+func TestScopesInherited(t *testing.T) {
+	r := newTestRepository(t)
+	ctx := context.Background()
+
+	if err := r.Inherit(ctx, "editor", "viewer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Inherit(ctx, "admin", "editor"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := r.Scopes(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"directory:read", "merchant:read", "merchant:write", "sessions:revoke"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Scopes(admin) = %v, want %v", got, want)
+	}
+	if got, _ := r.Scopes(ctx, "viewer"); !reflect.DeepEqual(got, []string{"directory:read", "merchant:read"}) {
+		t.Errorf("Scopes(viewer) = %v, parents must not inherit from children", got)
+	}
+}
@@ -0,0 +1,42 @@
+package scoperequests
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+	StatusCancelled = "cancelled"
+)
+
+var (
+	ErrNotFound     = errors.New("scope request not found")
+	ErrUnknownScope = errors.New("unknown scope")
+	// ErrNotRequestable is returned for scopes without an owning role, nobody could approve them
+	ErrNotRequestable = errors.New("scope has no approver and cannot be requested")
+	ErrDuration       = errors.New("requested duration exceeds the scope's limit")
+	ErrAlreadyPending = errors.New("a request for this scope is already pending")
+	ErrNotPending     = errors.New("scope request is no longer pending")
+	ErrNotApprover    = errors.New("approver does not hold the scope's owning role")
+	ErrSelfApproval   = errors.New("employees cannot decide their own requests")
+)
+
+// Request asks for a direct scope grant. Once approved the grant starts at
+// approval and lasts DurationHours, or forever when nil.
+type Request struct {
+	ID         int `db:"id"`
+	EmployeeID int `db:"employee_id"`
+	// Employee is the requester's uid
+	Employee      string     `db:"employee"`
+	Scope         string     `db:"scope"`
+	Reason        string     `db:"reason"`
+	DurationHours *int       `db:"duration_hours"`
+	Status        string     `db:"status"`
+	DecidedBy     string     `db:"decided_by"`
+	DecidedAt     *time.Time `db:"decided_at"`
+	DecisionNote  string     `db:"decision_note"`
+	CreatedAt     time.Time  `db:"created_at"`
+}
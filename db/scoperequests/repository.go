@@ -0,0 +1,235 @@
+package scoperequests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+const selectRequests = `
+	SELECT q.id, q.employee_id, e.uid, s.name, q.reason, q.duration_hours, q.status,
+		COALESCE(d.uid, ''), q.decided_at, COALESCE(q.decision_note, ''), q.created_at
+	FROM scope_requests q
+	JOIN employees e ON e.id = q.employee_id
+	JOIN scopes s ON s.id = q.scope_id
+	LEFT JOIN employees d ON d.id = q.decided_by`
+
+// approverRoles selects the ids of every role employee $1 holds, inherited
+// ones included.
+const approverRoles = `
+	WITH RECURSIVE approver_roles AS (
+		SELECT role_id AS id FROM employee_roles WHERE employee_id = $1
+		UNION
+		SELECT rp.parent_id FROM role_parents rp JOIN approver_roles a ON rp.role_id = a.id
+	)`
+
+func (r *Repository) query(ctx context.Context, sql string, args ...any) ([]Request, error) {
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scope requests: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Request
+	for rows.Next() {
+		var q Request
+		if err := rows.Scan(&q.ID, &q.EmployeeID, &q.Employee, &q.Scope, &q.Reason, &q.DurationHours, &q.Status,
+			&q.DecidedBy, &q.DecidedAt, &q.DecisionNote, &q.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan scope request: %w", err)
+		}
+		list = append(list, q)
+	}
+	return list, rows.Err()
+}
+
+func (r *Repository) Get(ctx context.Context, id int) (*Request, error) {
+	list, err := r.query(ctx, selectRequests+" WHERE q.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	return &list[0], nil
+}
+
+// ListByEmployee returns the requests an employee made, newest first.
+func (r *Repository) ListByEmployee(ctx context.Context, employeeID int) ([]Request, error) {
+	return r.query(ctx, selectRequests+" WHERE q.employee_id = $1 ORDER BY q.created_at DESC, q.id DESC", employeeID)
+}
+
+// ListApprovable returns the pending requests approverID may decide: those
+// for scopes owned by a role the approver holds, made by someone else.
+func (r *Repository) ListApprovable(ctx context.Context, approverID int) ([]Request, error) {
+	return r.query(ctx, approverRoles+selectRequests+`
+		WHERE q.status = 'pending' AND q.employee_id <> $1
+		  AND s.owner_role_id IN (SELECT id FROM approver_roles)
+		ORDER BY q.created_at, q.id`,
+		approverID,
+	)
+}
+
+// Create records a pending request. durationHours of 0 asks for a permanent
+// grant, which scopes with a grant limit refuse.
+func (r *Repository) Create(ctx context.Context, employeeID int, scope, reason string, durationHours int) (*Request, error) {
+	var scopeID int
+	var ownerRoleID, maxHours *int
+	err := r.pool.QueryRow(ctx,
+		"SELECT id, owner_role_id, max_grant_hours FROM scopes WHERE name = $1", scope,
+	).Scan(&scopeID, &ownerRoleID, &maxHours)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownScope, scope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scope: %w", err)
+	}
+	if ownerRoleID == nil {
+		return nil, ErrNotRequestable
+	}
+	if maxHours != nil && (durationHours <= 0 || durationHours > *maxHours) {
+		return nil, fmt.Errorf("%w: at most %d hours", ErrDuration, *maxHours)
+	}
+
+	var duration *int
+	if durationHours > 0 {
+		duration = &durationHours
+	}
+
+	var id int
+	err = r.pool.QueryRow(ctx, `
+		INSERT INTO scope_requests (employee_id, scope_id, reason, duration_hours)
+		VALUES ($1, $2, $3, $4) RETURNING id`,
+		employeeID, scopeID, reason, duration,
+	).Scan(&id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrAlreadyPending
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scope request: %w", err)
+	}
+	return r.Get(ctx, id)
+}
+
+// Decide approves or rejects a pending request on behalf of approverID, who
+// must hold the scope's owning role and not be the requester. Approval grants
+// the scope in the same transaction; an existing permanent grant is kept.
+// The scope's grant limit is read again under lock, a request it has since
+// been lowered below can only be rejected.
+func (r *Repository) Decide(ctx context.Context, id, approverID int, approve bool, note string) (*Request, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var employeeID, scopeID int
+	var status, reason string
+	var duration, ownerRoleID, maxHours *int
+	err = tx.QueryRow(ctx, `
+		SELECT q.employee_id, q.scope_id, q.status, q.reason, q.duration_hours, s.owner_role_id, s.max_grant_hours
+		FROM scope_requests q JOIN scopes s ON s.id = q.scope_id
+		WHERE q.id = $1 FOR UPDATE OF q FOR SHARE OF s`,
+		id,
+	).Scan(&employeeID, &scopeID, &status, &reason, &duration, &ownerRoleID, &maxHours)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scope request: %w", err)
+	}
+
+	if status != StatusPending {
+		return nil, ErrNotPending
+	}
+	if employeeID == approverID {
+		return nil, ErrSelfApproval
+	}
+	if ownerRoleID == nil {
+		return nil, ErrNotApprover
+	}
+	var holdsRole bool
+	err = tx.QueryRow(ctx, approverRoles+" SELECT EXISTS (SELECT 1 FROM approver_roles WHERE id = $2)",
+		approverID, *ownerRoleID,
+	).Scan(&holdsRole)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check approver roles: %w", err)
+	}
+	if !holdsRole {
+		return nil, ErrNotApprover
+	}
+	if approve && maxHours != nil && (duration == nil || *duration > *maxHours) {
+		return nil, fmt.Errorf("%w: at most %d hours", ErrDuration, *maxHours)
+	}
+
+	status = StatusRejected
+	if approve {
+		status = StatusApproved
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE scope_requests SET status = $2, decided_by = $3, decided_at = now(), decision_note = NULLIF($4, '')
+		WHERE id = $1`,
+		id, status, approverID, note,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update scope request: %w", err)
+	}
+
+	if approve {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO employee_scopes (employee_id, scope_id, starts_at, expires_at, granted_by, reason)
+			VALUES ($1, $2, now(), now() + $3::int * interval '1 hour', $4, $5)
+			ON CONFLICT (employee_id, scope_id) DO UPDATE SET
+				starts_at = EXCLUDED.starts_at,
+				expires_at = EXCLUDED.expires_at,
+				granted_by = EXCLUDED.granted_by,
+				reason = EXCLUDED.reason
+			WHERE employee_scopes.expires_at IS NOT NULL`,
+			employeeID, scopeID, duration, approverID, reason,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to grant scope: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, id)
+}
+
+// Cancel withdraws a pending request made by employeeID.
+func (r *Repository) Cancel(ctx context.Context, id, employeeID int) (*Request, error) {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE scope_requests SET status = 'cancelled', decided_at = now()
+		WHERE id = $1 AND employee_id = $2 AND status = 'pending'`,
+		id, employeeID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel scope request: %w", err)
+	}
+
+	q, err := r.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if q.EmployeeID != employeeID {
+		return nil, ErrNotFound
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrNotPending
+	}
+	return q, nil
+}
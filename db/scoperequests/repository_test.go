@@ -0,0 +1,220 @@
+package scoperequests_test
+
+import (
+	"context"
+	"errors"
+	"go-ldap-sso/db/dbtest"
+	"go-ldap-sso/db/roles"
+	"go-ldap-sso/db/scoperequests"
+	"go-ldap-sso/db/scopes"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type fixture struct {
+	pool     *pgxpool.Pool
+	requests *scoperequests.Repository
+	scopes   *scopes.Repository
+	// alice requests, bob approves through a role inheriting the owning
+	// one, carol holds no role
+	alice, bob, carol int
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	database := dbtest.Open(t)
+	ctx := context.Background()
+	f := &fixture{
+		pool:     database.Pool,
+		requests: scoperequests.NewRepository(database.Pool),
+		scopes:   scopes.NewRepository(database.Pool),
+	}
+
+	for uid, id := range map[string]*int{"alice": &f.alice, "bob": &f.bob, "carol": &f.carol} {
+		err := f.pool.QueryRow(ctx,
+			"INSERT INTO employees (uid, name, email) VALUES ($1, $1, $1 || '@example.org') RETURNING id", uid,
+		).Scan(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := f.pool.Exec(ctx, "INSERT INTO scopes (name) VALUES ('program:write'), ('audit:read')"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := roles.NewRepository(database.Pool)
+	for _, role := range []string{"operator", "lead"} {
+		if _, err := r.Create(ctx, role, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Inherit(ctx, "lead", "operator"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Assign(ctx, "bob", "lead"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.scopes.SetPolicy(ctx, "program:write", "operator", 72); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// expiry returns when alice's direct grant of program:write expires, nil
+// for a permanent one.
+func (f *fixture) expiry(t *testing.T) *time.Time {
+	t.Helper()
+	var expires *time.Time
+	err := f.pool.QueryRow(context.Background(), `
+		SELECT es.expires_at FROM employee_scopes es JOIN scopes s ON s.id = es.scope_id
+		WHERE es.employee_id = $1 AND s.name = 'program:write'`,
+		f.alice,
+	).Scan(&expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expires
+}
+
+func TestCreateRequest(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		scope string
+		hours int
+		want  error
+	}{
+		{"unknown scope", "nothing:read", 8, scoperequests.ErrUnknownScope},
+		{"no owning role", "audit:read", 8, scoperequests.ErrNotRequestable},
+		{"permanent over a limit", "program:write", 0, scoperequests.ErrDuration},
+		{"over the limit", "program:write", 73, scoperequests.ErrDuration},
+		{"within the limit", "program:write", 8, nil},
+		{"already pending", "program:write", 8, scoperequests.ErrAlreadyPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := f.requests.Create(ctx, f.alice, tt.scope, "month-end fix", tt.hours)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Create() error = %v, want %v", err, tt.want)
+			}
+			if err == nil && (q.Status != scoperequests.StatusPending || q.Employee != "alice" || *q.DurationHours != 8) {
+				t.Errorf("Create() = %+v", q)
+			}
+		})
+	}
+}
+
+func TestDecideRequest(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	q, err := f.requests.Create(ctx, f.alice, "program:write", "month-end fix", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if list, _ := f.requests.ListApprovable(ctx, f.bob); len(list) != 1 || list[0].ID != q.ID {
+		t.Errorf("ListApprovable(bob) = %+v, want the request", list)
+	}
+	for _, id := range []int{f.alice, f.carol} {
+		if list, _ := f.requests.ListApprovable(ctx, id); len(list) != 0 {
+			t.Errorf("ListApprovable(%d) = %+v, want none", id, list)
+		}
+	}
+
+	if _, err := f.requests.Decide(ctx, q.ID, f.alice, true, ""); !errors.Is(err, scoperequests.ErrSelfApproval) {
+		t.Errorf("Decide() by the requester error = %v, want ErrSelfApproval", err)
+	}
+	if _, err := f.requests.Decide(ctx, q.ID, f.carol, true, ""); !errors.Is(err, scoperequests.ErrNotApprover) {
+		t.Errorf("Decide() without the owning role error = %v, want ErrNotApprover", err)
+	}
+	if _, err := f.requests.Decide(ctx, q.ID+100, f.bob, true, ""); !errors.Is(err, scoperequests.ErrNotFound) {
+		t.Errorf("Decide() of an unknown request error = %v, want ErrNotFound", err)
+	}
+
+	decided, err := f.requests.Decide(ctx, q.ID, f.bob, true, "ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decided.Status != scoperequests.StatusApproved || decided.DecidedBy != "bob" || decided.DecisionNote != "ok" {
+		t.Errorf("Decide() = %+v", decided)
+	}
+	if expires := f.expiry(t); expires == nil || time.Until(*expires) > 8*time.Hour || time.Until(*expires) < 7*time.Hour {
+		t.Errorf("grant expires at %v, want in 8 hours", expires)
+	}
+	if _, err := f.requests.Decide(ctx, q.ID, f.bob, false, ""); !errors.Is(err, scoperequests.ErrNotPending) {
+		t.Errorf("Decide() twice error = %v, want ErrNotPending", err)
+	}
+}
+
+func TestDecideKeepsPermanentGrant(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	if err := f.scopes.Grant(ctx, "alice", "program:write", "", "", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	q, err := f.requests.Create(ctx, f.alice, "program:write", "", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.requests.Decide(ctx, q.ID, f.bob, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if expires := f.expiry(t); expires != nil {
+		t.Errorf("permanent grant shortened to %v", expires)
+	}
+}
+
+func TestDecideLoweredLimit(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	q, err := f.requests.Create(ctx, f.alice, "program:write", "", 48)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.scopes.SetPolicy(ctx, "program:write", "operator", 24); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.requests.Decide(ctx, q.ID, f.bob, true, ""); !errors.Is(err, scoperequests.ErrDuration) {
+		t.Errorf("Decide() over the lowered limit error = %v, want ErrDuration", err)
+	}
+	decided, err := f.requests.Decide(ctx, q.ID, f.bob, false, "too long")
+	if err != nil || decided.Status != scoperequests.StatusRejected {
+		t.Errorf("rejecting = %+v, %v", decided, err)
+	}
+}
+
+func TestCancelRequest(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	q, err := f.requests.Create(ctx, f.alice, "program:write", "", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.requests.Cancel(ctx, q.ID, f.carol); !errors.Is(err, scoperequests.ErrNotFound) {
+		t.Errorf("Cancel() by someone else error = %v, want ErrNotFound", err)
+	}
+	cancelled, err := f.requests.Cancel(ctx, q.ID, f.alice)
+	if err != nil || cancelled.Status != scoperequests.StatusCancelled {
+		t.Fatalf("Cancel() = %+v, %v", cancelled, err)
+	}
+	if _, err := f.requests.Cancel(ctx, q.ID, f.alice); !errors.Is(err, scoperequests.ErrNotPending) {
+		t.Errorf("Cancel() twice error = %v, want ErrNotPending", err)
+	}
+	if _, err := f.requests.Decide(ctx, q.ID, f.bob, true, ""); !errors.Is(err, scoperequests.ErrNotPending) {
+		t.Errorf("Decide() of a cancelled request error = %v, want ErrNotPending", err)
+	}
+
+	// A new request can follow the cancelled one
+	if _, err := f.requests.Create(ctx, f.alice, "program:write", "", 8); err != nil {
+		t.Errorf("Create() after Cancel() error = %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package scopes
+
+import "time"
+
+type Scope struct {
+	ID          int    `db:"id"`
+	Name        string `db:"name"`
+	Description string `db:"description"`
+	// OwnerRole approves requests for this scope, empty if requests can't be approved
+	OwnerRole     string `db:"owner_role"`
+	MaxGrantHours *int   `db:"max_grant_hours"`
+	// MFARequired makes holders use a second factor at LDAP login. Nil
+	// means the default: required for write and wildcard scopes.
+	MFARequired *bool `db:"mfa_required"`
+}
+
+// Grant is a scope given to an employee directly, as opposed to through a role.
+type Grant struct {
+	Scope     string     `db:"scope"`
+	StartsAt  time.Time  `db:"starts_at"`
+	ExpiresAt *time.Time `db:"expires_at"`
+	// GrantedBy is the uid of the granting admin, empty if unknown
+	GrantedBy string `db:"granted_by"`
+	Reason    string `db:"reason"`
+}
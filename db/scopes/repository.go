@@ -0,0 +1,262 @@
+package scopes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+func (r *Repository) List(ctx context.Context) ([]Scope, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT s.id, s.name, COALESCE(s.description, ''), COALESCE(r.name, ''), s.max_grant_hours, s.mfa_required
+		FROM scopes s LEFT JOIN roles r ON r.id = s.owner_role_id
+		ORDER BY s.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scopes: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Scope
+	for rows.Next() {
+		var s Scope
+		if err := rows.Scan(&s.ID, &s.Name, &s.Description, &s.OwnerRole, &s.MaxGrantHours, &s.MFARequired); err != nil {
+			return nil, fmt.Errorf("failed to scan scope: %w", err)
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// effectiveScopes selects (employee_id, scope name) for every scope an
+// employee holds: granted directly in employee_scopes, while the grant is
+// active, or through a role in employee_roles, including the roles those
+// roles inherit from. UNION (not UNION ALL) keeps the recursion finite should
+// role_parents ever form a cycle.
+const effectiveScopes = `
+	WITH RECURSIVE employee_role_tree AS (
+		SELECT er.employee_id, er.role_id FROM employee_roles er
+		UNION
+		SELECT t.employee_id, rp.parent_id FROM role_parents rp
+		JOIN employee_role_tree t ON rp.role_id = t.role_id
+	)
+	SELECT es.employee_id, s.name FROM employee_scopes es
+	JOIN scopes s ON s.id = es.scope_id
+	WHERE es.starts_at <= now() AND (es.expires_at IS NULL OR es.expires_at > now())
+	UNION
+	SELECT t.employee_id, s.name FROM employee_role_tree t
+	JOIN role_scopes rs ON rs.role_id = t.role_id
+	JOIN scopes s ON s.id = rs.scope_id`
+
+// ForEmployee returns the effective scope names of one employee, sorted.
+func (r *Repository) ForEmployee(ctx context.Context, employeeID int) ([]string, error) {
+	rows, err := r.pool.Query(ctx,
+		"SELECT name FROM ("+effectiveScopes+") es WHERE employee_id = $1 ORDER BY name",
+		employeeID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query employee scopes: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan employee scope: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// ByEmployee maps employee ids to their effective scope names.
+func (r *Repository) ByEmployee(ctx context.Context) (map[int][]string, error) {
+	rows, err := r.pool.Query(ctx,
+		"SELECT employee_id, name FROM ("+effectiveScopes+") es ORDER BY employee_id, name",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query employee scopes: %w", err)
+	}
+	defer rows.Close()
+
+	granted := make(map[int][]string)
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan employee scope: %w", err)
+		}
+		granted[id] = append(granted[id], name)
+	}
+	return granted, rows.Err()
+}
+
+// mfaRequired is the condition on scopes s making holders use a second
+// factor: the scope's own setting, or by default its being a write or
+// wildcard scope.
+const mfaRequired = `COALESCE(s.mfa_required, s.name LIKE '%:write' OR s.name LIKE '%*')`
+
+// RequiresMFA reports whether any effective scope of the employee requires
+// a second factor.
+func (r *Repository) RequiresMFA(ctx context.Context, employeeID int) (bool, error) {
+	var required bool
+	err := r.pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM (`+effectiveScopes+`) es JOIN scopes s ON s.name = es.name
+			WHERE es.employee_id = $1 AND `+mfaRequired+`
+		)`,
+		employeeID,
+	).Scan(&required)
+	if err != nil {
+		return false, fmt.Errorf("failed to query mfa requirement: %w", err)
+	}
+	return required, nil
+}
+
+// SetMFARequired sets whether holders of scope must use a second factor;
+// nil restores the default.
+func (r *Repository) SetMFARequired(ctx context.Context, scope string, required *bool) error {
+	tag, err := r.pool.Exec(ctx, "UPDATE scopes SET mfa_required = $2 WHERE name = $1", scope, required)
+	if err != nil {
+		return fmt.Errorf("failed to update scope: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("scope not found: %s", scope)
+	}
+	return nil
+}
+
+// GrantTTL returns how long until the first of the employee's active,
+// time-bound direct grants expires, or 0 if none is time-bound. Tokens
+// shouldn't outlive the grants they carry.
+func (r *Repository) GrantTTL(ctx context.Context, employeeID int) (time.Duration, error) {
+	var seconds *float64
+	err := r.pool.QueryRow(ctx, `
+		SELECT EXTRACT(EPOCH FROM MIN(expires_at) - now())::float8 FROM employee_scopes
+		WHERE employee_id = $1 AND starts_at <= now() AND expires_at > now()`,
+		employeeID,
+	).Scan(&seconds)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query grant expiry: %w", err)
+	}
+	if seconds == nil {
+		return 0, nil
+	}
+	return time.Duration(*seconds * float64(time.Second)), nil
+}
+
+// Grant gives an employee (uid or email) a scope directly. A zero duration
+// grants it permanently, startsIn delays the start. grantedBy (uid or email,
+// may be empty) and reason are recorded with the grant; granting again
+// replaces the previous grant.
+func (r *Repository) Grant(ctx context.Context, employee, scope, grantedBy, reason string, startsIn, duration time.Duration) error {
+	tag, err := r.pool.Exec(ctx, `
+		INSERT INTO employee_scopes (employee_id, scope_id, starts_at, expires_at, granted_by, reason)
+		SELECT e.id, s.id,
+			now() + $3::float8 * interval '1 second',
+			CASE WHEN $4::float8 > 0 THEN now() + ($3::float8 + $4::float8) * interval '1 second' END,
+			(SELECT id FROM employees WHERE $5::text <> '' AND (uid = $5 OR email = $5)),
+			NULLIF($6::text, '')
+		FROM employees e, scopes s
+		WHERE (e.uid = $1 OR e.email = $1) AND s.name = $2
+		ON CONFLICT (employee_id, scope_id) DO UPDATE SET
+			starts_at = EXCLUDED.starts_at,
+			expires_at = EXCLUDED.expires_at,
+			granted_by = EXCLUDED.granted_by,
+			reason = EXCLUDED.reason`,
+		employee, scope, startsIn.Seconds(), duration.Seconds(), grantedBy, reason,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to grant scope: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("employee or scope not found: %s, %s", employee, scope)
+	}
+	return nil
+}
+
+// Revoke removes a direct grant; scopes held through roles are unaffected.
+func (r *Repository) Revoke(ctx context.Context, employee, scope string) error {
+	_, err := r.pool.Exec(ctx, `
+		DELETE FROM employee_scopes
+		WHERE employee_id = (SELECT id FROM employees WHERE uid = $1 OR email = $1)
+		  AND scope_id = (SELECT id FROM scopes WHERE name = $2)`,
+		employee, scope,
+	)
+	return err
+}
+
+// SetPolicy sets the role approving requests for scope (empty for none) and
+// the longest grant a request may ask for (0 for no limit).
+func (r *Repository) SetPolicy(ctx context.Context, scope, ownerRole string, maxGrantHours int) error {
+	var ownerID *int
+	if ownerRole != "" {
+		var id int
+		err := r.pool.QueryRow(ctx, "SELECT id FROM roles WHERE name = $1", ownerRole).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("role not found: %s", ownerRole)
+		}
+		if err != nil {
+			return err
+		}
+		ownerID = &id
+	}
+
+	var maxHours *int
+	if maxGrantHours > 0 {
+		maxHours = &maxGrantHours
+	}
+
+	tag, err := r.pool.Exec(ctx,
+		"UPDATE scopes SET owner_role_id = $2, max_grant_hours = $3 WHERE name = $1",
+		scope, ownerID, maxHours,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update scope: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("scope not found: %s", scope)
+	}
+	return nil
+}
+
+// Grants lists the direct grants of an employee (uid or email), expired and
+// future ones included.
+func (r *Repository) Grants(ctx context.Context, employee string) ([]Grant, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT s.name, es.starts_at, es.expires_at, COALESCE(g.uid, ''), COALESCE(es.reason, '')
+		FROM employee_scopes es
+		JOIN employees e ON e.id = es.employee_id
+		JOIN scopes s ON s.id = es.scope_id
+		LEFT JOIN employees g ON g.id = es.granted_by
+		WHERE e.uid = $1 OR e.email = $1
+		ORDER BY s.name`,
+		employee,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query grants: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Grant
+	for rows.Next() {
+		var g Grant
+		if err := rows.Scan(&g.Scope, &g.StartsAt, &g.ExpiresAt, &g.GrantedBy, &g.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan grant: %w", err)
+		}
+		list = append(list, g)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,79 @@
+package scopes_test
+
+import (
+	"context"
+	"go-ldap-sso/db/dbtest"
+	"go-ldap-sso/db/roles"
+	"go-ldap-sso/db/scopes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestForEmployeeThroughRoles(t *testing.T) {
+	database := dbtest.Open(t)
+	ctx := context.Background()
+
+	var alice int
+	err := database.Pool.QueryRow(ctx, `
+		INSERT INTO employees (uid, name, email) VALUES ('alice', 'Alice', 'alice@example.org') RETURNING id`,
+	).Scan(&alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Pool.Exec(ctx,
+		"INSERT INTO scopes (name) VALUES ('directory:read'), ('merchant:read'), ('merchant:write'), ('reports:read'), ('audit:read')",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	r := roles.NewRepository(database.Pool)
+	for role, scope := range map[string]string{"viewer": "merchant:read", "editor": "merchant:write", "lead": "directory:read"} {
+		if _, err := r.Create(ctx, role, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.GrantScope(ctx, role, scope); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// lead -> editor -> viewer, alice only holds lead
+	if err := r.Inherit(ctx, "editor", "viewer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Inherit(ctx, "lead", "editor"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Assign(ctx, "alice", "lead"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := scopes.NewRepository(database.Pool)
+	// A direct grant adds to the roles, an expired or future one doesn't
+	if err := s.Grant(ctx, "alice", "reports:read", "", "", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Grant(ctx, "alice", "audit:read", "", "", time.Hour, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.ForEmployee(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"directory:read", "merchant:read", "merchant:write", "reports:read"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ForEmployee() = %v, want %v", got, want)
+	}
+
+	// Dropping the middle role cuts off what it inherited
+	if err := r.Disinherit(ctx, "lead", "editor"); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.ForEmployee(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"directory:read", "reports:read"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ForEmployee() after Disinherit = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,10 @@
+package syncstate
+
+import "time"
+
+type State struct {
+	Name      string     `db:"name"`
+	Cookie    []byte     `db:"cookie"`
+	HighWater *time.Time `db:"high_water"`
+	UpdatedAt time.Time  `db:"updated_at"`
+}
@@ -0,0 +1,59 @@
+package syncstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{pool: pool}
+}
+
+// Get returns the stored state, or an empty State when none was saved yet.
+func (r *Repository) Get(ctx context.Context, name string) (*State, error) {
+	s := &State{Name: name}
+	err := r.pool.QueryRow(ctx,
+		"SELECT cookie, high_water, updated_at FROM ldap_sync_state WHERE name = $1",
+		name,
+	).Scan(&s.Cookie, &s.HighWater, &s.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sync state: %w", err)
+	}
+	return s, nil
+}
+
+func (r *Repository) SaveCookie(ctx context.Context, name string, cookie []byte) error {
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO ldap_sync_state (name, cookie, updated_at) VALUES ($1, $2, now())
+		ON CONFLICT (name) DO UPDATE SET cookie = EXCLUDED.cookie, updated_at = now()`,
+		name, cookie,
+	)
+	return err
+}
+
+func (r *Repository) SaveHighWater(ctx context.Context, name string, highWater time.Time) error {
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO ldap_sync_state (name, high_water, updated_at) VALUES ($1, $2, now())
+		ON CONFLICT (name) DO UPDATE SET high_water = EXCLUDED.high_water, updated_at = now()`,
+		name, highWater,
+	)
+	return err
+}
+
+// Reset forgets the cookie and high-water mark so the next run starts from scratch.
+func (r *Repository) Reset(ctx context.Context, name string) error {
+	_, err := r.pool.Exec(ctx, "DELETE FROM ldap_sync_state WHERE name = $1", name)
+	return err
+}
@@ -1,24 +1,77 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"go-ldap-sso/config"
+	"go-ldap-sso/pkg/authz"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
-func GenerateToken(email string, scopes []string, cfg *config.Config) (string, error) {
+// TokenClaims is what an LDAP login token says about its holder.
+type TokenClaims struct {
+	// Subject is the employee's email, kept in "sub" for existing consumers
+	Subject    string
+	Name       string
+	EmployeeID int
+	Scopes     authz.Scopes
+	SessionID  string
+	// Elevated marks break-glass tokens carrying an emergency role's scopes
+	Elevated bool
+	// ExpiresIn shortens the configured token lifetime when positive
+	ExpiresIn time.Duration
+	// AuthTime is when the holder last proved who they are, "auth_time";
+	// GenerateToken uses the current time when it is zero
+	AuthTime time.Time
+	// AMR lists the authentication methods (RFC 8176) used at AuthTime
+	AMR []string
+	// IssuedAt is set by GenerateToken
+	IssuedAt time.Time
+}
+
+// NewSessionID returns a random identifier for a login session.
+func NewSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func GenerateToken(c TokenClaims, cfg *config.Config) (string, error) {
+	now := time.Now()
+	lifetime := time.Duration(cfg.AuthConfig.JWTExpiryHours) * time.Hour
+	if c.ExpiresIn > 0 && c.ExpiresIn < lifetime {
+		lifetime = c.ExpiresIn
+	}
+	authTime := c.AuthTime
+	if authTime.IsZero() {
+		authTime = now
+	}
 	claims := jwt.MapClaims{
-		"sub":    email,
-		"scopes": scopes,
-		"exp":    time.Now().Add(time.Duration(cfg.AuthConfig.JWTExpiryHours) * time.Hour).Unix(),
+		"sub":       c.Subject,
+		"name":      c.Name,
+		"eid":       c.EmployeeID,
+		"scopes":    c.Scopes,
+		"sid":       c.SessionID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(lifetime).Unix(),
+		"auth_time": authTime.Unix(),
+	}
+	if len(c.AMR) > 0 {
+		claims["amr"] = c.AMR
+	}
+	if c.Elevated {
+		claims["elevated"] = true
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(cfg.AuthConfig.JWTSecret))
 }
 
-func ValidateToken(tokenString string, cfg *config.Config) (email string, scopes []string, err error) {
+func ValidateToken(tokenString string, cfg *config.Config) (*TokenClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Pastikan metode signing cocok
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -28,33 +81,64 @@ func ValidateToken(tokenString string, cfg *config.Config) (email string, scopes
 	})
 
 	if err != nil {
-		return "", nil, fmt.Errorf("invalid token: %w", err)
+		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
-		return "", nil, fmt.Errorf("invalid token claims")
+		return nil, fmt.Errorf("invalid token claims")
 	}
 
 	// Ambil email
 	sub, ok := claims["sub"].(string)
 	if !ok {
-		return "", nil, fmt.Errorf("missing subject (email)")
+		return nil, fmt.Errorf("missing subject (email)")
+	}
+
+	// Ambil scopes; null untuk karyawan tanpa scope
+	var rawScopes []interface{}
+	if claims["scopes"] != nil {
+		rawScopes, ok = claims["scopes"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid scopes")
+		}
 	}
 
-	// Ambil scopes
-	rawScopes, ok := claims["scopes"].([]interface{})
+	scopesStr := stringList(rawScopes)
+
+	// Klaim lain opsional, token lama tidak memilikinya
+	name, _ := claims["name"].(string)
+	eid, _ := claims["eid"].(float64)
+	sid, _ := claims["sid"].(string)
+	iat, _ := claims["iat"].(float64)
+	elevated, _ := claims["elevated"].(bool)
+	// Tokens from before auth_time was recorded authenticated when issued
+	authTime, ok := claims["auth_time"].(float64)
 	if !ok {
-		return "", nil, fmt.Errorf("invalid scopes")
+		authTime = iat
 	}
+	rawAMR, _ := claims["amr"].([]interface{})
+
+	return &TokenClaims{
+		Subject:    sub,
+		Name:       name,
+		EmployeeID: int(eid),
+		Scopes:     scopesStr,
+		SessionID:  sid,
+		Elevated:   elevated,
+		IssuedAt:   time.Unix(int64(iat), 0),
+		AuthTime:   time.Unix(int64(authTime), 0),
+		AMR:        stringList(rawAMR),
+	}, nil
+}
 
-	// Convert interface{} slice to []string
-	var scopesStr []string
-	for _, s := range rawScopes {
+// stringList converts a JSON array to strings, skipping other values.
+func stringList(list []interface{}) []string {
+	var strs []string
+	for _, s := range list {
 		if str, ok := s.(string); ok {
-			scopesStr = append(scopesStr, str)
+			strs = append(strs, str)
 		}
 	}
-
-	return sub, scopesStr, nil
+	return strs
 }
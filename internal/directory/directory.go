@@ -0,0 +1,184 @@
+package directory
+
+import (
+	"errors"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxResults caps how many entries a single search asks the directory for,
+// whatever offset/limit the client sends.
+const MaxResults = 500
+
+var ErrNotFound = errors.New("directory: not found")
+
+// Person is the public view of a directory user; the DN and account state
+// stay internal. Disabled accounts are never returned as people.
+type Person struct {
+	UID   string `json:"uid"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type SearchResult struct {
+	Users []Person
+	// More is set when results beyond offset+limit exist
+	More bool
+	// Truncated is set when the directory had more matches than MaxResults,
+	// which are never returned
+	Truncated bool
+}
+
+// Members are the people of a group, Truncated when it has more than
+// MaxResults.
+type Members struct {
+	People    []Person
+	Truncated bool
+}
+
+// searchHits is a cached SearchUsers answer.
+type searchHits struct {
+	people    []Person
+	truncated bool
+}
+
+// Service answers people lookups from LDAP with a short-lived in-memory
+// cache in front, so a people picker typing letter by letter doesn't hit
+// the directory for every keystroke.
+type Service struct {
+	ldap *ldapauth.LDAPClient
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func NewService(ldapClient *ldapauth.LDAPClient, ttl time.Duration) *Service {
+	return &Service{
+		ldap:  ldapClient,
+		ttl:   ttl,
+		cache: make(map[string]cacheEntry),
+	}
+}
+
+// SearchUsers returns the page [offset, offset+limit) of enabled users
+// matching query. Paging happens here over the cached matches of a single
+// directory search capped at MaxResults, not with the server-side paged
+// results control: that can't seek to an offset and would pin a connection
+// between requests. Clients narrow the query when Truncated is set.
+func (s *Service) SearchUsers(query string, offset, limit int) (*SearchResult, error) {
+	query = strings.TrimSpace(query)
+	v, err := s.cached("search:"+strings.ToLower(query), func() (interface{}, error) {
+		users, truncated, err := s.ldap.SearchUsers(query, MaxResults)
+		if err != nil {
+			return nil, err
+		}
+		return searchHits{people: toPeople(users), truncated: truncated}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hits := v.(searchHits)
+	people := hits.people
+	if offset >= len(people) {
+		return &SearchResult{Users: []Person{}, Truncated: hits.truncated}, nil
+	}
+	end := offset + limit
+	if end > len(people) {
+		end = len(people)
+	}
+	return &SearchResult{Users: people[offset:end], More: end < len(people), Truncated: hits.truncated}, nil
+}
+
+func (s *Service) GetUser(uid string) (*Person, error) {
+	v, err := s.cached("user:"+uid, func() (interface{}, error) {
+		user, err := s.ldap.LookupUser(uid)
+		if errors.Is(err, ldapauth.ErrUserNotFound) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if user.Disabled {
+			return nil, ErrNotFound
+		}
+		p := toPerson(user)
+		return &p, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Person), nil
+}
+
+// GroupMembers returns the enabled ones of up to MaxResults members of the
+// group cn.
+func (s *Service) GroupMembers(cn string) (*Members, error) {
+	v, err := s.cached("group:"+strings.ToLower(cn), func() (interface{}, error) {
+		users, truncated, err := s.ldap.GroupMembers(cn, MaxResults)
+		if errors.Is(err, ldapauth.ErrGroupNotFound) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Members{People: toPeople(users), Truncated: truncated}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Members), nil
+}
+
+// cached returns the cached value for key or loads it. Errors are not cached.
+func (s *Service) cached(key string, load func() (interface{}, error)) (interface{}, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	if e, ok := s.cache[key]; ok && now.Before(e.expires) {
+		s.mu.Unlock()
+		return e.value, nil
+	}
+	s.mu.Unlock()
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Drop expired entries now and then so the map doesn't grow unbounded
+	if len(s.cache) > 1000 {
+		for k, e := range s.cache {
+			if now.After(e.expires) {
+				delete(s.cache, k)
+			}
+		}
+	}
+	s.cache[key] = cacheEntry{value: value, expires: now.Add(s.ttl)}
+	return value, nil
+}
+
+func toPerson(u *ldapauth.User) Person {
+	return Person{UID: u.UID, Name: u.Name, Email: u.Email}
+}
+
+// toPeople leaves out disabled accounts, so they can't be picked.
+func toPeople(users []*ldapauth.User) []Person {
+	people := make([]Person, 0, len(users))
+	for _, u := range users {
+		if !u.Disabled {
+			people = append(people, toPerson(u))
+		}
+	}
+	return people
+}
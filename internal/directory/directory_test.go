@@ -0,0 +1,96 @@
+package directory
+
+import (
+	"errors"
+	"go-ldap-sso/internal/ldapserver/ldaptest"
+	"testing"
+	"time"
+)
+
+const testLDIF = `dn: ou=users,dc=example,dc=org
+objectClass: organizationalUnit
+ou: users
+
+dn: uid=alice,ou=users,dc=example,dc=org
+objectClass: inetOrgPerson
+cn: Alice Example
+sn: Example
+uid: alice
+mail: alice@example.org
+
+dn: uid=bob,ou=users,dc=example,dc=org
+objectClass: inetOrgPerson
+cn: Bob Example
+sn: Example
+uid: bob
+mail: bob@example.org
+pwdAccountLockedTime: 000001010000Z
+
+dn: uid=carol,ou=users,dc=example,dc=org
+objectClass: inetOrgPerson
+cn: Carol Example
+sn: Example
+uid: carol
+mail: carol@example.org
+
+dn: cn=devs,ou=users,dc=example,dc=org
+objectClass: posixGroup
+cn: devs
+memberUid: alice
+memberUid: bob
+`
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	return NewService(ldaptest.Connect(t, ldaptest.Start(t, testLDIF)), time.Minute)
+}
+
+func uids(people []Person) []string {
+	list := make([]string, len(people))
+	for i, p := range people {
+		list[i] = p.UID
+	}
+	return list
+}
+
+func TestSearchUsersSkipsDisabled(t *testing.T) {
+	s := newTestService(t)
+
+	res, err := s.SearchUsers("example", 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := uids(res.Users); len(got) != 1 || got[0] != "alice" || !res.More {
+		t.Errorf("first page = %v, more %t, want [alice] and more", got, res.More)
+	}
+	res, err = s.SearchUsers("example", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := uids(res.Users); len(got) != 1 || got[0] != "carol" || res.More {
+		t.Errorf("second page = %v, more %t, want [carol] and no more", got, res.More)
+	}
+}
+
+func TestGetUserDisabled(t *testing.T) {
+	s := newTestService(t)
+
+	if p, err := s.GetUser("alice"); err != nil || p.Email != "alice@example.org" {
+		t.Errorf("GetUser(alice) = %+v, %v", p, err)
+	}
+	if _, err := s.GetUser("bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetUser(bob) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGroupMembersSkipsDisabled(t *testing.T) {
+	s := newTestService(t)
+
+	members, err := s.GroupMembers("devs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := uids(members.People); len(got) != 1 || got[0] != "alice" {
+		t.Errorf("members = %v, want [alice]", got)
+	}
+}
@@ -0,0 +1,296 @@
+package dirsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-ldap-sso/db/employees"
+	"go-ldap-sso/db/syncstate"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// stateName is the ldap_sync_state row used by the incremental sync.
+const stateName = "employees"
+
+// Incremental propagates single directory changes to employees as they
+// happen. It uses RFC 4533 syncrepl when the server supports it and polls
+// modifyTimestamp otherwise. Deletions are only seen through syncrepl, by DN
+// or entryUUID, the full Syncer still has to run now and then to catch them
+// on other servers.
+type Incremental struct {
+	ldap         *ldapauth.LDAPClient
+	pool         *pgxpool.Pool
+	repo         *employees.Repository
+	state        *syncstate.Repository
+	pollInterval time.Duration
+}
+
+func NewIncremental(ldapClient *ldapauth.LDAPClient, pool *pgxpool.Pool, pollInterval time.Duration) *Incremental {
+	return &Incremental{
+		ldap:         ldapClient,
+		pool:         pool,
+		repo:         employees.NewRepository(pool),
+		state:        syncstate.NewRepository(pool),
+		pollInterval: pollInterval,
+	}
+}
+
+// Run blocks until ctx is cancelled, reconnecting with backoff when the
+// directory goes away.
+func (s *Incremental) Run(ctx context.Context) {
+	backoff := time.Second
+
+	supported, err := s.ldap.SupportsSyncrepl()
+	for err != nil && ctx.Err() == nil {
+		log.Printf("⚠️ Incremental LDAP sync: %v (retrying in %s)", err, backoff)
+		sleep(ctx, backoff)
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+		supported, err = s.ldap.SupportsSyncrepl()
+	}
+
+	if supported {
+		log.Println("🔄 Incremental LDAP sync using syncrepl")
+	} else {
+		log.Printf("🔄 Incremental LDAP sync polling modifyTimestamp every %s", s.pollInterval)
+	}
+
+	backoff = time.Second
+	for ctx.Err() == nil {
+		if supported {
+			err = s.runSyncrepl(ctx)
+		} else {
+			err = s.Poll(ctx)
+			if err == nil {
+				backoff = time.Second
+				sleep(ctx, s.pollInterval)
+				continue
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		log.Printf("⚠️ Incremental LDAP sync interrupted: %v (retrying in %s)", err, backoff)
+		sleep(ctx, backoff)
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+// Reset drops the stored cookie and high-water mark.
+func (s *Incremental) Reset(ctx context.Context) error {
+	return s.state.Reset(ctx, stateName)
+}
+
+func (s *Incremental) runSyncrepl(ctx context.Context) error {
+	st, err := s.state.Get(ctx, stateName)
+	if err != nil {
+		return err
+	}
+
+	r := s.newRefresh()
+	err = s.ldap.Syncrepl(ctx, st.Cookie, func(ev ldapauth.SyncEvent) error {
+		return r.handle(ctx, ev)
+	})
+	if errors.Is(err, ldapauth.ErrSyncRefreshRequired) {
+		log.Println("⚠️ Sync cookie rejected by server, starting a full refresh")
+		return s.state.SaveCookie(ctx, stateName, nil)
+	}
+	return err
+}
+
+// refresh applies the events of one syncrepl search. Entries reported during
+// the refresh phase are remembered, since a present phase only tells which
+// entries still exist. The cookie is held back until the refresh phase is
+// over and every deletion is applied, so an interrupted search starts over.
+type refresh struct {
+	*Incremental
+	uuids   map[string]bool
+	dns     map[string]bool
+	done    bool
+	pending []byte
+}
+
+func (s *Incremental) newRefresh() *refresh {
+	return &refresh{Incremental: s, uuids: make(map[string]bool), dns: make(map[string]bool)}
+}
+
+func (r *refresh) handle(ctx context.Context, ev ldapauth.SyncEvent) error {
+	switch {
+	case ev.User != nil:
+		if ev.State == ldapauth.SyncDelete {
+			if err := r.remove(ctx, ev.User); err != nil {
+				return err
+			}
+			break
+		}
+		r.see(ev.User.EntryUUID, ev.User.DN)
+		if err := r.applyEvent(ctx, ev); err != nil {
+			// A bad entry must not stall the stream, the full sync will report it
+			log.Printf("⚠️ Sync %s %s failed: %v", ev.State, ev.User.DN, err)
+		}
+	case len(ev.UUIDs) > 0 && ev.State == ldapauth.SyncDelete:
+		n, err := r.repo.SetStatusByEntryUUIDs(ctx, r.pool, ev.UUIDs, employees.StatusRemoved)
+		if err != nil {
+			return fmt.Errorf("failed to remove deleted entries: %w", err)
+		}
+		if n > 0 {
+			log.Printf("🔄 Sync removed %d employee(s) of deleted entries", n)
+		}
+	case len(ev.UUIDs) > 0:
+		for _, id := range ev.UUIDs {
+			r.see(id, "")
+		}
+	}
+
+	if ev.PresentDone {
+		if err := r.removeUnseen(ctx); err != nil {
+			return err
+		}
+	}
+	if ev.RefreshDone {
+		r.done = true
+	}
+
+	if len(ev.Cookie) > 0 {
+		r.pending = ev.Cookie
+	}
+	if r.done && r.pending != nil {
+		if err := r.state.SaveCookie(ctx, stateName, r.pending); err != nil {
+			return fmt.Errorf("failed to save sync cookie: %w", err)
+		}
+		r.pending = nil
+	}
+	return nil
+}
+
+func (r *refresh) see(entryUUID, dn string) {
+	if r.done {
+		return
+	}
+	if entryUUID != "" {
+		r.uuids[entryUUID] = true
+	}
+	if dn != "" {
+		r.dns[dn] = true
+	}
+}
+
+func (r *refresh) remove(ctx context.Context, u *ldapauth.User) error {
+	var n int64
+	var err error
+	if u.EntryUUID != "" {
+		n, err = r.repo.SetStatusByEntryUUIDs(ctx, r.pool, []string{u.EntryUUID}, employees.StatusRemoved)
+	}
+	if err == nil && n == 0 && u.DN != "" {
+		n, err = r.repo.SetStatusByDN(ctx, r.pool, u.DN, employees.StatusRemoved)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove %s: %w", u.DN, err)
+	}
+	if n > 0 {
+		log.Printf("🔄 Sync remove %s", u.DN)
+	}
+	return nil
+}
+
+// removeUnseen ends a present phase by removing the employees of every entry
+// it didn't report.
+func (r *refresh) removeUnseen(ctx context.Context) error {
+	if len(r.uuids) == 0 && len(r.dns) == 0 {
+		// A wrong base DN or filter would otherwise mark every employee as removed
+		return fmt.Errorf("present phase reported no entries, refusing to remove employees")
+	}
+
+	n, err := r.repo.RemoveUnseen(ctx, r.pool, keys(r.uuids), keys(r.dns))
+	if err != nil {
+		return fmt.Errorf("failed to remove employees of deleted entries: %w", err)
+	}
+	if n > 0 {
+		log.Printf("🔄 Sync removed %d employee(s) missing from the directory", n)
+	}
+	r.uuids = make(map[string]bool)
+	r.dns = make(map[string]bool)
+	return nil
+}
+
+func (s *Incremental) applyEvent(ctx context.Context, ev ldapauth.SyncEvent) error {
+	switch ev.State {
+	case ldapauth.SyncAdd, ldapauth.SyncModify:
+		if err := s.upsert(ctx, ev.User); err != nil {
+			return err
+		}
+		log.Printf("🔄 Sync %s %s (%s)", ev.State, ev.User.UID, statusOf(ev.User))
+	}
+	return nil
+}
+
+// Poll fetches everything modified since the stored high-water mark once.
+func (s *Incremental) Poll(ctx context.Context) error {
+	st, err := s.state.Get(ctx, stateName)
+	if err != nil {
+		return err
+	}
+
+	var since time.Time
+	if st.HighWater != nil {
+		since = *st.HighWater
+	}
+
+	users, highWater, err := s.ldap.ListUsersModifiedSince(since)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		if err := s.upsert(ctx, u); err != nil {
+			log.Printf("⚠️ Sync update %s failed: %v", u.DN, err)
+		}
+	}
+
+	// modifyTimestamp has second precision, so entries at the mark are fetched
+	// again on the next poll; upserting them twice is harmless
+	if highWater.After(since) {
+		log.Printf("🔄 Sync applied %d change(s) up to %s", len(users), highWater.Format(time.RFC3339))
+		return s.state.SaveHighWater(ctx, stateName, highWater)
+	}
+	return nil
+}
+
+func (s *Incremental) upsert(ctx context.Context, u *ldapauth.User) error {
+	if u.UID == "" || u.Email == "" {
+		return fmt.Errorf("entry has no uid or mail")
+	}
+	return s.repo.Upsert(ctx, s.pool, employees.Employee{
+		UID:       u.UID,
+		Name:      u.Name,
+		Email:     u.Email,
+		DN:        u.DN,
+		EntryUUID: u.EntryUUID,
+		Status:    statusOf(u),
+	})
+}
+
+func keys(set map[string]bool) []string {
+	list := make([]string, 0, len(set))
+	for k := range set {
+		list = append(list, k)
+	}
+	return list
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
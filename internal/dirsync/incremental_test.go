@@ -0,0 +1,125 @@
+package dirsync
+
+import (
+	"context"
+	"go-ldap-sso/db/dbtest"
+	"go-ldap-sso/db/employees"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"testing"
+)
+
+const (
+	aliceUUID = "0b1c6e2a-4a8e-4d3b-9a51-0f5e0d7f3c11"
+	bobUUID   = "5d2a9c4e-8f61-4b7a-a2c3-6e1f0b9d4a22"
+	carolUUID = "9e3f1a6b-2c7d-4e8f-b1a0-7d4c2e5f6a33"
+)
+
+// newTestIncremental returns an Incremental over the test database holding
+// the active employees alice, bob and carol.
+func newTestIncremental(t *testing.T) *Incremental {
+	t.Helper()
+	database := dbtest.Open(t)
+	s := NewIncremental(nil, database.Pool, 0)
+	for uid, id := range map[string]string{"alice": aliceUUID, "bob": bobUUID, "carol": carolUUID} {
+		err := s.repo.Upsert(context.Background(), database.Pool, employees.Employee{
+			UID: uid, Name: uid, Email: uid + "@example.org", DN: "uid=" + uid + ",dc=example",
+			EntryUUID: id, Status: employees.StatusActive,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func checkStatus(t *testing.T, s *Incremental, want map[string]string) {
+	t.Helper()
+	for uid, status := range want {
+		e, err := s.repo.Find(context.Background(), uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Status != status {
+			t.Errorf("%s status = %s, want %s", uid, e.Status, status)
+		}
+	}
+}
+
+func checkCookie(t *testing.T, s *Incremental, want string) {
+	t.Helper()
+	st, err := s.state.Get(context.Background(), stateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(st.Cookie) != want {
+		t.Errorf("saved cookie = %q, want %q", st.Cookie, want)
+	}
+}
+
+func TestSyncreplPresentPhase(t *testing.T) {
+	s := newTestIncremental(t)
+	ctx := context.Background()
+	r := s.newRefresh()
+
+	events := []ldapauth.SyncEvent{
+		{State: ldapauth.SyncPresent, User: &ldapauth.User{DN: "uid=alice,dc=example", EntryUUID: aliceUUID}, Cookie: []byte("c1")},
+		{State: ldapauth.SyncPresent, UUIDs: []string{bobUUID}},
+	}
+	for _, ev := range events {
+		if err := r.handle(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Held back until the phase is over, a restart must see every entry again
+	checkCookie(t, s, "")
+
+	if err := r.handle(ctx, ldapauth.SyncEvent{PresentDone: true, RefreshDone: true, Cookie: []byte("c2")}); err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, s, map[string]string{
+		"alice": employees.StatusActive,
+		"bob":   employees.StatusActive,
+		"carol": employees.StatusRemoved,
+	})
+	checkCookie(t, s, "c2")
+
+	// Live changes advance the cookie right away
+	if err := r.handle(ctx, ldapauth.SyncEvent{Cookie: []byte("c3")}); err != nil {
+		t.Fatal(err)
+	}
+	checkCookie(t, s, "c3")
+}
+
+func TestSyncreplDeletes(t *testing.T) {
+	s := newTestIncremental(t)
+	ctx := context.Background()
+	r := s.newRefresh()
+
+	events := []ldapauth.SyncEvent{
+		{State: ldapauth.SyncDelete, UUIDs: []string{bobUUID}},
+		{RefreshDone: true, Cookie: []byte("c1")},
+		{State: ldapauth.SyncDelete, User: &ldapauth.User{EntryUUID: carolUUID}, Cookie: []byte("c2")},
+	}
+	for _, ev := range events {
+		if err := r.handle(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkStatus(t, s, map[string]string{
+		"alice": employees.StatusActive,
+		"bob":   employees.StatusRemoved,
+		"carol": employees.StatusRemoved,
+	})
+	checkCookie(t, s, "c2")
+}
+
+func TestSyncreplEmptyPresentPhase(t *testing.T) {
+	s := newTestIncremental(t)
+	r := s.newRefresh()
+
+	if err := r.handle(context.Background(), ldapauth.SyncEvent{PresentDone: true, RefreshDone: true, Cookie: []byte("c1")}); err == nil {
+		t.Error("present phase without entries accepted")
+	}
+	checkStatus(t, s, map[string]string{"carol": employees.StatusActive})
+	checkCookie(t, s, "")
+}
@@ -0,0 +1,260 @@
+package dirsync
+
+import (
+	"context"
+	"fmt"
+	"go-ldap-sso/db/employees"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	ActionCreate     = "create"
+	ActionUpdate     = "update"
+	ActionDisable    = "disable"
+	ActionReactivate = "reactivate"
+	ActionRemove     = "remove"
+)
+
+// Change is one row of the sync diff.
+type Change struct {
+	UID    string
+	Action string
+	// Fields lists the columns that differ for updates
+	Fields []string
+	Err    error
+}
+
+type Summary struct {
+	DryRun    bool
+	Changes   []Change
+	Unchanged int
+	Skipped   []Change
+	Duration  time.Duration
+}
+
+func (s *Summary) Count(action string) int {
+	n := 0
+	for _, c := range s.Changes {
+		if c.Action == action && c.Err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Summary) Failed() int {
+	n := 0
+	for _, c := range s.Changes {
+		if c.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Summary) String() string {
+	return fmt.Sprintf("created=%d updated=%d disabled=%d reactivated=%d removed=%d unchanged=%d skipped=%d failed=%d",
+		s.Count(ActionCreate), s.Count(ActionUpdate), s.Count(ActionDisable), s.Count(ActionReactivate),
+		s.Count(ActionRemove), s.Unchanged, len(s.Skipped), s.Failed())
+}
+
+// Syncer mirrors LDAP users into the employees table, keyed by uid.
+type Syncer struct {
+	ldap *ldapauth.LDAPClient
+	repo *employees.Repository
+}
+
+func NewSyncer(ldapClient *ldapauth.LDAPClient, repo *employees.Repository) *Syncer {
+	return &Syncer{ldap: ldapClient, repo: repo}
+}
+
+// Run computes the diff between LDAP and employees and applies it unless dryRun is set.
+func (s *Syncer) Run(ctx context.Context, dryRun bool) (*Summary, error) {
+	start := time.Now()
+
+	users, err := s.ldap.ListUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list LDAP users: %w", err)
+	}
+	if len(users) == 0 {
+		// A wrong base DN or filter would otherwise mark every employee as removed
+		return nil, fmt.Errorf("LDAP returned no users, refusing to sync")
+	}
+
+	existing, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := Diff(users, existing)
+	summary.DryRun = dryRun
+
+	if !dryRun {
+		if err := s.apply(ctx, users, summary); err != nil {
+			return nil, err
+		}
+	}
+
+	summary.Duration = time.Since(start)
+	return summary, nil
+}
+
+// Diff compares directory users with employee rows without touching the database.
+func Diff(users []*ldapauth.User, existing []employees.Employee) *Summary {
+	summary := &Summary{}
+
+	byUID := make(map[string]employees.Employee, len(existing))
+	for _, e := range existing {
+		byUID[e.UID] = e
+	}
+
+	seen := make(map[string]bool, len(users))
+	for _, u := range users {
+		if u.UID != "" {
+			// Seen even when skipped, a mail removed in LDAP must not mark
+			// the employee removed
+			seen[u.UID] = true
+		}
+		if u.UID == "" || u.Email == "" {
+			action := ActionCreate
+			if _, ok := byUID[u.UID]; ok {
+				action = ActionUpdate
+			}
+			summary.Skipped = append(summary.Skipped, Change{
+				UID: u.DN, Action: action, Err: fmt.Errorf("entry has no uid or mail"),
+			})
+			continue
+		}
+
+		e, ok := byUID[u.UID]
+		if !ok {
+			summary.Changes = append(summary.Changes, Change{UID: u.UID, Action: ActionCreate})
+			continue
+		}
+
+		var fields []string
+		if e.Name != u.Name {
+			fields = append(fields, "name")
+		}
+		if !strings.EqualFold(e.Email, u.Email) {
+			fields = append(fields, "email")
+		}
+		if e.DN != u.DN {
+			fields = append(fields, "dn")
+		}
+
+		status := statusOf(u)
+		switch {
+		case status != e.Status && status == employees.StatusDisabled:
+			summary.Changes = append(summary.Changes, Change{UID: u.UID, Action: ActionDisable, Fields: fields})
+		case status != e.Status:
+			summary.Changes = append(summary.Changes, Change{UID: u.UID, Action: ActionReactivate, Fields: fields})
+		case len(fields) > 0:
+			summary.Changes = append(summary.Changes, Change{UID: u.UID, Action: ActionUpdate, Fields: fields})
+		default:
+			summary.Unchanged++
+		}
+	}
+
+	for _, e := range existing {
+		if !seen[e.UID] && e.Status != employees.StatusRemoved {
+			summary.Changes = append(summary.Changes, Change{UID: e.UID, Action: ActionRemove})
+		}
+	}
+
+	return summary
+}
+
+func (s *Syncer) apply(ctx context.Context, users []*ldapauth.User, summary *Summary) error {
+	byUID := make(map[string]*ldapauth.User, len(users))
+	for _, u := range users {
+		byUID[u.UID] = u
+	}
+
+	tx, err := s.repo.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for i := range summary.Changes {
+		c := &summary.Changes[i]
+		// Savepoint per row so one conflicting email doesn't abort the whole sync
+		c.Err = withSavepoint(ctx, tx, func(sp pgx.Tx) error {
+			if c.Action == ActionRemove {
+				return s.repo.SetStatus(ctx, sp, c.UID, employees.StatusRemoved)
+			}
+			u := byUID[c.UID]
+			return s.repo.Upsert(ctx, sp, employees.Employee{
+				UID:    u.UID,
+				Name:   u.Name,
+				Email:  u.Email,
+				DN:     u.DN,
+				Status: statusOf(u),
+			})
+		})
+		if c.Err != nil {
+			log.Printf("⚠️ Sync %s %s failed: %v", c.Action, c.UID, c.Err)
+		}
+	}
+
+	uids := make([]string, 0, len(users))
+	for _, u := range users {
+		if u.UID != "" {
+			uids = append(uids, u.UID)
+		}
+	}
+	if err := s.repo.Touch(ctx, tx, uids); err != nil {
+		return fmt.Errorf("failed to update synced_at: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit sync: %w", err)
+	}
+	return nil
+}
+
+func withSavepoint(ctx context.Context, tx pgx.Tx, fn func(pgx.Tx) error) error {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err := fn(sp); err != nil {
+		sp.Rollback(ctx)
+		return err
+	}
+	return sp.Commit(ctx)
+}
+
+func statusOf(u *ldapauth.User) string {
+	if u.Disabled {
+		return employees.StatusDisabled
+	}
+	return employees.StatusActive
+}
+
+// RunEvery runs a sync on every tick until ctx is cancelled. Errors are only
+// logged so a directory outage doesn't stop the job.
+func (s *Syncer) RunEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			summary, err := s.Run(ctx, false)
+			if err != nil {
+				log.Printf("⚠️ LDAP sync failed: %v", err)
+				continue
+			}
+			log.Printf("🔄 LDAP sync done in %s: %s", summary.Duration.Round(time.Millisecond), summary)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package dirsync
+
+import (
+	"go-ldap-sso/db/employees"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	existing := []employees.Employee{
+		{UID: "alice", Name: "Alice", Email: "alice@example.org", DN: "uid=alice,dc=example", Status: employees.StatusActive},
+		{UID: "bob", Name: "Bob", Email: "bob@example.org", DN: "uid=bob,dc=example", Status: employees.StatusActive},
+		{UID: "carol", Name: "Carol", Email: "carol@example.org", DN: "uid=carol,dc=example", Status: employees.StatusActive},
+		{UID: "dave", Name: "Dave", Email: "dave@example.org", DN: "uid=dave,dc=example", Status: employees.StatusRemoved},
+	}
+	users := []*ldapauth.User{
+		{UID: "alice", Name: "Alice", Email: "alice@example.org", DN: "uid=alice,dc=example"},
+		// mail removed in LDAP: skipped, but still present
+		{UID: "bob", Name: "Bob", DN: "uid=bob,dc=example"},
+		{UID: "erin", Name: "Erin", Email: "erin@example.org", DN: "uid=erin,dc=example"},
+		{Name: "No UID", Email: "nouid@example.org", DN: "cn=nouid,dc=example"},
+	}
+
+	summary := Diff(users, existing)
+
+	want := map[string]string{"erin": ActionCreate, "carol": ActionRemove}
+	if len(summary.Changes) != len(want) {
+		t.Fatalf("Diff() changes = %+v, want %v", summary.Changes, want)
+	}
+	for _, c := range summary.Changes {
+		if want[c.UID] != c.Action {
+			t.Errorf("Diff() change %s %s, want %q", c.Action, c.UID, want[c.UID])
+		}
+	}
+	if summary.Unchanged != 1 {
+		t.Errorf("Diff() unchanged = %d, want 1", summary.Unchanged)
+	}
+	if len(summary.Skipped) != 2 {
+		t.Fatalf("Diff() skipped = %+v, want bob and the entry without uid", summary.Skipped)
+	}
+	if summary.Skipped[0].Action != ActionUpdate || summary.Skipped[1].Action != ActionCreate {
+		t.Errorf("Diff() skipped actions = %s, %s, want update, create", summary.Skipped[0].Action, summary.Skipped[1].Action)
+	}
+}
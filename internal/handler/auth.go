@@ -10,30 +10,83 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"go-ldap-sso/config"
 	"go-ldap-sso/db"
+	"go-ldap-sso/db/authsessions"
+	"go-ldap-sso/db/breakglass"
+	"go-ldap-sso/db/emaillogin"
+	"go-ldap-sso/db/employees"
+	mfadb "go-ldap-sso/db/mfa"
+	"go-ldap-sso/db/passkeys"
+	"go-ldap-sso/db/passwordreset"
+	"go-ldap-sso/db/policies"
+	"go-ldap-sso/db/relationtuples"
+	"go-ldap-sso/db/roles"
+	"go-ldap-sso/db/scoperequests"
+	"go-ldap-sso/db/scopes"
 	"go-ldap-sso/internal/auth"
+	"go-ldap-sso/internal/directory"
 	"go-ldap-sso/internal/helper"
 	ldapauth "go-ldap-sso/internal/ldap"
-	"io"
+	"go-ldap-sso/internal/mail"
+	"go-ldap-sso/internal/mfa"
+	"go-ldap-sso/internal/policy"
+	"go-ldap-sso/internal/rebac"
+	"go-ldap-sso/internal/session"
+	"go-ldap-sso/internal/webhook"
+	"go-ldap-sso/pkg/authz"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/crewjam/saml"
 	"github.com/crewjam/saml/samlsp"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gorilla/sessions"
 )
 
 type AuthHandler struct {
-	cfg        *config.Config
-	samlSP     *samlsp.Middleware
-	store      sessions.Store
-	ldapClient *ldapauth.LDAPClient
-	db         *db.Database
+	cfg         *config.Config
+	samlSP      *samlsp.Middleware
+	store       sessions.Store
+	ldapClient  *ldapauth.LDAPClient
+	db          *db.Database
+	mailer      mail.Sender
+	resetTokens *passwordreset.Repository
+	directory   *directory.Service
+	scopes      *scopes.Repository
+	employees   *employees.Repository
+	// scopeRequests backs the request/approve workflow for direct scope grants
+	scopeRequests *scoperequests.Repository
+	roles         *roles.Repository
+	elevations    *breakglass.Repository
+	notifier      webhook.Notifier
+	policies      *policy.Engine
+	policyStore   *policies.Repository
+	// relations answers relationship checks over relationTuples
+	relations      *rebac.Checker
+	relationTuples *relationtuples.Repository
+	// loginSessions holds the rows behind store
+	loginSessions *authsessions.Repository
+	// mfaStore keeps TOTP enrollments, recovery codes and login challenges,
+	// TOTP secrets sealed with mfaCipher
+	mfaStore  *mfadb.Repository
+	mfaCipher *mfa.Cipher
+	// webAuthn runs passkey ceremonies for credentials kept in passkeys
+	webAuthn *webauthn.WebAuthn
+	passkeys *passkeys.Repository
+	// emailLogins keeps the mailed codes and links of email logins
+	emailLogins *emaillogin.Repository
+	// mailing counts the mails still being sent after their response
+	mailing sync.WaitGroup
 }
 
 type LoginReq struct {
@@ -42,19 +95,94 @@ type LoginReq struct {
 }
 
 type LoginRes struct {
-	Token string `json:"token"`
+	Token           string              `json:"token,omitempty"`
+	PasswordWarning *PasswordWarningRes `json:"password_warning,omitempty"`
+	// Instead of a token, a login needing a second factor gets MFAToken to
+	// send with a code to /ldap-login/mfa, or with a passkey assertion to
+	// /ldap-login/mfa/webauthn. MFAMethods lists the factors set up. Without
+	// any yet, MFAEnrollmentRequired asks to enroll an authenticator first.
+	MFARequired           bool     `json:"mfa_required,omitempty"`
+	MFAEnrollmentRequired bool     `json:"mfa_enrollment_required,omitempty"`
+	MFAToken              string   `json:"mfa_token,omitempty"`
+	MFAMethods            []string `json:"mfa_methods,omitempty"`
+	// RecoveryCodes are shown once, after enrolling during login
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type PasswordWarningRes struct {
+	ExpiresInSeconds     *int64 `json:"expires_in_seconds,omitempty"`
+	GraceLoginsRemaining *int64 `json:"grace_logins_remaining,omitempty"`
+}
+
+// ldapErrors maps typed LDAP failures to the status and message returned
+// to the browser; the raw directory error is only logged.
+var ldapErrors = map[ldapauth.AuthErrorCode]struct {
+	status  int
+	message string
+}{
+	ldapauth.CodeInvalidCredentials:   {http.StatusUnauthorized, "invalid username or password"},
+	ldapauth.CodeAccountLocked:        {http.StatusForbidden, "account is locked, contact your administrator"},
+	ldapauth.CodeAccountDisabled:      {http.StatusForbidden, "account is disabled"},
+	ldapauth.CodePasswordExpired:      {http.StatusForbidden, "password has expired"},
+	ldapauth.CodePasswordMustChange:   {http.StatusForbidden, "password must be changed before logging in"},
+	ldapauth.CodeDirectoryUnavailable: {http.StatusServiceUnavailable, "directory service unavailable, try again later"},
+	ldapauth.CodePasswordRejected:     {http.StatusUnprocessableEntity, "new password does not meet the password policy"},
+}
+
+func writeLDAPError(w http.ResponseWriter, err error) {
+	var open *ldapauth.CircuitOpenError
+	if errors.As(err, &open) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(open.RetryAfter.Seconds()))))
+	}
+
+	code := ldapauth.AuthErrorCodeOf(err)
+	e, ok := ldapErrors[code]
+	if !ok {
+		e = ldapErrors[ldapauth.CodeDirectoryUnavailable]
+	}
+	writeError(w, e.status, string(code), e.message)
+}
+
+func newPasswordWarningRes(warning *ldapauth.PasswordWarning) *PasswordWarningRes {
+	if warning == nil {
+		return nil
+	}
+	res := &PasswordWarningRes{}
+	if warning.ExpiresInSeconds >= 0 {
+		res.ExpiresInSeconds = &warning.ExpiresInSeconds
+	}
+	if warning.GraceLoginsRemaining >= 0 {
+		res.GraceLoginsRemaining = &warning.GraceLoginsRemaining
+	}
+	return res
 }
 
 func NewAuthHandler(cfg *config.Config, db *db.Database) (*AuthHandler, error) {
-	// 1️⃣ Session store with secret from config (rotate via env/config)
-	store := sessions.NewCookieStore([]byte("cfg.AuthConfig.SessionSecret"))
-	store.Options = &sessions.Options{
-		Path:     "/",
-		MaxAge:   int(1 * time.Hour.Seconds()),
-		HttpOnly: true,
-		Secure:   false, // for localhost/http
-		SameSite: http.SameSiteLaxMode,
+	// 1️⃣ Session store in Postgres, the cookie only carries the signed and
+	// encrypted id. Previous keys keep old cookies valid during a rotation.
+	keyPairs, err := session.KeyPairs(&cfg.AuthConfig, cfg.IsDevelopment())
+	if err != nil {
+		return nil, fmt.Errorf("session keys: %w", err)
+	}
+	mfaCipher, err := newMFACipher(cfg)
+	if err != nil {
+		return nil, err
+	}
+	webAuthn, err := newWebAuthn(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: %w", err)
 	}
+	mailer, err := mail.NewSender(&cfg.MailConfig, cfg.IsDevelopment())
+	if err != nil {
+		return nil, fmt.Errorf("mail: %w", err)
+	}
+	loginSessions := authsessions.NewRepository(db.Pool)
+	store := session.NewStore(loginSessions,
+		time.Duration(cfg.AuthConfig.SessionIdleMinutes)*time.Minute,
+		time.Duration(cfg.AuthConfig.SessionAbsoluteHours)*time.Hour,
+		keyPairs...,
+	)
+	store.Options.Secure = false // for localhost/http
 
 	// 2️⃣ Initialize SAML SP (with Secure=false for local dev)
 	samlSP, err := setupSAML(cfg)
@@ -81,13 +209,54 @@ func NewAuthHandler(cfg *config.Config, db *db.Database) (*AuthHandler, error) {
 		}
 	}()
 
-	return &AuthHandler{
-		cfg:        cfg,
-		samlSP:     samlSP,
-		store:      store,
-		ldapClient: ldapClient,
-		db:         db,
-	}, nil
+	engine, err := policy.NewEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	relationSchema, err := rebac.LoadSchema(cfg.AuthConfig.RelationSchemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("relation schema: %w", err)
+	}
+	relationTuples := relationtuples.NewRepository(db.Pool)
+
+	h := &AuthHandler{
+		cfg:            cfg,
+		samlSP:         samlSP,
+		store:          store,
+		ldapClient:     ldapClient,
+		db:             db,
+		mailer:         mailer,
+		resetTokens:    passwordreset.NewRepository(db.Pool),
+		directory:      directory.NewService(ldapClient, time.Duration(cfg.LDAPConfig.DirectoryCacheSeconds)*time.Second),
+		scopes:         scopes.NewRepository(db.Pool),
+		employees:      employees.NewRepository(db.Pool),
+		scopeRequests:  scoperequests.NewRepository(db.Pool),
+		roles:          roles.NewRepository(db.Pool),
+		elevations:     breakglass.NewRepository(db.Pool),
+		notifier:       webhook.NewNotifier(cfg.AuthConfig.SecurityWebhookURL),
+		policies:       engine,
+		policyStore:    policies.NewRepository(db.Pool),
+		relations:      rebac.NewChecker(relationSchema, relationTuples),
+		relationTuples: relationTuples,
+		loginSessions:  loginSessions,
+		mfaStore:       mfadb.NewRepository(db.Pool),
+		mfaCipher:      mfaCipher,
+		webAuthn:       webAuthn,
+		passkeys:       passkeys.NewRepository(db.Pool),
+		emailLogins:    emaillogin.NewRepository(db.Pool),
+	}
+	samlSP.Session = samlSessionProvider{SessionProvider: samlSP.Session, h: h}
+	samlSP.OnError = samlError
+
+	if err := h.reloadPolicies(context.Background()); err != nil {
+		log.Printf("⚠️ Failed to load authorization policies: %v", err)
+	}
+	go h.watchPolicies()
+	go h.cleanupSessions()
+	go h.retryElevationNotifications()
+
+	return h, nil
 }
 
 func setupSAML(cfg *config.Config) (*samlsp.Middleware, error) {
@@ -185,70 +354,77 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) HandleLDAPLogin(w http.ResponseWriter, r *http.Request) {
-	// Baca dan log isi body sekali
-	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "unable to read request body", http.StatusBadRequest)
-		return
-	}
-	log.Println("📥 Raw Request Body:", string(bodyBytes))
-
-	// Restore ulang body agar bisa dipakai untuk decode
-	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
 	// Decode ke struct
 	var req LoginReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
 		return
 	}
 
 	ctx := context.Background()
 
 	// Authenticate
-	email, err := h.ldapClient.Authenticate(req.Username, req.Password)
+	result, err := h.ldapClient.AuthenticateUser(req.Username, req.Password)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		log.Printf("❌ LDAP login failed for %q: %v", req.Username, err)
+		writeLDAPError(w, err)
 		return
 	}
+	email := result.Email
 
-	// Query employee ID
-	var employeeID int
-	err = h.db.Pool.QueryRow(ctx, `SELECT id FROM employees WHERE email = $1`, email).Scan(&employeeID)
+	employee, err := h.employees.FindActive(ctx, email)
 	if err != nil {
-		http.Error(w, "employee not found", http.StatusUnauthorized)
+		if !errors.Is(err, employees.ErrNotFound) {
+			log.Printf("❌ Failed to look up employee %s: %v", email, err)
+		}
+		writeError(w, http.StatusUnauthorized, "employee_not_found", "employee not found")
 		return
 	}
 
-	// Fetch scopes
-	rows, err := h.db.Pool.Query(ctx, `
-		SELECT s.name FROM scopes s
-		JOIN employee_scopes es ON es.scope_id = s.id
-		WHERE es.employee_id = $1`, employeeID)
-	if err != nil {
-		http.Error(w, "failed to fetch scopes", http.StatusInternalServerError)
+	res := LoginRes{PasswordWarning: newPasswordWarningRes(result.Warning)}
+
+	// Second factor first, if enrolled or required by a scope held
+	if h.beginMFA(w, r, employee, res) {
 		return
 	}
-	defer rows.Close()
+	h.completeLogin(w, r, employee, authz.MethodLDAP, []string{authz.AMRPassword}, res)
+}
 
-	var scopeNames []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			http.Error(w, "error reading scopes", http.StatusInternalServerError)
-			return
-		}
-		scopeNames = append(scopeNames, name)
-	}
+// tokenClaims returns the claims of a token for employee: their scopes, and a
+// lifetime no longer than a time-bound grant they carry. It answers the
+// request and returns false on failure.
+func (h *AuthHandler) tokenClaims(w http.ResponseWriter, r *http.Request, employee *employees.Employee) (auth.TokenClaims, bool) {
+	ctx := r.Context()
+	email := employee.Email
 
-	// Generate token
-	token, err := auth.GenerateToken(email, scopeNames, h.cfg)
+	// Fetch scopes, direct grants plus those of the employee's roles
+	scopeNames, err := h.tokenScopes(ctx, employee.ID)
 	if err != nil {
-		http.Error(w, "token generation error", http.StatusInternalServerError)
-		return
+		log.Printf("❌ Failed to fetch scopes for %s: %v", email, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to fetch scopes")
+		return auth.TokenClaims{}, false
 	}
 
-	// Set JWT token as HttpOnly cookie
+	// The token must not outlive a time-bound grant it carries
+	grantTTL, err := h.scopes.GrantTTL(ctx, employee.ID)
+	if err != nil {
+		log.Printf("❌ Failed to fetch grant expiry for %s: %v", email, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to fetch scopes")
+		return auth.TokenClaims{}, false
+	}
+
+	return auth.TokenClaims{
+		Subject:    email,
+		Name:       employee.Name,
+		EmployeeID: employee.ID,
+		Scopes:     scopeNames,
+		ExpiresIn:  grantTTL,
+	}, true
+}
+
+// setTokenCookie hands token to the browser as the HttpOnly ldap_token
+// cookie.
+func setTokenCookie(w http.ResponseWriter, token string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "ldap_token",
 		Value:    token,
@@ -256,9 +432,43 @@ func (h *AuthHandler) HandleLDAPLogin(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,
 		MaxAge:   int(time.Hour.Seconds()), // 1 jam
 	})
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(LoginRes{Token: token})
+// completeLogin issues the token of an employee authenticated by method with
+// the factors in amr, starting a session and setting the ldap_token cookie,
+// and answers with res.
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, employee *employees.Employee, method string, amr []string, res LoginRes) {
+	email := employee.Email
+	claims, ok := h.tokenClaims(w, r, employee)
+	if !ok {
+		return
+	}
+
+	sessionID, err := h.startSession(w, r, employee, method)
+	if errors.Is(err, authsessions.ErrLimitReached) {
+		writeError(w, http.StatusForbidden, "session_limit_reached", "too many active sessions, sign out on another device first")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to start session for %s: %v", email, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to start session")
+		return
+	}
+
+	// Generate token
+	claims.SessionID = sessionID
+	claims.AMR = amr
+	token, err := auth.GenerateToken(claims, h.cfg)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "token generation error")
+		return
+	}
+
+	// Set JWT token as HttpOnly cookie
+	setTokenCookie(w, token)
+
+	res.Token = token
+	writeJSON(w, http.StatusOK, res)
 }
 
 func (h *AuthHandler) HandleSSOLogin(w http.ResponseWriter, r *http.Request) {
@@ -375,15 +585,37 @@ func (h *AuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
 
 func (h *AuthHandler) HybridAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// 1) Try LDAP JWT
-		cookie, err := r.Cookie("ldap_token")
-		if err == nil && cookie.Value != "" {
-			email, scopes, err := auth.ValidateToken(cookie.Value, h.cfg)
+		// 1) Try LDAP JWT, from the Authorization header (services) or the cookie (browser)
+		token := bearerToken(r)
+		if cookie, err := r.Cookie("ldap_token"); token == "" && err == nil {
+			token = cookie.Value
+		}
+		if token != "" {
+			var loginSession *authsessions.Session
+			claims, err := auth.ValidateToken(token, h.cfg)
+			if err == nil {
+				// The token only lasts as long as its login session
+				loginSession, err = h.loginSessions.Touch(r.Context(), claims.SessionID, h.sessionIdle())
+				if errors.Is(err, authsessions.ErrRevoked) {
+					h.rejectRevoked(w, r)
+					return
+				}
+			}
 			if err == nil {
-				// ✅ Token valid → inject context dan lanjut
-				log.Printf("🔐 LDAP Authenticated: %s, scopes: %v\n", email, scopes)
-				ctx := context.WithValue(r.Context(), "email", email)
-				ctx = context.WithValue(ctx, "userScopes", scopes)
+				// ✅ Token valid → inject principal dan lanjut
+				log.Printf("🔐 LDAP Authenticated: %s, scopes: %v\n", claims.Subject, claims.Scopes)
+				ctx := authz.WithPrincipal(r.Context(), &authz.Principal{
+					Subject:    claims.Subject,
+					Email:      claims.Subject,
+					Name:       claims.Name,
+					EmployeeID: claims.EmployeeID,
+					Scopes:     claims.Scopes,
+					Method:     loginSession.Method,
+					AuthTime:   claims.AuthTime,
+					AMR:        claims.AMR,
+					SessionID:  claims.SessionID,
+					Elevated:   claims.Elevated,
+				})
 				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			} else {
@@ -392,62 +624,133 @@ func (h *AuthHandler) HybridAuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		// 2) If no valid LDAP, let SAML middleware handle
+		if _, err := h.store.Get(r, authSessionName); errors.Is(err, authsessions.ErrRevoked) {
+			h.rejectRevoked(w, r)
+			return
+		}
 		samlCookie, samlErr := r.Cookie("saml_token")
 		if samlErr == nil && samlCookie.Value != "" {
 			//saml token
-			h.samlSP.RequireAccount(next).ServeHTTP(w, r)
+			h.samlSP.RequireAccount(h.samlPrincipal(next)).ServeHTTP(w, r)
 			return
 		}
 
 		session := samlsp.SessionFromContext(r.Context())
 		if session != nil {
 			log.Println("🔐 SAML session detected", session)
-			next.ServeHTTP(w, r)
+			h.samlPrincipal(next).ServeHTTP(w, r)
 			return
 		}
 		http.Redirect(w, r, "/login", http.StatusFound)
 	})
 }
 
-func (h *AuthHandler) IndexHandler(w http.ResponseWriter, r *http.Request) {
-	// 🔍 Coba cek JWT (LDAP login)
-	if email := r.Context().Value("email"); email != nil {
-		scopes := r.Context().Value("userScopes")
-		w.Header().Set("Content-Type", "text/plain")
-		fmt.Fprintf(w, "✅ Logged in via LDAP JWT\n\n")
-		fmt.Fprintf(w, "Email: %s\nScopes: %v\n", email, scopes)
-		return
+// tokenScopes returns the scopes to put in an employee's token, plus extra,
+// expanded against the scope catalog so wildcard and write grants also list
+// the concrete scopes they cover.
+func (h *AuthHandler) tokenScopes(ctx context.Context, employeeID int, extra ...string) ([]string, error) {
+	granted, err := h.scopes.ForEmployee(ctx, employeeID)
+	if err != nil {
+		return nil, err
+	}
+	granted = append(granted, extra...)
+	catalog, err := h.scopes.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(catalog))
+	for _, s := range catalog {
+		names = append(names, s.Name)
 	}
 
-	// 🔐 Cek SAML session
-	session := samlsp.SessionFromContext(r.Context())
-	if session == nil {
-		// ❌ Tidak ada JWT, tidak ada SAML → redirect ke general login
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
+	expanded, invalid := authz.ExpandScopes(granted, names)
+	if len(invalid) > 0 {
+		log.Printf("⚠️ Ignoring invalid scopes for employee %d: %v", employeeID, invalid)
 	}
+	return expanded, nil
+}
+
+// samlPrincipal puts the SAML session's employee in the context as an
+// authz.Principal, with the same scopes an LDAP login would get. Unknown or
+// inactive employees get a principal without scopes; a session without
+// attributes is answered 401.
+func (h *AuthHandler) samlPrincipal(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		samlSession, ok := samlsp.SessionFromContext(r.Context()).(samlsp.SessionWithAttributes)
+		if !ok {
+			// Handlers behind this middleware rely on a principal, without
+			// attributes there is nobody to build one for
+			log.Printf("⚠️ SAML session without attributes: %T", samlsp.SessionFromContext(r.Context()))
+			writeError(w, http.StatusUnauthorized, "unauthenticated", "authentication required")
+			return
+		}
+
+		attrs := samlSession.GetAttributes()
+		email := attrs.Get("email")
+		principal := &authz.Principal{
+			Subject: email,
+			Email:   email,
+			Name:    attrs.Get("displayName"),
+			Method:  authz.MethodSAML,
+		}
+		if s := h.currentSession(r); s != nil {
+			principal.SessionID = s.ID
+		}
+		if claims, ok := samlSession.(samlsp.JWTSessionClaims); ok {
+			if claims.Subject != "" {
+				principal.Subject = claims.Subject
+			}
+			// The IdP doesn't tell which factors it checked, AMR stays
+			// empty
+			principal.AuthTime = time.Unix(claims.IssuedAt, 0)
+		}
 
-	// 🧠 Pastikan session bertipe SAML
-	samlSession, ok := session.(samlsp.SessionWithAttributes)
+		employee, err := h.employees.FindActive(r.Context(), email)
+		switch {
+		case err == nil:
+			principal.EmployeeID = employee.ID
+			if principal.Name == "" {
+				principal.Name = employee.Name
+			}
+			principal.Scopes, err = h.tokenScopes(r.Context(), employee.ID)
+			if err != nil {
+				log.Printf("❌ Failed to fetch scopes for %s: %v", email, err)
+				writeError(w, http.StatusInternalServerError, "internal_error", "failed to fetch scopes")
+				return
+			}
+		case errors.Is(err, employees.ErrNotFound):
+			log.Printf("⚠️ SAML user %q is not an active employee", email)
+		default:
+			log.Printf("❌ Failed to look up SAML user %q: %v", email, err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "failed to look up employee")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(authz.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+func (h *AuthHandler) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authz.FromContext(r.Context())
 	if !ok {
-		// ❌ Session ada tapi bukan session dengan atribut → redirect juga
+		// ❌ Tidak ada JWT, tidak ada SAML → redirect ke general login
 		http.Redirect(w, r, "/login", http.StatusFound)
 		return
 	}
 
-	// ✅ SAML valid → tampilkan info
-	attrs := samlSession.GetAttributes()
-	uid := attrs.Get("uid")
-	name := attrs.Get("displayName")
-	email := attrs.Get("email")
-
 	w.Header().Set("Content-Type", "text/plain")
-	fmt.Fprintf(w, "✅ Logged in via SAML\n\n")
-	fmt.Fprintf(w, "NameID: %s\nUID: %s\nEmail: %s\n\n", name, uid, email)
-
-	// Print all attributes
-	fmt.Fprintf(w, "All Attributes:\n")
-	for key, attr := range attrs {
-		fmt.Fprintf(w, "- %s: %v\n", key, attr)
-	}
+	fmt.Fprintf(w, "✅ Logged in via %s\n\n", strings.ToUpper(principal.Method))
+	fmt.Fprintf(w, "Subject: %s\nName: %s\nEmail: %s\nEmployee ID: %d\n", principal.Subject, principal.Name, principal.Email, principal.EmployeeID)
+	fmt.Fprintf(w, "Authenticated: %s %v\nSession: %s\n", principal.AuthTime.Format(time.RFC3339), principal.AMR, principal.SessionID)
+	fmt.Fprintf(w, "Scopes: %v\n", principal.Scopes)
+	fmt.Fprintf(w, "\nManage your sessions: /sessions\n")
+	fmt.Fprintf(w, "Second factor: /mfa\n")
 }
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-ldap-sso/db/employees"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"go-ldap-sso/internal/policy"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type CheckReq struct {
+	// Subject is the uid or email of the employee asking
+	Subject  string         `json:"subject"`
+	Action   string         `json:"action"`
+	Resource CheckResource  `json:"resource"`
+	Request  map[string]any `json:"request"`
+}
+
+type CheckResource struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+// reloadPolicies loads the policy files and the enabled policies from
+// Postgres into the engine. On error, including a single invalid policy, the
+// current set stays in place.
+func (h *AuthHandler) reloadPolicies(ctx context.Context) error {
+	list, err := policy.LoadDir(h.cfg.AuthConfig.PolicyDir)
+	if err != nil {
+		return err
+	}
+	stored, err := h.policyStore.ListEnabled(ctx)
+	if err != nil {
+		return err
+	}
+
+	n, err := h.policies.Load(append(list, stored...))
+	if err != nil {
+		return err
+	}
+	log.Printf("📜 Loaded %d authorization policies", n)
+	return nil
+}
+
+// watchPolicies reloads the policies every PolicyReloadSeconds.
+func (h *AuthHandler) watchPolicies() {
+	interval := time.Duration(h.cfg.AuthConfig.PolicyReloadSeconds) * time.Second
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := h.reloadPolicies(ctx); err != nil {
+			log.Printf("⚠️ Policy reload failed, keeping current policies: %v", err)
+		}
+		cancel()
+	}
+}
+
+// HandleAuthzCheck serves POST /authz/check, deciding whether subject may
+// perform action on resource according to the loaded policies.
+func (h *AuthHandler) HandleAuthzCheck(w http.ResponseWriter, r *http.Request) {
+	var req CheckReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	req.Subject = strings.TrimSpace(req.Subject)
+	if req.Subject == "" || req.Action == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "subject and action are required")
+		return
+	}
+
+	principal, err := h.policyPrincipal(r.Context(), req.Subject)
+	if errors.Is(err, employees.ErrNotFound) {
+		writeJSON(w, http.StatusOK, policy.Decision{Allowed: false, Reason: "unknown or inactive subject"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to load principal %q for policy check: %v", req.Subject, err)
+		writeError(w, http.StatusServiceUnavailable, "principal_unavailable", "failed to load subject attributes")
+		return
+	}
+
+	attributes := req.Resource.Attributes
+	if attributes == nil {
+		attributes = map[string]any{}
+	}
+	decision := h.policies.Check(policy.Input{
+		Principal: principal,
+		Action:    req.Action,
+		Resource: map[string]any{
+			"type":       req.Resource.Type,
+			"id":         req.Resource.ID,
+			"attributes": attributes,
+		},
+		Request: req.Request,
+	})
+	log.Printf("⚖️ authz check %s %s %s/%s: %v (%s)", req.Subject, req.Action, req.Resource.Type, req.Resource.ID, decision.Allowed, decision.Reason)
+	writeJSON(w, http.StatusOK, decision)
+}
+
+// policyPrincipal gathers what policies know about an employee: the
+// employees row, effective scopes and roles, and the configured LDAP
+// attributes.
+func (h *AuthHandler) policyPrincipal(ctx context.Context, subject string) (map[string]any, error) {
+	employee, err := h.employees.FindActive(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	scopeNames, err := h.tokenScopes(ctx, employee.ID)
+	if err != nil {
+		return nil, err
+	}
+	roleNames, err := h.roles.ForEmployee(ctx, employee.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := map[string]any{}
+	if names := h.cfg.AuthConfig.PolicyLDAPAttributes; len(names) > 0 {
+		values, err := h.ldapClient.UserAttributes(employee.UID, names)
+		if err != nil && !errors.Is(err, ldapauth.ErrUserNotFound) {
+			return nil, err
+		}
+		for name, v := range values {
+			attributes[name] = v
+		}
+	}
+
+	return map[string]any{
+		"subject":     subject,
+		"uid":         employee.UID,
+		"email":       employee.Email,
+		"name":        employee.Name,
+		"employee_id": employee.ID,
+		"dn":          employee.DN,
+		"scopes":      nonNil(scopeNames),
+		"roles":       nonNil(roleNames),
+		"attributes":  attributes,
+	}, nil
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-ldap-sso/db/breakglass"
+	"go-ldap-sso/db/roles"
+	"go-ldap-sso/internal/auth"
+	"go-ldap-sso/internal/helper"
+	"go-ldap-sso/internal/webhook"
+	"go-ldap-sso/pkg/authz"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// minJustificationLength keeps "x" from passing as a justification.
+const minJustificationLength = 10
+
+// Elevations security was not told about are sent again every
+// elevationNotifyRetry, once the first attempt had time to finish.
+const (
+	elevationNotifyRetry = time.Minute
+	elevationNotifyBatch = 50
+)
+
+type BreakGlassReq struct {
+	Justification string `json:"justification"`
+}
+
+type BreakGlassRes struct {
+	Token       string    `json:"token"`
+	Role        string    `json:"role"`
+	Scopes      []string  `json:"scopes"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	ElevationID int       `json:"elevation_id"`
+}
+
+// HandleBreakGlass serves POST /api/break-glass. Holders of the break-glass
+// scope get a short-lived token with the emergency role's scopes on top of
+// their own, marked elevated. The elevation is recorded before the token is
+// issued and security is notified through the webhook.
+func (h *AuthHandler) HandleBreakGlass(w http.ResponseWriter, r *http.Request) {
+	principal, ok := authz.FromContext(r.Context())
+	if !ok || principal.EmployeeID == 0 {
+		writeError(w, http.StatusForbidden, "not_employee", "only active employees can elevate")
+		return
+	}
+	if principal.Elevated {
+		// Otherwise an elevated token could keep renewing itself
+		writeError(w, http.StatusForbidden, "already_elevated", "log in with a regular token to elevate again")
+		return
+	}
+
+	var req BreakGlassReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	justification := strings.TrimSpace(req.Justification)
+	if len([]rune(justification)) < minJustificationLength {
+		writeError(w, http.StatusBadRequest, "invalid_request", "a justification of at least 10 characters is required")
+		return
+	}
+
+	ctx := r.Context()
+	role := h.cfg.AuthConfig.BreakGlassRole
+
+	roleScopes, err := h.roles.Scopes(ctx, role)
+	if errors.Is(err, roles.ErrNotFound) {
+		log.Printf("❌ Break-glass role %q does not exist", role)
+		writeError(w, http.StatusServiceUnavailable, "break_glass_unavailable", "break-glass role is not configured")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to fetch break-glass role scopes: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to fetch scopes")
+		return
+	}
+
+	scopeNames, err := h.tokenScopes(ctx, principal.EmployeeID, roleScopes...)
+	if err != nil {
+		log.Printf("❌ Failed to fetch scopes for %s: %v", principal.Email, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to fetch scopes")
+		return
+	}
+
+	ttl := time.Duration(h.cfg.AuthConfig.BreakGlassMinutes) * time.Minute
+	elevation := &breakglass.Elevation{
+		EmployeeID:    principal.EmployeeID,
+		RoleName:      role,
+		Justification: justification,
+		Scopes:        scopeNames,
+		SessionID:     principal.SessionID,
+		IPAddress:     helper.ClientIP(r),
+		UserAgent:     r.UserAgent(),
+		Email:         principal.Email,
+	}
+	if err := h.elevations.Record(ctx, elevation, ttl); err != nil {
+		log.Printf("❌ %v", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to record elevation")
+		return
+	}
+
+	token, err := auth.GenerateToken(auth.TokenClaims{
+		Subject:    principal.Email,
+		Name:       principal.Name,
+		EmployeeID: principal.EmployeeID,
+		Scopes:     scopeNames,
+		SessionID:  principal.SessionID,
+		Elevated:   true,
+		ExpiresIn:  ttl,
+		// An elevation doesn't make the login any more recent
+		AuthTime: principal.AuthTime,
+		AMR:      principal.AMR,
+	}, h.cfg)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "token generation error")
+		return
+	}
+
+	log.Printf("🚨 Break-glass: %s elevated to %s until %s: %s", principal.Email, role, elevation.ExpiresAt.Format(time.RFC3339), justification)
+	go h.notifyElevation(elevation)
+
+	writeJSON(w, http.StatusOK, BreakGlassRes{
+		Token:       token,
+		Role:        role,
+		Scopes:      scopeNames,
+		ExpiresAt:   elevation.ExpiresAt,
+		ElevationID: elevation.ID,
+	})
+}
+
+// notifyElevation tells security about an elevation. It runs after the
+// response so a slow webhook doesn't delay the incident response; when it
+// fails, retryElevationNotifications sends it again.
+func (h *AuthHandler) notifyElevation(e *breakglass.Elevation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := h.notifier.Notify(ctx, webhook.Event{
+		Type: "break_glass.elevated",
+		Time: e.CreatedAt,
+		Data: map[string]any{
+			"elevation_id":  e.ID,
+			"employee":      e.Email,
+			"employee_id":   e.EmployeeID,
+			"role":          e.RoleName,
+			"justification": e.Justification,
+			"scopes":        e.Scopes,
+			"expires_at":    e.ExpiresAt,
+			"ip_address":    e.IPAddress,
+			"user_agent":    e.UserAgent,
+		},
+	})
+	if err != nil {
+		log.Printf("❌ Failed to notify security of elevation #%d: %v", e.ID, err)
+		return err
+	}
+	if err := h.elevations.MarkNotified(ctx, e.ID); err != nil {
+		log.Printf("⚠️ Failed to mark elevation #%d notified: %v", e.ID, err)
+	}
+	return nil
+}
+
+// retryElevationNotifications re-sends the elevations whose notification
+// failed, until security acknowledges them. An elevation may be reported
+// twice if marking it notified fails, never not at all.
+func (h *AuthHandler) retryElevationNotifications() {
+	ticker := time.NewTicker(elevationNotifyRetry)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		pending, err := h.elevations.ListUnnotified(ctx, elevationNotifyRetry, elevationNotifyBatch)
+		cancel()
+		if err != nil {
+			log.Printf("⚠️ Failed to list unnotified elevations: %v", err)
+			continue
+		}
+		for i := range pending {
+			// Stop at the first failure, the webhook is most likely still down
+			if h.notifyElevation(&pending[i]) != nil {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"errors"
+	"go-ldap-sso/internal/directory"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultDirectoryLimit = 20
+	maxDirectoryLimit     = 100
+)
+
+type DirectorySearchRes struct {
+	Users      []directory.Person `json:"users"`
+	NextOffset *int               `json:"next_offset,omitempty"`
+	// Truncated is set when the directory stopped at its result limit, the
+	// query should be narrowed to see the rest
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type GroupMembersRes struct {
+	Group   string             `json:"group"`
+	Members []directory.Person `json:"members"`
+	// Truncated is set when the group has more members than listed
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// HandleDirectorySearch serves GET /api/directory/users?q=&offset=&limit=
+func (h *AuthHandler) HandleDirectorySearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len([]rune(q)) < 2 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "query parameter q needs at least 2 characters")
+		return
+	}
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid offset")
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultDirectoryLimit)
+	if err != nil || limit < 1 || limit > maxDirectoryLimit {
+		writeError(w, http.StatusBadRequest, "invalid_request", "limit must be between 1 and 100")
+		return
+	}
+
+	result, err := h.directory.SearchUsers(q, offset, limit)
+	if err != nil {
+		writeDirectoryError(w, err)
+		return
+	}
+
+	res := DirectorySearchRes{Users: result.Users, Truncated: result.Truncated}
+	if result.More {
+		next := offset + limit
+		res.NextOffset = &next
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// HandleDirectoryUser serves GET /api/directory/users/{uid}
+func (h *AuthHandler) HandleDirectoryUser(w http.ResponseWriter, r *http.Request) {
+	person, err := h.directory.GetUser(r.PathValue("uid"))
+	if err != nil {
+		writeDirectoryError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, person)
+}
+
+// HandleDirectoryGroupMembers serves GET /api/directory/groups/{cn}/members
+func (h *AuthHandler) HandleDirectoryGroupMembers(w http.ResponseWriter, r *http.Request) {
+	cn := r.PathValue("cn")
+	members, err := h.directory.GroupMembers(cn)
+	if err != nil {
+		writeDirectoryError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, GroupMembersRes{Group: cn, Members: members.People, Truncated: members.Truncated})
+}
+
+func writeDirectoryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, directory.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "not found")
+		return
+	}
+	log.Printf("❌ Directory lookup failed: %v", err)
+	writeError(w, http.StatusServiceUnavailable, "directory_unavailable", "directory service unavailable, try again later")
+}
+
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-ldap-sso/db/emaillogin"
+	"go-ldap-sso/db/employees"
+	"go-ldap-sso/internal/helper"
+	"go-ldap-sso/internal/mail"
+	"go-ldap-sso/pkg/authz"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type EmailLoginReq struct {
+	Email string `json:"email"`
+}
+
+type EmailLoginVerifyReq struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+type EmailLoginLinkReq struct {
+	Token string `json:"token"`
+}
+
+// HandleEmailLoginLinkPage serves GET /email-login/link, the magic link
+// target. The page posts the token back, so mail scanners opening the link
+// don't use it up.
+func (h *AuthHandler) HandleEmailLoginLinkPage(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, "templates/email-login.html")
+}
+
+// HandleEmailLogin serves POST /email-login, mailing a code and magic link
+// to an employee allowed to log in by email. It answers the same way
+// whether or not the address may log in.
+func (h *AuthHandler) HandleEmailLogin(w http.ResponseWriter, r *http.Request) {
+	var req EmailLoginReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	ctx := r.Context()
+	email := strings.TrimSpace(req.Email)
+
+	var employeeID *int
+	employee, err := h.employees.FindEmailLogin(ctx, email)
+	if err == nil {
+		employeeID = &employee.ID
+	} else if !errors.Is(err, employees.ErrNotFound) {
+		log.Printf("❌ Failed to look up employee %s: %v", email, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to send login code")
+		return
+	}
+
+	ip := helper.ClientIP(r)
+	recent, err := h.emailLogins.RecordRequest(ctx, employeeID, ip, time.Hour)
+	if err != nil {
+		log.Printf("❌ Failed to record email login request from %s: %v", ip, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to send login code")
+		return
+	}
+	// Only the address limit is told to the client, the employee one would
+	// reveal which emails may log in
+	if recent.IP >= h.cfg.AuthConfig.EmailLoginMaxPerIPHour {
+		log.Printf("🚫 Email login requests from %s over the hourly limit", ip)
+		w.Header().Set("Retry-After", "3600")
+		writeError(w, http.StatusTooManyRequests, "rate_limited", "too many login code requests, try again later")
+		return
+	}
+
+	if employee != nil {
+		if recent.Employee >= h.cfg.AuthConfig.EmailLoginMaxPerHour {
+			log.Printf("🚫 Email login code for %s not sent: hourly limit reached", employee.UID)
+		} else {
+			// Sent after responding, so the answer doesn't take longer for
+			// addresses that may log in by email
+			ctx := context.WithoutCancel(ctx)
+			h.mailing.Add(1)
+			go func() {
+				defer h.mailing.Done()
+				if err := h.sendLoginCode(ctx, employee); err != nil {
+					log.Printf("⚠️ Email login code for %s not sent: %v", employee.UID, err)
+				}
+			}()
+		}
+	}
+
+	writeJSON(w, http.StatusAccepted, MessageRes{
+		Message: "if the address may log in by email, a login code has been sent to it",
+	})
+}
+
+func (h *AuthHandler) sendLoginCode(ctx context.Context, employee *employees.Employee) error {
+	// Accounts with a second factor keep using it, a mailed code would
+	// bypass it
+	status, err := h.mfaState(ctx, employee.ID)
+	if err != nil {
+		return err
+	}
+	if status.Enrolled() || status.Required {
+		return errors.New("account uses a second factor")
+	}
+
+	minutes := h.cfg.AuthConfig.EmailLoginCodeMinutes
+	code, token, err := h.emailLogins.Create(ctx, employee.ID, time.Duration(minutes)*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/email-login/link?token=%s", h.cfg.GetBaseURL(), url.QueryEscape(token))
+	mailCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	return h.mailer.Send(mailCtx, mail.Message{
+		To:      employee.Email,
+		Subject: "Your login code",
+		Body: fmt.Sprintf("Hi %s,\n\nYour login code is %s\n\nOr log in with the link below. "+
+			"Both can be used once and expire in %d minutes.\n\n%s\n\n"+
+			"If you did not request this, you can ignore this email.\n",
+			employee.Name, code, minutes, link),
+	})
+}
+
+// HandleEmailLoginVerify serves POST /email-login/verify, logging in with a
+// mailed code.
+func (h *AuthHandler) HandleEmailLoginVerify(w http.ResponseWriter, r *http.Request) {
+	var req EmailLoginVerifyReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" || req.Code == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	ctx := r.Context()
+
+	employee, err := h.employees.FindEmailLogin(ctx, strings.TrimSpace(req.Email))
+	if err == nil {
+		err = h.emailLogins.RedeemCode(ctx, employee.ID, strings.TrimSpace(req.Code), h.cfg.AuthConfig.EmailLoginMaxAttempts)
+	}
+	if errors.Is(err, employees.ErrNotFound) || errors.Is(err, emaillogin.ErrInvalidCode) {
+		log.Printf("❌ Email login failed for %q: %v", req.Email, err)
+		writeError(w, http.StatusUnauthorized, "invalid_code", "login code is invalid or has expired")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to check email login code of %q: %v", req.Email, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to check login code")
+		return
+	}
+	h.completeEmailLogin(w, r, employee)
+}
+
+// HandleEmailLoginLink serves POST /email-login/link, logging in with the
+// token of a magic link.
+func (h *AuthHandler) HandleEmailLoginLink(w http.ResponseWriter, r *http.Request) {
+	var req EmailLoginLinkReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	ctx := r.Context()
+
+	employeeID, err := h.emailLogins.RedeemLink(ctx, req.Token)
+	var employee *employees.Employee
+	if err == nil {
+		employee, err = h.employees.FindActiveByID(ctx, employeeID)
+	}
+	if errors.Is(err, emaillogin.ErrInvalidCode) || errors.Is(err, employees.ErrNotFound) {
+		writeError(w, http.StatusUnauthorized, "invalid_code", "login link is invalid or has expired")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to redeem email login link: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to check login link")
+		return
+	}
+	h.completeEmailLogin(w, r, employee)
+}
+
+// completeEmailLogin issues the token of an employee who proved access to
+// their mailbox, unless they have since set up or become required to use a
+// second factor.
+func (h *AuthHandler) completeEmailLogin(w http.ResponseWriter, r *http.Request, employee *employees.Employee) {
+	status, err := h.mfaState(r.Context(), employee.ID)
+	if err != nil {
+		log.Printf("❌ Failed to check MFA of %s: %v", employee.UID, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to check second factor")
+		return
+	}
+	if status.Enrolled() || status.Required {
+		writeError(w, http.StatusForbidden, "mfa_required", "this account must log in with a second factor")
+		return
+	}
+
+	log.Printf("📧 %s logged in by email", employee.UID)
+	h.completeLogin(w, r, employee, authz.MethodEmail, []string{authz.AMREmail}, LoginRes{})
+}
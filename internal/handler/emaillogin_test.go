@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"context"
+	"go-ldap-sso/internal/mail"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+var (
+	mailedCode  = regexp.MustCompile(`login code is (\d{6})`)
+	mailedToken = regexp.MustCompile(`token=(\S+)`)
+)
+
+// requestCode asks for a login code for email from ip and returns the code
+// and link token mailed, empty when nothing was mailed.
+func requestCode(t *testing.T, h *AuthHandler, ip, email string) (code, token string) {
+	t.Helper()
+	sender := h.mailer.(*mail.MemorySender)
+	before := len(sender.Messages())
+
+	w := serve(t, h.HandleEmailLogin, jsonRequest(t, ip, EmailLoginReq{Email: email}), nil)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("HandleEmailLogin() status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	h.mailing.Wait()
+
+	messages := sender.Messages()
+	if len(messages) == before {
+		return "", ""
+	}
+	body := messages[len(messages)-1].Body
+	token, err := url.QueryUnescape(mailedToken.FindStringSubmatch(body)[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mailedCode.FindStringSubmatch(body)[1], token
+}
+
+// verifyCode logs in with a mailed code and returns the status and the
+// response, a LoginRes or an ErrorRes.
+func verifyCode(t *testing.T, h *AuthHandler, email, code string) (int, LoginRes, ErrorRes) {
+	t.Helper()
+	var res struct {
+		LoginRes
+		ErrorRes
+	}
+	w := serve(t, h.HandleEmailLoginVerify, jsonRequest(t, "192.0.2.1", EmailLoginVerifyReq{Email: email, Code: code}), &res)
+	return w.Code, res.LoginRes, res.ErrorRes
+}
+
+func TestEmailLoginCode(t *testing.T) {
+	h, _ := newTestHandler(t)
+	createEmployee(t, h, "alice", true)
+	const email = "alice@example.com"
+
+	code, _ := requestCode(t, h, "192.0.2.1", email)
+	if code == "" {
+		t.Fatal("no login code mailed")
+	}
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "000001"
+	}
+	if status, _, res := verifyCode(t, h, email, wrong); status != http.StatusUnauthorized || res.Code != "invalid_code" {
+		t.Errorf("verify with a wrong code = %d %q, want 401 invalid_code", status, res.Code)
+	}
+	status, res, _ := verifyCode(t, h, email, code)
+	if status != http.StatusOK || res.Token == "" {
+		t.Fatalf("verify = %d %+v, want a token", status, res)
+	}
+	if status, _, _ := verifyCode(t, h, email, code); status != http.StatusUnauthorized {
+		t.Errorf("verify with a used code = %d, want 401", status)
+	}
+}
+
+func TestEmailLoginMaxAttempts(t *testing.T) {
+	h, _ := newTestHandler(t)
+	createEmployee(t, h, "alice", true)
+	const email = "alice@example.com"
+
+	code, _ := requestCode(t, h, "192.0.2.1", email)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "000001"
+	}
+	for i := 0; i < h.cfg.AuthConfig.EmailLoginMaxAttempts; i++ {
+		if status, _, _ := verifyCode(t, h, email, wrong); status != http.StatusUnauthorized {
+			t.Fatalf("attempt %d = %d, want 401", i+1, status)
+		}
+	}
+	if status, _, _ := verifyCode(t, h, email, code); status != http.StatusUnauthorized {
+		t.Errorf("verify with the right code after %d attempts = %d, want 401",
+			h.cfg.AuthConfig.EmailLoginMaxAttempts, status)
+	}
+}
+
+func TestEmailLoginLinkSingleUse(t *testing.T) {
+	h, _ := newTestHandler(t)
+	createEmployee(t, h, "alice", true)
+	const email = "alice@example.com"
+
+	code, token := requestCode(t, h, "192.0.2.1", email)
+
+	var res LoginRes
+	w := serve(t, h.HandleEmailLoginLink, jsonRequest(t, "192.0.2.1", EmailLoginLinkReq{Token: token}), &res)
+	if w.Code != http.StatusOK || res.Token == "" {
+		t.Fatalf("HandleEmailLoginLink() = %d %s, want a token", w.Code, w.Body)
+	}
+	if w := serve(t, h.HandleEmailLoginLink, jsonRequest(t, "192.0.2.1", EmailLoginLinkReq{Token: token}), nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("HandleEmailLoginLink() with a used link = %d, want 401", w.Code)
+	}
+	// The code mailed with the link is used up with it
+	if status, _, _ := verifyCode(t, h, email, code); status != http.StatusUnauthorized {
+		t.Errorf("verify with the code of a used link = %d, want 401", status)
+	}
+}
+
+func TestEmailLoginRateLimits(t *testing.T) {
+	h, sender := newTestHandler(t)
+	createEmployee(t, h, "alice", true)
+
+	// Per employee: requests over the limit are answered alike but not mailed
+	ips := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}
+	for _, ip := range ips {
+		requestCode(t, h, ip, "alice@example.com")
+	}
+	if got, want := len(sender.Messages()), h.cfg.AuthConfig.EmailLoginMaxPerHour; got != want {
+		t.Errorf("%d requests mailed %d codes, want %d", len(ips), got, want)
+	}
+
+	// Per address: told to the client, unknown emails count too
+	const ip = "198.51.100.1"
+	for i := 0; i < h.cfg.AuthConfig.EmailLoginMaxPerIPHour; i++ {
+		requestCode(t, h, ip, "nobody@example.com")
+	}
+	w := serve(t, h.HandleEmailLogin, jsonRequest(t, ip, EmailLoginReq{Email: "nobody@example.com"}), nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("request over the address limit = %d, Retry-After %q, want 429 with Retry-After",
+			w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestEmailLoginRefusesMFA(t *testing.T) {
+	h, sender := newTestHandler(t)
+	ctx := context.Background()
+
+	createEmployee(t, h, "bob", false)
+	totp := createEmployee(t, h, "carol", true)
+	if _, err := h.db.Pool.Exec(ctx,
+		`INSERT INTO employee_totp (employee_id, secret_encrypted, confirmed_at) VALUES ($1, '\x00', now())`,
+		totp,
+	); err != nil {
+		t.Fatal(err)
+	}
+	required := createEmployee(t, h, "dave", true)
+	grantScope(t, h, required, "merchant:write")
+
+	for _, email := range []string{"nobody@example.com", "bob@example.com", "carol@example.com", "dave@example.com"} {
+		if code, _ := requestCode(t, h, "192.0.2.1", email); code != "" {
+			t.Errorf("login code mailed to %s", email)
+		}
+	}
+	if n := len(sender.Messages()); n != 0 {
+		t.Fatalf("%d mails sent, want none", n)
+	}
+
+	// Codes mailed before a second factor became required no longer log in
+	erin := createEmployee(t, h, "erin", true)
+	code, _ := requestCode(t, h, "192.0.2.1", "erin@example.com")
+	grantScope(t, h, erin, "merchant:write")
+	if status, _, res := verifyCode(t, h, "erin@example.com", code); status != http.StatusForbidden || res.Code != "mfa_required" {
+		t.Errorf("verify after MFA became required = %d %q, want 403 mfa_required", status, res.Code)
+	}
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db/authsessions"
+	"go-ldap-sso/db/dbtest"
+	"go-ldap-sso/db/emaillogin"
+	"go-ldap-sso/db/employees"
+	mfadb "go-ldap-sso/db/mfa"
+	"go-ldap-sso/db/passkeys"
+	"go-ldap-sso/db/passwordreset"
+	"go-ldap-sso/db/scopes"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"go-ldap-sso/internal/ldapserver/ldaptest"
+	"go-ldap-sso/internal/mail"
+	"go-ldap-sso/internal/mfa"
+	"go-ldap-sso/internal/session"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+const testLDIF = `dn: ou=users,dc=example,dc=org
+objectClass: organizationalUnit
+ou: users
+
+dn: uid=alice,ou=users,dc=example,dc=org
+objectClass: inetOrgPerson
+cn: Alice
+sn: Example
+uid: alice
+mail: alice@example.com
+userPassword: secret123
+
+dn: uid=bob,ou=users,dc=example,dc=org
+objectClass: inetOrgPerson
+cn: Bob
+sn: Example
+uid: bob
+mail: bob@example.com
+userPassword: hunter22
+`
+
+// testLDAP starts the embedded directory holding testLDIF and returns a
+// client bound to it as the service account.
+func testLDAP(t *testing.T) *ldapauth.LDAPClient {
+	t.Helper()
+	return ldaptest.Connect(t, ldaptest.Start(t, testLDIF))
+}
+
+// newTestHandler returns an AuthHandler over the test database and the
+// embedded directory, mailing into the returned MemorySender. It has no
+// SAML provider, so only handlers not needing one can be tested.
+func newTestHandler(t *testing.T) (*AuthHandler, *mail.MemorySender) {
+	t.Helper()
+	database := dbtest.Open(t)
+
+	cfg := &config.Config{Host: "localhost", Port: "8080"}
+	cfg.AuthConfig = config.AuthConfig{
+		JWTSecret:                  "test-secret",
+		JWTExpiryHours:             1,
+		PasswordResetTTLMins:       30,
+		PasswordResetMaxPerHour:    2,
+		PasswordResetMaxPerIPHour:  5,
+		PasswordChangeMaxPerHour:   3,
+		PasswordChangeMaxPerIPHour: 5,
+		SessionIdleMinutes:         30,
+		SessionAbsoluteHours:       8,
+		MFAChallengeMinutes:        5,
+		MFAMaxAttempts:             5,
+		MFARecoveryCodes:           10,
+		MFAIssuer:                  "go-ldap-sso",
+		StepUpMaxAgeMinutes:        5,
+		WebAuthnRPID:               "localhost",
+		WebAuthnRPName:             "go-ldap-sso",
+		WebAuthnOrigins:            []string{"http://localhost:8080"},
+		WebAuthnCeremonyMinutes:    5,
+		WebAuthnLoginMaxPerIP:      3,
+		EmailLoginCodeMinutes:      10,
+		EmailLoginMaxAttempts:      3,
+		EmailLoginMaxPerHour:       2,
+		EmailLoginMaxPerIPHour:     5,
+	}
+
+	webAuthn, err := newWebAuthn(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfaCipher, err := mfa.NewCipher(securecookie.GenerateRandomKey(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loginSessions := authsessions.NewRepository(database.Pool)
+	mailer := &mail.MemorySender{}
+	h := &AuthHandler{
+		cfg: cfg,
+		store: session.NewStore(loginSessions, 30*time.Minute, 8*time.Hour,
+			securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32)),
+		ldapClient:    testLDAP(t),
+		db:            database,
+		mailer:        mailer,
+		resetTokens:   passwordreset.NewRepository(database.Pool),
+		scopes:        scopes.NewRepository(database.Pool),
+		employees:     employees.NewRepository(database.Pool),
+		loginSessions: loginSessions,
+		mfaStore:      mfadb.NewRepository(database.Pool),
+		mfaCipher:     mfaCipher,
+		webAuthn:      webAuthn,
+		passkeys:      passkeys.NewRepository(database.Pool),
+		emailLogins:   emaillogin.NewRepository(database.Pool),
+	}
+	return h, mailer
+}
+
+// createEmployee adds an active employee and returns its id.
+func createEmployee(t *testing.T, h *AuthHandler, uid string, emailLogin bool) int {
+	t.Helper()
+	var id int
+	err := h.db.Pool.QueryRow(context.Background(), `
+		INSERT INTO employees (uid, name, email, email_login_allowed)
+		VALUES ($1, $1, $1 || '@example.com', $2) RETURNING id`,
+		uid, emailLogin,
+	).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// grantScope creates scope if needed and grants it directly to the employee.
+func grantScope(t *testing.T, h *AuthHandler, employeeID int, scope string) {
+	t.Helper()
+	_, err := h.db.Pool.Exec(context.Background(), `
+		WITH s AS (
+			INSERT INTO scopes (name) VALUES ($2)
+			ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING id
+		)
+		INSERT INTO employee_scopes (employee_id, scope_id) SELECT $1, id FROM s`,
+		employeeID, scope,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// jsonRequest returns a POST request from ip with body as JSON.
+func jsonRequest(t *testing.T, ip string, body any) *http.Request {
+	t.Helper()
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(raw))
+	r.RemoteAddr = ip + ":40000"
+	return r
+}
+
+// serve runs handler on r and decodes the response into res, when not nil.
+func serve(t *testing.T, handler http.HandlerFunc, r *http.Request, res any) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if res != nil && w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), res); err != nil {
+			t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+		}
+	}
+	return w
+}
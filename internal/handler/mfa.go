@@ -0,0 +1,495 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db/employees"
+	mfadb "go-ldap-sso/db/mfa"
+	"go-ldap-sso/internal/mfa"
+	"go-ldap-sso/internal/session"
+	"go-ldap-sso/pkg/authz"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// errInvalidCode is returned for wrong, reused or unusable second factor
+// codes.
+var errInvalidCode = errors.New("invalid code")
+
+type MFAVerifyReq struct {
+	MFAToken string `json:"mfa_token"`
+	// Code is a TOTP code or a recovery code
+	Code string `json:"code"`
+}
+
+type MFACodeReq struct {
+	Code string `json:"code"`
+}
+
+type TOTPEnrollRes struct {
+	Secret string `json:"secret"`
+	URL    string `json:"otpauth_url"`
+	// QRCode is a PNG data URL of URL
+	QRCode string `json:"qr_code"`
+}
+
+type RecoveryCodesRes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFAStatusRes struct {
+	TOTPEnabled       bool `json:"totp_enabled"`
+	Passkeys          int  `json:"passkeys"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// Second factor methods offered at login
+const (
+	mfaMethodTOTP    = "totp"
+	mfaMethodPasskey = "passkey"
+)
+
+// mfaStatus is what an employee has set up as a second factor.
+type mfaStatus struct {
+	// TOTP is set for a confirmed authenticator app
+	TOTP     bool
+	Passkeys int
+	// Required is set when a scope held requires a second factor
+	Required bool
+}
+
+// Enrolled reports whether any second factor is set up.
+func (s mfaStatus) Enrolled() bool {
+	return s.TOTP || s.Passkeys > 0
+}
+
+// Methods lists the second factors usable at login.
+func (s mfaStatus) Methods() []string {
+	var methods []string
+	if s.TOTP {
+		methods = append(methods, mfaMethodTOTP)
+	}
+	if s.Passkeys > 0 {
+		methods = append(methods, mfaMethodPasskey)
+	}
+	return methods
+}
+
+// newMFACipher returns the cipher for TOTP secrets. Outside development
+// MFA_ENCRYPTION_KEY is required; in development a fixed, public key stands
+// in for a missing one.
+func newMFACipher(cfg *config.Config) (*mfa.Cipher, error) {
+	key, err := session.DecodeKey(cfg.AuthConfig.MFAEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("MFA_ENCRYPTION_KEY: %w", err)
+	}
+	if len(key) == 0 {
+		if !cfg.IsDevelopment() {
+			return nil, errors.New("MFA_ENCRYPTION_KEY is required outside development")
+		}
+		log.Println("⚠️ MFA_ENCRYPTION_KEY is not set, using a development key: TOTP secrets are not protected")
+		sum := sha256.Sum256([]byte("go-ldap-sso development mfa key"))
+		key = sum[:]
+	}
+	return mfa.NewCipher(key)
+}
+
+// secretContext binds a sealed TOTP secret to its employee.
+func secretContext(employeeID int) []byte {
+	return []byte("employee_totp:" + strconv.Itoa(employeeID))
+}
+
+// beginMFA answers the password step of a login with a second factor
+// challenge if the employee has an authenticator app or passkey, or holds a
+// scope requiring one. It reports whether it answered.
+func (h *AuthHandler) beginMFA(w http.ResponseWriter, r *http.Request, employee *employees.Employee, res LoginRes) bool {
+	ctx := r.Context()
+
+	status, err := h.mfaState(ctx, employee.ID)
+	if err != nil {
+		log.Printf("❌ Failed to check MFA of %s: %v", employee.UID, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to check second factor")
+		return true
+	}
+	if !status.Enrolled() && !status.Required {
+		return false
+	}
+
+	token, err := h.mfaStore.CreateChallenge(ctx, employee.ID, time.Duration(h.cfg.AuthConfig.MFAChallengeMinutes)*time.Minute)
+	if err != nil {
+		log.Printf("❌ Failed to create MFA challenge for %s: %v", employee.UID, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to start second factor")
+		return true
+	}
+
+	res.MFAToken = token
+	res.MFARequired = status.Enrolled()
+	res.MFAEnrollmentRequired = !status.Enrolled()
+	res.MFAMethods = status.Methods()
+	writeJSON(w, http.StatusOK, res)
+	return true
+}
+
+// mfaState returns the second factors of an employee and whether their
+// scopes require one.
+func (h *AuthHandler) mfaState(ctx context.Context, employeeID int) (mfaStatus, error) {
+	var status mfaStatus
+	totp, err := h.mfaStore.TOTP(ctx, employeeID)
+	if err != nil && !errors.Is(err, mfadb.ErrNotEnrolled) {
+		return status, err
+	}
+	status.TOTP = err == nil && totp.Confirmed()
+
+	if status.Passkeys, err = h.passkeys.Count(ctx, employeeID); err != nil {
+		return status, err
+	}
+	status.Required, err = h.scopes.RequiresMFA(ctx, employeeID)
+	return status, err
+}
+
+// challengeEmployee returns the employee of a login challenge, counting an
+// attempt against it, or answers the request and returns nil.
+func (h *AuthHandler) challengeEmployee(w http.ResponseWriter, r *http.Request, token string) (*mfadb.Challenge, *employees.Employee) {
+	challenge, err := h.mfaStore.Challenge(r.Context(), token, h.cfg.AuthConfig.MFAMaxAttempts)
+	if errors.Is(err, mfadb.ErrInvalidChallenge) {
+		writeError(w, http.StatusUnauthorized, "mfa_challenge_invalid", "second factor step expired, log in again")
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("❌ Failed to load MFA challenge: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to check second factor")
+		return nil, nil
+	}
+
+	employee, err := h.employees.FindActiveByID(r.Context(), challenge.EmployeeID)
+	if err != nil {
+		if !errors.Is(err, employees.ErrNotFound) {
+			log.Printf("❌ Failed to look up employee %d: %v", challenge.EmployeeID, err)
+		}
+		writeError(w, http.StatusUnauthorized, "employee_not_found", "employee not found")
+		return nil, nil
+	}
+	return challenge, employee
+}
+
+// verifySecondFactor checks code, a TOTP code or an unused recovery code,
+// for employeeID. The first TOTP code after enrolling confirms the
+// enrollment and returns the new recovery codes.
+func (h *AuthHandler) verifySecondFactor(ctx context.Context, employeeID int, code string) ([]string, error) {
+	totp, err := h.mfaStore.TOTP(ctx, employeeID)
+	if errors.Is(err, mfadb.ErrNotEnrolled) {
+		return nil, errInvalidCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !mfa.LooksLikeTOTP(code) {
+		// Recovery codes only exist once an enrollment is confirmed
+		if !totp.Confirmed() {
+			return nil, errInvalidCode
+		}
+		err := h.mfaStore.UseRecoveryCode(ctx, employeeID, mfa.HashRecoveryCode(code))
+		if errors.Is(err, mfadb.ErrCodeUsed) {
+			return nil, errInvalidCode
+		}
+		if err != nil {
+			return nil, err
+		}
+		left, _ := h.mfaStore.RecoveryCodesLeft(ctx, employeeID)
+		log.Printf("🔑 Employee %d used a recovery code, %d left", employeeID, left)
+		return nil, nil
+	}
+
+	secret, err := h.mfaCipher.Open(totp.SecretEncrypted, secretContext(employeeID))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt totp secret: %w", err)
+	}
+	step, ok := mfa.VerifyTOTP(string(secret), code, time.Now())
+	if !ok {
+		return nil, errInvalidCode
+	}
+	if err := h.mfaStore.UseTOTPStep(ctx, employeeID, step); err != nil {
+		if errors.Is(err, mfadb.ErrCodeUsed) {
+			return nil, errInvalidCode
+		}
+		return nil, err
+	}
+
+	if totp.Confirmed() {
+		return nil, nil
+	}
+	log.Printf("🔐 Employee %d confirmed TOTP enrollment", employeeID)
+	return h.newRecoveryCodes(ctx, employeeID)
+}
+
+// newRecoveryCodes replaces the recovery codes of an employee, returning the
+// plain codes to show once.
+func (h *AuthHandler) newRecoveryCodes(ctx context.Context, employeeID int) ([]string, error) {
+	codes, err := mfa.NewRecoveryCodes(h.cfg.AuthConfig.MFARecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = mfa.HashRecoveryCode(c)
+	}
+	if err := h.mfaStore.ReplaceRecoveryCodes(ctx, employeeID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// enrollTOTP starts an enrollment for employee, replacing an unconfirmed
+// one, and answers with the secret to scan.
+func (h *AuthHandler) enrollTOTP(w http.ResponseWriter, r *http.Request, employee *employees.Employee) {
+	key, err := mfa.NewTOTP(h.cfg.AuthConfig.MFAIssuer, employee.Email)
+	if err != nil {
+		log.Printf("❌ Failed to generate TOTP key: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to generate secret")
+		return
+	}
+	sealed, err := h.mfaCipher.Seal([]byte(key.Secret()), secretContext(employee.ID))
+	if err != nil {
+		log.Printf("❌ Failed to encrypt TOTP secret: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to generate secret")
+		return
+	}
+
+	err = h.mfaStore.StartTOTP(r.Context(), employee.ID, sealed)
+	if errors.Is(err, mfadb.ErrAlreadyEnrolled) {
+		writeError(w, http.StatusConflict, "mfa_already_enrolled", "an authenticator is already enrolled")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to store TOTP secret of %s: %v", employee.UID, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to store secret")
+		return
+	}
+
+	qr, err := mfa.QRCode(key)
+	if err != nil {
+		log.Printf("❌ Failed to render QR code: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to render QR code")
+		return
+	}
+	writeJSON(w, http.StatusOK, TOTPEnrollRes{Secret: key.Secret(), URL: key.URL(), QRCode: qr})
+}
+
+func writeMFAError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidCode) {
+		writeError(w, http.StatusUnauthorized, "invalid_code", "invalid or already used code")
+		return
+	}
+	log.Printf("❌ Second factor check failed: %v", err)
+	writeError(w, http.StatusInternalServerError, "internal_error", "failed to check second factor")
+}
+
+// HandleMFAEnroll serves POST /ldap-login/mfa/enroll, enrolling an
+// authenticator during a login that requires one.
+func (h *AuthHandler) HandleMFAEnroll(w http.ResponseWriter, r *http.Request) {
+	var req MFAVerifyReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	_, employee := h.challengeEmployee(w, r, req.MFAToken)
+	if employee == nil {
+		return
+	}
+	h.enrollTOTP(w, r, employee)
+}
+
+// HandleMFAVerify serves POST /ldap-login/mfa, the second step of an LDAP
+// login, issuing the token once the code checks out.
+func (h *AuthHandler) HandleMFAVerify(w http.ResponseWriter, r *http.Request) {
+	var req MFAVerifyReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	challenge, employee := h.challengeEmployee(w, r, req.MFAToken)
+	if employee == nil {
+		return
+	}
+
+	codes, err := h.verifySecondFactor(r.Context(), employee.ID, req.Code)
+	if err != nil {
+		log.Printf("❌ Second factor failed for %s (attempt %d)", employee.UID, challenge.Attempts)
+		writeMFAError(w, err)
+		return
+	}
+	if err := h.mfaStore.DeleteChallenge(r.Context(), challenge.ID); err != nil {
+		log.Printf("⚠️ Failed to delete MFA challenge: %v", err)
+	}
+
+	amr := []string{authz.AMRPassword, authz.AMROTP, authz.AMRMultiFactor}
+	h.completeLogin(w, r, employee, authz.MethodLDAP, amr, LoginRes{RecoveryCodes: codes})
+}
+
+// HandleMFAPage serves GET /mfa
+func (h *AuthHandler) HandleMFAPage(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, "templates/mfa.html")
+}
+
+// mfaEmployee returns the caller's employee, or answers the request and
+// returns nil.
+func (h *AuthHandler) mfaEmployee(w http.ResponseWriter, r *http.Request) *employees.Employee {
+	principal := authz.MustFromContext(r.Context())
+	employee, err := h.employees.FindActiveByID(r.Context(), principal.EmployeeID)
+	if errors.Is(err, employees.ErrNotFound) {
+		writeError(w, http.StatusForbidden, "employee_not_found", "only active employees can manage a second factor")
+		return nil
+	}
+	if err != nil {
+		log.Printf("❌ Failed to look up employee %d: %v", principal.EmployeeID, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to look up employee")
+		return nil
+	}
+	return employee
+}
+
+// HandleMFAStatus serves GET /api/mfa
+func (h *AuthHandler) HandleMFAStatus(w http.ResponseWriter, r *http.Request) {
+	employee := h.mfaEmployee(w, r)
+	if employee == nil {
+		return
+	}
+	status, err := h.mfaState(r.Context(), employee.ID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	left, err := h.mfaStore.RecoveryCodesLeft(r.Context(), employee.ID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, MFAStatusRes{
+		TOTPEnabled:       status.TOTP,
+		Passkeys:          status.Passkeys,
+		Required:          status.Required,
+		RecoveryCodesLeft: left,
+	})
+}
+
+// HandleTOTPEnroll serves POST /api/mfa/totp/enroll
+func (h *AuthHandler) HandleTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	employee := h.mfaEmployee(w, r)
+	if employee == nil {
+		return
+	}
+	h.enrollTOTP(w, r, employee)
+}
+
+// HandleTOTPConfirm serves POST /api/mfa/totp/confirm, completing an
+// enrollment with its first code.
+func (h *AuthHandler) HandleTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	employee := h.mfaEmployee(w, r)
+	if employee == nil {
+		return
+	}
+	var req MFACodeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !mfa.LooksLikeTOTP(req.Code) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "a 6 digit code is required")
+		return
+	}
+
+	status, err := h.mfaState(r.Context(), employee.ID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	if status.TOTP {
+		writeError(w, http.StatusConflict, "mfa_already_enrolled", "an authenticator is already enrolled")
+		return
+	}
+
+	codes, err := h.verifySecondFactor(r.Context(), employee.ID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, RecoveryCodesRes{RecoveryCodes: codes})
+}
+
+// HandleTOTPDisable serves POST /api/mfa/totp/disable, taking the mfa_token
+// of POST /api/reauth to limit the attempts. Holders of scopes requiring a
+// second factor can't disable it unless they have a passkey.
+func (h *AuthHandler) HandleTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	var req MFAVerifyReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	employee := h.reauthEmployee(w, r, req.MFAToken)
+	if employee == nil {
+		return
+	}
+
+	status, err := h.mfaState(r.Context(), employee.ID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	if status.Required && status.Passkeys == 0 {
+		writeError(w, http.StatusForbidden, "mfa_required", "your scopes require a second factor")
+		return
+	}
+	if status.TOTP {
+		if _, err := h.verifySecondFactor(r.Context(), employee.ID, req.Code); err != nil {
+			writeMFAError(w, err)
+			return
+		}
+	}
+
+	if err := h.mfaStore.DeleteTOTP(r.Context(), employee.ID); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	log.Printf("🔓 %s disabled TOTP", employee.UID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRegenerateRecoveryCodes serves POST /api/mfa/recovery-codes,
+// replacing all recovery codes after checking a current code, with the
+// mfa_token of POST /api/reauth limiting the attempts.
+func (h *AuthHandler) HandleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req MFAVerifyReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	employee := h.reauthEmployee(w, r, req.MFAToken)
+	if employee == nil {
+		return
+	}
+
+	status, err := h.mfaState(r.Context(), employee.ID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	if !status.TOTP {
+		writeError(w, http.StatusConflict, "mfa_not_enrolled", "enroll an authenticator first")
+		return
+	}
+	if _, err := h.verifySecondFactor(r.Context(), employee.ID, req.Code); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+
+	codes, err := h.newRecoveryCodes(r.Context(), employee.ID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, RecoveryCodesRes{RecoveryCodes: codes})
+}
@@ -0,0 +1,277 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go-ldap-sso/internal/auth"
+	"go-ldap-sso/internal/mfa"
+	"go-ldap-sso/pkg/authz"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+// enrollTOTP gives employeeID a confirmed authenticator and recovery codes,
+// returning the secret and the codes. No code of the current time steps has
+// been used yet.
+func enrollTOTP(t *testing.T, h *AuthHandler, employeeID int) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	key, err := mfa.NewTOTP("go-ldap-sso", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := h.mfaCipher.Seal([]byte(key.Secret()), secretContext(employeeID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.mfaStore.StartTOTP(ctx, employeeID, sealed); err != nil {
+		t.Fatal(err)
+	}
+	// Confirmed with a step long gone
+	if err := h.mfaStore.UseTOTPStep(ctx, employeeID, 1); err != nil {
+		t.Fatal(err)
+	}
+	codes, err := h.newRecoveryCodes(ctx, employeeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.Secret(), codes
+}
+
+// totpCode returns the current code of secret.
+func totpCode(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// postJSON sends body to path with bearer token through the routes of h.
+func postJSON(t *testing.T, h *AuthHandler, path, token string, body any) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(raw))
+	r.Header.Set("Authorization", "Bearer "+token)
+	return route(t, h, r)
+}
+
+// reauthToken starts a re-authentication and returns its mfa_token.
+func reauthToken(t *testing.T, h *AuthHandler, token string) string {
+	t.Helper()
+	w, code := postJSON(t, h, "/api/reauth", token, struct{}{})
+	var res ReauthStartRes
+	if err := json.Unmarshal(w.Body.Bytes(), &res); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("POST /api/reauth = %d %q", w.Code, code)
+	}
+	return res.MFAToken
+}
+
+// reissue returns token as if its holder authenticated at authTime with amr.
+func reissue(t *testing.T, h *AuthHandler, token string, authTime time.Time, amr ...string) string {
+	t.Helper()
+	claims, err := auth.ValidateToken(token, h.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims.AuthTime = authTime
+	claims.AMR = amr
+	reissued, err := auth.GenerateToken(*claims, h.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reissued
+}
+
+// mfaLogin logs in with a password and then code, returning the status and
+// the response, a LoginRes or an ErrorRes.
+func mfaLogin(t *testing.T, h *AuthHandler, username, password, code string) (int, LoginRes, ErrorRes) {
+	t.Helper()
+	var first LoginRes
+	w := serve(t, h.HandleLDAPLogin, jsonRequest(t, "192.0.2.1", LoginReq{Username: username, Password: password}), &first)
+	if w.Code != http.StatusOK || !first.MFARequired || first.MFAToken == "" {
+		t.Fatalf("password step = %d %s, want a second factor challenge", w.Code, w.Body.String())
+	}
+
+	var res struct {
+		LoginRes
+		ErrorRes
+	}
+	w = serve(t, h.HandleMFAVerify, jsonRequest(t, "192.0.2.1", MFAVerifyReq{MFAToken: first.MFAToken, Code: code}), &res)
+	return w.Code, res.LoginRes, res.ErrorRes
+}
+
+func TestMFALoginReplayedCode(t *testing.T) {
+	h, _ := newTestHandler(t)
+	id := createEmployee(t, h, "alice", false)
+	secret, _ := enrollTOTP(t, h, id)
+	code := totpCode(t, secret)
+
+	status, res, _ := mfaLogin(t, h, "alice", "secret123", code)
+	if status != http.StatusOK || res.Token == "" {
+		t.Fatalf("login = %d, want a token", status)
+	}
+	claims, err := auth.ValidateToken(res.Token, h.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(claims.AMR, authz.AMRMultiFactor) {
+		t.Errorf("amr = %v, want mfa", claims.AMR)
+	}
+
+	status, _, e := mfaLogin(t, h, "alice", "secret123", code)
+	if status != http.StatusUnauthorized || e.Code != "invalid_code" {
+		t.Errorf("replayed code = %d %q, want 401 invalid_code", status, e.Code)
+	}
+}
+
+func TestMFALoginMaxAttempts(t *testing.T) {
+	h, _ := newTestHandler(t)
+	id := createEmployee(t, h, "alice", false)
+	secret, _ := enrollTOTP(t, h, id)
+
+	var first LoginRes
+	serve(t, h.HandleLDAPLogin, jsonRequest(t, "192.0.2.1", LoginReq{Username: "alice", Password: "secret123"}), &first)
+	verify := func(code string) ErrorRes {
+		var res ErrorRes
+		serve(t, h.HandleMFAVerify, jsonRequest(t, "192.0.2.1", MFAVerifyReq{MFAToken: first.MFAToken, Code: code}), &res)
+		return res
+	}
+	for i := 0; i < h.cfg.AuthConfig.MFAMaxAttempts; i++ {
+		if res := verify("000000"); res.Code != "invalid_code" {
+			t.Fatalf("wrong code %d = %q, want invalid_code", i+1, res.Code)
+		}
+	}
+	if res := verify(totpCode(t, secret)); res.Code != "mfa_challenge_invalid" {
+		t.Errorf("right code after %d attempts = %q, want mfa_challenge_invalid", h.cfg.AuthConfig.MFAMaxAttempts, res.Code)
+	}
+}
+
+func TestMFARecoveryCode(t *testing.T) {
+	h, _ := newTestHandler(t)
+	id := createEmployee(t, h, "alice", false)
+	_, codes := enrollTOTP(t, h, id)
+
+	// Codes can be typed loosely
+	status, res, _ := mfaLogin(t, h, "alice", "secret123", strings.ToUpper(codes[0]))
+	if status != http.StatusOK || res.Token == "" {
+		t.Fatalf("login with a recovery code = %d, want a token", status)
+	}
+	if left, _ := h.mfaStore.RecoveryCodesLeft(context.Background(), id); left != len(codes)-1 {
+		t.Errorf("%d recovery codes left, want %d", left, len(codes)-1)
+	}
+
+	for name, code := range map[string]string{"used": codes[0], "unknown": "aaaa-bbbb-cccc"} {
+		if status, _, e := mfaLogin(t, h, "alice", "secret123", code); status != http.StatusUnauthorized || e.Code != "invalid_code" {
+			t.Errorf("%s recovery code = %d %q, want 401 invalid_code", name, status, e.Code)
+		}
+	}
+}
+
+func TestMFARecoveryCodeNeedsConfirmation(t *testing.T) {
+	h, _ := newTestHandler(t)
+	id := createEmployee(t, h, "alice", false)
+	_, codes := enrollTOTP(t, h, id)
+	if _, err := h.db.Pool.Exec(context.Background(),
+		"UPDATE employee_totp SET confirmed_at = NULL WHERE employee_id = $1", id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.verifySecondFactor(context.Background(), id, codes[0]); !errors.Is(err, errInvalidCode) {
+		t.Errorf("recovery code of an unconfirmed enrollment error = %v, want errInvalidCode", err)
+	}
+}
+
+func TestTOTPDisableAttempts(t *testing.T) {
+	h, _ := newTestHandler(t)
+	id := createEmployee(t, h, "alice", false)
+	_, login := ldapLogin(t, h, "alice", "secret123")
+	secret, _ := enrollTOTP(t, h, id)
+	const path = "/api/mfa/totp/disable"
+
+	if w, code := postJSON(t, h, path, login.Token, MFAVerifyReq{Code: totpCode(t, secret)}); code != "mfa_challenge_invalid" {
+		t.Errorf("without mfa_token = %d %q, want mfa_challenge_invalid", w.Code, code)
+	}
+
+	token := reauthToken(t, h, login.Token)
+	for i := 0; i < h.cfg.AuthConfig.MFAMaxAttempts; i++ {
+		if w, code := postJSON(t, h, path, login.Token, MFAVerifyReq{MFAToken: token, Code: "000000"}); code != "invalid_code" {
+			t.Fatalf("wrong code %d = %d %q, want invalid_code", i+1, w.Code, code)
+		}
+	}
+	if w, code := postJSON(t, h, path, login.Token, MFAVerifyReq{MFAToken: token, Code: totpCode(t, secret)}); code != "mfa_challenge_invalid" {
+		t.Errorf("right code after the attempts = %d %q, want mfa_challenge_invalid", w.Code, code)
+	}
+	if status, _ := h.mfaState(context.Background(), id); !status.TOTP {
+		t.Fatal("authenticator disabled without a valid code")
+	}
+
+	token = reauthToken(t, h, login.Token)
+	if w, code := postJSON(t, h, path, login.Token, MFAVerifyReq{MFAToken: token, Code: totpCode(t, secret)}); w.Code != http.StatusNoContent {
+		t.Fatalf("disable = %d %q, want 204", w.Code, code)
+	}
+	if status, _ := h.mfaState(context.Background(), id); status.TOTP {
+		t.Error("authenticator still enabled")
+	}
+}
+
+func TestRegenerateRecoveryCodes(t *testing.T) {
+	h, _ := newTestHandler(t)
+	id := createEmployee(t, h, "alice", false)
+	_, login := ldapLogin(t, h, "alice", "secret123")
+	_, old := enrollTOTP(t, h, id)
+	const path = "/api/mfa/recovery-codes"
+
+	token := reauthToken(t, h, login.Token)
+	for i := 0; i < h.cfg.AuthConfig.MFAMaxAttempts; i++ {
+		if w, code := postJSON(t, h, path, login.Token, MFAVerifyReq{MFAToken: token, Code: "aaaa-bbbb-cccc"}); code != "invalid_code" {
+			t.Fatalf("wrong code %d = %d %q, want invalid_code", i+1, w.Code, code)
+		}
+	}
+	if w, code := postJSON(t, h, path, login.Token, MFAVerifyReq{MFAToken: token, Code: old[0]}); code != "mfa_challenge_invalid" {
+		t.Errorf("right code after the attempts = %d %q, want mfa_challenge_invalid", w.Code, code)
+	}
+
+	token = reauthToken(t, h, login.Token)
+	w, code := postJSON(t, h, path, login.Token, MFAVerifyReq{MFAToken: token, Code: old[0]})
+	var res RecoveryCodesRes
+	if err := json.Unmarshal(w.Body.Bytes(), &res); w.Code != http.StatusOK || err != nil || len(res.RecoveryCodes) != 10 {
+		t.Fatalf("regenerate = %d %q, want 10 new codes", w.Code, code)
+	}
+	if _, err := h.verifySecondFactor(context.Background(), id, old[1]); !errors.Is(err, errInvalidCode) {
+		t.Errorf("old recovery code error = %v, want errInvalidCode", err)
+	}
+	if _, err := h.verifySecondFactor(context.Background(), id, res.RecoveryCodes[0]); err != nil {
+		t.Errorf("new recovery code error = %v", err)
+	}
+}
+
+func TestMFAManagementNeedsRecentLogin(t *testing.T) {
+	h, _ := newTestHandler(t)
+	id := createEmployee(t, h, "alice", false)
+	_, login := ldapLogin(t, h, "alice", "secret123")
+	secret, _ := enrollTOTP(t, h, id)
+	token := reauthToken(t, h, login.Token)
+	stale := reissue(t, h, login.Token, time.Now().Add(-time.Hour), authz.AMRPassword)
+
+	for _, path := range []string{"/api/mfa/totp/disable", "/api/mfa/recovery-codes"} {
+		w, code := postJSON(t, h, path, stale, MFAVerifyReq{MFAToken: token, Code: totpCode(t, secret)})
+		if w.Code != http.StatusUnauthorized || code != "step_up_required" {
+			t.Errorf("%s with an old login = %d %q, want 401 step_up_required", path, w.Code, code)
+		}
+	}
+	if status, _ := h.mfaState(context.Background(), id); !status.TOTP {
+		t.Error("authenticator disabled without a recent login")
+	}
+}
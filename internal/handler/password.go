@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-ldap-sso/db/passwordreset"
+	"go-ldap-sso/internal/helper"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"go-ldap-sso/internal/mail"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type ChangePasswordReq struct {
+	Username    string `json:"username"`
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type ForgotPasswordReq struct {
+	Username string `json:"username"`
+}
+
+type ResetPasswordReq struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type MessageRes struct {
+	Message string `json:"message"`
+}
+
+func (h *AuthHandler) HandleChangePasswordPage(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, "templates/change-password.html")
+}
+
+func (h *AuthHandler) HandleForgotPasswordPage(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, "templates/forgot-password.html")
+}
+
+func (h *AuthHandler) HandleResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, "templates/reset-password.html")
+}
+
+// HandleChangePassword changes the password with the old one, also for users
+// whose password expired or must be changed after an admin reset. Attempts
+// are limited per account and per address, since a wrong old password is
+// told apart like at login.
+func (h *AuthHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+
+	ip := helper.ClientIP(r)
+	recent, err := h.resetTokens.RecordRequest(r.Context(), passwordreset.RequestChange, req.Username, ip, time.Hour)
+	if err != nil {
+		log.Printf("❌ Failed to record password change attempt from %s: %v", ip, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "password change failed")
+		return
+	}
+	// Unknown usernames are counted too, so telling the account limit
+	// reveals nothing
+	if recent.IP >= h.cfg.AuthConfig.PasswordChangeMaxPerIPHour || recent.Account >= h.cfg.AuthConfig.PasswordChangeMaxPerHour {
+		log.Printf("🚫 Password change attempts for %q from %s over the hourly limit", req.Username, ip)
+		w.Header().Set("Retry-After", "3600")
+		writeError(w, http.StatusTooManyRequests, "rate_limited", "too many password change attempts, try again later")
+		return
+	}
+
+	if err := h.ldapClient.ChangePassword(req.Username, req.OldPassword, req.NewPassword); err != nil {
+		log.Printf("❌ Password change failed for %q: %v", req.Username, err)
+		writeLDAPError(w, err)
+		return
+	}
+
+	log.Printf("🔑 Password changed for %q", req.Username)
+	writeJSON(w, http.StatusOK, MessageRes{Message: "password changed"})
+}
+
+// HandleForgotPassword mails a single-use reset link. It answers the same way,
+// and as fast, whether or not the account exists: the lookup and the mail
+// happen after the answer.
+func (h *AuthHandler) HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+
+	ip := helper.ClientIP(r)
+	recent, err := h.resetTokens.RecordRequest(r.Context(), passwordreset.RequestReset, req.Username, ip, time.Hour)
+	if err != nil {
+		log.Printf("❌ Failed to record password reset request from %s: %v", ip, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to send reset link")
+		return
+	}
+	// Only the address limit is told to the client, the account one would
+	// reveal which accounts exist
+	if recent.IP >= h.cfg.AuthConfig.PasswordResetMaxPerIPHour {
+		log.Printf("🚫 Password reset requests from %s over the hourly limit", ip)
+		w.Header().Set("Retry-After", "3600")
+		writeError(w, http.StatusTooManyRequests, "rate_limited", "too many reset requests, try again later")
+		return
+	}
+
+	if recent.Account >= h.cfg.AuthConfig.PasswordResetMaxPerHour {
+		log.Printf("🚫 Password reset for %q not sent: hourly limit reached", req.Username)
+	} else {
+		ctx := context.WithoutCancel(r.Context())
+		h.mailing.Add(1)
+		go func() {
+			defer h.mailing.Done()
+			if err := h.sendResetLink(ctx, req.Username); err != nil {
+				log.Printf("⚠️ Password reset for %q not sent: %v", req.Username, err)
+			}
+		}()
+	}
+
+	writeJSON(w, http.StatusAccepted, MessageRes{
+		Message: "if the account exists, a reset link has been sent to its email address",
+	})
+}
+
+func (h *AuthHandler) sendResetLink(ctx context.Context, username string) error {
+	user, err := h.ldapClient.LookupUser(username)
+	if err != nil {
+		return err
+	}
+
+	var employeeID int
+	var email string
+	err = h.db.Pool.QueryRow(ctx, `SELECT id, email FROM employees WHERE uid = $1 AND status = 'active'`, username).Scan(&employeeID, &email)
+	if err != nil {
+		return fmt.Errorf("employee lookup: %w", err)
+	}
+	if user.Email != "" {
+		email = user.Email
+	}
+
+	ttl := time.Duration(h.cfg.AuthConfig.PasswordResetTTLMins) * time.Minute
+	token, err := h.resetTokens.Create(ctx, employeeID, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/password/reset?token=%s", h.cfg.GetBaseURL(), url.QueryEscape(token))
+	mailCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	return h.mailer.Send(mailCtx, mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. "+
+			"It can be used once and expires in %d minutes.\n\n%s\n\n"+
+			"If you did not request this, you can ignore this email.\n",
+			user.Name, h.cfg.AuthConfig.PasswordResetTTLMins, link),
+	})
+}
+
+// HandleResetPassword sets a new password for the owner of a reset token.
+func (h *AuthHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+
+	var uid string
+	err := h.resetTokens.Redeem(r.Context(), req.Token, func(e *passwordreset.Employee) error {
+		uid = e.UID
+		return h.ldapClient.ResetPassword(e.UID, req.NewPassword)
+	})
+	if errors.Is(err, passwordreset.ErrInvalidToken) {
+		writeError(w, http.StatusBadRequest, "invalid_token", "reset link is invalid or has expired")
+		return
+	}
+	var authErr *ldapauth.AuthError
+	if errors.As(err, &authErr) {
+		log.Printf("❌ Password reset failed for %q: %v", uid, err)
+		writeLDAPError(w, err)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Password reset failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "password reset failed")
+		return
+	}
+
+	log.Printf("🔑 Password reset for %q", uid)
+	writeJSON(w, http.StatusOK, MessageRes{Message: "password has been reset"})
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"go-ldap-sso/internal/mail"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// requestResetLink asks for a reset link for username from ip and returns
+// the response and the token mailed, empty when nothing was mailed.
+func requestResetLink(t *testing.T, h *AuthHandler, ip, username string) (int, string, string) {
+	t.Helper()
+	sender := h.mailer.(*mail.MemorySender)
+	before := len(sender.Messages())
+
+	w := serve(t, h.HandleForgotPassword, jsonRequest(t, ip, ForgotPasswordReq{Username: username}), nil)
+	h.mailing.Wait()
+
+	messages := sender.Messages()
+	if len(messages) == before {
+		return w.Code, w.Body.String(), ""
+	}
+	token, err := url.QueryUnescape(mailedToken.FindStringSubmatch(messages[len(messages)-1].Body)[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, w.Body.String(), token
+}
+
+func resetPassword(t *testing.T, h *AuthHandler, token, password string) (int, ErrorRes) {
+	t.Helper()
+	var res ErrorRes
+	w := serve(t, h.HandleResetPassword, jsonRequest(t, "192.0.2.1", ResetPasswordReq{Token: token, NewPassword: password}), &res)
+	return w.Code, res
+}
+
+func changePassword(t *testing.T, h *AuthHandler, ip, username, oldPassword string) (int, ErrorRes) {
+	t.Helper()
+	var res ErrorRes
+	req := ChangePasswordReq{Username: username, OldPassword: oldPassword, NewPassword: oldPassword + "-new"}
+	w := serve(t, h.HandleChangePassword, jsonRequest(t, ip, req), &res)
+	return w.Code, res
+}
+
+func TestForgotPasswordSameAnswer(t *testing.T) {
+	h, sender := newTestHandler(t)
+	createEmployee(t, h, "alice", false)
+
+	known, knownBody, token := requestResetLink(t, h, "192.0.2.1", "alice")
+	if token == "" {
+		t.Fatal("no reset link mailed to alice")
+	}
+	unknown, unknownBody, _ := requestResetLink(t, h, "192.0.2.1", "nobody")
+	if known != http.StatusAccepted || unknown != known || unknownBody != knownBody {
+		t.Errorf("answers differ: %d %s for alice, %d %s for an unknown account", known, knownBody, unknown, unknownBody)
+	}
+	// bob is in the directory but not an employee
+	if _, body, token := requestResetLink(t, h, "192.0.2.1", "bob"); token != "" || body != knownBody {
+		t.Errorf("answer for bob = %s, token %q", body, token)
+	}
+	if n := len(sender.Messages()); n != 1 {
+		t.Errorf("%d mails sent, want 1", n)
+	}
+}
+
+func TestResetPasswordToken(t *testing.T) {
+	h, _ := newTestHandler(t)
+	createEmployee(t, h, "alice", false)
+
+	_, _, old := requestResetLink(t, h, "192.0.2.1", "alice")
+	_, _, token := requestResetLink(t, h, "192.0.2.2", "alice")
+	if status, res := resetPassword(t, h, old, "first-new-pass"); status != http.StatusBadRequest || res.Code != "invalid_token" {
+		t.Errorf("reset with a replaced link = %d %q, want 400 invalid_token", status, res.Code)
+	}
+
+	if status, res := resetPassword(t, h, token, "first-new-pass"); status != http.StatusOK {
+		t.Fatalf("reset = %d %q, want 200", status, res.Code)
+	}
+	if _, err := h.ldapClient.AuthenticateUser("alice", "first-new-pass"); err != nil {
+		t.Errorf("login with the new password: %v", err)
+	}
+	if status, res := resetPassword(t, h, token, "second-new-pass"); status != http.StatusBadRequest || res.Code != "invalid_token" {
+		t.Errorf("reset with a used link = %d %q, want 400 invalid_token", status, res.Code)
+	}
+
+	_, _, token = requestResetLink(t, h, "192.0.2.3", "bob")
+	if token != "" {
+		t.Fatal("reset link mailed to bob, who is no employee")
+	}
+	createEmployee(t, h, "bob", false)
+	_, _, token = requestResetLink(t, h, "192.0.2.3", "bob")
+	if _, err := h.db.Pool.Exec(context.Background(),
+		"UPDATE password_reset_tokens SET expires_at = now() - interval '1 second'",
+	); err != nil {
+		t.Fatal(err)
+	}
+	if status, res := resetPassword(t, h, token, "second-new-pass"); status != http.StatusBadRequest || res.Code != "invalid_token" {
+		t.Errorf("reset with an expired link = %d %q, want 400 invalid_token", status, res.Code)
+	}
+	if _, err := h.ldapClient.AuthenticateUser("bob", "hunter22"); err != nil {
+		t.Errorf("bob's password changed by an expired link: %v", err)
+	}
+}
+
+func TestForgotPasswordRateLimits(t *testing.T) {
+	h, sender := newTestHandler(t)
+	createEmployee(t, h, "alice", false)
+
+	// Per account: requests over the limit are answered alike but not mailed
+	ips := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}
+	for _, ip := range ips {
+		if status, _, _ := requestResetLink(t, h, ip, "alice"); status != http.StatusAccepted {
+			t.Fatalf("request from %s = %d, want 202", ip, status)
+		}
+	}
+	if got, want := len(sender.Messages()), h.cfg.AuthConfig.PasswordResetMaxPerHour; got != want {
+		t.Errorf("%d requests mailed %d links, want %d", len(ips), got, want)
+	}
+
+	// Per address: told to the client, unknown accounts count too
+	const ip = "198.51.100.1"
+	for i := 0; i < h.cfg.AuthConfig.PasswordResetMaxPerIPHour; i++ {
+		requestResetLink(t, h, ip, "nobody")
+	}
+	w := serve(t, h.HandleForgotPassword, jsonRequest(t, ip, ForgotPasswordReq{Username: "nobody"}), nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("request over the address limit = %d, Retry-After %q, want 429 with Retry-After",
+			w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	if status, res := changePassword(t, h, "192.0.2.1", "alice", "wrong"); status != http.StatusUnauthorized || res.Code != "invalid_credentials" {
+		t.Errorf("change with a wrong password = %d %q, want 401 invalid_credentials", status, res.Code)
+	}
+	if status, res := changePassword(t, h, "192.0.2.1", "alice", "secret123"); status != http.StatusOK {
+		t.Fatalf("change = %d %q, want 200", status, res.Code)
+	}
+	if _, err := h.ldapClient.AuthenticateUser("alice", "secret123-new"); err != nil {
+		t.Errorf("login with the new password: %v", err)
+	}
+}
+
+func TestChangePasswordRateLimits(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	// Per account, over several addresses: even the right password is
+	// refused once the limit is reached
+	for i := 0; i < h.cfg.AuthConfig.PasswordChangeMaxPerHour; i++ {
+		changePassword(t, h, "192.0.2."+string(rune('1'+i)), "bob", "wrong")
+	}
+	if status, res := changePassword(t, h, "192.0.2.9", "bob", "hunter22"); status != http.StatusTooManyRequests || res.Code != "rate_limited" {
+		t.Errorf("change over the account limit = %d %q, want 429 rate_limited", status, res.Code)
+	}
+	if _, err := h.ldapClient.AuthenticateUser("bob", "hunter22"); err != nil {
+		t.Errorf("bob's password changed over the limit: %v", err)
+	}
+
+	// Per address, unknown accounts count too
+	const ip = "198.51.100.1"
+	for i := 0; i < h.cfg.AuthConfig.PasswordChangeMaxPerIPHour; i++ {
+		changePassword(t, h, ip, "nobody"+string(rune('a'+i)), "wrong")
+	}
+	if status, _ := changePassword(t, h, ip, "alice", "secret123"); status != http.StatusTooManyRequests {
+		t.Errorf("change over the address limit = %d, want 429", status)
+	}
+}
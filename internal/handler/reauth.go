@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"encoding/json"
+	"go-ldap-sso/db/employees"
+	"go-ldap-sso/db/passkeys"
+	"go-ldap-sso/internal/auth"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"go-ldap-sso/pkg/authz"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// Re-authentication methods offered besides the second factors
+const reauthMethodPassword = "password"
+
+type ReauthStartRes struct {
+	// MFAToken is sent with every step, it limits the attempts like the
+	// second step of a login
+	MFAToken string   `json:"mfa_token"`
+	Methods  []string `json:"methods"`
+}
+
+type ReauthPasswordReq struct {
+	MFAToken string `json:"mfa_token"`
+	Password string `json:"password"`
+}
+
+type ReauthRes struct {
+	Token    string    `json:"token"`
+	AuthTime time.Time `json:"auth_time"`
+	AMR      []string  `json:"amr"`
+}
+
+// HandleReauthPage serves GET /reauth, where RequireRecentAuth sends
+// browsers.
+func (h *AuthHandler) HandleReauthPage(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, "templates/reauth.html")
+}
+
+// HandleReauthStart serves POST /api/reauth, starting a re-authentication of
+// the caller and listing the methods they can use.
+func (h *AuthHandler) HandleReauthStart(w http.ResponseWriter, r *http.Request) {
+	employee := h.mfaEmployee(w, r)
+	if employee == nil {
+		return
+	}
+	status, err := h.mfaState(r.Context(), employee.ID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	token, err := h.mfaStore.CreateChallenge(r.Context(), employee.ID, time.Duration(h.cfg.AuthConfig.MFAChallengeMinutes)*time.Minute)
+	if err != nil {
+		log.Printf("❌ Failed to create re-authentication challenge for %s: %v", employee.UID, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to start re-authentication")
+		return
+	}
+	writeJSON(w, http.StatusOK, ReauthStartRes{
+		MFAToken: token,
+		Methods:  append([]string{reauthMethodPassword}, status.Methods()...),
+	})
+}
+
+// reauthEmployee returns the caller's employee for a re-authentication
+// step, counting an attempt against its challenge, or answers the request
+// and returns nil.
+func (h *AuthHandler) reauthEmployee(w http.ResponseWriter, r *http.Request, token string) *employees.Employee {
+	_, employee := h.challengeEmployee(w, r, token)
+	if employee == nil {
+		return nil
+	}
+	if employee.ID != authz.MustFromContext(r.Context()).EmployeeID {
+		writeError(w, http.StatusUnauthorized, "mfa_challenge_invalid", "re-authentication expired, start again")
+		return nil
+	}
+	return employee
+}
+
+// stepUp reissues the caller's token, in the same session, as authenticated
+// now with factors. Factors proven within the last MFAChallengeMinutes are
+// kept, so a password and a second factor entered one after the other add
+// up to a multi-factor authentication.
+func (h *AuthHandler) stepUp(w http.ResponseWriter, r *http.Request, employee *employees.Employee, factors ...string) {
+	principal := authz.MustFromContext(r.Context())
+	if principal.SessionID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "no login session to re-authenticate")
+		return
+	}
+
+	amr := slices.Clone(factors)
+	if time.Since(principal.AuthTime) < time.Duration(h.cfg.AuthConfig.MFAChallengeMinutes)*time.Minute {
+		for _, m := range principal.AMR {
+			if !slices.Contains(amr, m) {
+				amr = append(amr, m)
+			}
+		}
+	}
+	used := 0
+	for _, m := range []string{authz.AMRPassword, authz.AMROTP, authz.AMRHardwareKey} {
+		if slices.Contains(amr, m) {
+			used++
+		}
+	}
+	if used > 1 && !slices.Contains(amr, authz.AMRMultiFactor) {
+		amr = append(amr, authz.AMRMultiFactor)
+	}
+
+	claims, ok := h.tokenClaims(w, r, employee)
+	if !ok {
+		return
+	}
+	claims.SessionID = principal.SessionID
+	claims.AMR = amr
+	claims.AuthTime = time.Now()
+	token, err := auth.GenerateToken(claims, h.cfg)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "token generation error")
+		return
+	}
+	setTokenCookie(w, token)
+
+	log.Printf("🔐 %s re-authenticated with %s", employee.UID, strings.Join(amr, ", "))
+	writeJSON(w, http.StatusOK, ReauthRes{Token: token, AuthTime: claims.AuthTime.Truncate(time.Second), AMR: amr})
+}
+
+// HandleReauthPassword serves POST /api/reauth/password
+func (h *AuthHandler) HandleReauthPassword(w http.ResponseWriter, r *http.Request) {
+	var req ReauthPasswordReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	employee := h.reauthEmployee(w, r, req.MFAToken)
+	if employee == nil {
+		return
+	}
+
+	result, err := h.ldapClient.AuthenticateUser(employee.UID, req.Password)
+	if err != nil {
+		log.Printf("❌ Re-authentication failed for %s: %v", employee.UID, err)
+		writeLDAPError(w, err)
+		return
+	}
+	if !strings.EqualFold(result.Email, employee.Email) {
+		log.Printf("❌ Re-authentication of %s bound to %s", employee.UID, result.Email)
+		e := ldapErrors[ldapauth.CodeInvalidCredentials]
+		writeError(w, e.status, string(ldapauth.CodeInvalidCredentials), e.message)
+		return
+	}
+	h.stepUp(w, r, employee, authz.AMRPassword)
+}
+
+// HandleReauthTOTP serves POST /api/reauth/totp, taking an authenticator app
+// or recovery code.
+func (h *AuthHandler) HandleReauthTOTP(w http.ResponseWriter, r *http.Request) {
+	var req MFAVerifyReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	employee := h.reauthEmployee(w, r, req.MFAToken)
+	if employee == nil {
+		return
+	}
+
+	status, err := h.mfaState(r.Context(), employee.ID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	if !status.TOTP {
+		writeError(w, http.StatusConflict, "mfa_not_enrolled", "no authenticator enrolled")
+		return
+	}
+	if _, err := h.verifySecondFactor(r.Context(), employee.ID, req.Code); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	h.stepUp(w, r, employee, authz.AMROTP)
+}
+
+// HandleReauthPasskeyBegin serves POST /api/reauth/webauthn/begin
+func (h *AuthHandler) HandleReauthPasskeyBegin(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyBeginReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	employee := h.reauthEmployee(w, r, req.MFAToken)
+	if employee == nil {
+		return
+	}
+	user, err := h.passkeyUser(r.Context(), employee)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	if len(user.credentials) == 0 {
+		writeError(w, http.StatusConflict, "mfa_not_enrolled", "no passkey registered")
+		return
+	}
+
+	options, data, err := h.webAuthn.BeginLogin(user)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	h.beginPasskeyCeremony(w, r, &employee.ID, passkeys.CeremonyMFA, options, data)
+}
+
+// HandleReauthPasskeyFinish serves POST /api/reauth/webauthn/finish
+func (h *AuthHandler) HandleReauthPasskeyFinish(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyFinishReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	employee := h.reauthEmployee(w, r, req.MFAToken)
+	if employee == nil {
+		return
+	}
+	data := h.takePasskeyCeremony(w, r, req, passkeys.CeremonyMFA, employee.ID)
+	if data == nil {
+		return
+	}
+
+	ctx := r.Context()
+	user, err := h.passkeyUser(ctx, employee)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err == nil {
+		var credential *webauthn.Credential
+		if credential, err = h.webAuthn.ValidateLogin(user, *data, parsed); err == nil {
+			err = h.usePasskey(ctx, employee, credential)
+		}
+	}
+	if err != nil {
+		log.Printf("❌ Passkey re-authentication failed for %s: %v", employee.UID, err)
+		writePasskeyError(w, err)
+		return
+	}
+	h.stepUp(w, r, employee, passkeyAMR(parsed)...)
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"go-ldap-sso/internal/auth"
+	"go-ldap-sso/pkg/authz"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// reauthStep posts a re-authentication step and returns the answer, failing
+// the test unless it succeeded.
+func reauthStep(t *testing.T, h *AuthHandler, path, token string, body any) ReauthRes {
+	t.Helper()
+	w, code := postJSON(t, h, path, token, body)
+	var res ReauthRes
+	if err := json.Unmarshal(w.Body.Bytes(), &res); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("%s = %d %q", path, w.Code, code)
+	}
+	return res
+}
+
+func sorted(amr []string) []string {
+	amr = slices.Clone(amr)
+	slices.Sort(amr)
+	return amr
+}
+
+func TestStepUpFactors(t *testing.T) {
+	const challenge = 5 * time.Minute
+	tests := []struct {
+		name     string
+		authTime time.Duration
+		amr      []string
+		step     string
+		want     []string
+	}{
+		{"otp after a recent password", time.Minute, []string{authz.AMRPassword}, "totp",
+			[]string{authz.AMRMultiFactor, authz.AMROTP, authz.AMRPassword}},
+		{"password after a recent otp", time.Minute, []string{authz.AMROTP}, "password",
+			[]string{authz.AMRMultiFactor, authz.AMROTP, authz.AMRPassword}},
+		{"otp after an old password", challenge + time.Minute, []string{authz.AMRPassword}, "totp",
+			[]string{authz.AMROTP}},
+		{"password after an old otp", challenge + time.Minute, []string{authz.AMROTP}, "password",
+			[]string{authz.AMRPassword}},
+		// The same factor twice is still one factor
+		{"password after a recent password", time.Minute, []string{authz.AMRPassword}, "password",
+			[]string{authz.AMRPassword}},
+		{"password after a recent email code", time.Minute, []string{authz.AMREmail}, "password",
+			[]string{authz.AMREmail, authz.AMRPassword}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t)
+			if time.Duration(h.cfg.AuthConfig.MFAChallengeMinutes)*time.Minute != challenge {
+				t.Fatalf("MFAChallengeMinutes = %d, the cases assume 5", h.cfg.AuthConfig.MFAChallengeMinutes)
+			}
+			id := createEmployee(t, h, "alice", false)
+			_, login := ldapLogin(t, h, "alice", "secret123")
+			secret, _ := enrollTOTP(t, h, id)
+			token := reissue(t, h, login.Token, time.Now().Add(-tt.authTime), tt.amr...)
+			mfaToken := reauthToken(t, h, token)
+
+			var res ReauthRes
+			if tt.step == "totp" {
+				res = reauthStep(t, h, "/api/reauth/totp", token, MFAVerifyReq{MFAToken: mfaToken, Code: totpCode(t, secret)})
+			} else {
+				res = reauthStep(t, h, "/api/reauth/password", token, ReauthPasswordReq{MFAToken: mfaToken, Password: "secret123"})
+			}
+			if got := sorted(res.AMR); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("amr = %v, want %v", got, tt.want)
+			}
+
+			claims, err := auth.ValidateToken(res.Token, h.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.SessionID != sessionOf(t, h, login.Token) {
+				t.Error("step-up token is for another session")
+			}
+			if time.Since(claims.AuthTime) > time.Minute || !reflect.DeepEqual(sorted(claims.AMR), tt.want) {
+				t.Errorf("token auth_time %v, amr %v, want now and %v", claims.AuthTime, claims.AMR, tt.want)
+			}
+		})
+	}
+}
+
+func TestStepUpPasswordThenOTP(t *testing.T) {
+	h, _ := newTestHandler(t)
+	id := createEmployee(t, h, "alice", false)
+	_, login := ldapLogin(t, h, "alice", "secret123")
+	secret, _ := enrollTOTP(t, h, id)
+	stale := reissue(t, h, login.Token, time.Now().Add(-time.Hour), authz.AMRPassword)
+
+	// The same challenge carries through both steps, each with the token the
+	// last one returned
+	mfaToken := reauthToken(t, h, stale)
+	first := reauthStep(t, h, "/api/reauth/password", stale, ReauthPasswordReq{MFAToken: mfaToken, Password: "secret123"})
+	if !reflect.DeepEqual(first.AMR, []string{authz.AMRPassword}) {
+		t.Fatalf("after the password amr = %v, want [pwd]", first.AMR)
+	}
+	second := reauthStep(t, h, "/api/reauth/totp", first.Token, MFAVerifyReq{MFAToken: mfaToken, Code: totpCode(t, secret)})
+	if want := []string{authz.AMRMultiFactor, authz.AMROTP, authz.AMRPassword}; !reflect.DeepEqual(sorted(second.AMR), want) {
+		t.Errorf("after the code amr = %v, want %v", second.AMR, want)
+	}
+
+	// Good for operations needing mfa, like break-glass
+	handler := authz.RequireRecentAuth("/reauth", 10*time.Minute, authz.AMRMultiFactor)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"password only", first.Token, http.StatusUnauthorized},
+		{"password and code", second.Token, http.StatusNoContent},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+tc.token)
+		w := httptest.NewRecorder()
+		h.HybridAuthMiddleware(handler).ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s = %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
+
+func TestStepUpFailures(t *testing.T) {
+	h, _ := newTestHandler(t)
+	createEmployee(t, h, "alice", false)
+	bobID := createEmployee(t, h, "bob", false)
+	_, alice := ldapLogin(t, h, "alice", "secret123")
+	_, bob := ldapLogin(t, h, "bob", "hunter22")
+	mfaToken := reauthToken(t, h, alice.Token)
+
+	// Another employee's password doesn't re-authenticate alice
+	w, code := postJSON(t, h, "/api/reauth/password", alice.Token, ReauthPasswordReq{MFAToken: mfaToken, Password: "hunter22"})
+	if w.Code != http.StatusUnauthorized || code != "invalid_credentials" {
+		t.Errorf("wrong password = %d %q, want 401 invalid_credentials", w.Code, code)
+	}
+	// Nor does her challenge serve bob
+	w, code = postJSON(t, h, "/api/reauth/password", bob.Token, ReauthPasswordReq{MFAToken: mfaToken, Password: "hunter22"})
+	if w.Code != http.StatusUnauthorized || code != "mfa_challenge_invalid" {
+		t.Errorf("alice's challenge used by bob = %d %q, want 401 mfa_challenge_invalid", w.Code, code)
+	}
+	// No authenticator to check a code against
+	w, code = postJSON(t, h, "/api/reauth/totp", alice.Token, MFAVerifyReq{MFAToken: mfaToken, Code: "123456"})
+	if w.Code != http.StatusConflict || code != "mfa_not_enrolled" {
+		t.Errorf("code without an authenticator = %d %q, want 409 mfa_not_enrolled", w.Code, code)
+	}
+
+	// A principal without a login session has nothing to step up
+	employee, err := h.employees.FindActiveByID(context.Background(), bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/reauth/password", nil)
+	r = r.WithContext(authz.WithPrincipal(r.Context(), &authz.Principal{EmployeeID: bobID, AuthTime: time.Now()}))
+	var res ErrorRes
+	rec := serve(t, func(w http.ResponseWriter, r *http.Request) { h.stepUp(w, r, employee, authz.AMRPassword) }, r, &res)
+	if rec.Code != http.StatusBadRequest || res.Code != "invalid_request" {
+		t.Errorf("stepUp() without a session = %d %q, want 400 invalid_request", rec.Code, res.Code)
+	}
+}
@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-ldap-sso/db/employees"
+	"go-ldap-sso/db/relationtuples"
+	"go-ldap-sso/internal/rebac"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultTupleLimit = 100
+	maxTupleLimit     = 1000
+	maxTupleWrites    = 500
+)
+
+type RelationCheckReq struct {
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+	Subject  string `json:"subject"`
+}
+
+type RelationCheckRes struct {
+	Allowed bool `json:"allowed"`
+}
+
+type RelationListObjectsReq struct {
+	Namespace string `json:"namespace"`
+	Relation  string `json:"relation"`
+	Subject   string `json:"subject"`
+}
+
+type RelationListObjectsRes struct {
+	Objects []string `json:"objects"`
+}
+
+// RelationWriteReq holds tuples as strings, "merchant:42#owner@employee:johndoe".
+type RelationWriteReq struct {
+	Write  []string `json:"write"`
+	Delete []string `json:"delete"`
+}
+
+type RelationTuplesRes struct {
+	Tuples []string `json:"tuples"`
+}
+
+func writeRelationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rebac.ErrInvalidTuple):
+		writeError(w, http.StatusBadRequest, "invalid_tuple", err.Error())
+	case errors.Is(err, rebac.ErrUnknownRelation):
+		writeError(w, http.StatusBadRequest, "unknown_relation", err.Error())
+	case errors.Is(err, rebac.ErrTooDeep):
+		writeError(w, http.StatusUnprocessableEntity, "too_deep", err.Error())
+	case errors.Is(err, rebac.ErrTooManyObjects):
+		writeError(w, http.StatusUnprocessableEntity, "too_many_objects", err.Error())
+	default:
+		log.Printf("❌ Relation request failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "relation request failed")
+	}
+}
+
+// activeSubject reports whether subject may be granted anything: employees
+// must still be active, other subjects are taken as they are.
+func (h *AuthHandler) activeSubject(ctx context.Context, subject rebac.Subject) (bool, error) {
+	if subject.Namespace != "employee" || subject.Relation != "" {
+		return true, nil
+	}
+	_, err := h.employees.FindActive(ctx, subject.ID)
+	if errors.Is(err, employees.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// HandleRelationCheck serves POST /api/relations/check
+func (h *AuthHandler) HandleRelationCheck(w http.ResponseWriter, r *http.Request) {
+	var req RelationCheckReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	object, err := rebac.ParseObject(req.Object)
+	if err != nil {
+		writeRelationError(w, err)
+		return
+	}
+	subject, err := rebac.ParseSubject(req.Subject)
+	if err != nil {
+		writeRelationError(w, err)
+		return
+	}
+
+	active, err := h.activeSubject(r.Context(), subject)
+	if err != nil {
+		writeRelationError(w, err)
+		return
+	}
+	allowed := false
+	if active {
+		allowed, err = h.relations.Check(r.Context(), object, req.Relation, subject)
+		if err != nil {
+			writeRelationError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, RelationCheckRes{Allowed: allowed})
+}
+
+// HandleRelationExpand serves POST /api/relations/expand
+func (h *AuthHandler) HandleRelationExpand(w http.ResponseWriter, r *http.Request) {
+	var req RelationCheckReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	object, err := rebac.ParseObject(req.Object)
+	if err != nil {
+		writeRelationError(w, err)
+		return
+	}
+
+	tree, err := h.relations.Expand(r.Context(), object, req.Relation)
+	if err != nil {
+		writeRelationError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tree)
+}
+
+// HandleRelationListObjects serves POST /api/relations/list-objects
+func (h *AuthHandler) HandleRelationListObjects(w http.ResponseWriter, r *http.Request) {
+	var req RelationListObjectsReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	subject, err := rebac.ParseSubject(req.Subject)
+	if err != nil {
+		writeRelationError(w, err)
+		return
+	}
+
+	active, err := h.activeSubject(r.Context(), subject)
+	if err != nil {
+		writeRelationError(w, err)
+		return
+	}
+	objects := []string{}
+	if active {
+		objects, err = h.relations.ListObjects(r.Context(), req.Namespace, req.Relation, subject)
+		if err != nil {
+			writeRelationError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, RelationListObjectsRes{Objects: objects})
+}
+
+// HandleRelationTuples serves GET /api/relations/tuples?object=&relation=&subject=&limit=
+func (h *AuthHandler) HandleRelationTuples(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var filter relationtuples.Filter
+
+	if s := q.Get("object"); s != "" {
+		object, err := rebac.ParseObject(s)
+		if err != nil {
+			writeRelationError(w, err)
+			return
+		}
+		filter.Namespace, filter.ObjectID = object.Namespace, object.ID
+	} else {
+		filter.Namespace = q.Get("namespace")
+	}
+	filter.Relation = q.Get("relation")
+	if s := q.Get("subject"); s != "" {
+		subject, err := rebac.ParseSubject(s)
+		if err != nil {
+			writeRelationError(w, err)
+			return
+		}
+		filter.Subject = &subject
+	}
+
+	limit, err := queryInt(r, "limit", defaultTupleLimit)
+	if err != nil || limit < 1 || limit > maxTupleLimit {
+		writeError(w, http.StatusBadRequest, "invalid_request", "limit must be between 1 and "+strconv.Itoa(maxTupleLimit))
+		return
+	}
+
+	tuples, err := h.relationTuples.Read(r.Context(), filter, limit)
+	if err != nil {
+		writeRelationError(w, err)
+		return
+	}
+	res := RelationTuplesRes{Tuples: make([]string, 0, len(tuples))}
+	for _, t := range tuples {
+		res.Tuples = append(res.Tuples, t.String())
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// HandleRelationWrite serves POST /api/relations/tuples, applying the deletes
+// and writes of the body atomically after checking them against the schema.
+func (h *AuthHandler) HandleRelationWrite(w http.ResponseWriter, r *http.Request) {
+	var req RelationWriteReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	if len(req.Write)+len(req.Delete) == 0 || len(req.Write)+len(req.Delete) > maxTupleWrites {
+		writeError(w, http.StatusBadRequest, "invalid_request", "between 1 and "+strconv.Itoa(maxTupleWrites)+" tuples per request")
+		return
+	}
+
+	parse := func(list []string, validate bool) ([]rebac.Tuple, error) {
+		tuples := make([]rebac.Tuple, 0, len(list))
+		for _, s := range list {
+			t, err := rebac.ParseTuple(s)
+			if err != nil {
+				return nil, err
+			}
+			if validate {
+				if err := h.relations.Schema().ValidateTuple(t); err != nil {
+					return nil, err
+				}
+			}
+			tuples = append(tuples, t)
+		}
+		return tuples, nil
+	}
+	writes, err := parse(req.Write, true)
+	if err != nil {
+		writeRelationError(w, err)
+		return
+	}
+	// Deletes aren't held to the schema so tuples left over from an older
+	// schema can still be removed
+	deletes, err := parse(req.Delete, false)
+	if err != nil {
+		writeRelationError(w, err)
+		return
+	}
+
+	if err := h.relationTuples.Apply(r.Context(), writes, deletes); err != nil {
+		writeRelationError(w, err)
+		return
+	}
+	log.Printf("🔗 Relation tuples: %d written, %d deleted", len(writes), len(deletes))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"go-ldap-sso/pkg/authz"
 	"log"
 	"net/http"
+	"time"
 )
 
 func SetupRoutes(h *AuthHandler) *http.Server {
@@ -29,8 +31,92 @@ func SetupRoutes(h *AuthHandler) *http.Server {
 
 	mux.HandleFunc("/login", h.HandleLogin)
 	mux.HandleFunc("/ldap-login", h.HandleLDAPLogin)
+	mux.HandleFunc("POST /ldap-login/mfa", h.HandleMFAVerify)
+	mux.HandleFunc("POST /ldap-login/mfa/enroll", h.HandleMFAEnroll)
+	mux.HandleFunc("POST /ldap-login/mfa/webauthn/begin", h.HandlePasskeyMFABegin)
+	mux.HandleFunc("POST /ldap-login/mfa/webauthn/finish", h.HandlePasskeyMFAFinish)
+	mux.HandleFunc("POST /webauthn/login/begin", h.HandlePasskeyLoginBegin)
+	mux.HandleFunc("POST /webauthn/login/finish", h.HandlePasskeyLoginFinish)
+	mux.HandleFunc("POST /email-login", h.HandleEmailLogin)
+	mux.HandleFunc("POST /email-login/verify", h.HandleEmailLoginVerify)
+	mux.HandleFunc("GET /email-login/link", h.HandleEmailLoginLinkPage)
+	mux.HandleFunc("POST /email-login/link", h.HandleEmailLoginLink)
 	mux.HandleFunc("/sso-login", h.HandleSSOLogin)
 
+	mux.HandleFunc("GET /password/change", h.HandleChangePasswordPage)
+	mux.HandleFunc("POST /password/change", h.HandleChangePassword)
+	mux.HandleFunc("GET /password/forgot", h.HandleForgotPasswordPage)
+	mux.HandleFunc("POST /password/forgot", h.HandleForgotPassword)
+	mux.HandleFunc("GET /password/reset", h.HandleResetPasswordPage)
+	mux.HandleFunc("POST /password/reset", h.HandleResetPassword)
+
+	directoryRead := func(fn http.HandlerFunc) http.Handler {
+		return h.HybridAuthMiddleware(authz.RequireScopes("directory:read")(fn))
+	}
+	mux.Handle("GET /api/directory/users", directoryRead(h.HandleDirectorySearch))
+	mux.Handle("GET /api/directory/users/{uid}", directoryRead(h.HandleDirectoryUser))
+	mux.Handle("GET /api/directory/groups/{cn}/members", directoryRead(h.HandleDirectoryGroupMembers))
+
+	authenticated := func(fn http.HandlerFunc) http.Handler {
+		return h.HybridAuthMiddleware(fn)
+	}
+	// Sensitive operations also need a login within STEP_UP_MAX_AGE_MINUTES,
+	// with factors if given; browsers are sent to /reauth for it
+	stepUpAge := time.Duration(h.cfg.AuthConfig.StepUpMaxAgeMinutes) * time.Minute
+	recentAuth := func(next http.Handler, factors ...string) http.Handler {
+		return authz.RequireRecentAuth("/reauth", stepUpAge, factors...)(next)
+	}
+	sensitive := func(fn http.HandlerFunc) http.Handler {
+		return h.HybridAuthMiddleware(recentAuth(fn))
+	}
+	mux.Handle("POST /api/scope-requests", authenticated(h.HandleCreateScopeRequest))
+	mux.Handle("GET /api/scope-requests", authenticated(h.HandleListScopeRequests))
+	mux.Handle("GET /api/scope-requests/pending", authenticated(h.HandleListApprovableScopeRequests))
+	mux.Handle("POST /api/scope-requests/{id}/approve", sensitive(h.HandleApproveScopeRequest))
+	mux.Handle("POST /api/scope-requests/{id}/reject", authenticated(h.HandleRejectScopeRequest))
+	mux.Handle("POST /api/scope-requests/{id}/cancel", authenticated(h.HandleCancelScopeRequest))
+
+	mux.Handle("GET /mfa", authenticated(h.HandleMFAPage))
+	mux.Handle("GET /api/mfa", authenticated(h.HandleMFAStatus))
+	mux.Handle("POST /api/mfa/totp/enroll", sensitive(h.HandleTOTPEnroll))
+	mux.Handle("POST /api/mfa/totp/confirm", authenticated(h.HandleTOTPConfirm))
+	mux.Handle("POST /api/mfa/totp/disable", sensitive(h.HandleTOTPDisable))
+	mux.Handle("POST /api/mfa/recovery-codes", sensitive(h.HandleRegenerateRecoveryCodes))
+	mux.Handle("POST /api/webauthn/register/begin", sensitive(h.HandlePasskeyRegisterBegin))
+	mux.Handle("POST /api/webauthn/register/finish", sensitive(h.HandlePasskeyRegisterFinish))
+	mux.Handle("GET /api/webauthn/credentials", authenticated(h.HandleListPasskeys))
+	mux.Handle("POST /api/webauthn/credentials/{id}/delete", sensitive(h.HandleDeletePasskey))
+
+	mux.Handle("GET /reauth", authenticated(h.HandleReauthPage))
+	mux.Handle("POST /api/reauth", authenticated(h.HandleReauthStart))
+	mux.Handle("POST /api/reauth/password", authenticated(h.HandleReauthPassword))
+	mux.Handle("POST /api/reauth/totp", authenticated(h.HandleReauthTOTP))
+	mux.Handle("POST /api/reauth/webauthn/begin", authenticated(h.HandleReauthPasskeyBegin))
+	mux.Handle("POST /api/reauth/webauthn/finish", authenticated(h.HandleReauthPasskeyFinish))
+
+	mux.Handle("GET /sessions", authenticated(h.HandleSessionsPage))
+	mux.Handle("GET /api/sessions", authenticated(h.HandleListSessions))
+	mux.Handle("POST /api/sessions/{id}/revoke", authenticated(h.HandleRevokeSession))
+	mux.Handle("POST /api/admin/employees/{employee}/sessions/revoke",
+		h.HybridAuthMiddleware(authz.RequireScopes("sessions:revoke")(recentAuth(http.HandlerFunc(h.HandleAdminRevokeSessions)))))
+
+	mux.Handle("POST /api/break-glass",
+		h.HybridAuthMiddleware(authz.RequireScopes(h.cfg.AuthConfig.BreakGlassScope)(
+			recentAuth(http.HandlerFunc(h.HandleBreakGlass), authz.AMRMultiFactor))))
+
+	mux.Handle("POST /authz/check",
+		h.HybridAuthMiddleware(authz.RequireScopes("authz:check")(http.HandlerFunc(h.HandleAuthzCheck))))
+
+	relationsRead := func(fn http.HandlerFunc) http.Handler {
+		return h.HybridAuthMiddleware(authz.RequireScopes("relations:read")(fn))
+	}
+	mux.Handle("POST /api/relations/check", relationsRead(h.HandleRelationCheck))
+	mux.Handle("POST /api/relations/expand", relationsRead(h.HandleRelationExpand))
+	mux.Handle("POST /api/relations/list-objects", relationsRead(h.HandleRelationListObjects))
+	mux.Handle("GET /api/relations/tuples", relationsRead(h.HandleRelationTuples))
+	mux.Handle("POST /api/relations/tuples",
+		h.HybridAuthMiddleware(authz.RequireScopes("relations:write")(recentAuth(http.HandlerFunc(h.HandleRelationWrite)))))
+
 	mux.HandleFunc("/logout", h.HandleLogout)
 	mux.HandleFunc("/", h.HybridAuthMiddleware(http.HandlerFunc(h.IndexHandler)).ServeHTTP)
 
@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"go-ldap-sso/db/scoperequests"
+	"go-ldap-sso/pkg/authz"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ScopeRequestReq struct {
+	Scope  string `json:"scope"`
+	Reason string `json:"reason"`
+	// DurationHours of 0 asks for a permanent grant
+	DurationHours int `json:"duration_hours"`
+}
+
+type ScopeDecisionReq struct {
+	Note string `json:"note"`
+}
+
+type ScopeRequestRes struct {
+	ID            int        `json:"id"`
+	Employee      string     `json:"employee"`
+	Scope         string     `json:"scope"`
+	Reason        string     `json:"reason"`
+	DurationHours *int       `json:"duration_hours,omitempty"`
+	Status        string     `json:"status"`
+	DecidedBy     string     `json:"decided_by,omitempty"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty"`
+	DecisionNote  string     `json:"decision_note,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type ScopeRequestListRes struct {
+	Requests []ScopeRequestRes `json:"requests"`
+}
+
+func newScopeRequestRes(q *scoperequests.Request) ScopeRequestRes {
+	return ScopeRequestRes{
+		ID:            q.ID,
+		Employee:      q.Employee,
+		Scope:         q.Scope,
+		Reason:        q.Reason,
+		DurationHours: q.DurationHours,
+		Status:        q.Status,
+		DecidedBy:     q.DecidedBy,
+		DecidedAt:     q.DecidedAt,
+		DecisionNote:  q.DecisionNote,
+		CreatedAt:     q.CreatedAt,
+	}
+}
+
+func newScopeRequestListRes(list []scoperequests.Request) ScopeRequestListRes {
+	res := ScopeRequestListRes{Requests: []ScopeRequestRes{}}
+	for i := range list {
+		res.Requests = append(res.Requests, newScopeRequestRes(&list[i]))
+	}
+	return res
+}
+
+// scopeRequestErrors maps workflow errors to the status and code returned.
+var scopeRequestErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{scoperequests.ErrNotFound, http.StatusNotFound, "not_found"},
+	{scoperequests.ErrUnknownScope, http.StatusBadRequest, "unknown_scope"},
+	{scoperequests.ErrNotRequestable, http.StatusUnprocessableEntity, "not_requestable"},
+	{scoperequests.ErrDuration, http.StatusUnprocessableEntity, "invalid_duration"},
+	{scoperequests.ErrAlreadyPending, http.StatusConflict, "already_pending"},
+	{scoperequests.ErrNotPending, http.StatusConflict, "not_pending"},
+	{scoperequests.ErrNotApprover, http.StatusForbidden, "not_approver"},
+	{scoperequests.ErrSelfApproval, http.StatusForbidden, "self_approval"},
+}
+
+func writeScopeRequestError(w http.ResponseWriter, err error) {
+	for _, e := range scopeRequestErrors {
+		if errors.Is(err, e.err) {
+			writeError(w, e.status, e.code, err.Error())
+			return
+		}
+	}
+	log.Printf("❌ Scope request failed: %v", err)
+	writeError(w, http.StatusInternalServerError, "internal_error", "scope request failed")
+}
+
+// requestingEmployee returns the caller's employee id, answering 403 itself
+// when the caller isn't an active employee.
+func requestingEmployee(w http.ResponseWriter, r *http.Request) (int, bool) {
+	p, ok := authz.FromContext(r.Context())
+	if !ok || p.EmployeeID == 0 {
+		writeError(w, http.StatusForbidden, "not_employee", "only active employees can use scope requests")
+		return 0, false
+	}
+	return p.EmployeeID, true
+}
+
+func requestID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not_found", "scope request not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// HandleCreateScopeRequest serves POST /api/scope-requests
+func (h *AuthHandler) HandleCreateScopeRequest(w http.ResponseWriter, r *http.Request) {
+	employeeID, ok := requestingEmployee(w, r)
+	if !ok {
+		return
+	}
+
+	var req ScopeRequestReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Scope == "" || req.Reason == "" || req.DurationHours < 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "scope and reason are required, duration_hours must not be negative")
+		return
+	}
+
+	q, err := h.scopeRequests.Create(r.Context(), employeeID, req.Scope, req.Reason, req.DurationHours)
+	if err != nil {
+		writeScopeRequestError(w, err)
+		return
+	}
+	log.Printf("📝 Scope request #%d: %s asks for %s", q.ID, q.Employee, q.Scope)
+	writeJSON(w, http.StatusCreated, newScopeRequestRes(q))
+}
+
+// HandleListScopeRequests serves GET /api/scope-requests, the caller's own requests
+func (h *AuthHandler) HandleListScopeRequests(w http.ResponseWriter, r *http.Request) {
+	employeeID, ok := requestingEmployee(w, r)
+	if !ok {
+		return
+	}
+	list, err := h.scopeRequests.ListByEmployee(r.Context(), employeeID)
+	if err != nil {
+		writeScopeRequestError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newScopeRequestListRes(list))
+}
+
+// HandleListApprovableScopeRequests serves GET /api/scope-requests/pending,
+// the requests waiting for the caller's decision
+func (h *AuthHandler) HandleListApprovableScopeRequests(w http.ResponseWriter, r *http.Request) {
+	employeeID, ok := requestingEmployee(w, r)
+	if !ok {
+		return
+	}
+	list, err := h.scopeRequests.ListApprovable(r.Context(), employeeID)
+	if err != nil {
+		writeScopeRequestError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newScopeRequestListRes(list))
+}
+
+// HandleApproveScopeRequest serves POST /api/scope-requests/{id}/approve
+func (h *AuthHandler) HandleApproveScopeRequest(w http.ResponseWriter, r *http.Request) {
+	h.decideScopeRequest(w, r, true)
+}
+
+// HandleRejectScopeRequest serves POST /api/scope-requests/{id}/reject
+func (h *AuthHandler) HandleRejectScopeRequest(w http.ResponseWriter, r *http.Request) {
+	h.decideScopeRequest(w, r, false)
+}
+
+func (h *AuthHandler) decideScopeRequest(w http.ResponseWriter, r *http.Request, approve bool) {
+	approverID, ok := requestingEmployee(w, r)
+	if !ok {
+		return
+	}
+	id, ok := requestID(w, r)
+	if !ok {
+		return
+	}
+
+	// The note is optional, an empty body is fine
+	var req ScopeDecisionReq
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+			return
+		}
+	}
+
+	q, err := h.scopeRequests.Decide(r.Context(), id, approverID, approve, strings.TrimSpace(req.Note))
+	if err != nil {
+		writeScopeRequestError(w, err)
+		return
+	}
+	log.Printf("✅ Scope request #%d %s by %s", q.ID, q.Status, q.DecidedBy)
+	writeJSON(w, http.StatusOK, newScopeRequestRes(q))
+}
+
+// HandleCancelScopeRequest serves POST /api/scope-requests/{id}/cancel
+func (h *AuthHandler) HandleCancelScopeRequest(w http.ResponseWriter, r *http.Request) {
+	employeeID, ok := requestingEmployee(w, r)
+	if !ok {
+		return
+	}
+	id, ok := requestID(w, r)
+	if !ok {
+		return
+	}
+
+	q, err := h.scopeRequests.Cancel(r.Context(), id, employeeID)
+	if err != nil {
+		writeScopeRequestError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newScopeRequestRes(q))
+}
@@ -0,0 +1,320 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db/authsessions"
+	"go-ldap-sso/db/employees"
+	"go-ldap-sso/internal/helper"
+	"go-ldap-sso/internal/session"
+	"go-ldap-sso/pkg/authz"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/gorilla/sessions"
+)
+
+// authSessionName is the cookie of the server-side login session.
+const authSessionName = "auth-session"
+
+// startSession records a login of employee (nil when unknown) by method and
+// sets the session cookie, returning the session id. Logins over the
+// employee's session limit fail with authsessions.ErrLimitReached, or revoke
+// the oldest sessions in evict-oldest mode.
+func (h *AuthHandler) startSession(w http.ResponseWriter, r *http.Request, employee *employees.Employee, method string) (string, error) {
+	// A login always starts a fresh session, never reuses the old id
+	s, _ := h.store.New(r, authSessionName)
+	s.ID = ""
+	s.IsNew = true
+	s.Values = map[interface{}]interface{}{session.KeyMethod: method}
+	if employee != nil {
+		s.Values[session.KeyEmployeeID] = employee.ID
+	}
+	if err := s.Save(r, w); err != nil {
+		return "", err
+	}
+	if employee == nil {
+		return s.ID, nil
+	}
+
+	limit, err := h.sessionLimit(r.Context(), employee.ID)
+	if err != nil || limit == 0 {
+		return s.ID, err
+	}
+	evict := h.cfg.AuthConfig.SessionLimitMode == config.SessionLimitEvictOldest
+	evicted, err := h.loginSessions.EnforceLimit(r.Context(), employee.ID, s.ID, limit, h.sessionIdle(), evict)
+	if errors.Is(err, authsessions.ErrLimitReached) {
+		log.Printf("🚫 Refused %s login of %s: %d active sessions allowed", method, employee.UID, limit)
+		// The row is gone already, only the cookie is left to clear
+		s.ID = ""
+		s.Options.MaxAge = -1
+		_ = s.Save(r, w)
+		return "", err
+	}
+	if err != nil {
+		return "", err
+	}
+	if evicted > 0 {
+		log.Printf("🚪 Evicted %d oldest sessions of %s (limit %d)", evicted, employee.UID, limit)
+	}
+	return s.ID, nil
+}
+
+// sessionLimit returns how many active sessions employeeID may have, 0 for
+// no limit: SessionLimit, or the strictest override of a scope they hold.
+func (h *AuthHandler) sessionLimit(ctx context.Context, employeeID int) (int, error) {
+	limit := h.cfg.AuthConfig.SessionLimit
+	if len(h.cfg.AuthConfig.SessionLimitOverrides) == 0 {
+		return limit, nil
+	}
+
+	granted, err := h.scopes.ForEmployee(ctx, employeeID)
+	if err != nil {
+		return 0, fmt.Errorf("fetch scopes: %w", err)
+	}
+	for scope, n := range h.cfg.AuthConfig.SessionLimitOverrides {
+		if authz.Scopes(granted).Grants(scope) && (limit == 0 || n < limit) {
+			limit = n
+		}
+	}
+	return limit, nil
+}
+
+// samlError handles errors of the SAML middleware, explaining refused logins
+// instead of the bare 403 of samlsp.DefaultOnError.
+func samlError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, authsessions.ErrLimitReached) {
+		http.Error(w, "Too many active sessions: sign out on another device and try again", http.StatusForbidden)
+		return
+	}
+	samlsp.DefaultOnError(w, r, err)
+}
+
+// currentSession returns the request's active login session, or nil if it
+// has none or it timed out.
+func (h *AuthHandler) currentSession(r *http.Request) *sessions.Session {
+	s, err := h.store.Get(r, authSessionName)
+	if err != nil {
+		if !errors.Is(err, authsessions.ErrRevoked) {
+			log.Printf("⚠️ Failed to load session: %v", err)
+		}
+		return nil
+	}
+	if s.IsNew {
+		return nil
+	}
+	return s
+}
+
+// rejectRevoked answers a request made with a revoked session: the session
+// cookies are cleared, browsers are sent to the login page and API clients
+// get a 401.
+func (h *AuthHandler) rejectRevoked(w http.ResponseWriter, r *http.Request) {
+	log.Printf("🚫 Rejected request from revoked session: %s %s", r.Method, r.URL.Path)
+	for _, name := range []string{"ldap_token", "saml_token", authSessionName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	if bearerToken(r) != "" {
+		writeError(w, http.StatusUnauthorized, "session_revoked", "session has been revoked")
+		return
+	}
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+// cleanupSessions removes expired sessions every SessionCleanupMinutes.
+func (h *AuthHandler) cleanupSessions() {
+	interval := time.Duration(h.cfg.AuthConfig.SessionCleanupMinutes) * time.Minute
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		n, err := h.loginSessions.DeleteExpired(ctx, h.sessionIdle())
+		cancel()
+		if err != nil {
+			log.Printf("⚠️ Session cleanup failed: %v", err)
+		} else if n > 0 {
+			log.Printf("🧹 Removed %d expired sessions", n)
+		}
+	}
+}
+
+func (h *AuthHandler) sessionIdle() time.Duration {
+	return time.Duration(h.cfg.AuthConfig.SessionIdleMinutes) * time.Minute
+}
+
+// samlSessionProvider ties the samlsp cookie to a login session: the ACS
+// starts one, logout ends it, and the SAML cookie stops counting once the
+// session has timed out, sending the user back to the IdP.
+type samlSessionProvider struct {
+	samlsp.SessionProvider
+	h *AuthHandler
+}
+
+func (p samlSessionProvider) CreateSession(w http.ResponseWriter, r *http.Request, assertion *saml.Assertion) error {
+	email := assertionAttribute(assertion, "email")
+	var employee *employees.Employee
+	found, err := p.h.employees.FindActive(r.Context(), email)
+	switch {
+	case err == nil:
+		employee = found
+	case !errors.Is(err, employees.ErrNotFound):
+		return fmt.Errorf("look up employee %q: %w", email, err)
+	}
+
+	if _, err := p.h.startSession(w, r, employee, authz.MethodSAML); err != nil {
+		return fmt.Errorf("start session: %w", err)
+	}
+	return p.SessionProvider.CreateSession(w, r, assertion)
+}
+
+func (p samlSessionProvider) DeleteSession(w http.ResponseWriter, r *http.Request) error {
+	if s := p.h.currentSession(r); s != nil {
+		s.Options.MaxAge = -1
+		if err := s.Save(r, w); err != nil {
+			log.Printf("⚠️ Failed to end session: %v", err)
+		}
+	}
+	return p.SessionProvider.DeleteSession(w, r)
+}
+
+func (p samlSessionProvider) GetSession(r *http.Request) (samlsp.Session, error) {
+	s, err := p.SessionProvider.GetSession(r)
+	if err != nil {
+		return s, err
+	}
+	if p.h.currentSession(r) == nil {
+		return nil, samlsp.ErrNoSession
+	}
+	return s, nil
+}
+
+// assertionAttribute returns the first value of attribute name, matched on
+// its friendly name like samlsp does.
+func assertionAttribute(assertion *saml.Assertion, name string) string {
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			claimName := attr.FriendlyName
+			if claimName == "" {
+				claimName = attr.Name
+			}
+			if claimName == name && len(attr.Values) > 0 {
+				return attr.Values[0].Value
+			}
+		}
+	}
+	return ""
+}
+
+// SessionRes describes one login session of the caller.
+type SessionRes struct {
+	ID         string    `json:"id"`
+	Method     string    `json:"method"`
+	Device     string    `json:"device"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type RevokeSessionsRes struct {
+	Revoked int64 `json:"revoked"`
+}
+
+// HandleSessionsPage serves GET /sessions
+func (h *AuthHandler) HandleSessionsPage(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, "templates/sessions.html")
+}
+
+// HandleListSessions serves GET /api/sessions, the caller's active sessions.
+func (h *AuthHandler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	principal := authz.MustFromContext(r.Context())
+	res := []SessionRes{}
+	if principal.EmployeeID == 0 {
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+
+	list, err := h.loginSessions.ListActive(r.Context(), principal.EmployeeID, h.sessionIdle())
+	if err != nil {
+		log.Printf("❌ Failed to list sessions of %s: %v", principal.Subject, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to list sessions")
+		return
+	}
+	for _, s := range list {
+		res = append(res, SessionRes{
+			ID:         s.ID,
+			Method:     s.Method,
+			Device:     helper.DeviceName(s.UserAgent),
+			IPAddress:  s.IPAddress,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == principal.SessionID,
+		})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// HandleRevokeSession serves POST /api/sessions/{id}/revoke, ending one of
+// the caller's own sessions.
+func (h *AuthHandler) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	principal := authz.MustFromContext(r.Context())
+	id := r.PathValue("id")
+
+	err := h.loginSessions.Revoke(r.Context(), principal.EmployeeID, id, principal.EmployeeID)
+	if errors.Is(err, authsessions.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "session_not_found", "session not found")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Failed to revoke session of %s: %v", principal.Subject, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to revoke session")
+		return
+	}
+	log.Printf("🚪 %s revoked one of their sessions", principal.Subject)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleAdminRevokeSessions serves POST /api/admin/employees/{employee}/sessions/revoke,
+// ending every session of an employee (uid or email).
+func (h *AuthHandler) HandleAdminRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	principal := authz.MustFromContext(r.Context())
+	employee := r.PathValue("employee")
+
+	if _, err := h.employees.Find(r.Context(), employee); err != nil {
+		if errors.Is(err, employees.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "employee_not_found", "employee not found")
+			return
+		}
+		log.Printf("❌ Failed to look up employee %q: %v", employee, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to look up employee")
+		return
+	}
+
+	n, err := h.loginSessions.RevokeAll(r.Context(), employee, principal.EmployeeID)
+	if err != nil {
+		log.Printf("❌ Failed to revoke sessions of %q: %v", employee, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to revoke sessions")
+		return
+	}
+	log.Printf("🚪 %s revoked %d sessions of %s", principal.Subject, n, employee)
+	writeJSON(w, http.StatusOK, RevokeSessionsRes{Revoked: n})
+}
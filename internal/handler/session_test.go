@@ -0,0 +1,358 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db/authsessions"
+	"go-ldap-sso/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+)
+
+// ldapLogin logs in with a password and returns the response, failing the
+// test unless it succeeded.
+func ldapLogin(t *testing.T, h *AuthHandler, username, password string) (*httptest.ResponseRecorder, LoginRes) {
+	t.Helper()
+	var res LoginRes
+	w := serve(t, h.HandleLDAPLogin, jsonRequest(t, "192.0.2.1", LoginReq{Username: username, Password: password}), &res)
+	if w.Code != http.StatusOK || res.Token == "" {
+		t.Fatalf("HandleLDAPLogin(%s) status = %d, body %s", username, w.Code, w.Body.String())
+	}
+	return w, res
+}
+
+// sessionOf returns the login session id of token.
+func sessionOf(t *testing.T, h *AuthHandler, token string) string {
+	t.Helper()
+	claims, err := auth.ValidateToken(token, h.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims.SessionID
+}
+
+// cookieOf returns the cookie name set by w, the last one when it was set
+// more than once, as a browser would keep it.
+func cookieOf(t *testing.T, w *httptest.ResponseRecorder, name string) *http.Cookie {
+	t.Helper()
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatalf("no %s cookie set", name)
+	}
+	return cookie
+}
+
+// call sends method path with bearer token, if any, through the routes of h
+// and returns the response and its error code. Problems of pkg/authz carry
+// the code under the same key as ErrorRes.
+func call(t *testing.T, h *AuthHandler, method, path, token string, cookies ...*http.Cookie) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	r := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	return route(t, h, r)
+}
+
+// route serves r through the routes of h and returns the response and its
+// error code.
+func route(t *testing.T, h *AuthHandler, r *http.Request) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	SetupRoutes(h).Handler.ServeHTTP(w, r)
+
+	var res ErrorRes
+	if w.Code >= http.StatusBadRequest {
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("invalid error %q: %v", w.Body.String(), err)
+		}
+	}
+	return w, res.Code
+}
+
+func TestRevokeOtherEmployeesSession(t *testing.T) {
+	h, _ := newTestHandler(t)
+	createEmployee(t, h, "alice", false)
+	createEmployee(t, h, "bob", false)
+	_, alice := ldapLogin(t, h, "alice", "secret123")
+	_, bob := ldapLogin(t, h, "bob", "hunter22")
+	bobSession := sessionOf(t, h, bob.Token)
+
+	w, code := call(t, h, http.MethodPost, "/api/sessions/"+bobSession+"/revoke", alice.Token)
+	if w.Code != http.StatusNotFound || code != "session_not_found" {
+		t.Errorf("revoking bob's session = %d %q, want 404 session_not_found", w.Code, code)
+	}
+	if w, _ := call(t, h, http.MethodGet, "/api/sessions", bob.Token); w.Code != http.StatusOK {
+		t.Errorf("bob's session after alice's attempt = %d, want 200", w.Code)
+	}
+
+	w, _ = call(t, h, http.MethodPost, "/api/sessions/"+bobSession+"/revoke", bob.Token)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("revoking own session = %d, want 204", w.Code)
+	}
+}
+
+func TestRevokedSessionRejected(t *testing.T) {
+	h, _ := newTestHandler(t)
+	createEmployee(t, h, "alice", false)
+	login, alice := ldapLogin(t, h, "alice", "secret123")
+	_, other := ldapLogin(t, h, "alice", "secret123")
+
+	w, _ := call(t, h, http.MethodPost, "/api/sessions/"+sessionOf(t, h, alice.Token)+"/revoke", other.Token)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("revoke = %d, want 204", w.Code)
+	}
+
+	// Bearer token: API clients get a 401
+	w, code := call(t, h, http.MethodGet, "/api/sessions", alice.Token)
+	if w.Code != http.StatusUnauthorized || code != "session_revoked" {
+		t.Errorf("bearer request = %d %q, want 401 session_revoked", w.Code, code)
+	}
+
+	// Browser cookies: sent to the login page with the cookies cleared
+	browserCookies := map[string]*http.Cookie{
+		"ldap_token":    cookieOf(t, login, "ldap_token"),
+		authSessionName: cookieOf(t, login, authSessionName),
+	}
+	for name, cookie := range browserCookies {
+		t.Run(name, func(t *testing.T) {
+			w, _ := call(t, h, http.MethodGet, "/api/sessions", "", cookie)
+			if w.Code != http.StatusFound || w.Header().Get("Location") != "/login" {
+				t.Fatalf("cookie request = %d to %q, want a redirect to /login", w.Code, w.Header().Get("Location"))
+			}
+			if c := cookieOf(t, w, name); c.MaxAge >= 0 {
+				t.Errorf("%s cookie MaxAge = %d, want it cleared", name, c.MaxAge)
+			}
+		})
+	}
+
+	// The other session is unaffected
+	if w, _ := call(t, h, http.MethodGet, "/api/sessions", other.Token); w.Code != http.StatusOK {
+		t.Errorf("other session = %d, want 200", w.Code)
+	}
+}
+
+func TestAdminRevokeNeedsScope(t *testing.T) {
+	h, _ := newTestHandler(t)
+	aliceID := createEmployee(t, h, "alice", false)
+	createEmployee(t, h, "bob", false)
+	_, bob := ldapLogin(t, h, "bob", "hunter22")
+	const path = "/api/admin/employees/bob/sessions/revoke"
+
+	_, alice := ldapLogin(t, h, "alice", "secret123")
+	w, code := call(t, h, http.MethodPost, path, alice.Token)
+	if w.Code != http.StatusForbidden || code != "insufficient_scope" {
+		t.Fatalf("without sessions:revoke = %d %q, want 403 insufficient_scope", w.Code, code)
+	}
+	if w, _ := call(t, h, http.MethodGet, "/api/sessions", bob.Token); w.Code != http.StatusOK {
+		t.Fatalf("bob's session after refused revoke = %d, want 200", w.Code)
+	}
+
+	// Scopes are read at login, so log in again once granted
+	grantScope(t, h, aliceID, "sessions:revoke")
+	_, alice = ldapLogin(t, h, "alice", "secret123")
+	var res RevokeSessionsRes
+	w, _ = call(t, h, http.MethodPost, path, alice.Token)
+	if err := json.Unmarshal(w.Body.Bytes(), &res); w.Code != http.StatusOK || err != nil || res.Revoked != 1 {
+		t.Fatalf("with sessions:revoke = %d %s, want 1 revoked", w.Code, w.Body.String())
+	}
+	if w, code := call(t, h, http.MethodGet, "/api/sessions", bob.Token); w.Code != http.StatusUnauthorized || code != "session_revoked" {
+		t.Errorf("bob's session after revoke = %d %q, want 401 session_revoked", w.Code, code)
+	}
+
+	if w, code := call(t, h, http.MethodPost, "/api/admin/employees/nobody/sessions/revoke", alice.Token); w.Code != http.StatusNotFound || code != "employee_not_found" {
+		t.Errorf("unknown employee = %d %q, want 404 employee_not_found", w.Code, code)
+	}
+}
+
+// activeSessions returns how many sessions employeeID has that are usable.
+func activeSessions(t *testing.T, h *AuthHandler, employeeID int) int {
+	t.Helper()
+	list, err := h.loginSessions.ListActive(context.Background(), employeeID, h.sessionIdle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(list)
+}
+
+func TestSessionLimitReject(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.cfg.AuthConfig.SessionLimit = 2
+	h.cfg.AuthConfig.SessionLimitMode = config.SessionLimitReject
+	id := createEmployee(t, h, "alice", false)
+
+	_, first := ldapLogin(t, h, "alice", "secret123")
+	ldapLogin(t, h, "alice", "secret123")
+
+	var res ErrorRes
+	w := serve(t, h.HandleLDAPLogin, jsonRequest(t, "192.0.2.1", LoginReq{Username: "alice", Password: "secret123"}), &res)
+	if w.Code != http.StatusForbidden || res.Code != "session_limit_reached" {
+		t.Fatalf("third login = %d %q, want 403 session_limit_reached", w.Code, res.Code)
+	}
+	if c := cookieOf(t, w, authSessionName); c.MaxAge >= 0 {
+		t.Errorf("refused login left a session cookie, MaxAge %d", c.MaxAge)
+	}
+	if n := activeSessions(t, h, id); n != 2 {
+		t.Errorf("%d active sessions, want 2", n)
+	}
+	if w, _ := call(t, h, http.MethodGet, "/api/sessions", first.Token); w.Code != http.StatusOK {
+		t.Errorf("first session after refused login = %d, want 200", w.Code)
+	}
+}
+
+func TestSessionLimitEvictOldest(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.cfg.AuthConfig.SessionLimit = 2
+	h.cfg.AuthConfig.SessionLimitMode = config.SessionLimitEvictOldest
+	id := createEmployee(t, h, "alice", false)
+
+	_, first := ldapLogin(t, h, "alice", "secret123")
+	// Sessions created in the same instant would tie on created_at
+	if _, err := h.db.Pool.Exec(context.Background(),
+		"UPDATE auth_sessions SET created_at = created_at - interval '1 minute' WHERE id = $1",
+		sessionOf(t, h, first.Token)); err != nil {
+		t.Fatal(err)
+	}
+	_, second := ldapLogin(t, h, "alice", "secret123")
+	_, third := ldapLogin(t, h, "alice", "secret123")
+
+	if n := activeSessions(t, h, id); n != 2 {
+		t.Errorf("%d active sessions, want 2", n)
+	}
+	if w, code := call(t, h, http.MethodGet, "/api/sessions", first.Token); code != "session_revoked" {
+		t.Errorf("oldest session = %d %q, want session_revoked", w.Code, code)
+	}
+	for _, token := range []string{second.Token, third.Token} {
+		if w, _ := call(t, h, http.MethodGet, "/api/sessions", token); w.Code != http.StatusOK {
+			t.Errorf("newer session = %d, want 200", w.Code)
+		}
+	}
+}
+
+func TestSessionLimitOverrides(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		overrides map[string]int
+		scopes    []string
+		want      int
+	}{
+		{"no limit", 0, nil, nil, 0},
+		{"global", 3, nil, nil, 3},
+		{"override without the scope", 3, map[string]int{"breakglass:elevate": 1}, []string{"directory:read"}, 3},
+		{"override tightens", 3, map[string]int{"breakglass:elevate": 1}, []string{"breakglass:elevate"}, 1},
+		{"override limits no limit", 0, map[string]int{"breakglass:elevate": 1}, []string{"breakglass:elevate"}, 1},
+		{"looser override ignored", 2, map[string]int{"breakglass:elevate": 5}, []string{"breakglass:elevate"}, 2},
+		{"strictest of several", 0, map[string]int{"breakglass:elevate": 2, "sessions:revoke": 1},
+			[]string{"breakglass:elevate", "sessions:revoke"}, 1},
+		{"override by wildcard", 3, map[string]int{"breakglass:elevate": 1}, []string{"*"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t)
+			h.cfg.AuthConfig.SessionLimit = tt.limit
+			h.cfg.AuthConfig.SessionLimitOverrides = tt.overrides
+			id := createEmployee(t, h, "alice", false)
+			for _, scope := range tt.scopes {
+				grantScope(t, h, id, scope)
+			}
+
+			got, err := h.sessionLimit(context.Background(), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("sessionLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionLimitOverrideApplied(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.cfg.AuthConfig.SessionLimitOverrides = map[string]int{"breakglass:elevate": 1}
+	id := createEmployee(t, h, "alice", false)
+	grantScope(t, h, id, "breakglass:elevate")
+
+	ldapLogin(t, h, "alice", "secret123")
+	var res ErrorRes
+	w := serve(t, h.HandleLDAPLogin, jsonRequest(t, "192.0.2.1", LoginReq{Username: "alice", Password: "secret123"}), &res)
+	if w.Code != http.StatusForbidden || res.Code != "session_limit_reached" {
+		t.Errorf("second login = %d %q, want 403 session_limit_reached", w.Code, res.Code)
+	}
+}
+
+// fakeSAMLSessions records the sessions the SAML middleware would create.
+type fakeSAMLSessions struct {
+	samlsp.SessionProvider
+	created int
+}
+
+func (f *fakeSAMLSessions) CreateSession(w http.ResponseWriter, r *http.Request, assertion *saml.Assertion) error {
+	f.created++
+	return nil
+}
+
+func samlAssertion(email string) *saml.Assertion {
+	return &saml.Assertion{AttributeStatements: []saml.AttributeStatement{{
+		Attributes: []saml.Attribute{{FriendlyName: "email", Values: []saml.AttributeValue{{Value: email}}}},
+	}}}
+}
+
+func TestSAMLCreateSessionLimit(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.cfg.AuthConfig.SessionLimit = 1
+	h.cfg.AuthConfig.SessionLimitMode = config.SessionLimitReject
+	id := createEmployee(t, h, "alice", false)
+	fake := &fakeSAMLSessions{}
+	provider := samlSessionProvider{SessionProvider: fake, h: h}
+
+	w := httptest.NewRecorder()
+	if err := provider.CreateSession(w, httptest.NewRequest(http.MethodPost, "/saml/acs", nil), samlAssertion("alice@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if fake.created != 1 || activeSessions(t, h, id) != 1 {
+		t.Fatalf("first SAML login: %d SAML sessions, %d active, want 1 and 1", fake.created, activeSessions(t, h, id))
+	}
+	var method string
+	if err := h.db.Pool.QueryRow(context.Background(),
+		"SELECT method FROM auth_sessions WHERE employee_id = $1", id).Scan(&method); err != nil || method != "saml" {
+		t.Errorf("session method = %q, %v, want saml", method, err)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/saml/acs", nil)
+	err := provider.CreateSession(w, r, samlAssertion("alice@example.com"))
+	if !errors.Is(err, authsessions.ErrLimitReached) {
+		t.Fatalf("second SAML login error = %v, want ErrLimitReached", err)
+	}
+	if fake.created != 1 {
+		t.Error("SAML session created over the limit")
+	}
+	w = httptest.NewRecorder()
+	samlError(w, r, err)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("samlError() status = %d, want 403", w.Code)
+	}
+
+	// Logins of unknown employees aren't limited
+	for i := 0; i < 2; i++ {
+		if err := provider.CreateSession(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/saml/acs", nil), samlAssertion("nobody@example.com")); err != nil {
+			t.Fatalf("unknown employee login %d error = %v", i+1, err)
+		}
+	}
+}
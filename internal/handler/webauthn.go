@@ -0,0 +1,475 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-ldap-sso/config"
+	"go-ldap-sso/db/employees"
+	"go-ldap-sso/db/passkeys"
+	"go-ldap-sso/internal/helper"
+	"go-ldap-sso/pkg/authz"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// errInvalidPasskey is returned for assertions that don't verify.
+var errInvalidPasskey = errors.New("invalid passkey")
+
+type PasskeyBeginReq struct {
+	// MFAToken is only sent for the second step of an LDAP login
+	MFAToken string `json:"mfa_token,omitempty"`
+}
+
+type PasskeyBeginRes struct {
+	CeremonyToken string `json:"ceremony_token"`
+	// Options is passed as is to navigator.credentials.create() or get()
+	Options interface{} `json:"options"`
+}
+
+type PasskeyFinishReq struct {
+	MFAToken      string `json:"mfa_token,omitempty"`
+	CeremonyToken string `json:"ceremony_token"`
+	// Name labels a new passkey, only read at registration
+	Name string `json:"name,omitempty"`
+	// Credential is the PublicKeyCredential returned by the browser
+	Credential json.RawMessage `json:"credential"`
+}
+
+type PasskeyRes struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func newWebAuthn(cfg *config.Config) (*webauthn.WebAuthn, error) {
+	timeout := time.Duration(cfg.AuthConfig.WebAuthnCeremonyMinutes) * time.Minute
+	ceremony := webauthn.TimeoutConfig{Enforce: true, Timeout: timeout, TimeoutUVD: timeout}
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.AuthConfig.WebAuthnRPID,
+		RPDisplayName: cfg.AuthConfig.WebAuthnRPName,
+		RPOrigins:     cfg.AuthConfig.WebAuthnOrigins,
+		Timeouts:      webauthn.TimeoutsConfig{Login: ceremony, Registration: ceremony},
+	})
+}
+
+// passkeyUser is an employee as seen by WebAuthn.
+type passkeyUser struct {
+	employee    *employees.Employee
+	credentials []webauthn.Credential
+}
+
+// passkeyUserHandle is the WebAuthn user handle of an employee, stored by
+// authenticators with discoverable credentials.
+func passkeyUserHandle(employeeID int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(employeeID))
+}
+
+func (u *passkeyUser) WebAuthnID() []byte                         { return passkeyUserHandle(u.employee.ID) }
+func (u *passkeyUser) WebAuthnName() string                       { return u.employee.Email }
+func (u *passkeyUser) WebAuthnDisplayName() string                { return u.employee.Name }
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// exclusions lists the passkeys already registered, so an authenticator
+// isn't registered twice.
+func (u *passkeyUser) exclusions() []protocol.CredentialDescriptor {
+	list := make([]protocol.CredentialDescriptor, len(u.credentials))
+	for i, c := range u.credentials {
+		list[i] = c.Descriptor()
+	}
+	return list
+}
+
+// passkeyUser loads the passkeys of employee.
+func (h *AuthHandler) passkeyUser(ctx context.Context, employee *employees.Employee) (*passkeyUser, error) {
+	stored, err := h.passkeys.List(ctx, employee.ID)
+	if err != nil {
+		return nil, err
+	}
+	user := &passkeyUser{employee: employee}
+	for _, s := range stored {
+		var c webauthn.Credential
+		if err := json.Unmarshal(s.Data, &c); err != nil {
+			return nil, fmt.Errorf("decode passkey %d: %w", s.ID, err)
+		}
+		user.credentials = append(user.credentials, c)
+	}
+	return user, nil
+}
+
+// beginPasskeyCeremony stores the state of a started ceremony and answers
+// with the options for the browser.
+func (h *AuthHandler) beginPasskeyCeremony(w http.ResponseWriter, r *http.Request, employeeID *int, kind string, options interface{}, data *webauthn.SessionData) {
+	raw, err := json.Marshal(data)
+	if err == nil {
+		var token string
+		token, err = h.passkeys.CreateCeremony(r.Context(), employeeID, kind, helper.ClientIP(r), raw,
+			time.Duration(h.cfg.AuthConfig.WebAuthnCeremonyMinutes)*time.Minute)
+		if err == nil {
+			writeJSON(w, http.StatusOK, PasskeyBeginRes{CeremonyToken: token, Options: options})
+			return
+		}
+	}
+	log.Printf("❌ Failed to start passkey %s: %v", kind, err)
+	writeError(w, http.StatusInternalServerError, "internal_error", "failed to start passkey ceremony")
+}
+
+// takePasskeyCeremony ends the ceremony of req, which must be of kind and,
+// for employeeID other than 0, started by that employee. It answers the
+// request and returns nil if there is none.
+func (h *AuthHandler) takePasskeyCeremony(w http.ResponseWriter, r *http.Request, req PasskeyFinishReq, kind string, employeeID int) *webauthn.SessionData {
+	ceremony, err := h.passkeys.TakeCeremony(r.Context(), req.CeremonyToken, kind)
+	if err == nil && employeeID != 0 && (ceremony.EmployeeID == nil || *ceremony.EmployeeID != employeeID) {
+		err = passkeys.ErrInvalidCeremony
+	}
+	if errors.Is(err, passkeys.ErrInvalidCeremony) {
+		writeError(w, http.StatusBadRequest, "passkey_ceremony_invalid", "passkey request expired, try again")
+		return nil
+	}
+	if err != nil {
+		log.Printf("❌ Failed to load passkey %s: %v", kind, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to check passkey")
+		return nil
+	}
+
+	var data webauthn.SessionData
+	if err := json.Unmarshal(ceremony.Data, &data); err != nil {
+		log.Printf("❌ Failed to decode passkey %s: %v", kind, err)
+		writeError(w, http.StatusInternalServerError, "internal_error", "failed to check passkey")
+		return nil
+	}
+	return &data
+}
+
+// usePasskey stores the credential after a verified assertion, with its new
+// sign count. A sign count going backwards means the authenticator may have
+// been cloned, and the assertion is refused.
+func (h *AuthHandler) usePasskey(ctx context.Context, employee *employees.Employee, credential *webauthn.Credential) error {
+	if credential.Authenticator.CloneWarning {
+		log.Printf("🚨 Passkey of %s reported a lower sign count, it may be cloned", employee.UID)
+		return errInvalidPasskey
+	}
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return err
+	}
+	return h.passkeys.Use(ctx, credential.ID, data)
+}
+
+// passkeyAMR returns the factors proven by a passkey assertion: the key,
+// and with user verification (PIN or biometrics) a second factor.
+func passkeyAMR(parsed *protocol.ParsedCredentialAssertionData) []string {
+	if parsed.Response.AuthenticatorData.Flags.HasUserVerified() {
+		return []string{authz.AMRHardwareKey, authz.AMRMultiFactor}
+	}
+	return []string{authz.AMRHardwareKey}
+}
+
+func writePasskeyError(w http.ResponseWriter, err error) {
+	var protocolErr *protocol.Error
+	if errors.Is(err, errInvalidPasskey) || errors.As(err, &protocolErr) {
+		writeError(w, http.StatusUnauthorized, "invalid_passkey", "passkey could not be verified")
+		return
+	}
+	log.Printf("❌ Passkey check failed: %v", err)
+	writeError(w, http.StatusInternalServerError, "internal_error", "failed to check passkey")
+}
+
+// HandlePasskeyRegisterBegin serves POST /api/webauthn/register/begin
+func (h *AuthHandler) HandlePasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	employee := h.mfaEmployee(w, r)
+	if employee == nil {
+		return
+	}
+	user, err := h.passkeyUser(r.Context(), employee)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+
+	// Discoverable credentials, so the passkey also works without a username
+	options, data, err := h.webAuthn.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(user.exclusions()),
+	)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	h.beginPasskeyCeremony(w, r, &employee.ID, passkeys.CeremonyRegister, options, data)
+}
+
+// HandlePasskeyRegisterFinish serves POST /api/webauthn/register/finish
+func (h *AuthHandler) HandlePasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	employee := h.mfaEmployee(w, r)
+	if employee == nil {
+		return
+	}
+	var req PasskeyFinishReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > 100 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "name is longer than 100 characters")
+		return
+	}
+
+	data := h.takePasskeyCeremony(w, r, req, passkeys.CeremonyRegister, employee.ID)
+	if data == nil {
+		return
+	}
+	user, err := h.passkeyUser(r.Context(), employee)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	credential, err := h.webAuthn.CreateCredential(user, *data, parsed)
+	if err != nil {
+		log.Printf("❌ Passkey registration failed for %s: %v", employee.UID, err)
+		writePasskeyError(w, err)
+		return
+	}
+
+	raw, err := json.Marshal(credential)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	stored := passkeys.Credential{EmployeeID: employee.ID, CredentialID: credential.ID, Name: name, Data: raw}
+	err = h.passkeys.Add(r.Context(), &stored)
+	if errors.Is(err, passkeys.ErrDuplicate) {
+		writeError(w, http.StatusConflict, "passkey_exists", "this passkey is already registered")
+		return
+	}
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+
+	log.Printf("🔐 %s registered passkey %q", employee.UID, name)
+	writeJSON(w, http.StatusCreated, PasskeyRes{ID: stored.ID, Name: stored.Name, CreatedAt: stored.CreatedAt})
+}
+
+// HandleListPasskeys serves GET /api/webauthn/credentials
+func (h *AuthHandler) HandleListPasskeys(w http.ResponseWriter, r *http.Request) {
+	employee := h.mfaEmployee(w, r)
+	if employee == nil {
+		return
+	}
+	stored, err := h.passkeys.List(r.Context(), employee.ID)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+
+	res := make([]PasskeyRes, len(stored))
+	for i, c := range stored {
+		res[i] = PasskeyRes{ID: c.ID, Name: c.Name, CreatedAt: c.CreatedAt, LastUsedAt: c.LastUsedAt}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// HandleDeletePasskey serves POST /api/webauthn/credentials/{id}/delete.
+// Holders of scopes requiring a second factor can't delete their last one.
+func (h *AuthHandler) HandleDeletePasskey(w http.ResponseWriter, r *http.Request) {
+	employee := h.mfaEmployee(w, r)
+	if employee == nil {
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid passkey id")
+		return
+	}
+
+	status, err := h.mfaState(r.Context(), employee.ID)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	if status.Required && !status.TOTP && status.Passkeys <= 1 {
+		writeError(w, http.StatusForbidden, "mfa_required", "your scopes require a second factor")
+		return
+	}
+
+	err = h.passkeys.Delete(r.Context(), employee.ID, id)
+	if errors.Is(err, passkeys.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "passkey not found")
+		return
+	}
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	log.Printf("🔓 %s deleted passkey %d", employee.UID, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlePasskeyLoginBegin serves POST /webauthn/login/begin, starting a
+// passwordless login with any passkey registered here.
+func (h *AuthHandler) HandlePasskeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	// Anyone can start one, and each is stored until it expires
+	ip := helper.ClientIP(r)
+	pending, err := h.passkeys.PendingCeremonies(r.Context(), passkeys.CeremonyLogin, ip)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	if pending >= h.cfg.AuthConfig.WebAuthnLoginMaxPerIP {
+		log.Printf("🚫 Passkey logins pending from %s over the limit", ip)
+		w.Header().Set("Retry-After", strconv.Itoa(h.cfg.AuthConfig.WebAuthnCeremonyMinutes*60))
+		writeError(w, http.StatusTooManyRequests, "rate_limited", "too many passkey logins started, try again later")
+		return
+	}
+
+	// Without a password, the passkey must verify the user itself (PIN or
+	// biometrics) to count as two factors
+	options, data, err := h.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	h.beginPasskeyCeremony(w, r, nil, passkeys.CeremonyLogin, options, data)
+}
+
+// HandlePasskeyLoginFinish serves POST /webauthn/login/finish, issuing the
+// token of the passkey's employee.
+func (h *AuthHandler) HandlePasskeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyFinishReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	data := h.takePasskeyCeremony(w, r, req, passkeys.CeremonyLogin, 0)
+	if data == nil {
+		return
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	var employee *employees.Employee
+	credential, err := h.webAuthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		stored, err := h.passkeys.FindByCredentialID(ctx, rawID)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(userHandle, passkeyUserHandle(stored.EmployeeID)) {
+			return nil, errInvalidPasskey
+		}
+		employee, err = h.employees.FindActiveByID(ctx, stored.EmployeeID)
+		if err != nil {
+			return nil, err
+		}
+		return h.passkeyUser(ctx, employee)
+	}, *data, parsed)
+	if err == nil {
+		err = h.usePasskey(ctx, employee, credential)
+	}
+	if err != nil {
+		log.Printf("❌ Passkey login failed: %v", err)
+		writePasskeyError(w, err)
+		return
+	}
+
+	log.Printf("🔐 %s logged in with a passkey", employee.UID)
+	h.completeLogin(w, r, employee, authz.MethodWebAuthn, passkeyAMR(parsed), LoginRes{})
+}
+
+// HandlePasskeyMFABegin serves POST /ldap-login/mfa/webauthn/begin, the
+// passkey alternative to a code in the second step of an LDAP login.
+func (h *AuthHandler) HandlePasskeyMFABegin(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyBeginReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	_, employee := h.challengeEmployee(w, r, req.MFAToken)
+	if employee == nil {
+		return
+	}
+	user, err := h.passkeyUser(r.Context(), employee)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	if len(user.credentials) == 0 {
+		writeError(w, http.StatusConflict, "mfa_not_enrolled", "no passkey registered")
+		return
+	}
+
+	options, data, err := h.webAuthn.BeginLogin(user)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	h.beginPasskeyCeremony(w, r, &employee.ID, passkeys.CeremonyMFA, options, data)
+}
+
+// HandlePasskeyMFAFinish serves POST /ldap-login/mfa/webauthn/finish,
+// issuing the token once the passkey checks out.
+func (h *AuthHandler) HandlePasskeyMFAFinish(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyFinishReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	challenge, employee := h.challengeEmployee(w, r, req.MFAToken)
+	if employee == nil {
+		return
+	}
+	data := h.takePasskeyCeremony(w, r, req, passkeys.CeremonyMFA, employee.ID)
+	if data == nil {
+		return
+	}
+
+	ctx := r.Context()
+	user, err := h.passkeyUser(ctx, employee)
+	if err != nil {
+		writePasskeyError(w, err)
+		return
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err == nil {
+		var credential *webauthn.Credential
+		if credential, err = h.webAuthn.ValidateLogin(user, *data, parsed); err == nil {
+			err = h.usePasskey(ctx, employee, credential)
+		}
+	}
+	if err != nil {
+		log.Printf("❌ Passkey second factor failed for %s (attempt %d): %v", employee.UID, challenge.Attempts, err)
+		writePasskeyError(w, err)
+		return
+	}
+	if err := h.mfaStore.DeleteChallenge(ctx, challenge.ID); err != nil {
+		log.Printf("⚠️ Failed to delete MFA challenge: %v", err)
+	}
+
+	amr := []string{authz.AMRPassword, authz.AMRHardwareKey, authz.AMRMultiFactor}
+	h.completeLogin(w, r, employee, authz.MethodLDAP, amr, LoginRes{})
+}
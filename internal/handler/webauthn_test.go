@@ -0,0 +1,309 @@
+package handler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"go-ldap-sso/pkg/authz"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+var b64 = base64.RawURLEncoding
+
+// softAuthenticator is a passkey held in memory, answering ceremonies the
+// way a browser would pass them on from a security key that verifies the
+// user.
+type softAuthenticator struct {
+	rpID, origin string
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	// SignCount is sent with the next assertion, then incremented
+	SignCount uint32
+}
+
+func newSoftAuthenticator(t *testing.T, h *AuthHandler) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{
+		rpID:         h.cfg.AuthConfig.WebAuthnRPID,
+		origin:       h.cfg.AuthConfig.WebAuthnOrigins[0],
+		key:          key,
+		credentialID: id,
+		SignCount:    1,
+	}
+}
+
+// ceremonyOptions is the part of the begin options the authenticator reads.
+type ceremonyOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		User      struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, kind string, options json.RawMessage) (ceremonyOptions, []byte) {
+	t.Helper()
+	var o ceremonyOptions
+	if err := json.Unmarshal(options, &o); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(map[string]string{"type": kind, "challenge": o.PublicKey.Challenge, "origin": a.origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o, data
+}
+
+// authData is the authenticator data with the user present and verified
+// flags, plus extra flags.
+func (a *softAuthenticator) authData(flags byte, count uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], flags|0x01|0x04)
+	return binary.BigEndian.AppendUint32(data, count)
+}
+
+// create answers navigator.credentials.create() options with a new
+// credential and "none" attestation.
+func (a *softAuthenticator) create(t *testing.T, options json.RawMessage) json.RawMessage {
+	t.Helper()
+	o, clientData := a.clientData(t, "webauthn.create", options)
+	userHandle, err := b64.DecodeString(o.PublicKey.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.userHandle = userHandle
+
+	point, err := a.key.PublicKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	xy := point.Bytes()[1:]
+	publicKey, err := webauthncbor.Marshal(map[int]any{1: 2, 3: -7, -1: 1, -2: xy[:32], -3: xy[32:]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Attested credential data: AAGUID, credential id length and id, key
+	authData := a.authData(0x40, 0)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{"fmt": "none", "attStmt": map[string]any{}, "authData": authData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64.EncodeToString(clientData),
+		"attestationObject": b64.EncodeToString(attestation),
+	})
+}
+
+// get answers navigator.credentials.get() options with an assertion
+// carrying SignCount.
+func (a *softAuthenticator) get(t *testing.T, options json.RawMessage) json.RawMessage {
+	t.Helper()
+	_, clientData := a.clientData(t, "webauthn.get", options)
+	authData := a.authData(0, a.SignCount)
+	a.SignCount++
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64.EncodeToString(clientData),
+		"authenticatorData": b64.EncodeToString(authData),
+		"signature":         b64.EncodeToString(signature),
+		"userHandle":        b64.EncodeToString(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]string) json.RawMessage {
+	t.Helper()
+	id := b64.EncodeToString(a.credentialID)
+	raw, err := json.Marshal(map[string]any{"id": id, "rawId": id, "type": "public-key", "response": response})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// beginRes is PasskeyBeginRes with the options kept as JSON.
+type beginRes struct {
+	CeremonyToken string          `json:"ceremony_token"`
+	Options       json.RawMessage `json:"options"`
+}
+
+// registerPasskey registers a new software passkey for the employee
+// through the handlers.
+func registerPasskey(t *testing.T, h *AuthHandler, employeeID int) *softAuthenticator {
+	t.Helper()
+	asEmployee := func(body any) *http.Request {
+		r := jsonRequest(t, "192.0.2.1", body)
+		return r.WithContext(authz.WithPrincipal(r.Context(), &authz.Principal{EmployeeID: employeeID}))
+	}
+
+	var begin beginRes
+	if w := serve(t, h.HandlePasskeyRegisterBegin, asEmployee(nil), &begin); w.Code != http.StatusOK {
+		t.Fatalf("HandlePasskeyRegisterBegin() = %d %s", w.Code, w.Body)
+	}
+	a := newSoftAuthenticator(t, h)
+	req := PasskeyFinishReq{CeremonyToken: begin.CeremonyToken, Name: "Test key", Credential: a.create(t, begin.Options)}
+	if w := serve(t, h.HandlePasskeyRegisterFinish, asEmployee(req), nil); w.Code != http.StatusCreated {
+		t.Fatalf("HandlePasskeyRegisterFinish() = %d %s", w.Code, w.Body)
+	}
+	return a
+}
+
+// passkeyLogin logs in without a password using a.
+func passkeyLogin(t *testing.T, h *AuthHandler, a *softAuthenticator) (int, LoginRes, ErrorRes) {
+	t.Helper()
+	var begin beginRes
+	if w := serve(t, h.HandlePasskeyLoginBegin, jsonRequest(t, "192.0.2.1", nil), &begin); w.Code != http.StatusOK {
+		t.Fatalf("HandlePasskeyLoginBegin() = %d %s", w.Code, w.Body)
+	}
+	var res struct {
+		LoginRes
+		ErrorRes
+	}
+	req := PasskeyFinishReq{CeremonyToken: begin.CeremonyToken, Credential: a.get(t, begin.Options)}
+	w := serve(t, h.HandlePasskeyLoginFinish, jsonRequest(t, "192.0.2.1", req), &res)
+	return w.Code, res.LoginRes, res.ErrorRes
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	h, _ := newTestHandler(t)
+	alice := createEmployee(t, h, "alice", false)
+	a := registerPasskey(t, h, alice)
+
+	if n, err := h.passkeys.Count(context.Background(), alice); n != 1 || err != nil {
+		t.Fatalf("Count() after registering = %d, %v", n, err)
+	}
+	for i := 0; i < 2; i++ {
+		status, res, errRes := passkeyLogin(t, h, a)
+		if status != http.StatusOK || res.Token == "" {
+			t.Fatalf("login %d = %d %q, want a token", i+1, status, errRes.Code)
+		}
+	}
+
+	// The sign count going backwards, or repeating, hints at a cloned key
+	a.SignCount -= 2
+	if status, _, res := passkeyLogin(t, h, a); status != http.StatusUnauthorized || res.Code != "invalid_passkey" {
+		t.Errorf("login with a lower sign count = %d %q, want 401 invalid_passkey", status, res.Code)
+	}
+	// The refused assertion didn't lower the stored count
+	a.SignCount += 2
+	if status, _, res := passkeyLogin(t, h, a); status != http.StatusOK {
+		t.Errorf("login with the next sign count = %d %q, want 200", status, res.Code)
+	}
+
+	// Another key for the same credential id doesn't verify
+	forged := newSoftAuthenticator(t, h)
+	forged.credentialID, forged.userHandle, forged.SignCount = a.credentialID, a.userHandle, a.SignCount
+	if status, _, _ := passkeyLogin(t, h, forged); status != http.StatusUnauthorized {
+		t.Errorf("login with a forged signature = %d, want 401", status)
+	}
+}
+
+func TestPasskeySecondFactor(t *testing.T) {
+	h, _ := newTestHandler(t)
+	ctx := context.Background()
+	alice := createEmployee(t, h, "alice", false)
+	a := registerPasskey(t, h, alice)
+
+	secondFactor := func(mfaToken string) (int, ErrorRes) {
+		t.Helper()
+		var begin beginRes
+		if w := serve(t, h.HandlePasskeyMFABegin, jsonRequest(t, "192.0.2.1", PasskeyBeginReq{MFAToken: mfaToken}), &begin); w.Code != http.StatusOK {
+			var res ErrorRes
+			json.Unmarshal(w.Body.Bytes(), &res)
+			return w.Code, res
+		}
+		var res ErrorRes
+		req := PasskeyFinishReq{MFAToken: mfaToken, CeremonyToken: begin.CeremonyToken, Credential: a.get(t, begin.Options)}
+		w := serve(t, h.HandlePasskeyMFAFinish, jsonRequest(t, "192.0.2.1", req), &res)
+		return w.Code, res
+	}
+
+	mfaToken, err := h.mfaStore.CreateChallenge(ctx, alice, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, res := secondFactor(mfaToken); status != http.StatusOK {
+		t.Fatalf("second factor = %d %q, want 200", status, res.Code)
+	}
+	// The challenge is used up
+	if status, _ := secondFactor(mfaToken); status != http.StatusUnauthorized {
+		t.Errorf("second factor with a used challenge = %d, want 401", status)
+	}
+
+	mfaToken, err = h.mfaStore.CreateChallenge(ctx, alice, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SignCount = 1
+	if status, res := secondFactor(mfaToken); status != http.StatusUnauthorized || res.Code != "invalid_passkey" {
+		t.Errorf("second factor with a lower sign count = %d %q, want 401 invalid_passkey", status, res.Code)
+	}
+
+	// Employees without a passkey are told to use another factor
+	bob := createEmployee(t, h, "bob", false)
+	mfaToken, err = h.mfaStore.CreateChallenge(ctx, bob, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, res := secondFactor(mfaToken); status != http.StatusConflict || res.Code != "mfa_not_enrolled" {
+		t.Errorf("second factor without a passkey = %d %q, want 409 mfa_not_enrolled", status, res.Code)
+	}
+}
+
+func TestPasskeyLoginBeginRateLimit(t *testing.T) {
+	h, _ := newTestHandler(t)
+	limit := h.cfg.AuthConfig.WebAuthnLoginMaxPerIP
+
+	// Finished logins no longer count
+	a := registerPasskey(t, h, createEmployee(t, h, "alice", false))
+	for i := 0; i <= limit; i++ {
+		if status, _, res := passkeyLogin(t, h, a); status != http.StatusOK {
+			t.Fatalf("login %d = %d %q, want 200", i+1, status, res.Code)
+		}
+	}
+
+	begin := func(ip string) *http.Response {
+		return serve(t, h.HandlePasskeyLoginBegin, jsonRequest(t, ip, nil), nil).Result()
+	}
+	for i := 0; i < limit; i++ {
+		if res := begin("198.51.100.1"); res.StatusCode != http.StatusOK {
+			t.Fatalf("login begin %d = %d, want 200", i+1, res.StatusCode)
+		}
+	}
+	res := begin("198.51.100.1")
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") == "" {
+		t.Errorf("login begin over the limit = %d, Retry-After %q, want 429 with Retry-After",
+			res.StatusCode, res.Header.Get("Retry-After"))
+	}
+	if res := begin("198.51.100.2"); res.StatusCode != http.StatusOK {
+		t.Errorf("login begin from another address = %d, want 200", res.StatusCode)
+	}
+}
@@ -1,6 +1,11 @@
 package helper
 
-import "net/url"
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
 
 func MustParseURL(raw string) *url.URL {
 	u, err := url.Parse(raw)
@@ -9,3 +14,51 @@ func MustParseURL(raw string) *url.URL {
 	}
 	return u
 }
+
+// ClientIP returns the address the request came from. Forwarding headers are
+// ignored since they can be set by anyone when no proxy strips them.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// DeviceName describes a user agent for people, like "Firefox on Linux".
+// Only common browsers and systems are recognised; anything else is
+// "Unknown browser" or "unknown system".
+func DeviceName(userAgent string) string {
+	browser := "Unknown browser"
+	// Order matters: Edge and Opera also claim to be Chrome, Chrome claims
+	// to be Safari
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	system := "unknown system"
+	for _, s := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+	return browser + " on " + system
+}
@@ -0,0 +1,56 @@
+package ldapauth
+
+import (
+	"fmt"
+	"go-ldap-sso/internal/ldif"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Apply executes one LDIF change record as the configured bind DN.
+func (lc *LDAPClient) Apply(rec ldif.Record) error {
+	return lc.withConn(func() error { return lc.apply(rec) })
+}
+
+// apply is Apply. Callers must hold connMutex.
+func (lc *LDAPClient) apply(rec ldif.Record) error {
+	switch rec.ChangeType {
+	case ldif.ChangeAdd:
+		req := ldap.NewAddRequest(rec.DN, nil)
+		for _, a := range rec.Attributes {
+			req.Attribute(a.Name, a.Values)
+		}
+		return lc.conn.Add(req)
+	case ldif.ChangeModify:
+		req := ldap.NewModifyRequest(rec.DN, nil)
+		for _, m := range rec.Modifications {
+			switch m.Op {
+			case ldif.ModAdd:
+				req.Add(m.Attribute.Name, m.Attribute.Values)
+			case ldif.ModDelete:
+				req.Delete(m.Attribute.Name, m.Attribute.Values)
+			case ldif.ModReplace:
+				req.Replace(m.Attribute.Name, m.Attribute.Values)
+			}
+		}
+		return lc.conn.Modify(req)
+	case ldif.ChangeDelete:
+		return lc.conn.Del(ldap.NewDelRequest(rec.DN, nil))
+	case ldif.ChangeModRDN:
+		return lc.conn.ModifyDN(ldap.NewModifyDNRequest(rec.DN, rec.NewRDN, rec.DeleteOldRDN, rec.NewSuperior))
+	}
+	return fmt.Errorf("unsupported changetype %q", rec.ChangeType)
+}
+
+// InBaseDN reports whether dn is Config.BaseDN or below it.
+func (lc *LDAPClient) InBaseDN(dn string) bool {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return false
+	}
+	base, err := ldap.ParseDN(lc.Config.BaseDN)
+	if err != nil {
+		return false
+	}
+	return base.AncestorOfFold(parsed) || base.EqualFold(parsed)
+}
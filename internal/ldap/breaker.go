@@ -0,0 +1,241 @@
+package ldapauth
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen matches the *CircuitOpenError returned without contacting
+// the directory while the breaker is open.
+var ErrCircuitOpen = errors.New("ldap: circuit breaker open")
+
+// CircuitOpenError is wrapped in a directory_unavailable *AuthError.
+type CircuitOpenError struct {
+	// RetryAfter is how long the breaker stays open, at least a second
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string { return ErrCircuitOpen.Error() }
+
+func (e *CircuitOpenError) Is(target error) bool { return target == ErrCircuitOpen }
+
+// breaker stops sending requests to a failing directory. After threshold
+// consecutive failures it opens for cooldown; then a single trial request is
+// let through and its outcome closes or re-opens the breaker. Only directory
+// failures count, a wrong password is a perfectly healthy answer.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a request may go to the directory.
+func (b *breaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if wait := time.Until(b.openUntil); wait > 0 || b.trial {
+		if wait < time.Second {
+			wait = time.Second
+		}
+		return &CircuitOpenError{RetryAfter: wait}
+	}
+	// Half-open: this request is the trial, everyone else keeps failing fast
+	b.trial = true
+	return nil
+}
+
+// check reports whether the breaker opened since allow let a request through.
+// Unlike allow it does not start a trial.
+func (b *breaker) check() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if wait := time.Until(b.openUntil); wait > 0 {
+		if wait < time.Second {
+			wait = time.Second
+		}
+		return &CircuitOpenError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// record feeds the outcome of an allowed request back.
+func (b *breaker) record(err error) {
+	if b.threshold <= 0 || errors.Is(err, ErrCircuitOpen) {
+		// Turned away by check, the directory was never asked
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if !isDirectoryFailure(err) {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+func isDirectoryFailure(err error) bool {
+	var authErr *AuthError
+	return errors.As(err, &authErr) && authErr.Code == CodeDirectoryUnavailable && !errors.Is(err, ErrCircuitOpen)
+}
+
+// userCache remembers uid lookups for a short while, including misses, so
+// repeated logins don't search the directory each time and a brown-out
+// doesn't turn every typo'd username into a 10 second wait.
+type userCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]userCacheEntry
+}
+
+type userCacheEntry struct {
+	user    *User // nil for a cached miss
+	expires time.Time
+}
+
+func newUserCache(ttl time.Duration) *userCache {
+	return &userCache{
+		ttl: ttl,
+		// Misses expire sooner so a freshly created account can log in quickly
+		negativeTTL: ttl / 2,
+		entries:     make(map[string]userCacheEntry),
+	}
+}
+
+func (c *userCache) get(username string) (*User, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[strings.ToLower(username)]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.user, true
+}
+
+func (c *userCache) put(username string, user *User) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	ttl := c.ttl
+	if user == nil {
+		ttl = c.negativeTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Drop expired entries now and then so the map doesn't grow unbounded
+	if len(c.entries) > 1000 {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[strings.ToLower(username)] = userCacheEntry{user: user, expires: now.Add(ttl)}
+}
+
+func (c *userCache) forget(username string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, strings.ToLower(username))
+}
+
+// attributeCache remembers UserAttributes answers like userCache does user
+// lookups, so a busy policy endpoint doesn't queue on the directory
+// connection for every decision.
+type attributeCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]attributeCacheEntry
+}
+
+type attributeCacheEntry struct {
+	attrs   map[string][]string // nil for a user not found
+	expires time.Time
+}
+
+func newAttributeCache(ttl time.Duration) *attributeCache {
+	return &attributeCache{ttl: ttl, entries: make(map[string]attributeCacheEntry)}
+}
+
+func attributeCacheKey(uid string, names []string) string {
+	return strings.ToLower(uid) + "\x00" + strings.Join(names, "\x00")
+}
+
+func (c *attributeCache) get(uid string, names []string) (map[string][]string, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[attributeCacheKey(uid, names)]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.attrs, true
+}
+
+func (c *attributeCache) put(uid string, names []string, attrs map[string][]string) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) > 1000 {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[attributeCacheKey(uid, names)] = attributeCacheEntry{attrs: attrs, expires: now.Add(c.ttl)}
+}
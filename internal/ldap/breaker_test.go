@@ -0,0 +1,109 @@
+package ldapauth
+
+import (
+	"errors"
+	"go-ldap-sso/config"
+	"go-ldap-sso/internal/ldif"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(2, time.Hour)
+	failure := newAuthError(CodeDirectoryUnavailable, errors.New("connection refused"))
+
+	// Two requests get in before either fails
+	if b.allow() != nil || b.allow() != nil {
+		t.Fatal("allow() refused a closed breaker")
+	}
+	b.record(failure)
+	b.record(failure)
+
+	// A third that queued behind them must not reach the directory either
+	if err := b.check(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("check() after opening = %v, want ErrCircuitOpen", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow() after opening = %v, want ErrCircuitOpen", err)
+	}
+
+	// Being turned away does not count as a healthy answer
+	b.record(newAuthError(CodeDirectoryUnavailable, b.check()))
+	if err := b.check(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("check() after a turned away request = %v, want ErrCircuitOpen", err)
+	}
+
+	// Past the cooldown a single trial goes through and its success closes it
+	b.openUntil = time.Now().Add(-time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow() of the trial = %v", err)
+	}
+	if err := b.check(); err != nil {
+		t.Fatalf("check() of the trial = %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow() during the trial = %v, want ErrCircuitOpen", err)
+	}
+	b.record(ErrInvalidCredentials)
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow() after a successful trial = %v", err)
+	}
+}
+
+func TestConnLock(t *testing.T) {
+	l := make(connLock, 1)
+	if !l.lockWithin(time.Second) {
+		t.Fatal("lockWithin() of a free lock failed")
+	}
+	if l.lockWithin(10 * time.Millisecond) {
+		t.Fatal("lockWithin() of a held lock succeeded")
+	}
+	l.Unlock()
+	if !l.lockWithin(time.Second) {
+		t.Fatal("lockWithin() after Unlock failed")
+	}
+}
+
+func TestHeldConnectionTimesOut(t *testing.T) {
+	lc := &LDAPClient{
+		Config:    &config.LDAPConfig{TimeoutSeconds: 1},
+		connMutex: make(connLock, 1),
+		breaker:   newBreaker(0, 0),
+	}
+	// A request hung on the directory holds the connection
+	lc.connMutex.Lock()
+	defer lc.connMutex.Unlock()
+
+	calls := map[string]func() error{
+		"Apply":       func() error { return lc.Apply(ldif.Record{}) },
+		"ListUsers":   func() error { _, err := lc.ListUsers(); return err },
+		"HealthCheck": lc.HealthCheck,
+		"SupportsSyncrepl": func() error {
+			_, err := lc.SupportsSyncrepl()
+			return err
+		},
+		"ListUsersModifiedSince": func() error {
+			_, _, err := lc.ListUsersModifiedSince(time.Time{})
+			return err
+		},
+	}
+	var wg sync.WaitGroup
+	for name, call := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := call(); AuthErrorCodeOf(err) != CodeDirectoryUnavailable {
+				t.Errorf("%s() error = %v, want directory unavailable", name, err)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("calls still waiting for the held connection")
+	}
+}
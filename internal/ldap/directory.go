@@ -0,0 +1,232 @@
+package ldapauth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrGroupNotFound is returned by GroupMembers for an unknown cn.
+var ErrGroupNotFound = errors.New("ldap: group not found")
+
+// groupFilter matches the group object classes of OpenLDAP and AD.
+const groupFilter = "(|(objectClass=groupOfNames)(objectClass=groupOfUniqueNames)(objectClass=posixGroup)(objectClass=group))"
+
+// ListUsers returns every entry matching Config.UserFilter, fetched with the
+// simple paged results control so servers with a size limit return all of them.
+func (lc *LDAPClient) ListUsers() (users []*User, err error) {
+	err = lc.withConn(func() error {
+		users, err = lc.listUsers()
+		return err
+	})
+	return users, err
+}
+
+// listUsers is ListUsers. Callers must hold connMutex.
+func (lc *LDAPClient) listUsers() ([]*User, error) {
+	searchRequest := ldap.NewSearchRequest(
+		lc.Config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		lc.userFilter(),
+		userAttributes,
+		nil,
+	)
+
+	sr, err := lc.conn.SearchWithPaging(searchRequest, lc.pageSize())
+	if err != nil {
+		return nil, fmt.Errorf("paged search failed: %w", err)
+	}
+
+	users := make([]*User, 0, len(sr.Entries))
+	for _, entry := range sr.Entries {
+		users = append(users, newUser(entry))
+	}
+	return users, nil
+}
+
+func (lc *LDAPClient) userFilter() string {
+	if lc.Config.UserFilter == "" {
+		return "(objectClass=inetOrgPerson)"
+	}
+	return lc.Config.UserFilter
+}
+
+func (lc *LDAPClient) pageSize() uint32 {
+	if lc.Config.SyncPageSize <= 0 {
+		return 500
+	}
+	return uint32(lc.Config.SyncPageSize)
+}
+
+// SearchUsers returns users whose uid, cn or mail contains query, at most
+// sizeLimit of them. truncated reports that the server stopped at the limit.
+func (lc *LDAPClient) SearchUsers(query string, sizeLimit int) (users []*User, truncated bool, err error) {
+	err = lc.withConn(func() error {
+		users, truncated, err = lc.searchUsers(query, sizeLimit)
+		return err
+	})
+	return users, truncated, err
+}
+
+// searchUsers is SearchUsers. Callers must hold connMutex.
+func (lc *LDAPClient) searchUsers(query string, sizeLimit int) (users []*User, truncated bool, err error) {
+	q := ldap.EscapeFilter(query)
+	filter := fmt.Sprintf("(&%s(|(uid=*%s*)(cn=*%s*)(mail=*%s*)))", lc.userFilter(), q, q, q)
+
+	searchRequest := ldap.NewSearchRequest(
+		lc.Config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, sizeLimit, 10, false,
+		filter,
+		userAttributes,
+		nil,
+	)
+
+	sr, err := lc.conn.Search(searchRequest)
+	if err != nil {
+		if !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || sr == nil {
+			return nil, false, newAuthError(CodeDirectoryUnavailable, fmt.Errorf("search failed: %w", err))
+		}
+		truncated = true
+	}
+
+	users = make([]*User, 0, len(sr.Entries))
+	for _, entry := range sr.Entries {
+		users = append(users, newUser(entry))
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UID < users[j].UID })
+	return users, truncated, nil
+}
+
+// GroupMembers resolves the members of the group with the given cn, at most
+// sizeLimit of them, with a single search. Both DN-valued (member,
+// uniqueMember) and uid-valued (memberUid) groups are supported; members that
+// are not users matching the user filter are skipped. truncated reports that
+// the group has more members than were resolved.
+func (lc *LDAPClient) GroupMembers(cn string, sizeLimit int) (members []*User, truncated bool, err error) {
+	err = lc.withConn(func() error {
+		members, truncated, err = lc.groupMembers(cn, sizeLimit)
+		return err
+	})
+	return members, truncated, err
+}
+
+// groupMembers is GroupMembers. Callers must hold connMutex.
+func (lc *LDAPClient) groupMembers(cn string, sizeLimit int) (members []*User, truncated bool, err error) {
+	sr, err := lc.conn.Search(ldap.NewSearchRequest(
+		lc.Config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		fmt.Sprintf("(&%s(cn=%s))", groupFilter, ldap.EscapeFilter(cn)),
+		[]string{"member", "uniqueMember", "memberUid"},
+		nil,
+	))
+	if err != nil {
+		return nil, false, newAuthError(CodeDirectoryUnavailable, fmt.Errorf("group search failed: %w", err))
+	}
+	if len(sr.Entries) == 0 {
+		return nil, false, ErrGroupNotFound
+	}
+	group := sr.Entries[0]
+
+	// DN members are matched on their first RDN, the only part a filter can
+	// test portably, and then checked against the full DN
+	var terms []string
+	dns := make(map[string]bool)
+	uids := make(map[string]bool)
+	for _, value := range append(group.GetAttributeValues("member"), group.GetAttributeValues("uniqueMember")...) {
+		dn, err := ldap.ParseDN(value)
+		if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+			continue
+		}
+		rdn := dn.RDNs[0].Attributes[0]
+		dns[strings.ToLower(dn.String())] = true
+		terms = append(terms, fmt.Sprintf("(%s=%s)", ldap.EscapeFilter(rdn.Type), ldap.EscapeFilter(rdn.Value)))
+	}
+	for _, uid := range group.GetAttributeValues("memberUid") {
+		uids[strings.ToLower(uid)] = true
+		terms = append(terms, fmt.Sprintf("(uid=%s)", ldap.EscapeFilter(uid)))
+	}
+	if len(terms) > sizeLimit {
+		terms, truncated = terms[:sizeLimit], true
+	}
+	if len(terms) == 0 {
+		return []*User{}, truncated, nil
+	}
+
+	res, err := lc.conn.Search(ldap.NewSearchRequest(
+		lc.Config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, sizeLimit, 10, false,
+		fmt.Sprintf("(&%s(|%s))", lc.userFilter(), strings.Join(terms, "")),
+		userAttributes,
+		nil,
+	))
+	if err != nil {
+		if !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || res == nil {
+			return nil, false, newAuthError(CodeDirectoryUnavailable, fmt.Errorf("member search failed: %w", err))
+		}
+		truncated = true
+	}
+
+	members = make([]*User, 0, len(res.Entries))
+	for _, entry := range res.Entries {
+		dn, err := ldap.ParseDN(entry.DN)
+		isMember := err == nil && dns[strings.ToLower(dn.String())]
+		if isMember || uids[strings.ToLower(entry.GetAttributeValue("uid"))] {
+			members = append(members, newUser(entry))
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool { return members[i].UID < members[j].UID })
+	return members, truncated, nil
+}
+
+// UserAttributes returns the requested attributes of the user with the given
+// uid, attribute names as asked for. Attributes the entry lacks are omitted.
+// Answers, including unknown users, are cached like user lookups.
+func (lc *LDAPClient) UserAttributes(uid string, names []string) (attrs map[string][]string, err error) {
+	if attrs, ok := lc.attributes.get(uid, names); ok {
+		if attrs == nil {
+			return nil, ErrUserNotFound
+		}
+		return attrs, nil
+	}
+
+	err = lc.withConn(func() error {
+		attrs, err = lc.findAttributes(uid, names)
+		return err
+	})
+	switch {
+	case err == nil:
+		lc.attributes.put(uid, names, attrs)
+	case errors.Is(err, ErrUserNotFound):
+		lc.attributes.put(uid, names, nil)
+	}
+	return attrs, err
+}
+
+// findAttributes is UserAttributes. Callers must hold connMutex.
+func (lc *LDAPClient) findAttributes(uid string, names []string) (map[string][]string, error) {
+	sr, err := lc.conn.Search(ldap.NewSearchRequest(
+		lc.Config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		fmt.Sprintf("(&%s(uid=%s))", lc.userFilter(), ldap.EscapeFilter(uid)),
+		names,
+		nil,
+	))
+	if err != nil {
+		return nil, newAuthError(CodeDirectoryUnavailable, fmt.Errorf("attribute search failed: %w", err))
+	}
+	if len(sr.Entries) != 1 {
+		return nil, ErrUserNotFound
+	}
+
+	attrs := make(map[string][]string)
+	for _, name := range names {
+		if values := sr.Entries[0].GetEqualFoldAttributeValues(name); len(values) > 0 {
+			attrs[name] = values
+		}
+	}
+	return attrs, nil
+}
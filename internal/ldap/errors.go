@@ -0,0 +1,172 @@
+package ldapauth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// AuthErrorCode is a stable, client-facing reason for a failed login.
+type AuthErrorCode string
+
+const (
+	CodeInvalidCredentials   AuthErrorCode = "invalid_credentials"
+	CodeAccountLocked        AuthErrorCode = "account_locked"
+	CodeAccountDisabled      AuthErrorCode = "account_disabled"
+	CodePasswordExpired      AuthErrorCode = "password_expired"
+	CodePasswordMustChange   AuthErrorCode = "password_must_change"
+	CodeDirectoryUnavailable AuthErrorCode = "directory_unavailable"
+	// CodePasswordRejected is returned when the directory refuses a new password
+	// (quality, length, history or minimum age checks)
+	CodePasswordRejected AuthErrorCode = "password_rejected"
+)
+
+// AuthError is returned by Authenticate. Code is safe to show to the user,
+// Err keeps the raw directory error for logging only.
+type AuthError struct {
+	Code AuthErrorCode
+	Err  error
+}
+
+func (e *AuthError) Error() string {
+	if e.Err == nil {
+		return string(e.Code)
+	}
+	return fmt.Sprintf("%s: %v", e.Code, e.Err)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// Is lets callers match on the code only, e.g. errors.Is(err, ErrAccountLocked).
+func (e *AuthError) Is(target error) bool {
+	t, ok := target.(*AuthError)
+	return ok && t.Err == nil && t.Code == e.Code
+}
+
+var (
+	ErrInvalidCredentials   = &AuthError{Code: CodeInvalidCredentials}
+	ErrAccountLocked        = &AuthError{Code: CodeAccountLocked}
+	ErrAccountDisabled      = &AuthError{Code: CodeAccountDisabled}
+	ErrPasswordExpired      = &AuthError{Code: CodePasswordExpired}
+	ErrPasswordMustChange   = &AuthError{Code: CodePasswordMustChange}
+	ErrDirectoryUnavailable = &AuthError{Code: CodeDirectoryUnavailable}
+	ErrPasswordRejected     = &AuthError{Code: CodePasswordRejected}
+)
+
+// ErrUserNotFound is returned by lookups when no entry matches the uid.
+var ErrUserNotFound = errors.New("ldap: user not found")
+
+func newAuthError(code AuthErrorCode, err error) *AuthError {
+	return &AuthError{Code: code, Err: err}
+}
+
+// AuthErrorCodeOf returns the code carried by err, or CodeDirectoryUnavailable
+// for anything that is not an *AuthError.
+func AuthErrorCodeOf(err error) AuthErrorCode {
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return authErr.Code
+	}
+	return CodeDirectoryUnavailable
+}
+
+// PasswordWarning carries the non-fatal password policy state of a successful bind.
+type PasswordWarning struct {
+	// ExpiresInSeconds is the time left before the password expires, -1 if unknown
+	ExpiresInSeconds int64
+	// GraceLoginsRemaining is set when the password already expired, -1 if unknown
+	GraceLoginsRemaining int64
+}
+
+// passwordPolicyControls is sent with every user bind. The response controls
+// are only returned by servers with ppolicy (Behera) or the Netscape
+// password controls enabled; other servers just ignore them.
+func passwordPolicyControls() []ldap.Control {
+	return []ldap.Control{ldap.NewControlBeheraPasswordPolicy()}
+}
+
+// classifyBind turns the result of a user bind into a warning or a typed error.
+func classifyBind(res *ldap.SimpleBindResult, bindErr error) (*PasswordWarning, error) {
+	warning := &PasswordWarning{ExpiresInSeconds: -1, GraceLoginsRemaining: -1}
+	mustChange := false
+
+	var policyErr int8 = -1
+	if res != nil {
+		for _, ctrl := range res.Controls {
+			switch c := ctrl.(type) {
+			case *ldap.ControlBeheraPasswordPolicy:
+				if c.Expire >= 0 {
+					warning.ExpiresInSeconds = c.Expire
+				}
+				if c.Grace >= 0 {
+					warning.GraceLoginsRemaining = c.Grace
+				}
+				policyErr = c.Error
+			case *ldap.ControlVChuPasswordMustChange:
+				mustChange = c.MustChange
+			case *ldap.ControlVChuPasswordWarning:
+				if c.Expire >= 0 {
+					warning.ExpiresInSeconds = c.Expire
+				}
+			}
+		}
+	}
+
+	if bindErr != nil {
+		switch policyErr {
+		case ldap.BeheraAccountLocked:
+			return nil, newAuthError(CodeAccountLocked, bindErr)
+		case ldap.BeheraPasswordExpired:
+			return nil, newAuthError(CodePasswordExpired, bindErr)
+		case ldap.BeheraChangeAfterReset:
+			return nil, newAuthError(CodePasswordMustChange, bindErr)
+		}
+		if code, ok := activeDirectoryBindCode(bindErr); ok {
+			return nil, newAuthError(code, bindErr)
+		}
+		if ldap.IsErrorWithCode(bindErr, ldap.LDAPResultInvalidCredentials) {
+			return nil, newAuthError(CodeInvalidCredentials, bindErr)
+		}
+		if ldap.IsErrorAnyOf(bindErr, ldap.LDAPResultUnwillingToPerform, ldap.LDAPResultConstraintViolation) {
+			// Also used for policy or syntax rejections, so only the ppolicy
+			// control or AD sub-code above can tell a locked account. Either
+			// way the directory answered and the login is refused.
+			return nil, newAuthError(CodeInvalidCredentials, bindErr)
+		}
+		return nil, newAuthError(CodeDirectoryUnavailable, bindErr)
+	}
+
+	// Bind succeeded but the server restricts the session until the password is changed
+	if mustChange || policyErr == ldap.BeheraChangeAfterReset {
+		return nil, newAuthError(CodePasswordMustChange, fmt.Errorf("server requires password change"))
+	}
+	if policyErr == ldap.BeheraPasswordExpired {
+		return nil, newAuthError(CodePasswordExpired, fmt.Errorf("password expired"))
+	}
+
+	if warning.ExpiresInSeconds < 0 && warning.GraceLoginsRemaining < 0 {
+		return nil, nil
+	}
+	return warning, nil
+}
+
+// activeDirectoryBindCode decodes the "data XXX" sub-code AD puts in the
+// diagnostic message of a failed bind (result code 49).
+func activeDirectoryBindCode(err error) (AuthErrorCode, bool) {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "data 775"):
+		return CodeAccountLocked, true
+	case strings.Contains(msg, "data 533"), strings.Contains(msg, "data 701"):
+		return CodeAccountDisabled, true
+	case strings.Contains(msg, "data 532"):
+		return CodePasswordExpired, true
+	case strings.Contains(msg, "data 773"):
+		return CodePasswordMustChange, true
+	}
+	return "", false
+}
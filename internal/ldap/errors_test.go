@@ -0,0 +1,162 @@
+package ldapauth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func bindError(code uint16, msg string) error {
+	return ldap.NewError(code, errors.New(msg))
+}
+
+func policyResult(expire, grace int64, policyErr int8) *ldap.SimpleBindResult {
+	return &ldap.SimpleBindResult{Controls: []ldap.Control{
+		&ldap.ControlBeheraPasswordPolicy{Expire: expire, Grace: grace, Error: policyErr},
+	}}
+}
+
+func TestClassifyBind(t *testing.T) {
+	tests := []struct {
+		name    string
+		res     *ldap.SimpleBindResult
+		err     error
+		code    AuthErrorCode // empty for success
+		warning *PasswordWarning
+	}{
+		{name: "success", res: &ldap.SimpleBindResult{}},
+		{
+			name:    "expiry warning",
+			res:     policyResult(3600, -1, -1),
+			warning: &PasswordWarning{ExpiresInSeconds: 3600, GraceLoginsRemaining: -1},
+		},
+		{
+			name:    "grace logins",
+			res:     policyResult(-1, 2, -1),
+			warning: &PasswordWarning{ExpiresInSeconds: -1, GraceLoginsRemaining: 2},
+		},
+		{
+			name:    "netscape expiry warning",
+			res:     &ldap.SimpleBindResult{Controls: []ldap.Control{&ldap.ControlVChuPasswordWarning{Expire: 60}}},
+			warning: &PasswordWarning{ExpiresInSeconds: 60, GraceLoginsRemaining: -1},
+		},
+		{
+			name: "wrong password",
+			err:  bindError(ldap.LDAPResultInvalidCredentials, "invalid credentials"),
+			code: CodeInvalidCredentials,
+		},
+		{
+			name: "ppolicy locked",
+			res:  policyResult(-1, -1, ldap.BeheraAccountLocked),
+			err:  bindError(ldap.LDAPResultInvalidCredentials, "invalid credentials"),
+			code: CodeAccountLocked,
+		},
+		{
+			name: "ppolicy expired",
+			res:  policyResult(-1, -1, ldap.BeheraPasswordExpired),
+			err:  bindError(ldap.LDAPResultInvalidCredentials, "invalid credentials"),
+			code: CodePasswordExpired,
+		},
+		{
+			name: "ppolicy change after reset refused",
+			res:  policyResult(-1, -1, ldap.BeheraChangeAfterReset),
+			err:  bindError(ldap.LDAPResultInvalidCredentials, "invalid credentials"),
+			code: CodePasswordMustChange,
+		},
+		{
+			name: "ppolicy change after reset accepted",
+			res:  policyResult(-1, -1, ldap.BeheraChangeAfterReset),
+			code: CodePasswordMustChange,
+		},
+		{
+			name: "netscape must change",
+			res:  &ldap.SimpleBindResult{Controls: []ldap.Control{&ldap.ControlVChuPasswordMustChange{MustChange: true}}},
+			code: CodePasswordMustChange,
+		},
+		{
+			name: "ppolicy expired accepted",
+			res:  policyResult(-1, -1, ldap.BeheraPasswordExpired),
+			code: CodePasswordExpired,
+		},
+		{
+			name: "ad locked",
+			err:  bindError(ldap.LDAPResultInvalidCredentials, "80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 775, v3839"),
+			code: CodeAccountLocked,
+		},
+		{
+			name: "unwilling to perform without control",
+			err:  bindError(ldap.LDAPResultUnwillingToPerform, "unauthenticated bind (DN with no password) disallowed"),
+			code: CodeInvalidCredentials,
+		},
+		{
+			name: "constraint violation without control",
+			err:  bindError(ldap.LDAPResultConstraintViolation, "invalid DN syntax"),
+			code: CodeInvalidCredentials,
+		},
+		{
+			name: "unwilling to perform with locked control",
+			res:  policyResult(-1, -1, ldap.BeheraAccountLocked),
+			err:  bindError(ldap.LDAPResultUnwillingToPerform, "account locked"),
+			code: CodeAccountLocked,
+		},
+		{
+			name: "server down",
+			err:  bindError(ldap.ErrorNetwork, "connection closed"),
+			code: CodeDirectoryUnavailable,
+		},
+		{
+			name: "busy",
+			err:  bindError(ldap.LDAPResultBusy, "busy"),
+			code: CodeDirectoryUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warning, err := classifyBind(tt.res, tt.err)
+			if tt.code == "" {
+				if err != nil {
+					t.Fatalf("classifyBind() error = %v, want none", err)
+				}
+			} else if got := AuthErrorCodeOf(err); err == nil || got != tt.code {
+				t.Fatalf("classifyBind() error = %v, want code %s", err, tt.code)
+			}
+
+			switch {
+			case tt.warning == nil && warning != nil:
+				t.Errorf("classifyBind() warning = %+v, want none", *warning)
+			case tt.warning != nil && (warning == nil || *warning != *tt.warning):
+				t.Errorf("classifyBind() warning = %+v, want %+v", warning, *tt.warning)
+			}
+		})
+	}
+}
+
+func TestActiveDirectoryBindCode(t *testing.T) {
+	tests := []struct {
+		subCode string
+		code    AuthErrorCode
+		ok      bool
+	}{
+		{"data 52e", "", false},
+		{"data 525", "", false},
+		{"data 775", CodeAccountLocked, true},
+		{"data 533", CodeAccountDisabled, true},
+		{"data 701", CodeAccountDisabled, true},
+		{"data 532", CodePasswordExpired, true},
+		{"data 773", CodePasswordMustChange, true},
+		{"DATA 775", CodeAccountLocked, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subCode, func(t *testing.T) {
+			err := bindError(ldap.LDAPResultInvalidCredentials,
+				"80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, "+tt.subCode+", v3839")
+			code, ok := activeDirectoryBindCode(err)
+			if code != tt.code || ok != tt.ok {
+				t.Errorf("activeDirectoryBindCode() = %q, %v, want %q, %v", code, ok, tt.code, tt.ok)
+			}
+		})
+	}
+}
@@ -2,10 +2,11 @@ package ldapauth
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"go-ldap-sso/config"
 	"log"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/go-ldap/ldap/v3"
@@ -14,14 +15,23 @@ import (
 type LDAPClient struct {
 	Config    *config.LDAPConfig
 	conn      *ldap.Conn
-	connMutex sync.Mutex
+	connMutex connLock
 	isClosed  bool
+
+	breaker    *breaker
+	users      *userCache
+	attributes *attributeCache
 }
 
 func NewLDAPClient(cfg *config.LDAPConfig) (*LDAPClient, error) {
 	client := &LDAPClient{
-		Config:   cfg,
-		isClosed: false,
+		Config:    cfg,
+		connMutex: make(connLock, 1),
+		isClosed:  false,
+		breaker:   newBreaker(cfg.BreakerThreshold, time.Duration(cfg.BreakerCooldownSecs)*time.Second),
+		users:     newUserCache(time.Duration(cfg.UserCacheSeconds) * time.Second),
+		// Policy checks ask for attributes as often as logins look up users
+		attributes: newAttributeCache(time.Duration(cfg.UserCacheSeconds) * time.Second),
 	}
 
 	if err := client.ensureConnection(); err != nil {
@@ -31,10 +41,37 @@ func NewLDAPClient(cfg *config.LDAPConfig) (*LDAPClient, error) {
 	return client, nil
 }
 
+// connLock guards the shared connection. Unlike sync.Mutex a waiter can give
+// up, so requests queued behind a hung directory fail instead of piling up.
+type connLock chan struct{}
+
+func (l connLock) Lock() { l <- struct{}{} }
+
+func (l connLock) Unlock() { <-l }
+
+// lockWithin reports whether the lock was acquired before timeout.
+func (l connLock) lockWithin(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case l <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
 func (lc *LDAPClient) ensureConnection() error {
 	lc.connMutex.Lock()
 	defer lc.connMutex.Unlock()
 
+	return lc.checkConnection()
+}
+
+// checkConnection makes sure the connection is alive, reconnecting if not.
+// Callers must hold connMutex.
+func (lc *LDAPClient) checkConnection() error {
 	if lc.conn != nil && !lc.isClosed {
 		// check connection with empty search
 		searchRequest := ldap.NewSearchRequest(
@@ -49,9 +86,167 @@ func (lc *LDAPClient) ensureConnection() error {
 		if err == nil {
 			return nil
 		}
+	}
+
+	return lc.reconnect()
+}
+
+// reconnect replaces the connection with a fresh one. Callers must hold
+// connMutex.
+func (lc *LDAPClient) reconnect() error {
+	if lc.conn != nil && !lc.isClosed {
 		lc.conn.Close()
 	}
 
+	conn, err := lc.dial(lc.timeout())
+	if err != nil {
+		return err
+	}
+
+	lc.conn = conn
+	lc.isClosed = false
+	return nil
+}
+
+func (lc *LDAPClient) timeout() time.Duration {
+	if lc.Config.TimeoutSeconds <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(lc.Config.TimeoutSeconds) * time.Second
+}
+
+// User is the subset of a directory entry the application cares about.
+type User struct {
+	DN    string
+	UID   string
+	Name  string
+	Email string
+	// EntryUUID is the RFC 4530 entryUUID, empty on servers without it
+	EntryUUID string
+	// Disabled is set for AD accounts with ACCOUNTDISABLE or ppolicy-locked OpenLDAP accounts
+	Disabled bool
+}
+
+// userAttributes are the attributes requested for every User lookup.
+var userAttributes = []string{"dn", "uid", "cn", "mail", "entryUUID", "userAccountControl", "pwdAccountLockedTime"}
+
+// uacAccountDisable is the ACCOUNTDISABLE flag of the AD userAccountControl attribute.
+const uacAccountDisable = 0x2
+
+func newUser(entry *ldap.Entry) *User {
+	disabled := entry.GetAttributeValue("pwdAccountLockedTime") != ""
+	if uac, err := strconv.ParseInt(entry.GetAttributeValue("userAccountControl"), 10, 64); err == nil {
+		disabled = disabled || uac&uacAccountDisable != 0
+	}
+
+	return &User{
+		DN:        entry.DN,
+		UID:       entry.GetAttributeValue("uid"),
+		Name:      entry.GetAttributeValue("cn"),
+		Email:     entry.GetAttributeValue("mail"),
+		EntryUUID: entry.GetAttributeValue("entryUUID"),
+		Disabled:  disabled,
+	}
+}
+
+// findUser looks up a single user by uid. Callers must hold connMutex.
+func (lc *LDAPClient) findUser(username string) (*User, error) {
+	searchRequest := ldap.NewSearchRequest(
+		lc.Config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf("(uid=%s)", ldap.EscapeFilter(username)),
+		userAttributes,
+		nil,
+	)
+
+	sr, err := lc.conn.Search(searchRequest)
+	if err != nil && lc.conn.IsClosing() {
+		// The connection dropped since ensureConnection checked it, reconnect and retry once
+		if err := lc.reconnect(); err != nil {
+			return nil, newAuthError(CodeDirectoryUnavailable, fmt.Errorf("search failed: %v", err))
+		}
+		sr, err = lc.conn.Search(searchRequest)
+		if err != nil {
+			return nil, newAuthError(CodeDirectoryUnavailable, fmt.Errorf("search failed after retry: %v", err))
+		}
+	}
+	if err != nil {
+		return nil, newAuthError(CodeDirectoryUnavailable, fmt.Errorf("search failed: %v", err))
+	}
+
+	switch len(sr.Entries) {
+	case 0:
+		return nil, ErrUserNotFound
+	case 1:
+	default:
+		return nil, fmt.Errorf("duplicate entries for uid %q", username)
+	}
+
+	return newUser(sr.Entries[0]), nil
+}
+
+// cachedUser is findUser behind the user cache. Callers must hold connMutex.
+func (lc *LDAPClient) cachedUser(username string) (*User, error) {
+	if user, ok := lc.users.get(username); ok {
+		if user == nil {
+			return nil, ErrUserNotFound
+		}
+		return user, nil
+	}
+
+	user, err := lc.findUser(username)
+	switch {
+	case err == nil:
+		lc.users.put(username, user)
+	case errors.Is(err, ErrUserNotFound):
+		lc.users.put(username, nil)
+	}
+	return user, err
+}
+
+// withConn runs fn holding connMutex on a live connection, behind the
+// circuit breaker. The wait for the connection is bounded by the request
+// timeout, and the breaker is checked again once it is acquired since it may
+// have opened while this request queued behind slower ones.
+func (lc *LDAPClient) withConn(fn func() error) (err error) {
+	if err := lc.breaker.allow(); err != nil {
+		return newAuthError(CodeDirectoryUnavailable, err)
+	}
+	defer func() { lc.breaker.record(err) }()
+
+	if !lc.connMutex.lockWithin(lc.timeout()) {
+		return newAuthError(CodeDirectoryUnavailable, errors.New("timed out waiting for the directory connection"))
+	}
+	defer lc.connMutex.Unlock()
+
+	if err := lc.breaker.check(); err != nil {
+		return newAuthError(CodeDirectoryUnavailable, err)
+	}
+	if err := lc.checkConnection(); err != nil {
+		return newAuthError(CodeDirectoryUnavailable, err)
+	}
+	return fn()
+}
+
+// LookupUser returns the directory entry of username.
+func (lc *LDAPClient) LookupUser(username string) (user *User, err error) {
+	err = lc.withConn(func() error {
+		user, err = lc.findUser(username)
+		return err
+	})
+	return user, err
+}
+
+// AuthResult is the outcome of a successful user bind.
+type AuthResult struct {
+	User
+	// Warning is non-nil when the password policy reported an upcoming expiry or grace logins
+	Warning *PasswordWarning
+}
+
+// dial opens a new connection bound as the service account. A zero timeout
+// disables the per-request timeout, needed for persistent searches.
+func (lc *LDAPClient) dial(timeout time.Duration) (*ldap.Conn, error) {
 	var conn *ldap.Conn
 	var err error
 
@@ -64,68 +259,72 @@ func (lc *LDAPClient) ensureConnection() error {
 	}
 
 	if err != nil {
-		return fmt.Errorf("connection failed: %v", err)
+		return nil, fmt.Errorf("connection failed: %v", err)
 	}
 
 	// Set timeout
-	conn.SetTimeout(10 * time.Second)
+	conn.SetTimeout(timeout)
 
 	err = conn.Bind(lc.Config.BindDN, lc.Config.BindPass)
 	if err != nil {
 		conn.Close()
-		return fmt.Errorf("admin bind failed: %v", err)
+		return nil, fmt.Errorf("admin bind failed: %v", err)
 	}
 
-	lc.conn = conn
-	lc.isClosed = false
-	return nil
+	return conn, nil
 }
 
 func (lc *LDAPClient) Authenticate(username, password string) (string, error) {
-	if err := lc.ensureConnection(); err != nil {
+	res, err := lc.AuthenticateUser(username, password)
+	if err != nil {
 		return "", err
 	}
+	return res.Email, nil
+}
 
-	lc.connMutex.Lock()
-	defer lc.connMutex.Unlock()
+// AuthenticateUser binds as the user with the password policy request control
+// and returns an *AuthError describing why the bind was refused. While the
+// circuit breaker is open it fails fast with directory_unavailable.
+func (lc *LDAPClient) AuthenticateUser(username, password string) (res *AuthResult, err error) {
+	if username == "" || password == "" {
+		// An empty password would be an unauthenticated bind, never treat it as a login
+		return nil, newAuthError(CodeInvalidCredentials, fmt.Errorf("empty username or password"))
+	}
 
-	// Search user
-	searchRequest := ldap.NewSearchRequest(
-		lc.Config.BaseDN,
-		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
-		fmt.Sprintf("(uid=%s)", ldap.EscapeFilter(username)),
-		[]string{"dn", "cn", "mail"},
-		nil,
-	)
+	err = lc.withConn(func() error {
+		res, err = lc.bindUser(username, password)
+		return err
+	})
+	return res, err
+}
 
-	sr, err := lc.conn.Search(searchRequest)
+// bindUser verifies the password of username. Callers must hold connMutex.
+func (lc *LDAPClient) bindUser(username, password string) (*AuthResult, error) {
+	user, err := lc.cachedUser(username)
 	if err != nil {
-		if err := lc.ensureConnection(); err != nil {
-			return "", fmt.Errorf("search failed: %v", err)
-		}
-		sr, err = lc.conn.Search(searchRequest)
-		if err != nil {
-			return "", fmt.Errorf("search failed after retry: %v", err)
+		if errors.Is(err, ErrUserNotFound) {
+			// Same code as a wrong password so the endpoint can't be used to enumerate users
+			return nil, newAuthError(CodeInvalidCredentials, err)
 		}
+		return nil, err
 	}
 
-	if len(sr.Entries) != 1 {
-		return "", fmt.Errorf("user not found or duplicate entries")
+	// Verify credentials, always going back to the admin bind afterwards
+	bindRes, bindErr := lc.conn.SimpleBind(ldap.NewSimpleBindRequest(user.DN, password, passwordPolicyControls()))
+	if err := lc.conn.Bind(lc.Config.BindDN, lc.Config.BindPass); err != nil {
+		log.Printf("Warning: failed to rebind as admin: %v", err)
 	}
 
-	userDN := sr.Entries[0].DN
-
-	// Verify credentials
-	err = lc.conn.Bind(userDN, password)
+	warning, err := classifyBind(bindRes, bindErr)
 	if err != nil {
-		return "", fmt.Errorf("invalid credentials: %v", err)
-	}
-
-	if err := lc.conn.Bind(lc.Config.BindDN, lc.Config.BindPass); err != nil {
-		log.Printf("Warning: failed to rebind as admin: %v", err)
+		if AuthErrorCodeOf(err) == CodeInvalidCredentials {
+			// The cached DN may be stale (entry moved or renamed), look it up again next time
+			lc.users.forget(username)
+		}
+		return nil, err
 	}
 
-	return sr.Entries[0].GetAttributeValue("mail"), nil
+	return &AuthResult{User: *user, Warning: warning}, nil
 }
 
 func (lc *LDAPClient) Close() {
@@ -138,22 +337,9 @@ func (lc *LDAPClient) Close() {
 	}
 }
 
+// HealthCheck reports whether the directory answers, reconnecting if the
+// connection dropped. It fails fast while the circuit breaker is open.
 func (lc *LDAPClient) HealthCheck() error {
-	lc.connMutex.Lock()
-	defer lc.connMutex.Unlock()
-
-	if lc.conn == nil || lc.isClosed {
-		return fmt.Errorf("no active connection")
-	}
-
-	searchRequest := ldap.NewSearchRequest(
-		lc.Config.BaseDN,
-		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
-		"(objectClass=*)",
-		[]string{"1.1"},
-		nil,
-	)
-
-	_, err := lc.conn.Search(searchRequest)
-	return err
+	// withConn checks the connection with a base search already
+	return lc.withConn(func() error { return nil })
 }
@@ -0,0 +1,183 @@
+package ldapauth_test
+
+import (
+	"errors"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"go-ldap-sso/internal/ldapserver/ldaptest"
+	"testing"
+)
+
+const testLDIF = `dn: ou=users,dc=example,dc=org
+objectClass: organizationalUnit
+ou: users
+
+dn: ou=groups,dc=example,dc=org
+objectClass: organizationalUnit
+ou: groups
+
+dn: uid=alice,ou=users,dc=example,dc=org
+objectClass: inetOrgPerson
+cn: Alice
+sn: Example
+uid: alice
+mail: alice@example.org
+userPassword: secret123
+
+dn: uid=bob,ou=users,dc=example,dc=org
+objectClass: inetOrgPerson
+cn: Bob
+sn: Example
+uid: bob
+mail: bob@example.org
+userPassword: hunter22
+
+dn: cn=admins,ou=groups,dc=example,dc=org
+objectClass: groupOfNames
+cn: admins
+member: uid=alice,ou=users,dc=example,dc=org
+member: uid=ghost,ou=users,dc=example,dc=org
+
+dn: cn=devs,ou=groups,dc=example,dc=org
+objectClass: posixGroup
+cn: devs
+memberUid: bob
+memberUid: alice
+`
+
+// newTestClient starts the embedded directory on a free port and returns a
+// client connected to it as the service account.
+func newTestClient(t *testing.T) *ldapauth.LDAPClient {
+	t.Helper()
+	cfg := ldaptest.Start(t, testLDIF)
+	cfg.UserCacheSeconds = 60
+	return ldaptest.Connect(t, cfg)
+}
+
+func TestAuthenticateUser(t *testing.T) {
+	client := newTestClient(t)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		code     ldapauth.AuthErrorCode // empty for success
+	}{
+		{name: "success", username: "alice", password: "secret123"},
+		{name: "wrong password", username: "alice", password: "nope", code: ldapauth.CodeInvalidCredentials},
+		{name: "unknown user", username: "mallory", password: "secret123", code: ldapauth.CodeInvalidCredentials},
+		{name: "empty password", username: "alice", password: "", code: ldapauth.CodeInvalidCredentials},
+		{name: "filter injection", username: "*", password: "secret123", code: ldapauth.CodeInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client.AuthenticateUser(tt.username, tt.password)
+			if tt.code != "" {
+				if err == nil || ldapauth.AuthErrorCodeOf(err) != tt.code {
+					t.Fatalf("AuthenticateUser() error = %v, want code %s", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AuthenticateUser() error = %v", err)
+			}
+			if res.Email != "alice@example.org" || res.Name != "Alice" || res.Warning != nil {
+				t.Errorf("AuthenticateUser() = %+v", res)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	client := newTestClient(t)
+
+	err := client.ChangePassword("alice", "wrong", "newsecret456")
+	if !errors.Is(err, ldapauth.ErrInvalidCredentials) {
+		t.Fatalf("ChangePassword() with a wrong old password error = %v", err)
+	}
+
+	if err := client.ChangePassword("alice", "secret123", "newsecret456"); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	if _, err := client.AuthenticateUser("alice", "secret123"); !errors.Is(err, ldapauth.ErrInvalidCredentials) {
+		t.Errorf("old password still accepted: %v", err)
+	}
+	if _, err := client.AuthenticateUser("alice", "newsecret456"); err != nil {
+		t.Errorf("new password refused: %v", err)
+	}
+
+	// The service account connection keeps working after the user binds
+	if _, err := client.LookupUser("bob"); err != nil {
+		t.Errorf("LookupUser() after change error = %v", err)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	client := newTestClient(t)
+
+	if err := client.ResetPassword("bob", "reset789"); err != nil {
+		t.Fatalf("ResetPassword() error = %v", err)
+	}
+	if _, err := client.AuthenticateUser("bob", "reset789"); err != nil {
+		t.Errorf("reset password refused: %v", err)
+	}
+	if err := client.ResetPassword("mallory", "reset789"); !errors.Is(err, ldapauth.ErrUserNotFound) {
+		t.Errorf("ResetPassword() of an unknown user error = %v", err)
+	}
+}
+
+func TestGroupMembers(t *testing.T) {
+	client := newTestClient(t)
+
+	uids := func(users []*ldapauth.User) []string {
+		var list []string
+		for _, u := range users {
+			list = append(list, u.UID)
+		}
+		return list
+	}
+
+	// DN members that no longer exist are skipped
+	members, truncated, err := client.GroupMembers("admins", 500)
+	if err != nil || truncated {
+		t.Fatalf("GroupMembers(admins) error = %v, truncated = %v", err, truncated)
+	}
+	if got := uids(members); len(got) != 1 || got[0] != "alice" {
+		t.Errorf("GroupMembers(admins) = %v, want [alice]", got)
+	}
+
+	members, truncated, err = client.GroupMembers("devs", 500)
+	if err != nil || truncated {
+		t.Fatalf("GroupMembers(devs) error = %v, truncated = %v", err, truncated)
+	}
+	if got := uids(members); len(got) != 2 || got[0] != "alice" || got[1] != "bob" {
+		t.Errorf("GroupMembers(devs) = %v, want [alice bob]", got)
+	}
+
+	members, truncated, err = client.GroupMembers("devs", 1)
+	if err != nil || !truncated || len(members) != 1 {
+		t.Errorf("GroupMembers(devs, 1) = %v, truncated = %v, error = %v", uids(members), truncated, err)
+	}
+
+	if _, _, err := client.GroupMembers("nobody", 500); !errors.Is(err, ldapauth.ErrGroupNotFound) {
+		t.Errorf("GroupMembers(nobody) error = %v", err)
+	}
+}
+
+func TestUserAttributes(t *testing.T) {
+	client := newTestClient(t)
+
+	for i := 0; i < 2; i++ { // the second round is answered from the cache
+		attrs, err := client.UserAttributes("alice", []string{"mail", "CN", "telephoneNumber"})
+		if err != nil {
+			t.Fatalf("UserAttributes() error = %v", err)
+		}
+		if len(attrs) != 2 || attrs["mail"][0] != "alice@example.org" || attrs["CN"][0] != "Alice" {
+			t.Errorf("UserAttributes() = %v", attrs)
+		}
+
+		if _, err := client.UserAttributes("mallory", []string{"mail"}); !errors.Is(err, ldapauth.ErrUserNotFound) {
+			t.Errorf("UserAttributes(mallory) error = %v", err)
+		}
+	}
+}
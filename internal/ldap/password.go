@@ -0,0 +1,122 @@
+package ldapauth
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"unicode/utf16"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ChangePassword verifies oldPassword and replaces it with newPassword.
+// Users with an expired or must-change password are allowed through, that is
+// what this flow exists for.
+func (lc *LDAPClient) ChangePassword(username, oldPassword, newPassword string) error {
+	if username == "" || oldPassword == "" || newPassword == "" {
+		return newAuthError(CodeInvalidCredentials, fmt.Errorf("empty username or password"))
+	}
+
+	return lc.withConn(func() error {
+		return lc.changePassword(username, oldPassword, newPassword)
+	})
+}
+
+// changePassword is ChangePassword. Callers must hold connMutex.
+func (lc *LDAPClient) changePassword(username, oldPassword, newPassword string) error {
+	user, err := lc.findUser(username)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return newAuthError(CodeInvalidCredentials, err)
+		}
+		return err
+	}
+
+	defer func() {
+		if err := lc.conn.Bind(lc.Config.BindDN, lc.Config.BindPass); err != nil {
+			log.Printf("Warning: failed to rebind as admin: %v", err)
+		}
+	}()
+
+	bindRes, bindErr := lc.conn.SimpleBind(ldap.NewSimpleBindRequest(user.DN, oldPassword, passwordPolicyControls()))
+	_, err = classifyBind(bindRes, bindErr)
+	switch AuthErrorCodeOf(err) {
+	case CodePasswordMustChange:
+		// The server accepted the bind but only allows a password change
+		if bindErr == nil {
+			break
+		}
+		fallthrough
+	case CodePasswordExpired:
+		// ppolicy only reports expiry after the password matched, but the bind
+		// itself failed, so the change has to go through the admin connection
+		if err := lc.conn.Bind(lc.Config.BindDN, lc.Config.BindPass); err != nil {
+			return newAuthError(CodeDirectoryUnavailable, fmt.Errorf("admin bind failed: %v", err))
+		}
+	default:
+		if err != nil {
+			return err
+		}
+	}
+
+	return lc.modifyPassword(user.DN, oldPassword, newPassword)
+}
+
+// ResetPassword sets a new password for username without knowing the old one.
+// It runs with the service account and must only be reached after the caller
+// proved ownership of the account another way (e.g. an emailed token).
+func (lc *LDAPClient) ResetPassword(username, newPassword string) error {
+	if newPassword == "" {
+		return newAuthError(CodePasswordRejected, fmt.Errorf("empty password"))
+	}
+
+	return lc.withConn(func() error {
+		user, err := lc.findUser(username)
+		if err != nil {
+			return err
+		}
+		return lc.modifyPassword(user.DN, "", newPassword)
+	})
+}
+
+// modifyPassword uses the Password Modify extended operation (RFC 3062), or
+// unicodePwd on Active Directory. An empty oldPassword means administrative reset.
+// Callers must hold connMutex.
+func (lc *LDAPClient) modifyPassword(dn, oldPassword, newPassword string) error {
+	var err error
+	if lc.Config.ServerType == "ad" {
+		req := ldap.NewModifyRequest(dn, nil)
+		if oldPassword == "" {
+			req.Replace("unicodePwd", []string{encodeUnicodePwd(newPassword)})
+		} else {
+			req.Delete("unicodePwd", []string{encodeUnicodePwd(oldPassword)})
+			req.Add("unicodePwd", []string{encodeUnicodePwd(newPassword)})
+		}
+		err = lc.conn.Modify(req)
+	} else {
+		_, err = lc.conn.PasswordModify(ldap.NewPasswordModifyRequest(dn, oldPassword, newPassword))
+	}
+
+	if err == nil {
+		return nil
+	}
+	if ldap.IsErrorAnyOf(err, ldap.LDAPResultConstraintViolation, ldap.LDAPResultUnwillingToPerform) {
+		return newAuthError(CodePasswordRejected, err)
+	}
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return newAuthError(CodeInvalidCredentials, err)
+	}
+	return newAuthError(CodeDirectoryUnavailable, err)
+}
+
+// encodeUnicodePwd returns the quoted UTF-16LE form Active Directory expects.
+// AD only accepts it over an encrypted connection.
+func encodeUnicodePwd(password string) string {
+	codes := utf16.Encode([]rune(`"` + password + `"`))
+	buf := make([]byte, len(codes)*2)
+	for i, c := range codes {
+		binary.LittleEndian.PutUint16(buf[i*2:], c)
+	}
+	return string(buf)
+}
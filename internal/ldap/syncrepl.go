@@ -0,0 +1,240 @@
+package ldapauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+)
+
+// controlTypeSyncRequest is the RFC 4533 content synchronization request control.
+const controlTypeSyncRequest = "1.3.6.1.4.1.4203.1.9.1.1"
+
+// ErrSyncRefreshRequired means the server no longer accepts the cookie and
+// the consumer has to start over without one.
+var ErrSyncRefreshRequired = errors.New("ldap: sync refresh required")
+
+type SyncState string
+
+const (
+	SyncAdd     SyncState = "add"
+	SyncModify  SyncState = "modify"
+	SyncDelete  SyncState = "delete"
+	SyncPresent SyncState = "present"
+)
+
+// SyncEvent is one message of a content synchronization search. Either User
+// is set (an entry changed or is present), UUIDs (a set of entries was
+// deleted or is present) or only Cookie (the server advanced the cookie or
+// ended a phase).
+type SyncEvent struct {
+	State SyncState
+	// User only carries the DN and EntryUUID for deletes and presents
+	User *User
+	// UUIDs are the entryUUIDs of a syncIdSet, entries deleted with State
+	// SyncDelete or unchanged with State SyncPresent
+	UUIDs []string
+	// PresentDone ends a present phase: entries not reported as added,
+	// modified or present since the search started no longer exist
+	PresentDone bool
+	// RefreshDone ends the refresh phase, later events are live changes
+	RefreshDone bool
+	Cookie      []byte
+}
+
+// SupportsSyncrepl reports whether the root DSE advertises the sync request control.
+func (lc *LDAPClient) SupportsSyncrepl() (supported bool, err error) {
+	err = lc.withConn(func() error {
+		supported, err = lc.supportsSyncrepl()
+		return err
+	})
+	return supported, err
+}
+
+// supportsSyncrepl is SupportsSyncrepl. Callers must hold connMutex.
+func (lc *LDAPClient) supportsSyncrepl() (bool, error) {
+	sr, err := lc.conn.Search(ldap.NewSearchRequest(
+		"",
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"supportedControl"},
+		nil,
+	))
+	if err != nil {
+		return false, fmt.Errorf("root DSE search failed: %w", err)
+	}
+	if len(sr.Entries) == 0 {
+		return false, nil
+	}
+
+	for _, oid := range sr.Entries[0].GetAttributeValues("supportedControl") {
+		if oid == controlTypeSyncRequest {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Syncrepl runs a refreshAndPersist content synchronization search on its own
+// connection and calls handle for every change until ctx is cancelled, the
+// server ends the search or handle returns an error. Pass the last persisted
+// cookie to only receive changes made since then.
+func (lc *LDAPClient) Syncrepl(ctx context.Context, cookie []byte, handle func(SyncEvent) error) error {
+	conn, err := lc.dial(0)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	searchRequest := ldap.NewSearchRequest(
+		lc.Config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		lc.userFilter(),
+		userAttributes,
+		nil,
+	)
+
+	res := conn.Syncrepl(ctx, searchRequest, 64, ldap.SyncRequestModeRefreshAndPersist, cookie, false)
+	for res.Next() {
+		ev := syncEventOf(res.Entry(), res.Controls())
+		if ev.User == nil && len(ev.UUIDs) == 0 && len(ev.Cookie) == 0 && !ev.PresentDone && !ev.RefreshDone {
+			continue
+		}
+		if err := handle(ev); err != nil {
+			return err
+		}
+	}
+
+	if err := res.Err(); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSyncRefreshRequired) {
+			return ErrSyncRefreshRequired
+		}
+		return fmt.Errorf("syncrepl search failed: %w", err)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("syncrepl search ended by server")
+}
+
+func syncStateOf(state ldap.ControlSyncStateState) SyncState {
+	switch state {
+	case ldap.SyncStateAdd:
+		return SyncAdd
+	case ldap.SyncStateModify:
+		return SyncModify
+	case ldap.SyncStateDelete:
+		return SyncDelete
+	default:
+		return SyncPresent
+	}
+}
+
+// syncEventOf turns one search result, an entry or an intermediate
+// syncInfo message, into a SyncEvent.
+func syncEventOf(entry *ldap.Entry, controls []ldap.Control) SyncEvent {
+	ev := SyncEvent{}
+	if entry != nil {
+		ev.User = newUser(entry)
+	}
+
+	for _, ctrl := range controls {
+		switch c := ctrl.(type) {
+		case *ldap.ControlSyncState:
+			ev.State = syncStateOf(c.State)
+			if ev.User != nil && ev.User.EntryUUID == "" && c.EntryUUID != (uuid.UUID{}) {
+				ev.User.EntryUUID = c.EntryUUID.String()
+			}
+			if len(c.Cookie) > 0 {
+				ev.Cookie = c.Cookie
+			}
+		case *ldap.ControlSyncInfo:
+			switch {
+			case c.NewCookie != nil:
+				ev.Cookie = c.NewCookie.Cookie
+			case c.RefreshDelete != nil:
+				ev.Cookie = c.RefreshDelete.Cookie
+				ev.RefreshDone = c.RefreshDelete.RefreshDone
+			case c.RefreshPresent != nil:
+				ev.Cookie = c.RefreshPresent.Cookie
+				ev.PresentDone = true
+				ev.RefreshDone = c.RefreshPresent.RefreshDone
+			case c.SyncIdSet != nil:
+				ev.Cookie = c.SyncIdSet.Cookie
+				ev.State = SyncPresent
+				if c.SyncIdSet.RefreshDeletes {
+					ev.State = SyncDelete
+				}
+				ev.UUIDs = make([]string, len(c.SyncIdSet.SyncUUIDs))
+				for i, id := range c.SyncIdSet.SyncUUIDs {
+					ev.UUIDs[i] = id.String()
+				}
+			}
+		case *ldap.ControlSyncDone:
+			ev.Cookie = c.Cookie
+		}
+	}
+	return ev
+}
+
+// generalizedTimeLayout is the LDAP GeneralizedTime format used by modifyTimestamp.
+const generalizedTimeLayout = "20060102150405Z"
+
+// ListUsersModifiedSince returns users whose modifyTimestamp is at or after
+// since, plus the highest modifyTimestamp seen (since itself when nothing changed).
+// Deletions are not visible this way; the full sync picks those up.
+func (lc *LDAPClient) ListUsersModifiedSince(since time.Time) (users []*User, highWater time.Time, err error) {
+	highWater = since
+	err = lc.withConn(func() error {
+		users, highWater, err = lc.listUsersModifiedSince(since)
+		return err
+	})
+	return users, highWater, err
+}
+
+// listUsersModifiedSince is ListUsersModifiedSince. Callers must hold connMutex.
+func (lc *LDAPClient) listUsersModifiedSince(since time.Time) ([]*User, time.Time, error) {
+	filter := lc.userFilter()
+	if !since.IsZero() {
+		filter = fmt.Sprintf("(&%s(modifyTimestamp>=%s))", filter, since.UTC().Format(generalizedTimeLayout))
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		lc.Config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter,
+		append([]string{"modifyTimestamp"}, userAttributes...),
+		nil,
+	)
+
+	sr, err := lc.conn.SearchWithPaging(searchRequest, lc.pageSize())
+	if err != nil {
+		return nil, since, fmt.Errorf("paged search failed: %w", err)
+	}
+
+	highWater := since
+	users := make([]*User, 0, len(sr.Entries))
+	for _, entry := range sr.Entries {
+		users = append(users, newUser(entry))
+		if ts, err := parseGeneralizedTime(entry.GetAttributeValue("modifyTimestamp")); err == nil && ts.After(highWater) {
+			highWater = ts
+		}
+	}
+	return users, highWater, nil
+}
+
+// parseGeneralizedTime accepts "20250516143345Z" and the fractional
+// "20250516143345.123Z" variant some servers return.
+func parseGeneralizedTime(value string) (time.Time, error) {
+	if i := strings.IndexAny(value, ".,"); i >= 0 {
+		value = value[:i] + "Z"
+	}
+	return time.Parse(generalizedTimeLayout, value)
+}
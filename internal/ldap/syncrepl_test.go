@@ -0,0 +1,64 @@
+package ldapauth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+)
+
+func TestSyncEventOf(t *testing.T) {
+	alice := uuid.MustParse("0b1c6e2a-4a8e-4d3b-9a51-0f5e0d7f3c11")
+	bob := uuid.MustParse("5d2a9c4e-8f61-4b7a-a2c3-6e1f0b9d4a22")
+	entry := &ldap.Entry{DN: "uid=alice,ou=users,dc=example,dc=org"}
+
+	tests := []struct {
+		name     string
+		entry    *ldap.Entry
+		controls []ldap.Control
+		want     SyncEvent
+	}{
+		{
+			name:     "entry uuid from the state control",
+			entry:    entry,
+			controls: []ldap.Control{&ldap.ControlSyncState{State: ldap.SyncStatePresent, EntryUUID: alice}},
+			want: SyncEvent{
+				State: SyncPresent,
+				User:  &User{DN: entry.DN, EntryUUID: alice.String()},
+			},
+		},
+		{
+			name:     "deleted id set",
+			controls: []ldap.Control{&ldap.ControlSyncInfo{SyncIdSet: &ldap.ControlSyncInfoSyncIdSet{Cookie: []byte("c1"), RefreshDeletes: true, SyncUUIDs: []uuid.UUID{alice, bob}}}},
+			want:     SyncEvent{State: SyncDelete, UUIDs: []string{alice.String(), bob.String()}, Cookie: []byte("c1")},
+		},
+		{
+			name:     "present id set",
+			controls: []ldap.Control{&ldap.ControlSyncInfo{SyncIdSet: &ldap.ControlSyncInfoSyncIdSet{SyncUUIDs: []uuid.UUID{bob}}}},
+			want:     SyncEvent{State: SyncPresent, UUIDs: []string{bob.String()}},
+		},
+		{
+			name:     "end of a present phase",
+			controls: []ldap.Control{&ldap.ControlSyncInfo{RefreshPresent: &ldap.ControlSyncInfoRefreshPresent{Cookie: []byte("c2"), RefreshDone: true}}},
+			want:     SyncEvent{PresentDone: true, RefreshDone: true, Cookie: []byte("c2")},
+		},
+		{
+			name:     "end of a delete phase",
+			controls: []ldap.Control{&ldap.ControlSyncInfo{RefreshDelete: &ldap.ControlSyncInfoRefreshDelete{Cookie: []byte("c3"), RefreshDone: true}}},
+			want:     SyncEvent{RefreshDone: true, Cookie: []byte("c3")},
+		},
+		{
+			name:     "new cookie",
+			controls: []ldap.Control{&ldap.ControlSyncInfo{NewCookie: &ldap.ControlSyncInfoNewCookie{Cookie: []byte("c4")}}},
+			want:     SyncEvent{Cookie: []byte("c4")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := syncEventOf(tt.entry, tt.controls); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("syncEventOf() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
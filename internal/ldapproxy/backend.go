@@ -0,0 +1,274 @@
+// Package ldapproxy serves a read-only virtual LDAP tree for appliances that
+// can only authenticate against LDAP. Binds are checked against the real
+// directory through ldapauth.LDAPClient; searches are answered from Postgres
+// so entries carry the effective scopes (direct grants and roles):
+//
+//	<base>
+//	├── ou=people   uid=<uid>: inetOrgPerson with scope and memberOf attributes
+//	└── ou=groups   cn=<scope>: groupOfNames, one per scope
+package ldapproxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"go-ldap-sso/db/employees"
+	"go-ldap-sso/db/scopes"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"go-ldap-sso/internal/ldapserver"
+	"go-ldap-sso/internal/ldif"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// queryTimeout bounds the Postgres work behind one bind or search.
+const queryTimeout = 10 * time.Second
+
+type Options struct {
+	BaseDN string
+	// BindDN/BindPassword is an optional service account that may search
+	// but is not an employee. Leave empty to only allow employee binds.
+	BindDN       string
+	BindPassword string
+	// CacheTTL is how long the virtual tree is reused between searches;
+	// zero rebuilds it for every search
+	CacheTTL time.Duration
+}
+
+type Backend struct {
+	opts      Options
+	ldap      *ldapauth.LDAPClient
+	employees *employees.Repository
+	scopes    *scopes.Repository
+
+	mu    sync.Mutex
+	tree  *ldapserver.Directory
+	built time.Time
+}
+
+func NewBackend(opts Options, ldapClient *ldapauth.LDAPClient, pool *pgxpool.Pool) *Backend {
+	return &Backend{
+		opts:      opts,
+		ldap:      ldapClient,
+		employees: employees.NewRepository(pool),
+		scopes:    scopes.NewRepository(pool),
+	}
+}
+
+func (b *Backend) peopleDN() string { return "ou=people," + b.opts.BaseDN }
+func (b *Backend) groupsDN() string { return "ou=groups," + b.opts.BaseDN }
+
+func (b *Backend) personDN(uid string) string {
+	return "uid=" + ldap.EscapeDN(uid) + "," + b.peopleDN()
+}
+
+func (b *Backend) groupDN(scope string) string {
+	return "cn=" + ldap.EscapeDN(scope) + "," + b.groupsDN()
+}
+
+func (b *Backend) isServiceAccount(dn string) bool {
+	if b.opts.BindDN == "" {
+		return false
+	}
+	got, err1 := ldap.ParseDN(dn)
+	want, err2 := ldap.ParseDN(b.opts.BindDN)
+	return err1 == nil && err2 == nil && got.EqualFold(want)
+}
+
+// Bind accepts the service account, or an employee named by a DN below the
+// virtual tree (or any DN starting with uid=), a bare uid or an email. The
+// password is checked by the real directory and the employee must be active.
+func (b *Backend) Bind(dn, password string) (string, error) {
+	if b.isServiceAccount(dn) {
+		if subtle.ConstantTimeCompare([]byte(password), []byte(b.opts.BindPassword)) != 1 {
+			return "", ldapserver.NewError(ldap.LDAPResultInvalidCredentials, "invalid credentials")
+		}
+		return b.opts.BindDN, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	employee, err := b.employees.FindActive(ctx, usernameOf(dn))
+	if errors.Is(err, employees.ErrNotFound) {
+		return "", ldapserver.NewError(ldap.LDAPResultInvalidCredentials, "invalid credentials")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := b.ldap.AuthenticateUser(employee.UID, password); err != nil {
+		return "", bindError(err)
+	}
+
+	log.Printf("🔐 LDAP proxy bind: %s", employee.UID)
+	return b.personDN(employee.UID), nil
+}
+
+func usernameOf(dn string) string {
+	if parsed, err := ldap.ParseDN(dn); err == nil && len(parsed.RDNs) > 0 && strings.Contains(dn, "=") {
+		for _, a := range parsed.RDNs[0].Attributes {
+			if strings.EqualFold(a.Type, "uid") {
+				return a.Value
+			}
+		}
+	}
+	return strings.TrimSpace(dn)
+}
+
+// bindError maps the typed directory errors to LDAP result codes, keeping the
+// code name as diagnostic message like AD's "data 775" hints.
+func bindError(err error) error {
+	code := ldapauth.AuthErrorCodeOf(err)
+	switch code {
+	case ldapauth.CodeDirectoryUnavailable:
+		log.Printf("⚠️ LDAP proxy: %v", err)
+		return ldapserver.NewError(ldap.LDAPResultUnavailable, string(code))
+	default:
+		return ldapserver.NewError(ldap.LDAPResultInvalidCredentials, string(code))
+	}
+}
+
+// Search answers from the virtual tree, rebuilt at most every CacheTTL so a
+// client walking the tree entry by entry doesn't scan the tables each time;
+// scope changes show up once it expires. Anonymous searches are refused.
+func (b *Backend) Search(boundDN, baseDN string, scope int, match func(*ldapserver.Entry) bool) ([]*ldapserver.Entry, error) {
+	if boundDN == "" {
+		return nil, ldapserver.NewError(ldap.LDAPResultInsufficientAccessRights, "bind first")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tree, err := b.currentTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Search(baseDN, scope, match)
+}
+
+// currentTree returns the cached tree or builds a new one. Concurrent
+// searches wait for a single build.
+func (b *Backend) currentTree(ctx context.Context) (*ldapserver.Directory, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tree != nil && time.Since(b.built) < b.opts.CacheTTL {
+		return b.tree, nil
+	}
+	tree, err := b.build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.tree, b.built = tree, time.Now()
+	return tree, nil
+}
+
+func (b *Backend) build(ctx context.Context) (*ldapserver.Directory, error) {
+	list, err := b.employees.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	allScopes, err := b.scopes.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	granted, err := b.scopes.ByEmployee(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := ldapserver.NewDirectory(b.opts.BaseDN)
+	add := func(dn string, attrs ...ldif.Attribute) error {
+		if err := tree.Add(dn, attrs); err != nil {
+			return fmt.Errorf("virtual entry %s: %w", dn, err)
+		}
+		return nil
+	}
+
+	if err := add(b.opts.BaseDN, attr("objectClass", "top", "dcObject", "organization"), attr("o", "go-ldap-sso")); err != nil {
+		return nil, err
+	}
+	if err := add(b.peopleDN(), attr("objectClass", "top", "organizationalUnit"), attr("ou", "people")); err != nil {
+		return nil, err
+	}
+	if err := add(b.groupsDN(), attr("objectClass", "top", "organizationalUnit"), attr("ou", "groups")); err != nil {
+		return nil, err
+	}
+
+	members := make(map[string][]string)
+	for _, e := range list {
+		if e.Status != employees.StatusActive {
+			continue
+		}
+		dn := b.personDN(e.UID)
+
+		var memberOf []string
+		for _, s := range granted[e.ID] {
+			memberOf = append(memberOf, b.groupDN(s))
+			members[s] = append(members[s], dn)
+		}
+
+		attrs := []ldif.Attribute{
+			attr("objectClass", "top", "person", "organizationalPerson", "inetOrgPerson"),
+			attr("uid", e.UID),
+			attr("cn", e.Name),
+			attr("sn", surname(e.Name)),
+			attr("mail", e.Email),
+			attr("employeeNumber", strconv.Itoa(e.ID)),
+		}
+		if len(memberOf) > 0 {
+			attrs = append(attrs, attr("scope", granted[e.ID]...), attr("memberOf", memberOf...))
+		}
+		if err := add(dn, attrs...); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range allScopes {
+		attrs := []ldif.Attribute{
+			attr("objectClass", "top", "groupOfNames"),
+			attr("cn", s.Name),
+		}
+		if s.Description != "" {
+			attrs = append(attrs, attr("description", s.Description))
+		}
+		if len(members[s.Name]) > 0 {
+			attrs = append(attrs, attr("member", members[s.Name]...))
+		}
+		if err := add(b.groupDN(s.Name), attrs...); err != nil {
+			return nil, err
+		}
+	}
+
+	return tree, nil
+}
+
+func attr(name string, values ...string) ldif.Attribute {
+	return ldif.Attribute{Name: name, Values: values}
+}
+
+func surname(name string) string {
+	fields := strings.Fields(name)
+	if len(fields) == 0 {
+		return name
+	}
+	return fields[len(fields)-1]
+}
+
+func (b *Backend) RootDSE() *ldapserver.Entry {
+	return ldapserver.NewEntry("",
+		attr("objectClass", "top"),
+		attr("namingContexts", b.opts.BaseDN),
+		attr("supportedLDAPVersion", "3"),
+		attr("supportedExtension", ldapserver.OIDWhoAmI),
+		attr("vendorName", "go-ldap-sso proxy"),
+	)
+}
@@ -0,0 +1,197 @@
+package ldapproxy
+
+import (
+	"context"
+	"go-ldap-sso/db/dbtest"
+	"go-ldap-sso/internal/ldapserver"
+	"go-ldap-sso/internal/ldapserver/ldaptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const testLDIF = `dn: ou=users,dc=example,dc=org
+objectClass: organizationalUnit
+ou: users
+
+dn: uid=alice,ou=users,dc=example,dc=org
+objectClass: inetOrgPerson
+cn: Alice Example
+sn: Example
+uid: alice
+mail: alice@example.org
+userPassword: secret123
+
+dn: uid=bob,ou=users,dc=example,dc=org
+objectClass: inetOrgPerson
+cn: Bob Example
+sn: Example
+uid: bob
+mail: bob@example.org
+userPassword: hunter22
+`
+
+const (
+	baseDN      = "dc=sso,dc=local"
+	serviceDN   = "cn=appliance,dc=sso,dc=local"
+	servicePass = "appliance-pass"
+)
+
+// startProxy serves the proxy over the test database and the embedded
+// directory. alice is an active employee holding directory:read and
+// merchant:write, bob a removed one; both can bind to the directory.
+func startProxy(t *testing.T) *ldap.Conn {
+	t.Helper()
+	database := dbtest.Open(t)
+	ctx := context.Background()
+
+	_, err := database.Pool.Exec(ctx, `
+		INSERT INTO employees (uid, name, email, status) VALUES
+			('alice', 'Alice Example', 'alice@example.org', 'active'),
+			('bob', 'Bob Example', 'bob@example.org', 'removed');
+		INSERT INTO scopes (name, description) VALUES
+			('directory:read', 'Read the directory'), ('merchant:write', ''), ('unused:read', '');
+		INSERT INTO employee_scopes (employee_id, scope_id)
+			SELECT e.id, s.id FROM employees e, scopes s
+			WHERE e.uid = 'alice' AND s.name IN ('directory:read', 'merchant:write')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := NewBackend(Options{
+		BaseDN:       baseDN,
+		BindDN:       serviceDN,
+		BindPassword: servicePass,
+		CacheTTL:     time.Minute,
+	}, ldaptest.Connect(t, ldaptest.Start(t, testLDIF)), database.Pool)
+	srv := ldapserver.NewServer(backend)
+	if err := srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := ldap.DialURL("ldap://" + srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestProxyBind(t *testing.T) {
+	conn := startProxy(t)
+
+	tests := []struct {
+		name     string
+		dn       string
+		password string
+		ok       bool
+	}{
+		{"virtual dn", "uid=alice,ou=people," + baseDN, "secret123", true},
+		{"bare uid", "alice", "secret123", true},
+		{"email", "alice@example.org", "secret123", true},
+		{"wrong password", "alice", "wrong", false},
+		{"removed employee", "bob", "hunter22", false},
+		{"unknown", "nobody", "secret123", false},
+		{"service account", serviceDN, servicePass, true},
+		{"service account wrong password", serviceDN, "wrong", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := conn.Bind(tt.dn, tt.password)
+			if tt.ok && err != nil {
+				t.Errorf("Bind() error = %v", err)
+			}
+			if !tt.ok && !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+				t.Errorf("Bind() error = %v, want invalid credentials", err)
+			}
+		})
+	}
+}
+
+func search(t *testing.T, conn *ldap.Conn, base string, scope int, filter string, attrs ...string) []*ldap.Entry {
+	t.Helper()
+	sr, err := conn.Search(ldap.NewSearchRequest(base, scope, ldap.NeverDerefAliases, 0, 0, false, filter, attrs, nil))
+	if err != nil {
+		t.Fatalf("Search(%s, %s) error = %v", base, filter, err)
+	}
+	return sr.Entries
+}
+
+func TestProxySearch(t *testing.T) {
+	conn := startProxy(t)
+
+	_, err := conn.Search(ldap.NewSearchRequest(baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false, "(uid=alice)", nil, nil))
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultInsufficientAccessRights) {
+		t.Errorf("anonymous search error = %v, want insufficient access", err)
+	}
+
+	if err := conn.Bind("alice", "secret123"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := search(t, conn, baseDN, ldap.ScopeWholeSubtree, "(scope=merchant:write)", "uid", "scope", "memberOf")
+	if len(entries) != 1 || entries[0].DN != "uid=alice,ou=people,"+baseDN {
+		t.Fatalf("search by scope = %d entries, want alice", len(entries))
+	}
+	if got, want := entries[0].GetAttributeValues("scope"), []string{"directory:read", "merchant:write"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("scope = %v, want %v", got, want)
+	}
+	if got := entries[0].GetAttributeValues("memberOf"); len(got) != 2 || got[0] != "cn=directory:read,ou=groups,"+baseDN {
+		t.Errorf("memberOf = %v", got)
+	}
+
+	// Removed employees aren't in the tree
+	if entries := search(t, conn, baseDN, ldap.ScopeWholeSubtree, "(uid=bob)"); len(entries) != 0 {
+		t.Errorf("search for bob = %d entries, want none", len(entries))
+	}
+
+	// The base DN limits the answer to its subtree
+	var groups []string
+	for _, e := range search(t, conn, "ou=groups,"+baseDN, ldap.ScopeSingleLevel, "(objectClass=*)", "cn") {
+		groups = append(groups, e.GetAttributeValue("cn"))
+	}
+	sort.Strings(groups)
+	if want := []string{"directory:read", "merchant:write", "unused:read"}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("groups = %v, want %v", groups, want)
+	}
+	if entries := search(t, conn, "ou=people,"+baseDN, ldap.ScopeBaseObject, "(objectClass=*)"); len(entries) != 1 {
+		t.Errorf("base object search = %d entries, want 1", len(entries))
+	}
+	_, err = conn.Search(ldap.NewSearchRequest("dc=example,dc=org", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false, "(uid=alice)", nil, nil))
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		t.Errorf("search outside the base error = %v, want no such object", err)
+	}
+}
+
+func TestProxyTreeCache(t *testing.T) {
+	database := dbtest.Open(t)
+	ctx := context.Background()
+	if _, err := database.Pool.Exec(ctx, "INSERT INTO scopes (name) VALUES ('directory:read')"); err != nil {
+		t.Fatal(err)
+	}
+	b := NewBackend(Options{BaseDN: baseDN, CacheTTL: time.Minute}, nil, database.Pool)
+
+	first, err := b.currentTree(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Pool.Exec(ctx, "INSERT INTO scopes (name) VALUES ('merchant:write')"); err != nil {
+		t.Fatal(err)
+	}
+	if tree, _ := b.currentTree(ctx); tree != first {
+		t.Error("tree rebuilt before CacheTTL")
+	}
+
+	b.built = time.Now().Add(-time.Hour)
+	tree, err := b.currentTree(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tree.Get("cn=merchant:write,ou=groups," + baseDN); !ok {
+		t.Error("expired tree not rebuilt")
+	}
+}
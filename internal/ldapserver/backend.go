@@ -0,0 +1,36 @@
+package ldapserver
+
+import "go-ldap-sso/internal/ldif"
+
+// Backend answers the operations of a Server. boundDN is whatever Bind
+// returned for the connection, empty while anonymous.
+type Backend interface {
+	// Bind checks a simple bind and returns the DN the connection is bound as.
+	Bind(dn, password string) (string, error)
+	// Search returns the entries in scope for which match is true, as far as
+	// boundDN may see them.
+	Search(boundDN, baseDN string, scope int, match func(*Entry) bool) ([]*Entry, error)
+	// RootDSE describes the server for base searches of "".
+	RootDSE() *Entry
+}
+
+// Writer is implemented by backends that accept updates. Servers on other
+// backends answer writes with unwillingToPerform.
+type Writer interface {
+	Add(boundDN, dn string, attrs []ldif.Attribute) error
+	Modify(boundDN, dn string, mods []ldif.Modification) error
+	Delete(boundDN, dn string) error
+	ModifyDN(boundDN, dn, newRDN string, deleteOldRDN bool, newSuperior string) error
+	// PasswordModify implements RFC 3062 and returns the generated password
+	// when newPassword is empty.
+	PasswordModify(boundDN, userID, oldPassword, newPassword string) (string, error)
+}
+
+// NewEntry builds an entry for backends that assemble results on the fly.
+func NewEntry(dn string, attrs ...ldif.Attribute) *Entry {
+	e := &Entry{DN: dn}
+	for _, a := range attrs {
+		e.set(a.Name, a.Values)
+	}
+	return e
+}
@@ -0,0 +1,437 @@
+package ldapserver
+
+import (
+	"crypto/rand"
+	"fmt"
+	"go-ldap-sso/internal/ldif"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const generalizedTimeLayout = "20060102150405Z"
+
+// ResultError carries the LDAP result code sent back to the client.
+type ResultError struct {
+	Code    uint16
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("%s: %s", ldap.LDAPResultCodeMap[e.Code], e.Message)
+}
+
+// NewError returns a ResultError, for backends to report LDAP result codes.
+func NewError(code uint16, format string, args ...interface{}) *ResultError {
+	return &ResultError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// operationalAttributes are maintained by the directory and only returned
+// when asked for explicitly or with "+".
+var operationalAttributes = map[string]bool{
+	"createtimestamp": true,
+	"modifytimestamp": true,
+	"entryuuid":       true,
+}
+
+type attribute struct {
+	Name   string
+	Values []string
+}
+
+type Entry struct {
+	DN    string
+	attrs []*attribute
+}
+
+func (e *Entry) get(name string) *attribute {
+	for _, a := range e.attrs {
+		if strings.EqualFold(a.Name, name) {
+			return a
+		}
+	}
+	return nil
+}
+
+// Values returns the values of the attribute, nil when absent.
+func (e *Entry) Values(name string) []string {
+	if a := e.get(name); a != nil {
+		return a.Values
+	}
+	return nil
+}
+
+func (e *Entry) set(name string, values []string) {
+	if a := e.get(name); a != nil {
+		a.Values = values
+		return
+	}
+	e.attrs = append(e.attrs, &attribute{Name: name, Values: values})
+}
+
+func (e *Entry) remove(name string) {
+	for i, a := range e.attrs {
+		if strings.EqualFold(a.Name, name) {
+			e.attrs = append(e.attrs[:i], e.attrs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (e *Entry) clone() *Entry {
+	c := &Entry{DN: e.DN}
+	for _, a := range e.attrs {
+		c.attrs = append(c.attrs, &attribute{Name: a.Name, Values: append([]string(nil), a.Values...)})
+	}
+	return c
+}
+
+func (e *Entry) touch(now time.Time) {
+	e.set("modifyTimestamp", []string{now.UTC().Format(generalizedTimeLayout)})
+}
+
+// Directory is an in-memory DIT. Attribute values compare case-insensitively
+// (except userPassword), which is close enough to the usual schemas for
+// development and tests.
+type Directory struct {
+	mu      sync.RWMutex
+	baseDN  string
+	entries map[string]*Entry
+}
+
+func NewDirectory(baseDN string) *Directory {
+	return &Directory{baseDN: baseDN, entries: make(map[string]*Entry)}
+}
+
+// normalizeDN lower-cases attribute types and values and drops spacing so
+// differently written DNs map to the same key.
+func normalizeDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(dn))
+	}
+	rdns := make([]string, 0, len(parsed.RDNs))
+	for _, rdn := range parsed.RDNs {
+		parts := make([]string, 0, len(rdn.Attributes))
+		for _, a := range rdn.Attributes {
+			parts = append(parts, strings.ToLower(a.Type)+"="+strings.ToLower(a.Value))
+		}
+		sort.Strings(parts)
+		rdns = append(rdns, strings.Join(parts, "+"))
+	}
+	return strings.Join(rdns, ",")
+}
+
+func parentDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) < 2 {
+		return ""
+	}
+	i := strings.Index(dn, ",")
+	for i > 0 && dn[i-1] == '\\' {
+		j := strings.Index(dn[i+1:], ",")
+		if j < 0 {
+			return ""
+		}
+		i += j + 1
+	}
+	return strings.TrimSpace(dn[i+1:])
+}
+
+// InBase reports whether dn is the base DN or below it.
+func (d *Directory) InBase(dn string) bool {
+	n, base := normalizeDN(dn), normalizeDN(d.baseDN)
+	return n == base || strings.HasSuffix(n, ","+base)
+}
+
+func (d *Directory) Get(dn string) (*Entry, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	e, ok := d.entries[normalizeDN(dn)]
+	if !ok {
+		return nil, false
+	}
+	return e.clone(), true
+}
+
+func (d *Directory) Add(dn string, attrs []ldif.Attribute) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := normalizeDN(dn)
+	if _, exists := d.entries[key]; exists {
+		return NewError(ldap.LDAPResultEntryAlreadyExists, "%s already exists", dn)
+	}
+	if !d.InBase(dn) {
+		return NewError(ldap.LDAPResultNoSuchObject, "%s is outside of %s", dn, d.baseDN)
+	}
+	if key != normalizeDN(d.baseDN) {
+		if _, ok := d.entries[normalizeDN(parentDN(dn))]; !ok {
+			return NewError(ldap.LDAPResultNoSuchObject, "parent of %s does not exist", dn)
+		}
+	}
+
+	now := time.Now()
+	e := &Entry{DN: dn}
+	for _, a := range attrs {
+		if operationalAttributes[strings.ToLower(a.Name)] {
+			continue
+		}
+		e.set(a.Name, append([]string(nil), a.Values...))
+	}
+	e.set("createTimestamp", []string{now.UTC().Format(generalizedTimeLayout)})
+	e.set("entryUUID", []string{newUUID()})
+	e.touch(now)
+
+	d.entries[key] = e
+	return nil
+}
+
+func (d *Directory) Modify(dn string, mods []ldif.Modification) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, ok := d.entries[normalizeDN(dn)]
+	if !ok {
+		return NewError(ldap.LDAPResultNoSuchObject, "%s does not exist", dn)
+	}
+
+	// Work on a copy so a failing modification leaves the entry untouched
+	e := current.clone()
+	for _, m := range mods {
+		name := m.Attribute.Name
+		switch m.Op {
+		case ldif.ModAdd:
+			existing := e.Values(name)
+			for _, v := range m.Attribute.Values {
+				if containsValue(name, existing, v) {
+					return NewError(ldap.LDAPResultAttributeOrValueExists, "%s: value already exists", name)
+				}
+				existing = append(existing, v)
+			}
+			e.set(name, existing)
+		case ldif.ModDelete:
+			existing := e.Values(name)
+			if existing == nil {
+				return NewError(ldap.LDAPResultNoSuchAttribute, "%s: no such attribute", name)
+			}
+			if len(m.Attribute.Values) == 0 {
+				e.remove(name)
+				continue
+			}
+			kept := existing[:0:0]
+			for _, v := range existing {
+				if !containsValue(name, m.Attribute.Values, v) {
+					kept = append(kept, v)
+				}
+			}
+			if len(kept) == len(existing) {
+				return NewError(ldap.LDAPResultNoSuchAttribute, "%s: no such value", name)
+			}
+			if len(kept) == 0 {
+				e.remove(name)
+			} else {
+				e.set(name, kept)
+			}
+		case ldif.ModReplace:
+			if len(m.Attribute.Values) == 0 {
+				e.remove(name)
+			} else {
+				e.set(name, append([]string(nil), m.Attribute.Values...))
+			}
+		default:
+			return NewError(ldap.LDAPResultProtocolError, "unknown modification %q", m.Op)
+		}
+	}
+
+	e.touch(time.Now())
+	d.entries[normalizeDN(dn)] = e
+	return nil
+}
+
+func (d *Directory) Delete(dn string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := normalizeDN(dn)
+	if _, ok := d.entries[key]; !ok {
+		return NewError(ldap.LDAPResultNoSuchObject, "%s does not exist", dn)
+	}
+	for k := range d.entries {
+		if strings.HasSuffix(k, ","+key) {
+			return NewError(ldap.LDAPResultNotAllowedOnNonLeaf, "%s has children", dn)
+		}
+	}
+	delete(d.entries, key)
+	return nil
+}
+
+// ModifyDN renames a leaf entry, optionally moving it under newSuperior.
+func (d *Directory) ModifyDN(dn, newRDN string, deleteOldRDN bool, newSuperior string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := normalizeDN(dn)
+	current, ok := d.entries[key]
+	if !ok {
+		return NewError(ldap.LDAPResultNoSuchObject, "%s does not exist", dn)
+	}
+	for k := range d.entries {
+		if strings.HasSuffix(k, ","+key) {
+			return NewError(ldap.LDAPResultNotAllowedOnNonLeaf, "%s has children", dn)
+		}
+	}
+
+	parent := parentDN(dn)
+	if newSuperior != "" {
+		if _, ok := d.entries[normalizeDN(newSuperior)]; !ok {
+			return NewError(ldap.LDAPResultNoSuchObject, "new superior %s does not exist", newSuperior)
+		}
+		parent = newSuperior
+	}
+	newDN := newRDN
+	if parent != "" {
+		newDN = newRDN + "," + parent
+	}
+	newKey := normalizeDN(newDN)
+	if _, exists := d.entries[newKey]; exists && newKey != key {
+		return NewError(ldap.LDAPResultEntryAlreadyExists, "%s already exists", newDN)
+	}
+
+	oldRDN, err := rdnAttributes(dn)
+	if err != nil {
+		return NewError(ldap.LDAPResultInvalidDNSyntax, "%v", err)
+	}
+	newAttrs, err := rdnAttributes(newDN)
+	if err != nil {
+		return NewError(ldap.LDAPResultInvalidDNSyntax, "%v", err)
+	}
+
+	e := current.clone()
+	e.DN = newDN
+	if deleteOldRDN {
+		for _, a := range oldRDN {
+			kept := []string{}
+			for _, v := range e.Values(a.Type) {
+				if !strings.EqualFold(v, a.Value) {
+					kept = append(kept, v)
+				}
+			}
+			e.set(a.Type, kept)
+		}
+	}
+	for _, a := range newAttrs {
+		values := e.Values(a.Type)
+		if !containsValue(a.Type, values, a.Value) {
+			e.set(a.Type, append(values, a.Value))
+		}
+	}
+	for _, a := range e.attrs {
+		if len(a.Values) == 0 {
+			e.remove(a.Name)
+		}
+	}
+	e.touch(time.Now())
+
+	delete(d.entries, key)
+	d.entries[newKey] = e
+	return nil
+}
+
+// Apply executes one LDIF record.
+func (d *Directory) Apply(rec ldif.Record) error {
+	switch rec.ChangeType {
+	case ldif.ChangeAdd:
+		return d.Add(rec.DN, rec.Attributes)
+	case ldif.ChangeModify:
+		return d.Modify(rec.DN, rec.Modifications)
+	case ldif.ChangeDelete:
+		return d.Delete(rec.DN)
+	case ldif.ChangeModRDN:
+		return d.ModifyDN(rec.DN, rec.NewRDN, rec.DeleteOldRDN, rec.NewSuperior)
+	}
+	return fmt.Errorf("unsupported changetype %q", rec.ChangeType)
+}
+
+// Search returns clones of the entries in scope that match the filter, sorted by DN.
+func (d *Directory) Search(baseDN string, scope int, match func(*Entry) bool) ([]*Entry, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	base := normalizeDN(baseDN)
+	if _, ok := d.entries[base]; !ok {
+		return nil, NewError(ldap.LDAPResultNoSuchObject, "%s does not exist", baseDN)
+	}
+
+	var results []*Entry
+	for key, e := range d.entries {
+		if !inScope(key, base, scope) || !match(e) {
+			continue
+		}
+		results = append(results, e.clone())
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return len(results[i].DN) < len(results[j].DN) ||
+			(len(results[i].DN) == len(results[j].DN) && results[i].DN < results[j].DN)
+	})
+	return results, nil
+}
+
+// Len returns the number of entries.
+func (d *Directory) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.entries)
+}
+
+func inScope(key, base string, scope int) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return key == base
+	case ldap.ScopeSingleLevel:
+		if !strings.HasSuffix(key, ","+base) {
+			return false
+		}
+		return !strings.Contains(strings.TrimSuffix(key, ","+base), ",")
+	default:
+		return key == base || strings.HasSuffix(key, ","+base)
+	}
+}
+
+func rdnAttributes(dn string) ([]*ldap.AttributeTypeAndValue, error) {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed.RDNs) == 0 {
+		return nil, fmt.Errorf("empty DN")
+	}
+	return parsed.RDNs[0].Attributes, nil
+}
+
+func containsValue(attr string, values []string, v string) bool {
+	for _, existing := range values {
+		if valuesEqual(attr, existing, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func valuesEqual(attr, a, b string) bool {
+	if strings.EqualFold(attr, "userPassword") {
+		return a == b
+	}
+	return strings.EqualFold(a, b)
+}
+
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
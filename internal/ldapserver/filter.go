@@ -0,0 +1,120 @@
+package ldapserver
+
+import (
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// matchFilter evaluates an RFC 4511 filter packet against an entry.
+// Extensible matches are not supported and never match.
+func matchFilter(e *Entry, f *ber.Packet) (bool, error) {
+	if f.ClassType != ber.ClassContext {
+		return false, NewError(ldap.LDAPResultProtocolError, "invalid filter")
+	}
+
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, child := range f.Children {
+			ok, err := matchFilter(e, child)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case ldap.FilterOr:
+		for _, child := range f.Children {
+			ok, err := matchFilter(e, child)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ldap.FilterNot:
+		if len(f.Children) != 1 {
+			return false, NewError(ldap.LDAPResultProtocolError, "invalid not filter")
+		}
+		ok, err := matchFilter(e, f.Children[0])
+		return !ok, err
+	case ldap.FilterPresent:
+		name := f.Data.String()
+		if strings.EqualFold(name, "objectClass") {
+			return true, nil
+		}
+		return len(e.Values(name)) > 0, nil
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch, ldap.FilterGreaterOrEqual, ldap.FilterLessOrEqual:
+		if len(f.Children) != 2 {
+			return false, NewError(ldap.LDAPResultProtocolError, "invalid assertion")
+		}
+		name, want := packetString(f.Children[0]), packetString(f.Children[1])
+		for _, v := range e.Values(name) {
+			if compareValue(f.Tag, name, v, want) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ldap.FilterSubstrings:
+		if len(f.Children) != 2 {
+			return false, NewError(ldap.LDAPResultProtocolError, "invalid substring filter")
+		}
+		name := packetString(f.Children[0])
+		for _, v := range e.Values(name) {
+			if matchSubstrings(v, f.Children[1].Children) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ldap.FilterExtensibleMatch:
+		return false, nil
+	}
+	return false, NewError(ldap.LDAPResultProtocolError, "unknown filter type %d", f.Tag)
+}
+
+func compareValue(op ber.Tag, attr, have, want string) bool {
+	switch op {
+	case ldap.FilterGreaterOrEqual:
+		return strings.ToLower(have) >= strings.ToLower(want)
+	case ldap.FilterLessOrEqual:
+		return strings.ToLower(have) <= strings.ToLower(want)
+	default:
+		return valuesEqual(attr, have, want)
+	}
+}
+
+func matchSubstrings(value string, parts []*ber.Packet) bool {
+	value = strings.ToLower(value)
+	for i, p := range parts {
+		s := strings.ToLower(packetString(p))
+		switch p.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, s) {
+				return false
+			}
+			value = value[len(s):]
+		case ldap.FilterSubstringsAny:
+			j := strings.Index(value, s)
+			if j < 0 {
+				return false
+			}
+			value = value[j+len(s):]
+		case ldap.FilterSubstringsFinal:
+			if i != len(parts)-1 || !strings.HasSuffix(value, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// packetString returns the value of an OCTET STRING or of a primitive
+// context-specific element, which the decoder leaves in Data.
+func packetString(p *ber.Packet) string {
+	if s, ok := p.Value.(string); ok {
+		return s
+	}
+	return p.Data.String()
+}
@@ -0,0 +1,58 @@
+// Package ldaptest runs the embedded directory for tests.
+package ldaptest
+
+import (
+	"go-ldap-sso/config"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"go-ldap-sso/internal/ldapserver"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const (
+	BaseDN       = "dc=example,dc=org"
+	RootDN       = "cn=admin,dc=example,dc=org"
+	RootPassword = "adminpass"
+)
+
+// Start serves ldif from the embedded directory on a free port until the
+// test ends and returns a client configuration binding as the root DN.
+func Start(t testing.TB, ldif string) *config.LDAPConfig {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "001_test.ldif"), []byte(ldif), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts := ldapserver.Options{BaseDN: BaseDN, RootDN: RootDN, RootPassword: RootPassword}
+	srv, err := ldapserver.Start(opts, dir, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	host, port, _ := net.SplitHostPort(srv.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	return &config.LDAPConfig{
+		Host:           host,
+		Port:           portNum,
+		BaseDN:         BaseDN,
+		BindDN:         RootDN,
+		BindPass:       RootPassword,
+		ServerType:     "openldap",
+		TimeoutSeconds: 5,
+	}
+}
+
+// Connect returns a client for cfg, closed when the test ends.
+func Connect(t testing.TB, cfg *config.LDAPConfig) *ldapauth.LDAPClient {
+	t.Helper()
+	client, err := ldapauth.NewLDAPClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
@@ -0,0 +1,251 @@
+package ldapserver
+
+import (
+	"errors"
+	"fmt"
+	"go-ldap-sso/internal/ldif"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+type Options struct {
+	// BaseDN is the naming context; entries outside of it are skipped when
+	// loading LDIF and rejected when added.
+	BaseDN string
+	// RootDN and RootPassword bind as the administrator, who may write and
+	// read userPassword. The root DN does not need to exist in the directory.
+	RootDN       string
+	RootPassword string
+}
+
+// Memory is the Backend of the embedded server: a Directory everyone may
+// read, only the root DN may write, and users may change their own password.
+type Memory struct {
+	opts Options
+	Dir  *Directory
+}
+
+// NewMemory creates a backend whose directory contains only the base entry.
+func NewMemory(opts Options) *Memory {
+	m := &Memory{opts: opts, Dir: NewDirectory(opts.BaseDN)}
+
+	rdn, _ := rdnAttributes(opts.BaseDN)
+	attrs := []ldif.Attribute{{Name: "objectClass", Values: []string{"top", "dcObject", "organization"}}}
+	for _, a := range rdn {
+		attrs = append(attrs, ldif.Attribute{Name: a.Type, Values: []string{a.Value}})
+	}
+	attrs = append(attrs, ldif.Attribute{Name: "o", Values: []string{opts.BaseDN}})
+	m.Dir.Add(opts.BaseDN, attrs)
+
+	return m
+}
+
+// Start creates an in-memory server, loads the LDIF files in ldifDir (if it
+// exists) and listens on addr. Tests pass "127.0.0.1:0" and dial Addr().
+func Start(opts Options, ldifDir, addr string) (*Server, error) {
+	m := NewMemory(opts)
+	if _, err := os.Stat(ldifDir); err == nil {
+		if err := m.LoadLDIFDir(ldifDir); err != nil {
+			return nil, err
+		}
+	}
+
+	s := NewServer(m)
+	if err := s.Listen(addr); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadLDIFDir applies every *.ldif file in dir in lexical order.
+func (m *Memory) LoadLDIFDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.ldif"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	return m.LoadLDIF(paths...)
+}
+
+// LoadLDIF applies the given files in order. Records outside the base DN,
+// like cn=config tweaks meant for a real OpenLDAP, are skipped, as is an add
+// of the base entry which NewMemory already created.
+func (m *Memory) LoadLDIF(paths ...string) error {
+	for _, path := range paths {
+		records, err := ldif.ParseFile(path)
+		if err != nil {
+			return err
+		}
+		for _, rec := range records {
+			if !m.Dir.InBase(rec.DN) {
+				continue
+			}
+			err := m.Dir.Apply(rec)
+			var re *ResultError
+			if errors.As(err, &re) && re.Code == ldap.LDAPResultEntryAlreadyExists && normalizeDN(rec.DN) == normalizeDN(m.opts.BaseDN) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s: %w", path, rec.Line, rec.DN, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) isRoot(dn string) bool {
+	return m.opts.RootDN != "" && dn != "" && normalizeDN(dn) == normalizeDN(m.opts.RootDN)
+}
+
+func (m *Memory) Bind(dn, password string) (string, error) {
+	if m.isRoot(dn) {
+		if password != m.opts.RootPassword {
+			return "", NewError(ldap.LDAPResultInvalidCredentials, "invalid credentials")
+		}
+		return dn, nil
+	}
+
+	e, ok := m.Dir.Get(dn)
+	if !ok || !containsValue("userPassword", e.Values("userPassword"), password) {
+		return "", NewError(ldap.LDAPResultInvalidCredentials, "invalid credentials")
+	}
+	return e.DN, nil
+}
+
+// Search hides userPassword from everyone but the root DN, in the filter as
+// well as in the results; otherwise a filter like (userPassword=a*) would
+// tell the password one character at a time.
+func (m *Memory) Search(boundDN, baseDN string, scope int, match func(*Entry) bool) ([]*Entry, error) {
+	root := m.isRoot(boundDN)
+	if !root {
+		filter := match
+		match = func(e *Entry) bool { return filter(withoutPassword(e)) }
+	}
+
+	entries, err := m.Dir.Search(baseDN, scope, match)
+	if err != nil {
+		return nil, err
+	}
+	if !root {
+		for _, e := range entries {
+			e.remove("userPassword")
+		}
+	}
+	return entries, nil
+}
+
+// withoutPassword returns a read-only view of e without userPassword,
+// sharing its attributes.
+func withoutPassword(e *Entry) *Entry {
+	if e.get("userPassword") == nil {
+		return e
+	}
+	view := &Entry{DN: e.DN, attrs: make([]*attribute, 0, len(e.attrs))}
+	for _, a := range e.attrs {
+		if !strings.EqualFold(a.Name, "userPassword") {
+			view.attrs = append(view.attrs, a)
+		}
+	}
+	return view
+}
+
+// RootDSE advertises what the server supports. Syncrepl is not offered, so
+// the incremental sync falls back to polling modifyTimestamp.
+func (m *Memory) RootDSE() *Entry {
+	e := &Entry{}
+	e.set("objectClass", []string{"top"})
+	e.set("namingContexts", []string{m.opts.BaseDN})
+	e.set("supportedLDAPVersion", []string{"3"})
+	e.set("supportedExtension", []string{OIDPasswordModify, OIDWhoAmI})
+	e.set("supportedControl", []string{})
+	e.set("vendorName", []string{"go-ldap-sso"})
+	return e
+}
+
+func (m *Memory) requireRoot(boundDN string) error {
+	if !m.isRoot(boundDN) {
+		return NewError(ldap.LDAPResultInsufficientAccessRights, "only the root DN may write")
+	}
+	return nil
+}
+
+func (m *Memory) Add(boundDN, dn string, attrs []ldif.Attribute) error {
+	if err := m.requireRoot(boundDN); err != nil {
+		return err
+	}
+	return m.Dir.Add(dn, attrs)
+}
+
+func (m *Memory) Modify(boundDN, dn string, mods []ldif.Modification) error {
+	// Users may change their own password; everything else is the root DN's
+	self := boundDN != "" && normalizeDN(boundDN) == normalizeDN(dn)
+	if !(self && onlyPassword(mods)) {
+		if err := m.requireRoot(boundDN); err != nil {
+			return err
+		}
+	}
+	return m.Dir.Modify(dn, mods)
+}
+
+func onlyPassword(mods []ldif.Modification) bool {
+	for _, mod := range mods {
+		if !strings.EqualFold(mod.Attribute.Name, "userPassword") {
+			return false
+		}
+	}
+	return len(mods) > 0
+}
+
+func (m *Memory) Delete(boundDN, dn string) error {
+	if err := m.requireRoot(boundDN); err != nil {
+		return err
+	}
+	return m.Dir.Delete(dn)
+}
+
+func (m *Memory) ModifyDN(boundDN, dn, newRDN string, deleteOldRDN bool, newSuperior string) error {
+	if err := m.requireRoot(boundDN); err != nil {
+		return err
+	}
+	return m.Dir.ModifyDN(dn, newRDN, deleteOldRDN, newSuperior)
+}
+
+// PasswordModify changes the bound user's own password when userID is
+// empty; only the root DN may change other users' passwords.
+func (m *Memory) PasswordModify(boundDN, userID, oldPassword, newPassword string) (string, error) {
+	if userID == "" {
+		userID = boundDN
+	}
+	if userID == "" {
+		return "", NewError(ldap.LDAPResultUnwillingToPerform, "bind first or name the user")
+	}
+	e, ok := m.Dir.Get(userID)
+	if !ok {
+		return "", NewError(ldap.LDAPResultNoSuchObject, "%s does not exist", userID)
+	}
+
+	if !m.isRoot(boundDN) {
+		if boundDN == "" || normalizeDN(boundDN) != normalizeDN(e.DN) {
+			return "", NewError(ldap.LDAPResultInsufficientAccessRights, "cannot change another user's password")
+		}
+		if oldPassword != "" && !containsValue("userPassword", e.Values("userPassword"), oldPassword) {
+			return "", NewError(ldap.LDAPResultInvalidCredentials, "old password does not match")
+		}
+	}
+
+	generated := ""
+	if newPassword == "" {
+		newPassword = strings.ReplaceAll(newUUID(), "-", "")[:16]
+		generated = newPassword
+	}
+
+	err := m.Dir.Modify(e.DN, []ldif.Modification{{
+		Op:        ldif.ModReplace,
+		Attribute: ldif.Attribute{Name: "userPassword", Values: []string{newPassword}},
+	}})
+	return generated, err
+}
@@ -0,0 +1,114 @@
+package ldapserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const testLDIF = `dn: ou=users,dc=example,dc=org
+objectClass: organizationalUnit
+ou: users
+
+dn: uid=alice,ou=users,dc=example,dc=org
+objectClass: inetOrgPerson
+cn: Alice
+sn: Example
+uid: alice
+mail: alice@example.org
+userPassword: secret123
+`
+
+var testOptions = Options{
+	BaseDN:       "dc=example,dc=org",
+	RootDN:       "cn=admin,dc=example,dc=org",
+	RootPassword: "adminpass",
+}
+
+func startTestServer(t *testing.T) *ldap.Conn {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "001_users.ldif"), []byte(testLDIF), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv, err := Start(testOptions, dir, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := ldap.DialURL("ldap://" + srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func search(t *testing.T, conn *ldap.Conn, filter string) []*ldap.Entry {
+	t.Helper()
+	sr, err := conn.Search(ldap.NewSearchRequest(
+		testOptions.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		filter, []string{"uid", "userPassword"}, nil,
+	))
+	if err != nil {
+		t.Fatalf("search %s: %v", filter, err)
+	}
+	return sr.Entries
+}
+
+func TestSearchHidesPasswordFromFilters(t *testing.T) {
+	conn := startTestServer(t)
+
+	// Anonymous, and then bound as a user: userPassword must not be usable
+	// as an oracle in either case
+	for _, bind := range []struct{ dn, password string }{
+		{},
+		{"uid=alice,ou=users,dc=example,dc=org", "secret123"},
+	} {
+		if bind.dn != "" {
+			if err := conn.Bind(bind.dn, bind.password); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, filter := range []string{
+			"(&(uid=alice)(userPassword=secret123))",
+			"(userPassword=s*)",
+			"(userPassword=*)",
+			"(|(uid=nobody)(userPassword=secret123))",
+		} {
+			if entries := search(t, conn, filter); len(entries) != 0 {
+				t.Errorf("bound as %q, %s matched %d entries", bind.dn, filter, len(entries))
+			}
+		}
+		// A negated password filter must not single out anyone either
+		if entries := search(t, conn, "(&(uid=alice)(!(userPassword=wrong)))"); len(entries) != 1 {
+			t.Errorf("bound as %q, negated password filter matched %d entries, want 1", bind.dn, len(entries))
+		}
+
+		entries := search(t, conn, "(uid=alice)")
+		if len(entries) != 1 {
+			t.Fatalf("bound as %q, (uid=alice) matched %d entries", bind.dn, len(entries))
+		}
+		if v := entries[0].GetAttributeValue("userPassword"); v != "" {
+			t.Errorf("bound as %q, userPassword returned: %q", bind.dn, v)
+		}
+	}
+}
+
+func TestRootSearchesPassword(t *testing.T) {
+	conn := startTestServer(t)
+	if err := conn.Bind(testOptions.RootDN, testOptions.RootPassword); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := search(t, conn, "(&(uid=alice)(userPassword=secret123))")
+	if len(entries) != 1 {
+		t.Fatalf("root search matched %d entries, want 1", len(entries))
+	}
+	if v := entries[0].GetAttributeValue("userPassword"); v != "secret123" {
+		t.Errorf("root search userPassword = %q", v)
+	}
+}
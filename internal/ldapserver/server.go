@@ -0,0 +1,497 @@
+// Package ldapserver is a small LDAPv3 server. The protocol handling here is
+// shared by the embedded in-memory directory (Memory, loaded from LDIF) and
+// other Backends such as the proxy in internal/ldapproxy. It supports simple
+// bind, search, add, modify, delete, modify DN and the password modify and
+// whoami extended operations.
+package ldapserver
+
+import (
+	"errors"
+	"go-ldap-sso/internal/ldif"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// OIDs of the supported extended operations, for backends building a RootDSE.
+const (
+	OIDPasswordModify = "1.3.6.1.4.1.4203.1.11.1"
+	OIDWhoAmI         = "1.3.6.1.4.1.4203.1.11.3"
+)
+
+type Server struct {
+	backend Backend
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+func NewServer(backend Backend) *Server {
+	return &Server{
+		backend: backend,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Listen starts accepting connections on addr in the background; use
+// "127.0.0.1:0" in tests and read the port back from Addr.
+func (s *Server) Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+	go s.Serve(l)
+	return nil
+}
+
+// ListenAndServe listens on addr and serves until Close.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return net.ErrClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Addr returns the listening address, nil before Listen/Serve.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Close stops the listener and drops open connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// session is the per-connection state.
+type session struct {
+	conn    net.Conn
+	boundDN string
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+	sess := &session{conn: conn}
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("⚠️ LDAP server: read from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+
+		messageID, ok := packet.Children[0].Value.(int64)
+		if !ok {
+			return
+		}
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationAbandonRequest:
+			// Requests are answered synchronously, nothing left to abandon
+		case ldap.ApplicationBindRequest:
+			sess.reply(messageID, ldap.ApplicationBindResponse, s.handleBind(sess, op))
+		case ldap.ApplicationSearchRequest:
+			sess.reply(messageID, ldap.ApplicationSearchResultDone, s.handleSearch(sess, messageID, op))
+		case ldap.ApplicationModifyRequest:
+			sess.reply(messageID, ldap.ApplicationModifyResponse, s.handleModify(sess, op))
+		case ldap.ApplicationAddRequest:
+			sess.reply(messageID, ldap.ApplicationAddResponse, s.handleAdd(sess, op))
+		case ldap.ApplicationDelRequest:
+			sess.reply(messageID, ldap.ApplicationDelResponse, s.handleDelete(sess, op))
+		case ldap.ApplicationModifyDNRequest:
+			sess.reply(messageID, ldap.ApplicationModifyDNResponse, s.handleModifyDN(sess, op))
+		case ldap.ApplicationExtendedRequest:
+			s.handleExtended(sess, messageID, op)
+		default:
+			sess.reply(messageID, ldap.ApplicationExtendedResponse,
+				NewError(ldap.LDAPResultProtocolError, "unsupported operation %d", op.Tag))
+		}
+	}
+}
+
+func (sess *session) write(p *ber.Packet) {
+	sess.conn.Write(p.Bytes())
+}
+
+func envelope(messageID int64, op *ber.Packet) *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	p.AppendChild(op)
+	return p
+}
+
+// result builds an LDAPResult-shaped response; err nil means success.
+// Errors other than *ResultError are logged and reported as "other" so
+// backend internals don't leak to clients.
+func result(tag ber.Tag, err error) *ber.Packet {
+	code := uint16(ldap.LDAPResultSuccess)
+	message := ""
+	if err != nil {
+		var re *ResultError
+		if errors.As(err, &re) {
+			code, message = re.Code, re.Message
+		} else {
+			log.Printf("⚠️ LDAP server: %v", err)
+			code, message = ldap.LDAPResultOther, "internal error"
+		}
+	}
+
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, ldap.ApplicationMap[uint8(tag)])
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "diagnosticMessage"))
+	return op
+}
+
+func (sess *session) reply(messageID int64, tag ber.Tag, err error) {
+	sess.write(envelope(messageID, result(tag, err)))
+}
+
+func (s *Server) handleBind(sess *session, op *ber.Packet) error {
+	// A new bind always starts out anonymous, whatever the outcome
+	sess.boundDN = ""
+
+	if len(op.Children) < 3 {
+		return NewError(ldap.LDAPResultProtocolError, "invalid bind request")
+	}
+	dn := packetString(op.Children[1])
+	auth := op.Children[2]
+	if auth.ClassType != ber.ClassContext || auth.Tag != 0 {
+		return NewError(ldap.LDAPResultAuthMethodNotSupported, "only simple bind is supported")
+	}
+	password := auth.Data.String()
+
+	if dn == "" && password == "" {
+		return nil
+	}
+	if password == "" {
+		return NewError(ldap.LDAPResultUnwillingToPerform, "unauthenticated bind is not allowed")
+	}
+
+	boundDN, err := s.backend.Bind(dn, password)
+	if err != nil {
+		return err
+	}
+	sess.boundDN = boundDN
+	return nil
+}
+
+func (s *Server) handleSearch(sess *session, messageID int64, op *ber.Packet) error {
+	if len(op.Children) < 8 {
+		return NewError(ldap.LDAPResultProtocolError, "invalid search request")
+	}
+	baseDN := packetString(op.Children[0])
+	scope, _ := op.Children[1].Value.(int64)
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	typesOnly, _ := op.Children[5].Value.(bool)
+	filter := op.Children[6]
+	var requested []string
+	for _, a := range op.Children[7].Children {
+		requested = append(requested, packetString(a))
+	}
+
+	if baseDN == "" && scope == ldap.ScopeBaseObject {
+		sess.write(envelope(messageID, searchEntry(s.backend.RootDSE(), requested, typesOnly)))
+		return nil
+	}
+
+	var matchErr error
+	entries, err := s.backend.Search(sess.boundDN, baseDN, int(scope), func(e *Entry) bool {
+		ok, err := matchFilter(e, filter)
+		if err != nil {
+			matchErr = err
+		}
+		return ok
+	})
+	if err != nil {
+		return err
+	}
+	if matchErr != nil {
+		return matchErr
+	}
+
+	for i, e := range entries {
+		if sizeLimit > 0 && int64(i) >= sizeLimit {
+			return NewError(ldap.LDAPResultSizeLimitExceeded, "size limit exceeded")
+		}
+		sess.write(envelope(messageID, searchEntry(e, requested, typesOnly)))
+	}
+	return nil
+}
+
+// searchEntry encodes an entry with the requested attribute selection:
+// none or "*" for all user attributes, "+" for operational ones, "1.1" for
+// none at all, plus any attribute named explicitly.
+func searchEntry(e *Entry, requested []string, typesOnly bool) *ber.Packet {
+	wantUser, wantOperational := len(requested) == 0, false
+	named := make(map[string]bool)
+	for _, r := range requested {
+		switch r {
+		case "*":
+			wantUser = true
+		case "+":
+			wantOperational = true
+		case "1.1":
+		default:
+			named[strings.ToLower(r)] = true
+		}
+	}
+
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "objectName"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+
+	for _, a := range e.attrs {
+		key := strings.ToLower(a.Name)
+		want := wantUser
+		if operationalAttributes[key] {
+			want = wantOperational
+		}
+		if !want && !named[key] {
+			continue
+		}
+
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, a.Name, "type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		if !typesOnly {
+			for _, v := range a.Values {
+				vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+			}
+		}
+		attr.AppendChild(vals)
+		attrs.AppendChild(attr)
+	}
+
+	op.AppendChild(attrs)
+	return op
+}
+
+func (s *Server) writer() (Writer, error) {
+	w, ok := s.backend.(Writer)
+	if !ok {
+		return nil, NewError(ldap.LDAPResultUnwillingToPerform, "this server is read-only")
+	}
+	return w, nil
+}
+
+func (s *Server) handleModify(sess *session, op *ber.Packet) error {
+	w, err := s.writer()
+	if err != nil {
+		return err
+	}
+	if len(op.Children) < 2 {
+		return NewError(ldap.LDAPResultProtocolError, "invalid modify request")
+	}
+	dn := packetString(op.Children[0])
+
+	var mods []ldif.Modification
+	for _, change := range op.Children[1].Children {
+		if len(change.Children) < 2 || len(change.Children[1].Children) < 2 {
+			return NewError(ldap.LDAPResultProtocolError, "invalid change")
+		}
+		code, _ := change.Children[0].Value.(int64)
+		mod := ldif.Modification{Attribute: attributeOf(change.Children[1])}
+		switch code {
+		case ldap.AddAttribute:
+			mod.Op = ldif.ModAdd
+		case ldap.DeleteAttribute:
+			mod.Op = ldif.ModDelete
+		case ldap.ReplaceAttribute:
+			mod.Op = ldif.ModReplace
+		default:
+			return NewError(ldap.LDAPResultProtocolError, "unknown modify operation %d", code)
+		}
+		mods = append(mods, mod)
+	}
+
+	return w.Modify(sess.boundDN, dn, mods)
+}
+
+func attributeOf(p *ber.Packet) ldif.Attribute {
+	a := ldif.Attribute{Name: packetString(p.Children[0])}
+	for _, v := range p.Children[1].Children {
+		a.Values = append(a.Values, packetString(v))
+	}
+	return a
+}
+
+func (s *Server) handleAdd(sess *session, op *ber.Packet) error {
+	w, err := s.writer()
+	if err != nil {
+		return err
+	}
+	if len(op.Children) < 2 {
+		return NewError(ldap.LDAPResultProtocolError, "invalid add request")
+	}
+	var attrs []ldif.Attribute
+	for _, a := range op.Children[1].Children {
+		if len(a.Children) < 2 {
+			return NewError(ldap.LDAPResultProtocolError, "invalid attribute")
+		}
+		attrs = append(attrs, attributeOf(a))
+	}
+	return w.Add(sess.boundDN, packetString(op.Children[0]), attrs)
+}
+
+func (s *Server) handleDelete(sess *session, op *ber.Packet) error {
+	w, err := s.writer()
+	if err != nil {
+		return err
+	}
+	return w.Delete(sess.boundDN, op.Data.String())
+}
+
+func (s *Server) handleModifyDN(sess *session, op *ber.Packet) error {
+	w, err := s.writer()
+	if err != nil {
+		return err
+	}
+	if len(op.Children) < 3 {
+		return NewError(ldap.LDAPResultProtocolError, "invalid modify DN request")
+	}
+	deleteOld, _ := op.Children[2].Value.(bool)
+	newSuperior := ""
+	if len(op.Children) > 3 {
+		newSuperior = packetString(op.Children[3])
+	}
+	return w.ModifyDN(sess.boundDN, packetString(op.Children[0]), packetString(op.Children[1]), deleteOld, newSuperior)
+}
+
+func (s *Server) handleExtended(sess *session, messageID int64, op *ber.Packet) {
+	if len(op.Children) < 1 {
+		sess.reply(messageID, ldap.ApplicationExtendedResponse, NewError(ldap.LDAPResultProtocolError, "invalid extended request"))
+		return
+	}
+	name := packetString(op.Children[0])
+
+	switch name {
+	case OIDWhoAmI:
+		res := result(ldap.ApplicationExtendedResponse, nil)
+		authzID := ""
+		if sess.boundDN != "" {
+			authzID = "dn:" + sess.boundDN
+		}
+		res.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 11, authzID, "responseValue"))
+		sess.write(envelope(messageID, res))
+	case OIDPasswordModify:
+		var value *ber.Packet
+		if len(op.Children) > 1 {
+			value = op.Children[1]
+		}
+		generated, err := s.passwordModify(sess, value)
+		res := result(ldap.ApplicationExtendedResponse, err)
+		if err == nil && generated != "" {
+			seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "PasswdModifyResponseValue")
+			seq.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, generated, "genPasswd"))
+			body := ber.Encode(ber.ClassContext, ber.TypePrimitive, 11, nil, "responseValue")
+			body.AppendChild(seq)
+			res.AppendChild(body)
+		}
+		sess.write(envelope(messageID, res))
+	default:
+		sess.reply(messageID, ldap.ApplicationExtendedResponse,
+			NewError(ldap.LDAPResultProtocolError, "unsupported extended operation %s", name))
+	}
+}
+
+func (s *Server) passwordModify(sess *session, value *ber.Packet) (string, error) {
+	w, err := s.writer()
+	if err != nil {
+		return "", err
+	}
+
+	var userID, oldPassword, newPassword string
+	if value != nil && len(value.Data.Bytes()) > 0 {
+		seq, err := ber.DecodePacketErr(value.Data.Bytes())
+		if err != nil {
+			return "", NewError(ldap.LDAPResultProtocolError, "invalid password modify request")
+		}
+		for _, field := range seq.Children {
+			switch field.Tag {
+			case 0:
+				userID = field.Data.String()
+			case 1:
+				oldPassword = field.Data.String()
+			case 2:
+				newPassword = field.Data.String()
+			}
+		}
+	}
+
+	return w.PasswordModify(sess.boundDN, userID, oldPassword, newPassword)
+}
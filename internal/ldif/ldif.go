@@ -0,0 +1,322 @@
+// Package ldif parses RFC 2849 LDIF files, both content records and change
+// records (add, modify, delete, modrdn/moddn).
+package ldif
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	ChangeAdd    = "add"
+	ChangeModify = "modify"
+	ChangeDelete = "delete"
+	ChangeModRDN = "modrdn"
+)
+
+const (
+	ModAdd     = "add"
+	ModDelete  = "delete"
+	ModReplace = "replace"
+)
+
+type Attribute struct {
+	Name   string
+	Values []string
+}
+
+type Modification struct {
+	Op        string
+	Attribute Attribute
+}
+
+// Record is one LDIF record. Content records (without changetype) are
+// returned as ChangeAdd.
+type Record struct {
+	DN         string
+	ChangeType string
+	// Line is where the record starts, for error messages
+	Line int
+
+	// Attributes is set for ChangeAdd
+	Attributes []Attribute
+	// Modifications is set for ChangeModify
+	Modifications []Modification
+	// NewRDN, DeleteOldRDN and NewSuperior are set for ChangeModRDN
+	NewRDN       string
+	DeleteOldRDN bool
+	NewSuperior  string
+}
+
+// Values returns the values of attribute name of an add record.
+func (r *Record) Values(name string) []string {
+	for _, a := range r.Attributes {
+		if strings.EqualFold(a.Name, name) {
+			return a.Values
+		}
+	}
+	return nil
+}
+
+func ParseFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return records, nil
+}
+
+type line struct {
+	no   int
+	text string
+}
+
+func Parse(r io.Reader) ([]Record, error) {
+	blocks, err := readBlocks(r)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(blocks))
+	for i, block := range blocks {
+		if i == 0 && len(block) == 1 && strings.HasPrefix(strings.ToLower(block[0].text), "version:") {
+			continue
+		}
+		// "version: 1" may also be the first line of the first record
+		if i == 0 && strings.HasPrefix(strings.ToLower(block[0].text), "version:") {
+			block = block[1:]
+		}
+
+		rec, err := parseRecord(block)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// readBlocks unfolds continuation lines, drops comments and splits the
+// input into records on blank lines.
+func readBlocks(r io.Reader) ([][]line, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var blocks [][]line
+	var current []line
+	inComment := false
+	no := 0
+
+	for scanner.Scan() {
+		no++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+
+		if strings.HasPrefix(text, " ") {
+			// Continuation of the previous line (or of a comment)
+			if inComment {
+				continue
+			}
+			if len(current) == 0 {
+				return nil, fmt.Errorf("line %d: continuation line without a preceding line", no)
+			}
+			current[len(current)-1].text += text[1:]
+			continue
+		}
+		inComment = false
+
+		if strings.TrimSpace(text) == "" {
+			if len(current) > 0 {
+				blocks = append(blocks, current)
+				current = nil
+			}
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			inComment = true
+			continue
+		}
+		current = append(current, line{no: no, text: text})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(current) > 0 {
+		blocks = append(blocks, current)
+	}
+	return blocks, nil
+}
+
+func parseRecord(block []line) (Record, error) {
+	name, value, err := splitLine(block[0])
+	if err != nil {
+		return Record{}, err
+	}
+	if !strings.EqualFold(name, "dn") {
+		return Record{}, fmt.Errorf("line %d: record must start with dn:, got %q", block[0].no, name)
+	}
+
+	rec := Record{DN: value, ChangeType: ChangeAdd, Line: block[0].no}
+	rest := block[1:]
+
+	// Controls are accepted but ignored
+	for len(rest) > 0 && strings.HasPrefix(strings.ToLower(rest[0].text), "control:") {
+		rest = rest[1:]
+	}
+
+	if len(rest) > 0 {
+		name, value, err := splitLine(rest[0])
+		if err != nil {
+			return Record{}, err
+		}
+		if strings.EqualFold(name, "changetype") {
+			rec.ChangeType = strings.ToLower(value)
+			rest = rest[1:]
+		}
+	}
+
+	switch rec.ChangeType {
+	case ChangeAdd:
+		attrs, err := parseAttributes(rest)
+		if err != nil {
+			return Record{}, err
+		}
+		if len(attrs) == 0 {
+			return Record{}, fmt.Errorf("line %d: add record for %q has no attributes", rec.Line, rec.DN)
+		}
+		rec.Attributes = attrs
+	case ChangeDelete:
+		if len(rest) > 0 {
+			return Record{}, fmt.Errorf("line %d: delete record must not have attributes", rest[0].no)
+		}
+	case ChangeModify:
+		mods, err := parseModifications(rest)
+		if err != nil {
+			return Record{}, err
+		}
+		rec.Modifications = mods
+	case ChangeModRDN, "moddn":
+		rec.ChangeType = ChangeModRDN
+		if err := parseModRDN(&rec, rest); err != nil {
+			return Record{}, err
+		}
+	default:
+		return Record{}, fmt.Errorf("line %d: unknown changetype %q", rec.Line, rec.ChangeType)
+	}
+
+	return rec, nil
+}
+
+func parseAttributes(lines []line) ([]Attribute, error) {
+	var attrs []Attribute
+	index := make(map[string]int)
+
+	for _, l := range lines {
+		name, value, err := splitLine(l)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(name)
+		if i, ok := index[key]; ok {
+			attrs[i].Values = append(attrs[i].Values, value)
+			continue
+		}
+		index[key] = len(attrs)
+		attrs = append(attrs, Attribute{Name: name, Values: []string{value}})
+	}
+	return attrs, nil
+}
+
+func parseModifications(lines []line) ([]Modification, error) {
+	var mods []Modification
+
+	for i := 0; i < len(lines); {
+		op, attrName, err := splitLine(lines[i])
+		if err != nil {
+			return nil, err
+		}
+		op = strings.ToLower(op)
+		if op != ModAdd && op != ModDelete && op != ModReplace {
+			return nil, fmt.Errorf("line %d: expected add:, delete: or replace:, got %q", lines[i].no, op)
+		}
+		i++
+
+		mod := Modification{Op: op, Attribute: Attribute{Name: attrName}}
+		for ; i < len(lines) && lines[i].text != "-"; i++ {
+			name, value, err := splitLine(lines[i])
+			if err != nil {
+				return nil, err
+			}
+			if !strings.EqualFold(name, attrName) {
+				return nil, fmt.Errorf("line %d: attribute %q does not match %s: %s", lines[i].no, name, op, attrName)
+			}
+			mod.Attribute.Values = append(mod.Attribute.Values, value)
+		}
+		// Skip the "-" separator (optional after the last modification)
+		i++
+
+		if op == ModAdd && len(mod.Attribute.Values) == 0 {
+			return nil, fmt.Errorf("add: %s without values", attrName)
+		}
+		mods = append(mods, mod)
+	}
+	if len(mods) == 0 {
+		return nil, fmt.Errorf("modify record without modifications")
+	}
+	return mods, nil
+}
+
+func parseModRDN(rec *Record, lines []line) error {
+	for _, l := range lines {
+		name, value, err := splitLine(l)
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(name) {
+		case "newrdn":
+			rec.NewRDN = value
+		case "deleteoldrdn":
+			rec.DeleteOldRDN = value == "1"
+		case "newsuperior":
+			rec.NewSuperior = value
+		default:
+			return fmt.Errorf("line %d: unexpected %q in modrdn record", l.no, name)
+		}
+	}
+	if rec.NewRDN == "" {
+		return fmt.Errorf("line %d: modrdn record without newrdn", rec.Line)
+	}
+	return nil
+}
+
+// splitLine splits "name: value", "name:: base64" and "name:< url" lines.
+func splitLine(l line) (string, string, error) {
+	i := strings.Index(l.text, ":")
+	if i <= 0 {
+		return "", "", fmt.Errorf("line %d: missing ':' in %q", l.no, l.text)
+	}
+	name := strings.TrimSpace(l.text[:i])
+	rest := l.text[i+1:]
+
+	switch {
+	case strings.HasPrefix(rest, ":"):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return "", "", fmt.Errorf("line %d: invalid base64 value: %w", l.no, err)
+		}
+		return name, string(decoded), nil
+	case strings.HasPrefix(rest, "<"):
+		return "", "", fmt.Errorf("line %d: URL values are not supported", l.no)
+	default:
+		return name, strings.TrimLeft(rest, " "), nil
+	}
+}
@@ -0,0 +1,141 @@
+// Package ldifapply applies the LDIF files of a directory to LDAP once each,
+// recording them in ldif_history the way the SQL seeders use seed_history.
+package ldifapply
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go-ldap-sso/db/ldifhistory"
+	ldapauth "go-ldap-sso/internal/ldap"
+	"go-ldap-sso/internal/ldif"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+type Runner struct {
+	ldap *ldapauth.LDAPClient
+	repo *ldifhistory.Repository
+	dir  string
+}
+
+func NewRunner(ldapClient *ldapauth.LDAPClient, repo *ldifhistory.Repository, dir string) *Runner {
+	return &Runner{ldap: ldapClient, repo: repo, dir: dir}
+}
+
+// Reset forgets the history so every file is applied again; use it after
+// recreating the directory server.
+func (r *Runner) Reset(ctx context.Context) error {
+	if err := r.repo.Initialize(ctx); err != nil {
+		return fmt.Errorf("failed to initialize ldif history: %w", err)
+	}
+	return r.repo.Reset(ctx)
+}
+
+// Run applies pending *.ldif files in lexical order. LDAP has no
+// transactions, so a file failing halfway is not recorded and the records
+// before the failure stay applied; on the next run an add of an existing
+// entry or a delete of a missing one counts as already applied, so fixing
+// the failing record and running again finishes the file.
+//
+// Records outside the configured base DN (cn=config ACLs and the like) are
+// skipped: the bind DN usually has no rights there, they need ldapmodify -Y
+// EXTERNAL on the server itself.
+func (r *Runner) Run(ctx context.Context) error {
+	if err := r.repo.Initialize(ctx); err != nil {
+		return fmt.Errorf("failed to initialize ldif history: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(r.dir, "*.ldif"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	if len(paths) == 0 {
+		log.Println("ℹ️ No LDIF files found")
+		return nil
+	}
+
+	applied, err := r.repo.GetApplied(ctx)
+	if err != nil {
+		return err
+	}
+
+	batch, err := r.repo.GetLastBatch(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get last batch: %w", err)
+	}
+	batch++
+
+	count := 0
+	for _, path := range paths {
+		name := filepath.Base(path)
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		sum := sha256.Sum256(content)
+		checksum := hex.EncodeToString(sum[:])
+
+		if previous, ok := applied[name]; ok {
+			if previous != checksum {
+				log.Printf("⚠️ LDIF %s changed since it was applied, add a new file instead", name)
+			} else {
+				log.Printf("ℹ️ LDIF %s already applied, skipping", name)
+			}
+			continue
+		}
+
+		records, err := ldif.Parse(bytes.NewReader(content))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		log.Printf("🏃 Applying LDIF: %s", name)
+		for _, rec := range records {
+			if !r.ldap.InBaseDN(rec.DN) {
+				log.Printf("⏭️ %s:%d %s is outside the base DN, skipping", name, rec.Line, rec.DN)
+				continue
+			}
+			err := r.ldap.Apply(rec)
+			if alreadyApplied(rec, err) {
+				log.Printf("ℹ️ %s:%d %s %s already done, skipping", name, rec.Line, strings.ToUpper(rec.ChangeType), rec.DN)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s:%d %s %s failed: %w", name, rec.Line, strings.ToUpper(rec.ChangeType), rec.DN, err)
+			}
+		}
+
+		if err := r.repo.RecordApply(ctx, name, checksum, batch); err != nil {
+			return fmt.Errorf("failed to record ldif history: %w", err)
+		}
+		log.Printf("✅ LDIF %s applied", name)
+		count++
+	}
+
+	if count > 0 {
+		log.Printf("🎉 Applied %d LDIF file(s) (batch %d)", count, batch)
+	}
+	return nil
+}
+
+// alreadyApplied reports whether err only says rec was applied before, by a
+// run that failed later in the same file.
+func alreadyApplied(rec ldif.Record, err error) bool {
+	switch rec.ChangeType {
+	case ldif.ChangeAdd:
+		return ldap.IsErrorWithCode(err, ldap.LDAPResultEntryAlreadyExists)
+	case ldif.ChangeDelete:
+		return ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject)
+	}
+	return false
+}
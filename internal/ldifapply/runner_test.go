@@ -0,0 +1,38 @@
+package ldifapply
+
+import (
+	"errors"
+	"go-ldap-sso/internal/ldif"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestAlreadyApplied(t *testing.T) {
+	exists := ldap.NewError(ldap.LDAPResultEntryAlreadyExists, errors.New("already exists"))
+	missing := ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object"))
+	denied := ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("denied"))
+
+	tests := []struct {
+		changeType string
+		err        error
+		want       bool
+	}{
+		{ldif.ChangeAdd, nil, false},
+		{ldif.ChangeAdd, exists, true},
+		{ldif.ChangeAdd, missing, false},
+		{ldif.ChangeAdd, denied, false},
+		{ldif.ChangeDelete, missing, true},
+		{ldif.ChangeDelete, exists, false},
+		{ldif.ChangeModify, missing, false},
+		{ldif.ChangeModify, exists, false},
+		{ldif.ChangeModRDN, missing, false},
+	}
+
+	for _, tt := range tests {
+		rec := ldif.Record{DN: "uid=alice,dc=example,dc=org", ChangeType: tt.changeType}
+		if got := alreadyApplied(rec, tt.err); got != tt.want {
+			t.Errorf("alreadyApplied(%s, %v) = %v, want %v", tt.changeType, tt.err, got, tt.want)
+		}
+	}
+}
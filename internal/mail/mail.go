@@ -0,0 +1,179 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-ldap-sso/config"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers plain-text mails. Handlers only depend on this interface so
+// the SMTP transport can be swapped for a local sink in development.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewSender returns the sender of the configured MAIL_SINK. Without one it
+// returns an SMTP sender, or a LogSender when no SMTP host is configured.
+// Mails carry reset links and login codes, so outside development only SMTP
+// is accepted and SMTP_HOST is required.
+func NewSender(cfg *config.MailConfig, development bool) (Sender, error) {
+	sink := cfg.Sink
+	if sink == "" {
+		sink = config.MailSinkSMTP
+		if cfg.SMTPHost == "" && development {
+			log.Println("⚠️ SMTP_HOST not set, mails will only be logged")
+			sink = config.MailSinkLog
+		}
+	}
+	if sink != config.MailSinkSMTP && !development {
+		return nil, fmt.Errorf("MAIL_SINK=%s would expose reset links and login codes, it is only allowed in development", sink)
+	}
+
+	switch sink {
+	case config.MailSinkLog:
+		return LogSender{}, nil
+	case config.MailSinkFile:
+		log.Printf("📂 Mails are written to %s instead of being sent", cfg.SinkDir)
+		return &FileSender{Dir: cfg.SinkDir, From: cfg.From}, nil
+	}
+	if cfg.SMTPHost == "" {
+		return nil, errors.New("SMTP_HOST is required to send mail outside development")
+	}
+	return &SMTPSender{cfg: cfg}, nil
+}
+
+type SMTPSender struct {
+	cfg *config.MailConfig
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	addr := fmt.Sprintf("%s:%d", s.cfg.SMTPHost, s.cfg.SMTPPort)
+
+	var auth smtp.Auth
+	if s.cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", s.cfg.SMTPUsername, s.cfg.SMTPPassword, s.cfg.SMTPHost)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, envelopeAddress(s.cfg.From), []string{msg.To}, buildMessage(s.cfg.From, msg))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("send mail: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LogSender writes mails to the application log instead of sending them.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	log.Printf("📧 Mail to %s\nSubject: %s\n\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileSender writes every mail as an .eml file in Dir, to open in a mail
+// client or read from scripts during development.
+type FileSender struct {
+	Dir  string
+	From string
+}
+
+func (s *FileSender) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return fmt.Errorf("create mail dir: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), fileSafe(msg.To))
+	path := filepath.Join(s.Dir, name)
+	if err := os.WriteFile(path, buildMessage(s.From, msg), 0o600); err != nil {
+		return fmt.Errorf("write mail: %w", err)
+	}
+	log.Printf("📧 Mail to %s written to %s", msg.To, path)
+	return nil
+}
+
+// MemorySender keeps mails in memory, for tests that need to read a mailed
+// code or link.
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (s *MemorySender) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages returns the mails sent so far, oldest first.
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.messages)
+}
+
+// Last returns the latest mail sent to, if any.
+func (s *MemorySender) Last(to string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if strings.EqualFold(s.messages[i].To, to) {
+			return s.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// fileSafe keeps letters, digits and ".-_" of an address, for file names.
+func fileSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// envelopeAddress extracts "a@b" from "Name <a@b>".
+func envelopeAddress(from string) string {
+	if i := strings.Index(from, "<"); i >= 0 {
+		if j := strings.Index(from[i:], ">"); j > 0 {
+			return from[i+1 : i+j]
+		}
+	}
+	return from
+}
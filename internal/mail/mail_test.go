@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"go-ldap-sso/config"
+	"testing"
+)
+
+func TestNewSender(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         config.MailConfig
+		development bool
+		want        Sender
+		wantErr     bool
+	}{
+		{"smtp host", config.MailConfig{SMTPHost: "smtp.example.com"}, false, &SMTPSender{}, false},
+		{"no smtp host in production", config.MailConfig{}, false, nil, true},
+		{"no smtp host in development", config.MailConfig{}, true, LogSender{}, false},
+		{"smtp sink without host", config.MailConfig{Sink: config.MailSinkSMTP}, true, nil, true},
+		{"log sink in production", config.MailConfig{Sink: config.MailSinkLog, SMTPHost: "smtp.example.com"}, false, nil, true},
+		{"file sink in production", config.MailConfig{Sink: config.MailSinkFile}, false, nil, true},
+		{"log sink in development", config.MailConfig{Sink: config.MailSinkLog}, true, LogSender{}, false},
+		{"file sink in development", config.MailConfig{Sink: config.MailSinkFile, SinkDir: "mails"}, true, &FileSender{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSender(&tt.cfg, tt.development)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSender() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			switch tt.want.(type) {
+			case *SMTPSender:
+				if _, ok := got.(*SMTPSender); !ok {
+					t.Errorf("NewSender() = %T, want *SMTPSender", got)
+				}
+			case LogSender:
+				if _, ok := got.(LogSender); !ok {
+					t.Errorf("NewSender() = %T, want LogSender", got)
+				}
+			case *FileSender:
+				if _, ok := got.(*FileSender); !ok {
+					t.Errorf("NewSender() = %T, want *FileSender", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package mfa
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Cipher encrypts secrets with AES-GCM. The nonce is stored in front of the
+// ciphertext.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher returns a Cipher for a 16, 24 or 32 byte key.
+func NewCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("mfa cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("mfa cipher: %w", err)
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Seal encrypts plaintext bound to context (e.g. the employee id), so a
+// ciphertext copied to another row doesn't decrypt.
+func (c *Cipher) Seal(plaintext, context []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, context), nil
+}
+
+// Open decrypts what Seal returned for the same context.
+func (c *Cipher) Open(sealed, context []byte) ([]byte, error) {
+	n := c.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, errors.New("mfa cipher: ciphertext too short")
+	}
+	return c.aead.Open(nil, sealed[:n], sealed[n:], context)
+}
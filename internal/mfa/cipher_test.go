@@ -0,0 +1,92 @@
+package mfa
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestCipher(t *testing.T, key string) *Cipher {
+	t.Helper()
+	c, err := NewCipher([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCipherRoundTrip(t *testing.T) {
+	c := newTestCipher(t, "0123456789abcdef0123456789abcdef")
+	secret := []byte(rfcSecret)
+	context := []byte("employee_totp:1")
+
+	sealed, err := c.Seal(secret, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, secret) {
+		t.Error("sealed secret holds the plaintext")
+	}
+	opened, err := c.Open(sealed, context)
+	if err != nil || !bytes.Equal(opened, secret) {
+		t.Fatalf("Open() = %q, %v, want the secret", opened, err)
+	}
+
+	again, err := c.Seal(secret, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Error("sealing twice gave the same ciphertext, nonce reused")
+	}
+}
+
+func TestCipherRejects(t *testing.T) {
+	c := newTestCipher(t, "0123456789abcdef0123456789abcdef")
+	context := []byte("employee_totp:1")
+	sealed, err := c.Seal([]byte(rfcSecret), context)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	tamperedNonce := bytes.Clone(sealed)
+	tamperedNonce[0] ^= 1
+
+	tests := []struct {
+		name    string
+		cipher  *Cipher
+		sealed  []byte
+		context string
+	}{
+		{"tampered ciphertext", c, tampered, "employee_totp:1"},
+		{"tampered nonce", c, tamperedNonce, "employee_totp:1"},
+		// A secret copied to another employee's row doesn't open
+		{"wrong context", c, sealed, "employee_totp:2"},
+		{"no context", c, sealed, ""},
+		{"wrong key", newTestCipher(t, "fedcba9876543210fedcba9876543210"), sealed, "employee_totp:1"},
+		{"truncated", c, sealed[:len(sealed)-1], "employee_totp:1"},
+		{"shorter than the nonce", c, sealed[:4], "employee_totp:1"},
+		{"empty", c, nil, "employee_totp:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if opened, err := tt.cipher.Open(tt.sealed, []byte(tt.context)); err == nil {
+				t.Errorf("Open() = %q, want an error", opened)
+			}
+		})
+	}
+}
+
+func TestNewCipherKeyLength(t *testing.T) {
+	for _, n := range []int{16, 24, 32} {
+		if _, err := NewCipher(make([]byte, n)); err != nil {
+			t.Errorf("NewCipher(%d bytes) error = %v", n, err)
+		}
+	}
+	for _, n := range []int{0, 15, 20, 64} {
+		if _, err := NewCipher(make([]byte, n)); err == nil {
+			t.Errorf("NewCipher(%d bytes) accepted", n)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+)
+
+// recoveryEncoding spells codes in lowercase without padding.
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// NewRecoveryCodes returns n random codes like "k3q7-x2mf-p9tz" (60 bits).
+func NewRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		raw := make([]byte, 8)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		s := recoveryEncoding.EncodeToString(raw)[:12]
+		codes[i] = s[:4] + "-" + s[4:8] + "-" + s[8:]
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode returns the stored form of a code, ignoring case, spaces
+// and dashes so codes can be typed loosely.
+func HashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// LooksLikeTOTP reports whether code is shaped like a TOTP code rather than a
+// recovery code.
+func LooksLikeTOTP(code string) bool {
+	if len(code) != int(totpOpts.Digits) {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package mfa
+
+import (
+	"regexp"
+	"testing"
+)
+
+var recoveryCodeFormat = regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`)
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("NewRecoveryCodes(10) = %d codes", len(codes))
+	}
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if !recoveryCodeFormat.MatchString(c) {
+			t.Errorf("code %q is not like k3q7-x2mf-p9tz", c)
+		}
+		if LooksLikeTOTP(c) {
+			t.Errorf("code %q looks like a TOTP code", c)
+		}
+		if seen[c] {
+			t.Errorf("code %q repeated", c)
+		}
+		seen[c] = true
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := HashRecoveryCode("k3q7-x2mf-p9tz")
+	for _, typed := range []string{"k3q7x2mfp9tz", "K3Q7-X2MF-P9TZ", " k3q7 x2mf p9tz ", "k3q7-x2mf-p9tz\n"} {
+		if got := HashRecoveryCode(typed); got != want {
+			t.Errorf("HashRecoveryCode(%q) differs from the code as shown", typed)
+		}
+	}
+	if HashRecoveryCode("k3q7-x2mf-p9ta") == want {
+		t.Error("different codes hash alike")
+	}
+	if want == "k3q7-x2mf-p9tz" || len(want) != 64 {
+		t.Errorf("HashRecoveryCode() = %q, want a SHA-256 hex digest", want)
+	}
+}
+
+func TestLooksLikeTOTP(t *testing.T) {
+	tests := map[string]bool{
+		"123456":         true,
+		"000000":         true,
+		"12345":          false,
+		"1234567":        false,
+		"12345a":         false,
+		"k3q7-x2mf-p9tz": false,
+		"":               false,
+		"１２３４５６":         false,
+	}
+	for code, want := range tests {
+		if got := LooksLikeTOTP(code); got != want {
+			t.Errorf("LooksLikeTOTP(%q) = %t, want %t", code, got, want)
+		}
+	}
+}
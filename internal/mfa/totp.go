@@ -0,0 +1,75 @@
+// Package mfa implements the second factors of LDAP logins: TOTP codes
+// (RFC 6238, 30 second steps, 6 digits, SHA-1 as authenticator apps expect),
+// single-use recovery codes, and the cipher keeping TOTP secrets encrypted
+// at rest.
+package mfa
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"image/png"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	// Period is the length of a TOTP time step
+	Period = 30 * time.Second
+	// Skew is how many steps before and after now are accepted, for clock
+	// drift and slow typing
+	Skew = 1
+)
+
+var totpOpts = totp.ValidateOpts{
+	Period:    uint(Period.Seconds()),
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// NewTOTP generates a TOTP key for account (the employee's email or uid)
+// shown under issuer in authenticator apps.
+func NewTOTP(issuer, account string) (*otp.Key, error) {
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: account,
+		Period:      totpOpts.Period,
+		Digits:      totpOpts.Digits,
+		Algorithm:   totpOpts.Algorithm,
+	})
+}
+
+// QRCode returns key as a PNG data URL for enrollment pages.
+func QRCode(key *otp.Key) (string, error) {
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// VerifyTOTP checks code against secret at now, allowing Skew steps either
+// way. It returns the matched time step, which callers must only accept once
+// to stop replays.
+func VerifyTOTP(secret, code string, now time.Time) (step int64, ok bool) {
+	if len(code) != int(totpOpts.Digits) {
+		return 0, false
+	}
+	current := now.Unix() / int64(totpOpts.Period)
+	for s := current - Skew; s <= current+Skew; s++ {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(s*int64(totpOpts.Period), 0), totpOpts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,66 @@
+package mfa
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 secret of the RFC 6238 test vectors, base32
+// encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestVerifyTOTP(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		at   int64
+		step int64
+		ok   bool
+	}{
+		// The last 6 digits of the RFC 6238 vectors
+		{"rfc 59", "287082", 59, 1, true},
+		{"rfc 1111111109", "081804", 1111111109, 37037036, true},
+		{"rfc 1234567890", "005924", 1234567890, 41152263, true},
+		{"start of step", "287082", 30, 1, true},
+		// Skew accepts the steps either side, reporting the code's own step
+		{"one step late", "287082", 59 + 30, 1, true},
+		{"one step early", "287082", 29, 1, true},
+		{"two steps late", "287082", 59 + 60, 0, false},
+		{"two steps early", "005924", 1234567890 - 60, 0, false},
+		{"wrong code", "287083", 59, 0, false},
+		{"too short", "28708", 59, 0, false},
+		{"eight digits", "94287082", 59, 0, false},
+		{"empty", "", 59, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := VerifyTOTP(rfcSecret, tt.code, time.Unix(tt.at, 0))
+			if ok != tt.ok || step != tt.step {
+				t.Errorf("VerifyTOTP(%q at %d) = %d, %t, want %d, %t", tt.code, tt.at, step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestVerifyTOTPBadSecret(t *testing.T) {
+	if _, ok := VerifyTOTP("not base32!", "287082", time.Unix(59, 0)); ok {
+		t.Error("code accepted for an invalid secret")
+	}
+}
+
+func TestNewTOTP(t *testing.T) {
+	key, err := NewTOTP("go-ldap-sso", "alice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Issuer() != "go-ldap-sso" || key.AccountName() != "alice@example.org" || key.Period() != uint64(Period.Seconds()) {
+		t.Errorf("key = %s", key.URL())
+	}
+	other, err := NewTOTP("go-ldap-sso", "alice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Secret() == other.Secret() {
+		t.Error("two keys share a secret")
+	}
+}
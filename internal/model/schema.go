@@ -3,24 +3,73 @@ package model
 import "time"
 
 type Employee struct {
-	ID    uint   `gorm:"primaryKey"`
-	UID   string `gorm:"unique;not null"`
-	Name  string
-	Email string `gorm:"unique;not null"`
+	ID       uint   `gorm:"primaryKey"`
+	UID      string `gorm:"unique;not null"`
+	Name     string
+	Email    string `gorm:"unique;not null"`
+	DN       string
+	Status   string `gorm:"not null;default:active"`
+	SyncedAt *time.Time
 }
 
 type Scope struct {
 	ID          uint   `gorm:"primaryKey"`
 	Name        string `gorm:"unique;not null"`
 	Description string
+	// OwnerRoleID is the role whose holders approve requests for this scope
+	OwnerRoleID   *uint
+	MaxGrantHours *int
+	// MFARequired nil means required for write and wildcard scopes
+	MFARequired *bool
 }
 
 type EmployeeScope struct {
 	EmployeeID uint
 	ScopeID    uint
+	StartsAt   time.Time
+	ExpiresAt  *time.Time
+	GrantedBy  *uint
+	Reason     string
 }
 
 type TokenBlacklist struct {
 	Token     string `gorm:"primaryKey"`
 	ExpiresAt time.Time
 }
+
+type Role struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"unique;not null"`
+	Description string
+	CreatedAt   time.Time
+}
+
+// RoleParent makes RoleID inherit the scopes of ParentID.
+type RoleParent struct {
+	RoleID   uint
+	ParentID uint
+}
+
+type RoleScope struct {
+	RoleID  uint
+	ScopeID uint
+}
+
+type EmployeeRole struct {
+	EmployeeID uint
+	RoleID     uint
+	CreatedAt  time.Time
+}
+
+type ScopeRequest struct {
+	ID            uint `gorm:"primaryKey"`
+	EmployeeID    uint
+	ScopeID       uint
+	Reason        string `gorm:"not null"`
+	DurationHours *int
+	Status        string `gorm:"not null;default:pending"`
+	DecidedBy     *uint
+	DecidedAt     *time.Time
+	DecisionNote  string
+	CreatedAt     time.Time
+}
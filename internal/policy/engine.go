@@ -0,0 +1,190 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"go-ldap-sso/pkg/authz"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+type compiled struct {
+	Policy
+	program cel.Program
+}
+
+// Engine holds the compiled policy set. Load swaps the set atomically so
+// reloads don't disturb decisions in flight.
+type Engine struct {
+	env *cel.Env
+
+	mu       sync.RWMutex
+	policies []compiled
+}
+
+func NewEngine() (*Engine, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("principal", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("action", cel.StringType),
+		cel.Variable("resource", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("now", cel.TimestampType),
+		cel.Function("granted",
+			cel.Overload("granted_list_string",
+				[]*cel.Type{cel.ListType(cel.StringType), cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(granted),
+			),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create CEL environment: %w", err)
+	}
+	return &Engine{env: env}, nil
+}
+
+func granted(scopes, scope ref.Val) ref.Val {
+	native, err := scopes.ConvertToNative(reflect.TypeOf([]string{}))
+	if err != nil {
+		return types.NewErr("granted: %v", err)
+	}
+	return types.Bool(authz.Scopes(native.([]string)).Grants(string(scope.(types.String))))
+}
+
+// Compile validates p and compiles its condition, which must be boolean.
+func (e *Engine) Compile(p Policy) error {
+	_, err := e.compile(p)
+	return err
+}
+
+func (e *Engine) compile(p Policy) (compiled, error) {
+	if err := p.validate(); err != nil {
+		return compiled{}, err
+	}
+	ast, issues := e.env.Compile(p.Condition)
+	if issues != nil && issues.Err() != nil {
+		return compiled{}, fmt.Errorf("%w %s: %v", ErrInvalidPolicy, p.Name, issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType {
+		return compiled{}, fmt.Errorf("%w %s: condition must be boolean, is %s", ErrInvalidPolicy, p.Name, ast.OutputType())
+	}
+	program, err := e.env.Program(ast)
+	if err != nil {
+		return compiled{}, fmt.Errorf("%w %s: %v", ErrInvalidPolicy, p.Name, err)
+	}
+	return compiled{Policy: p, program: program}, nil
+}
+
+// Validate compiles p on its own, for callers storing policies to be loaded
+// later.
+func Validate(p Policy) error {
+	e, err := NewEngine()
+	if err != nil {
+		return err
+	}
+	return e.Compile(p)
+}
+
+// Load replaces the policy set and returns the number of policies loaded.
+// When any policy is invalid or a name is defined twice nothing is replaced:
+// skipping a broken deny policy would silently allow what it was meant to
+// deny, so the previous set stays in place and every problem is returned.
+func (e *Engine) Load(policies []Policy) (int, error) {
+	set := make([]compiled, 0, len(policies))
+	seen := make(map[string]string)
+	var errs []error
+	for _, p := range policies {
+		if source, dup := seen[p.Name]; dup {
+			errs = append(errs, fmt.Errorf("%w %s: defined in both %s and %s", ErrInvalidPolicy, p.Name, source, p.Source))
+			continue
+		}
+		c, err := e.compile(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Source, err))
+			continue
+		}
+		seen[p.Name] = p.Source
+		set = append(set, c)
+	}
+	if len(errs) > 0 {
+		return 0, errors.Join(errs...)
+	}
+
+	e.mu.Lock()
+	e.policies = set
+	e.mu.Unlock()
+	return len(set), nil
+}
+
+// Policies returns the loaded policies.
+func (e *Engine) Policies() []Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	list := make([]Policy, 0, len(e.policies))
+	for _, c := range e.policies {
+		list = append(list, c.Policy)
+	}
+	return list
+}
+
+// Check decides in. A deny policy whose condition fails to evaluate counts as
+// matching, an allow policy as not matching: errors never grant access.
+func (e *Engine) Check(in Input) Decision {
+	if in.Now.IsZero() {
+		in.Now = time.Now()
+	}
+	vars := map[string]any{
+		"principal": orEmpty(in.Principal),
+		"action":    in.Action,
+		"resource":  orEmpty(in.Resource),
+		"request":   orEmpty(in.Request),
+		"now":       in.Now,
+	}
+
+	e.mu.RLock()
+	policies := e.policies
+	e.mu.RUnlock()
+
+	var allowedBy string
+	for _, c := range policies {
+		if !c.appliesTo(in.Action) {
+			continue
+		}
+
+		out, _, err := c.program.Eval(vars)
+		matched := err == nil && out == types.True
+		if err != nil {
+			log.Printf("⚠️ Policy %s failed to evaluate: %v", c.Name, err)
+		}
+
+		switch c.Effect {
+		case EffectDeny:
+			if matched || err != nil {
+				return Decision{Allowed: false, Policy: c.Name, Reason: "denied by policy " + c.Name}
+			}
+		case EffectAllow:
+			if matched && allowedBy == "" {
+				allowedBy = c.Name
+			}
+		}
+	}
+
+	if allowedBy == "" {
+		return Decision{Allowed: false, Reason: "no policy allows " + in.Action}
+	}
+	return Decision{Allowed: true, Policy: allowedBy, Reason: "allowed by policy " + allowedBy}
+}
+
+func orEmpty(m map[string]any) map[string]any {
+	if m == nil {
+		return map[string]any{}
+	}
+	return m
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoadKeepsPreviousSetOnError(t *testing.T) {
+	e, err := NewEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allow := Policy{Name: "allow-read", Effect: EffectAllow, Actions: []string{"merchant:read"}, Condition: "true", Source: "test"}
+	deny := Policy{Name: "deny-north", Effect: EffectDeny, Actions: []string{"merchant:*"},
+		Condition: `resource.attributes.region == "north"`, Source: "test"}
+	if n, err := e.Load([]Policy{allow, deny}); n != 2 || err != nil {
+		t.Fatalf("Load() = %d, %v", n, err)
+	}
+
+	north := Input{Action: "merchant:read", Resource: map[string]any{"attributes": map[string]any{"region": "north"}}}
+	if d := e.Check(north); d.Allowed {
+		t.Fatalf("Check() before reload = %+v, want denied", d)
+	}
+
+	tests := []struct {
+		name string
+		set  []Policy
+	}{
+		{
+			name: "deny with a syntax error",
+			set: []Policy{allow, {Name: "deny-north", Effect: EffectDeny, Actions: []string{"merchant:*"},
+				Condition: `resource.attributes.region == `, Source: "test"}},
+		},
+		{
+			name: "deny with a non-boolean condition",
+			set: []Policy{allow, {Name: "deny-north", Effect: EffectDeny, Actions: []string{"merchant:*"},
+				Condition: `resource.attributes.region`, Source: "test"}},
+		},
+		{
+			name: "deny without actions",
+			set:  []Policy{allow, {Name: "deny-north", Effect: EffectDeny, Condition: "true", Source: "test"}},
+		},
+		{
+			name: "duplicate name",
+			set:  []Policy{allow, deny, {Name: "deny-north", Effect: EffectAllow, Actions: []string{"*"}, Condition: "true", Source: "db"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := e.Load(tt.set)
+			if n != 0 || !errors.Is(err, ErrInvalidPolicy) {
+				t.Fatalf("Load() = %d, %v, want ErrInvalidPolicy", n, err)
+			}
+			if got := len(e.Policies()); got != 2 {
+				t.Errorf("Policies() after a failed load has %d policies, want 2", got)
+			}
+			if d := e.Check(north); d.Allowed || d.Policy != "deny-north" {
+				t.Errorf("Check() after a failed load = %+v, want denied by deny-north", d)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Policy{Name: "p", Effect: EffectAllow, Actions: []string{"*"}, Condition: `granted(principal.scopes, "a:read")`}
+	if err := Validate(valid); err != nil {
+		t.Errorf("Validate() of a valid policy = %v", err)
+	}
+
+	invalid := valid
+	invalid.Condition = `granted(principal.scopes)`
+	if err := Validate(invalid); !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("Validate() of an invalid policy = %v, want ErrInvalidPolicy", err)
+	}
+}
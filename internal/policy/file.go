@@ -0,0 +1,65 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// policyFile is the layout of a *.yaml policy file.
+type policyFile struct {
+	Policies []Policy `yaml:"policies"`
+}
+
+// LoadDir reads every *.yaml and *.yml file in dir, in name order. A missing
+// directory yields no policies.
+func LoadDir(dir string) ([]Policy, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read policy dir: %w", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if !e.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var policies []Policy
+	for _, name := range names {
+		list, err := LoadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, list...)
+	}
+	return policies, nil
+}
+
+// LoadFile reads the policies of one YAML file.
+func LoadFile(path string) ([]Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy file: %w", err)
+	}
+	var f policyFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for i := range f.Policies {
+		f.Policies[i].Source = path
+	}
+	return f.Policies, nil
+}
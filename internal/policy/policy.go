@@ -0,0 +1,99 @@
+// Package policy decides requests that scope strings alone can't express,
+// such as "merchant:write only for merchants in your own region". Policies
+// are CEL expressions evaluated over the principal, the action, the resource
+// and attributes of the request:
+//
+//	name: merchant-write-own-region
+//	effect: allow
+//	actions: ["merchant:write"]
+//	condition: >
+//	  granted(principal.scopes, "merchant:write") &&
+//	  resource.attributes.region in principal.attributes.l
+//
+// Variables available to conditions:
+//
+//	principal  map: subject, uid, email, name, employee_id, dn, scopes, roles,
+//	           attributes (LDAP attribute name to list of values)
+//	action     string, e.g. "merchant:write"
+//	resource   map: type, id, attributes
+//	request    map of caller-supplied attributes (ip, channel, ...)
+//	now        timestamp of the decision
+//
+// granted(scopes, scope) applies the scope grammar of pkg/authz.
+//
+// Deny overrides allow: a request is allowed when at least one allow policy
+// matches and no deny policy does. Without a matching allow policy it is
+// denied.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// Policy applies Condition to requests whose action matches one of Actions.
+// Actions are exact names or end in ":*" to cover every action below a
+// prefix; "*" covers all.
+type Policy struct {
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description" json:"description"`
+	Effect      string   `yaml:"effect" json:"effect"`
+	Actions     []string `yaml:"actions" json:"actions"`
+	Condition   string   `yaml:"condition" json:"condition"`
+	// Source tells where the policy was loaded from, "db" or a file path
+	Source string `yaml:"-" json:"source"`
+}
+
+func (p Policy) validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPolicy)
+	}
+	if p.Effect != EffectAllow && p.Effect != EffectDeny {
+		return fmt.Errorf("%w %s: effect must be %q or %q", ErrInvalidPolicy, p.Name, EffectAllow, EffectDeny)
+	}
+	if len(p.Actions) == 0 {
+		return fmt.Errorf("%w %s: at least one action is required", ErrInvalidPolicy, p.Name)
+	}
+	if strings.TrimSpace(p.Condition) == "" {
+		return fmt.Errorf("%w %s: condition is required", ErrInvalidPolicy, p.Name)
+	}
+	return nil
+}
+
+func (p Policy) appliesTo(action string) bool {
+	for _, a := range p.Actions {
+		if a == "*" || a == action {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(a, "*"); ok && strings.HasSuffix(prefix, ":") && strings.HasPrefix(action, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Input is what a decision is made on.
+type Input struct {
+	Principal map[string]any
+	Action    string
+	Resource  map[string]any
+	Request   map[string]any
+	Now       time.Time
+}
+
+// Decision is the outcome of Engine.Check.
+type Decision struct {
+	Allowed bool `json:"allowed"`
+	// Policy names the deciding policy, empty when no allow policy matched
+	Policy string `json:"policy,omitempty"`
+	Reason string `json:"reason"`
+}
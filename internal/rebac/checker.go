@@ -0,0 +1,303 @@
+// Package rebac answers relationship-based authorization questions over
+// Zanzibar-style relation tuples: check ("may employee:johndoe view
+// merchant:42?"), expand (the userset tree behind a relation) and list
+// objects ("which merchants may johndoe view?"). How relations derive from
+// one another is described by a Schema.
+package rebac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrTooDeep is returned when resolving a relation needs more than maxDepth
+// nested lookups. Cycles in the tuples don't count, they are cut short.
+var ErrTooDeep = errors.New("relation resolution too deep")
+
+// ErrTooManyObjects is returned by ListObjects for namespaces with more than
+// MaxListObjects objects.
+var ErrTooManyObjects = errors.New("too many objects to list")
+
+const maxDepth = 32
+
+// MaxListObjects caps the objects ListObjects checks one by one.
+const MaxListObjects = 1000
+
+// TupleReader is the storage behind a Checker.
+type TupleReader interface {
+	// Subjects returns the subjects of the tuples object#relation@...
+	Subjects(ctx context.Context, object Object, relation string) ([]Subject, error)
+	// ObjectIDs returns the ids of every object of namespace appearing in a tuple
+	ObjectIDs(ctx context.Context, namespace string) ([]string, error)
+}
+
+type Checker struct {
+	schema *Schema
+	tuples TupleReader
+}
+
+func NewChecker(schema *Schema, tuples TupleReader) *Checker {
+	return &Checker{schema: schema, tuples: tuples}
+}
+
+func (c *Checker) Schema() *Schema { return c.schema }
+
+// userset is object#relation.
+type userset struct {
+	object   Object
+	relation string
+}
+
+// checkRun holds the state of one Check or ListObjects call.
+type checkRun struct {
+	*Checker
+	ctx context.Context
+	// visiting holds the usersets being resolved on the current path; meeting
+	// one again means the tuples form a cycle, which adds no subjects
+	visiting map[userset]bool
+	// subjects remembers tuple reads, the same groups and parents come up
+	// again and again when listing objects
+	subjects map[userset][]Subject
+}
+
+func (c *Checker) newRun(ctx context.Context) *checkRun {
+	return &checkRun{Checker: c, ctx: ctx, visiting: make(map[userset]bool), subjects: make(map[userset][]Subject)}
+}
+
+func (r *checkRun) readSubjects(object Object, relation string) ([]Subject, error) {
+	key := userset{object, relation}
+	if subjects, ok := r.subjects[key]; ok {
+		return subjects, nil
+	}
+	subjects, err := r.tuples.Subjects(r.ctx, object, relation)
+	if err != nil {
+		return nil, err
+	}
+	r.subjects[key] = subjects
+	return subjects, nil
+}
+
+// Check reports whether subject has relation on object.
+func (c *Checker) Check(ctx context.Context, object Object, relation string, subject Subject) (bool, error) {
+	if !c.schema.HasRelation(object.Namespace, relation) {
+		return false, fmt.Errorf("%w: %s#%s", ErrUnknownRelation, object.Namespace, relation)
+	}
+	return c.newRun(ctx).check(object, relation, subject, 0)
+}
+
+func (r *checkRun) check(object Object, relation string, subject Subject, depth int) (bool, error) {
+	if depth > maxDepth {
+		return false, ErrTooDeep
+	}
+	// A userset subject trivially has its own relation
+	if subject.Relation == relation && subject.Object() == object {
+		return true, nil
+	}
+	rw, ok := r.schema.rewrite(object.Namespace, relation)
+	if !ok {
+		return false, nil
+	}
+
+	key := userset{object, relation}
+	if r.visiting[key] {
+		return false, nil
+	}
+	r.visiting[key] = true
+	defer delete(r.visiting, key)
+
+	return r.checkRewrite(object, relation, rw, subject, depth)
+}
+
+func (r *checkRun) checkRewrite(object Object, relation string, rw Rewrite, subject Subject, depth int) (bool, error) {
+	switch {
+	case rw.ComputedUserset != "":
+		return r.check(object, rw.ComputedUserset, subject, depth+1)
+
+	case rw.TupleToUserset != nil:
+		linked, err := r.readSubjects(object, rw.TupleToUserset.Tupleset)
+		if err != nil {
+			return false, err
+		}
+		for _, l := range linked {
+			ok, err := r.check(l.Object(), rw.TupleToUserset.ComputedUserset, subject, depth+1)
+			if ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+
+	case rw.Union != nil:
+		for _, child := range rw.Union {
+			ok, err := r.checkRewrite(object, relation, child, subject, depth)
+			if ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+
+	case rw.Intersection != nil:
+		for _, child := range rw.Intersection {
+			ok, err := r.checkRewrite(object, relation, child, subject, depth)
+			if !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case rw.Exclusion != nil:
+		ok, err := r.checkRewrite(object, relation, rw.Exclusion.Base, subject, depth)
+		if !ok || err != nil {
+			return false, err
+		}
+		excluded, err := r.checkRewrite(object, relation, rw.Exclusion.Subtract, subject, depth)
+		return !excluded, err
+
+	default: // this
+		subjects, err := r.readSubjects(object, relation)
+		if err != nil {
+			return false, err
+		}
+		for _, s := range subjects {
+			if s == subject {
+				return true, nil
+			}
+		}
+		for _, s := range subjects {
+			if s.Relation == "" {
+				continue
+			}
+			ok, err := r.check(s.Object(), s.Relation, subject, depth+1)
+			if ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+}
+
+// Node is one level of an expanded userset tree. Leaves list the subjects of
+// tuples, userset subjects among them can be expanded in turn.
+type Node struct {
+	Operation string   `json:"operation"` // leaf, union, intersection or exclusion
+	Userset   string   `json:"userset,omitempty"`
+	Subjects  []string `json:"subjects,omitempty"`
+	Children  []*Node  `json:"children,omitempty"`
+}
+
+// Expand returns the userset tree of object#relation, following rewrites.
+func (c *Checker) Expand(ctx context.Context, object Object, relation string) (*Node, error) {
+	if !c.schema.HasRelation(object.Namespace, relation) {
+		return nil, fmt.Errorf("%w: %s#%s", ErrUnknownRelation, object.Namespace, relation)
+	}
+	return c.expand(ctx, object, relation, 0)
+}
+
+func (c *Checker) expand(ctx context.Context, object Object, relation string, depth int) (*Node, error) {
+	if depth > maxDepth {
+		return nil, ErrTooDeep
+	}
+	rw, ok := c.schema.rewrite(object.Namespace, relation)
+	if !ok {
+		return &Node{Operation: "leaf", Userset: object.String() + "#" + relation}, nil
+	}
+	node, err := c.expandRewrite(ctx, object, relation, rw, depth)
+	if err != nil {
+		return nil, err
+	}
+	node.Userset = object.String() + "#" + relation
+	return node, nil
+}
+
+func (c *Checker) expandRewrite(ctx context.Context, object Object, relation string, rw Rewrite, depth int) (*Node, error) {
+	switch {
+	case rw.ComputedUserset != "":
+		return c.expand(ctx, object, rw.ComputedUserset, depth+1)
+
+	case rw.TupleToUserset != nil:
+		linked, err := c.tuples.Subjects(ctx, object, rw.TupleToUserset.Tupleset)
+		if err != nil {
+			return nil, err
+		}
+		node := &Node{Operation: "union"}
+		for _, l := range linked {
+			child, err := c.expand(ctx, l.Object(), rw.TupleToUserset.ComputedUserset, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		}
+		return node, nil
+
+	case rw.Union != nil, rw.Intersection != nil:
+		node := &Node{Operation: "union", Children: []*Node{}}
+		children := rw.Union
+		if rw.Intersection != nil {
+			node.Operation = "intersection"
+			children = rw.Intersection
+		}
+		for _, child := range children {
+			n, err := c.expandRewrite(ctx, object, relation, child, depth)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, n)
+		}
+		return node, nil
+
+	case rw.Exclusion != nil:
+		base, err := c.expandRewrite(ctx, object, relation, rw.Exclusion.Base, depth)
+		if err != nil {
+			return nil, err
+		}
+		subtract, err := c.expandRewrite(ctx, object, relation, rw.Exclusion.Subtract, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &Node{Operation: "exclusion", Children: []*Node{base, subtract}}, nil
+
+	default: // this
+		subjects, err := c.tuples.Subjects(ctx, object, relation)
+		if err != nil {
+			return nil, err
+		}
+		node := &Node{Operation: "leaf", Userset: object.String() + "#" + relation, Subjects: []string{}}
+		for _, s := range subjects {
+			node.Subjects = append(node.Subjects, s.String())
+		}
+		sort.Strings(node.Subjects)
+		return node, nil
+	}
+}
+
+// ListObjects returns the ids of the objects of namespace on which subject
+// has relation, sorted. Every object of the namespace that appears in a
+// tuple is checked, sharing tuple reads between the checks; namespaces with
+// more than MaxListObjects objects are refused with ErrTooManyObjects.
+func (c *Checker) ListObjects(ctx context.Context, namespace, relation string, subject Subject) ([]string, error) {
+	if !c.schema.HasRelation(namespace, relation) {
+		return nil, fmt.Errorf("%w: %s#%s", ErrUnknownRelation, namespace, relation)
+	}
+	ids, err := c.tuples.ObjectIDs(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > MaxListObjects {
+		return nil, fmt.Errorf("%w: %s has %d objects, at most %d can be listed", ErrTooManyObjects, namespace, len(ids), MaxListObjects)
+	}
+
+	run := c.newRun(ctx)
+	objects := []string{}
+	for _, id := range ids {
+		ok, err := run.check(Object{Namespace: namespace, ID: id}, relation, subject, 0)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			objects = append(objects, id)
+		}
+	}
+	sort.Strings(objects)
+	return objects, nil
+}
@@ -0,0 +1,230 @@
+package rebac
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testSchema = `
+namespaces:
+  employee: {}
+  group:
+    relations:
+      member: {}
+  folder:
+    relations:
+      parent: {}
+      viewer:
+        union:
+          - this: true
+          - tuple_to_userset: {tupleset: parent, computed_userset: viewer}
+  merchant:
+    relations:
+      region: {}
+      owner: {}
+      manager:
+        union:
+          - this: true
+          - computed_userset: owner
+      viewer:
+        union:
+          - this: true
+          - computed_userset: manager
+      blocked: {}
+      editor:
+        exclusion:
+          base: {computed_userset: manager}
+          subtract: {computed_userset: blocked}
+      auditor:
+        intersection:
+          - this: true
+          - computed_userset: viewer
+`
+
+// memoryTuples is a TupleReader over a fixed list of tuples.
+type memoryTuples struct {
+	tuples []Tuple
+	reads  map[userset]int
+}
+
+func (m *memoryTuples) Subjects(_ context.Context, object Object, relation string) ([]Subject, error) {
+	m.reads[userset{object, relation}]++
+	var list []Subject
+	for _, t := range m.tuples {
+		if t.Object == object && t.Relation == relation {
+			list = append(list, t.Subject)
+		}
+	}
+	return list, nil
+}
+
+func (m *memoryTuples) ObjectIDs(_ context.Context, namespace string) ([]string, error) {
+	var ids []string
+	for _, t := range m.tuples {
+		if t.Object.Namespace == namespace && !slices.Contains(ids, t.Object.ID) {
+			ids = append(ids, t.Object.ID)
+		}
+	}
+	return ids, nil
+}
+
+func parseSchema(t *testing.T, doc string) *Schema {
+	t.Helper()
+	var s Schema
+	if err := yaml.Unmarshal([]byte(doc), &s); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return &s
+}
+
+func newTestChecker(t *testing.T, tuples ...string) (*Checker, *memoryTuples) {
+	t.Helper()
+	store := &memoryTuples{reads: make(map[userset]int)}
+	for _, s := range tuples {
+		tuple, err := ParseTuple(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.tuples = append(store.tuples, tuple)
+	}
+	return NewChecker(parseSchema(t, testSchema), store), store
+}
+
+func TestCheck(t *testing.T) {
+	c, _ := newTestChecker(t,
+		"merchant:42#owner@employee:alice",
+		"merchant:42#manager@group:ops#member",
+		"merchant:42#viewer@employee:dave",
+		"merchant:42#blocked@employee:bob",
+		"merchant:42#auditor@employee:alice",
+		"merchant:42#auditor@employee:erin",
+		"group:ops#member@employee:bob",
+		"group:ops#member@employee:carol",
+		"folder:a#parent@folder:b",
+		"folder:b#viewer@employee:alice",
+		// Membership cycles: group:x and group:y include each other, and so
+		// do folder:c and folder:d
+		"group:x#member@group:y#member",
+		"group:y#member@group:x#member",
+		"group:y#member@employee:frank",
+		"merchant:43#viewer@group:x#member",
+		"folder:c#parent@folder:d",
+		"folder:d#parent@folder:c",
+	)
+
+	tests := []struct {
+		tuple string
+		want  bool
+	}{
+		{"merchant:42#owner@employee:alice", true},
+		{"merchant:42#owner@employee:bob", false},
+		// computed usersets
+		{"merchant:42#manager@employee:alice", true},
+		{"merchant:42#viewer@employee:alice", true},
+		// through a group
+		{"merchant:42#manager@employee:carol", true},
+		{"merchant:42#viewer@employee:bob", true},
+		{"merchant:42#manager@employee:dave", false},
+		// a userset subject holds its own relation
+		{"merchant:42#manager@group:ops#member", true},
+		// exclusion
+		{"merchant:42#editor@employee:carol", true},
+		{"merchant:42#editor@employee:bob", false},
+		{"merchant:42#editor@employee:dave", false},
+		// intersection
+		{"merchant:42#auditor@employee:alice", true},
+		{"merchant:42#auditor@employee:erin", false},
+		{"merchant:42#auditor@employee:dave", false},
+		// tuple to userset
+		{"folder:a#viewer@employee:alice", true},
+		{"folder:a#viewer@employee:bob", false},
+		// cycles resolve instead of failing
+		{"group:x#member@employee:frank", true},
+		{"merchant:43#viewer@employee:frank", true},
+		{"group:x#member@employee:alice", false},
+		{"merchant:43#viewer@employee:alice", false},
+		{"folder:c#viewer@employee:alice", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tuple, func(t *testing.T) {
+			tuple, err := ParseTuple(tt.tuple)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.Check(context.Background(), tuple.Object, tuple.Relation, tuple.Subject)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	_, err := c.Check(context.Background(), Object{"merchant", "42"}, "nope", Subject{Namespace: "employee", ID: "alice"})
+	if !errors.Is(err, ErrUnknownRelation) {
+		t.Errorf("Check() of an unknown relation error = %v", err)
+	}
+}
+
+func TestCheckTooDeep(t *testing.T) {
+	// A chain of distinct folders longer than maxDepth is not a cycle
+	var tuples []string
+	for i := 0; i <= maxDepth+1; i++ {
+		tuples = append(tuples, "folder:"+strconv.Itoa(i)+"#parent@folder:"+strconv.Itoa(i+1))
+	}
+	c, _ := newTestChecker(t, tuples...)
+
+	_, err := c.Check(context.Background(), Object{"folder", "0"}, "viewer", Subject{Namespace: "employee", ID: "alice"})
+	if !errors.Is(err, ErrTooDeep) {
+		t.Errorf("Check() error = %v, want ErrTooDeep", err)
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	c, store := newTestChecker(t,
+		"merchant:1#owner@employee:alice",
+		"merchant:2#manager@group:ops#member",
+		"merchant:3#viewer@group:ops#member",
+		"merchant:4#owner@employee:bob",
+		"merchant:2#blocked@employee:alice",
+		"group:ops#member@employee:alice",
+	)
+
+	ids, err := c.ListObjects(context.Background(), "merchant", "viewer", Subject{Namespace: "employee", ID: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ids, []string{"1", "2", "3"}) {
+		t.Errorf("ListObjects(viewer) = %v", ids)
+	}
+	// Shared by merchants 2 and 3, read once
+	if reads := store.reads[userset{Object{"group", "ops"}, "member"}]; reads != 1 {
+		t.Errorf("ListObjects(viewer) read group:ops#member %d times, want 1", reads)
+	}
+
+	ids, err = c.ListObjects(context.Background(), "merchant", "editor", Subject{Namespace: "employee", ID: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ids, []string{"1"}) {
+		t.Errorf("ListObjects(editor) = %v", ids)
+	}
+
+	for i := 0; i <= MaxListObjects; i++ {
+		tuple, _ := ParseTuple("merchant:m" + strconv.Itoa(i) + "#owner@employee:bob")
+		store.tuples = append(store.tuples, tuple)
+	}
+	if _, err := c.ListObjects(context.Background(), "merchant", "viewer", Subject{Namespace: "employee", ID: "alice"}); !errors.Is(err, ErrTooManyObjects) {
+		t.Errorf("ListObjects() of a large namespace error = %v, want ErrTooManyObjects", err)
+	}
+}
@@ -0,0 +1,204 @@
+package rebac
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrUnknownRelation = errors.New("unknown namespace or relation")
+
+// Schema lists the namespaces and, per relation, how it is computed:
+//
+//	namespaces:
+//	  employee: {}
+//	  group:
+//	    relations:
+//	      member: {}
+//	  merchant:
+//	    relations:
+//	      parent: {}
+//	      owner: {}
+//	      manager:
+//	        union:
+//	          - this: true
+//	          - computed_userset: owner
+//	      viewer:
+//	        union:
+//	          - this: true
+//	          - computed_userset: manager
+//	          - tuple_to_userset: {tupleset: parent, computed_userset: viewer}
+//
+// A relation without a rewrite ("{}") is only what its tuples say.
+type Schema struct {
+	Namespaces map[string]Namespace `yaml:"namespaces"`
+}
+
+type Namespace struct {
+	Relations map[string]Rewrite `yaml:"relations"`
+}
+
+// Rewrite is a userset rewrite rule; exactly one field is set, none means This.
+type Rewrite struct {
+	// This is the subjects of the relation's own tuples
+	This bool `yaml:"this"`
+	// ComputedUserset is another relation of the same object
+	ComputedUserset string `yaml:"computed_userset"`
+	// TupleToUserset follows the objects in Tupleset and takes their ComputedUserset
+	TupleToUserset *TupleToUserset `yaml:"tuple_to_userset"`
+	Union          []Rewrite       `yaml:"union"`
+	Intersection   []Rewrite       `yaml:"intersection"`
+	Exclusion      *Exclusion      `yaml:"exclusion"`
+}
+
+type TupleToUserset struct {
+	Tupleset        string `yaml:"tupleset"`
+	ComputedUserset string `yaml:"computed_userset"`
+}
+
+// Exclusion is Base without Subtract.
+type Exclusion struct {
+	Base     Rewrite `yaml:"base"`
+	Subtract Rewrite `yaml:"subtract"`
+}
+
+func (r Rewrite) isThis() bool {
+	return r.This || (r.ComputedUserset == "" && r.TupleToUserset == nil &&
+		r.Union == nil && r.Intersection == nil && r.Exclusion == nil)
+}
+
+// LoadSchema reads a YAML schema. A missing file yields an empty schema.
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Schema{Namespaces: map[string]Namespace{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read relation schema: %w", err)
+	}
+
+	var s Schema
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse relation schema: %w", err)
+	}
+	if s.Namespaces == nil {
+		s.Namespaces = map[string]Namespace{}
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Schema) validate() error {
+	for name, ns := range s.Namespaces {
+		if !nameRe.MatchString(name) {
+			return fmt.Errorf("relation schema: invalid namespace %q", name)
+		}
+		for rel, rw := range ns.Relations {
+			if !nameRe.MatchString(rel) {
+				return fmt.Errorf("relation schema: invalid relation %s#%s", name, rel)
+			}
+			if err := ns.validateRewrite(rw); err != nil {
+				return fmt.Errorf("relation schema: %s#%s: %w", name, rel, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (ns Namespace) validateRewrite(r Rewrite) error {
+	set := 0
+	if r.This {
+		set++
+	}
+	if r.ComputedUserset != "" {
+		set++
+		if _, ok := ns.Relations[r.ComputedUserset]; !ok {
+			return fmt.Errorf("computed_userset %q is not a relation of this namespace", r.ComputedUserset)
+		}
+	}
+	if r.TupleToUserset != nil {
+		set++
+		if _, ok := ns.Relations[r.TupleToUserset.Tupleset]; !ok {
+			return fmt.Errorf("tupleset %q is not a relation of this namespace", r.TupleToUserset.Tupleset)
+		}
+		if !nameRe.MatchString(r.TupleToUserset.ComputedUserset) {
+			return fmt.Errorf("tuple_to_userset needs a computed_userset")
+		}
+	}
+	for _, list := range [][]Rewrite{r.Union, r.Intersection} {
+		if list != nil {
+			set++
+			if len(list) == 0 {
+				return fmt.Errorf("empty union or intersection")
+			}
+			for _, child := range list {
+				if err := ns.validateRewrite(child); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if r.Exclusion != nil {
+		set++
+		if err := ns.validateRewrite(r.Exclusion.Base); err != nil {
+			return err
+		}
+		if err := ns.validateRewrite(r.Exclusion.Subtract); err != nil {
+			return err
+		}
+	}
+	if set > 1 {
+		return fmt.Errorf("a rewrite sets exactly one of this, computed_userset, tuple_to_userset, union, intersection, exclusion")
+	}
+	return nil
+}
+
+func (s *Schema) rewrite(namespace, relation string) (Rewrite, bool) {
+	rw, ok := s.Namespaces[namespace].Relations[relation]
+	return rw, ok
+}
+
+// ValidateTuple checks that t only names known namespaces and relations and
+// that its relation can hold tuples, i.e. uses "this" in its rewrite.
+func (s *Schema) ValidateTuple(t Tuple) error {
+	rw, ok := s.rewrite(t.Object.Namespace, t.Relation)
+	if !ok {
+		return fmt.Errorf("%w: %s#%s", ErrUnknownRelation, t.Object.Namespace, t.Relation)
+	}
+	if !usesThis(rw) {
+		return fmt.Errorf("%w: %s#%s is computed and cannot hold tuples", ErrInvalidTuple, t.Object.Namespace, t.Relation)
+	}
+	if _, ok := s.Namespaces[t.Subject.Namespace]; !ok {
+		return fmt.Errorf("%w: namespace %s", ErrUnknownRelation, t.Subject.Namespace)
+	}
+	if t.Subject.Relation != "" {
+		if _, ok := s.rewrite(t.Subject.Namespace, t.Subject.Relation); !ok {
+			return fmt.Errorf("%w: %s#%s", ErrUnknownRelation, t.Subject.Namespace, t.Subject.Relation)
+		}
+	}
+	return nil
+}
+
+func usesThis(r Rewrite) bool {
+	if r.isThis() {
+		return true
+	}
+	for _, list := range [][]Rewrite{r.Union, r.Intersection} {
+		for _, child := range list {
+			if usesThis(child) {
+				return true
+			}
+		}
+	}
+	return r.Exclusion != nil && usesThis(r.Exclusion.Base)
+}
+
+// HasRelation reports whether namespace defines relation.
+func (s *Schema) HasRelation(namespace, relation string) bool {
+	_, ok := s.rewrite(namespace, relation)
+	return ok
+}
@@ -0,0 +1,120 @@
+package rebac
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		err  string // substring of the error, empty for a valid schema
+	}{
+		{name: "example", doc: testSchema},
+		{name: "empty", doc: ""},
+		{
+			name: "invalid namespace",
+			doc:  "namespaces:\n  Merchant: {}\n",
+			err:  `invalid namespace "Merchant"`,
+		},
+		{
+			name: "invalid relation",
+			doc:  "namespaces:\n  merchant:\n    relations:\n      owner-x: {}\n",
+			err:  "invalid relation merchant#owner-x",
+		},
+		{
+			name: "unknown computed userset",
+			doc:  "namespaces:\n  merchant:\n    relations:\n      viewer: {computed_userset: owner}\n",
+			err:  `computed_userset "owner" is not a relation`,
+		},
+		{
+			name: "unknown tupleset",
+			doc:  "namespaces:\n  merchant:\n    relations:\n      viewer:\n        tuple_to_userset: {tupleset: parent, computed_userset: viewer}\n",
+			err:  `tupleset "parent" is not a relation`,
+		},
+		{
+			name: "tuple to userset without computed userset",
+			doc:  "namespaces:\n  merchant:\n    relations:\n      parent: {}\n      viewer:\n        tuple_to_userset: {tupleset: parent}\n",
+			err:  "tuple_to_userset needs a computed_userset",
+		},
+		{
+			name: "empty union",
+			doc:  "namespaces:\n  merchant:\n    relations:\n      viewer: {union: []}\n",
+			err:  "empty union or intersection",
+		},
+		{
+			name: "invalid union child",
+			doc:  "namespaces:\n  merchant:\n    relations:\n      viewer:\n        union:\n          - this: true\n          - computed_userset: owner\n",
+			err:  `computed_userset "owner"`,
+		},
+		{
+			name: "invalid exclusion subtract",
+			doc:  "namespaces:\n  merchant:\n    relations:\n      viewer:\n        exclusion:\n          base: {this: true}\n          subtract: {computed_userset: blocked}\n",
+			err:  `computed_userset "blocked"`,
+		},
+		{
+			name: "two rewrites",
+			doc:  "namespaces:\n  merchant:\n    relations:\n      owner: {}\n      viewer: {this: true, computed_userset: owner}\n",
+			err:  "exactly one of",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "relations.yaml")
+			if err := os.WriteFile(path, []byte(tt.doc), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			s, err := LoadSchema(path)
+			if tt.err == "" {
+				if err != nil || s.Namespaces == nil {
+					t.Fatalf("LoadSchema() = %v, %v", s, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("LoadSchema() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	s, err := LoadSchema(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err != nil || len(s.Namespaces) != 0 {
+		t.Errorf("LoadSchema() of a missing file = %v, %v, want an empty schema", s, err)
+	}
+}
+
+func TestValidateTuple(t *testing.T) {
+	s := parseSchema(t, testSchema)
+
+	tests := []struct {
+		tuple string
+		err   error
+	}{
+		{"merchant:42#owner@employee:alice", nil},
+		{"merchant:42#manager@group:ops#member", nil},
+		{"folder:a#parent@folder:b", nil},
+		{"merchant:42#editor@employee:alice", ErrInvalidTuple},
+		{"merchant:42#nope@employee:alice", ErrUnknownRelation},
+		{"store:42#owner@employee:alice", ErrUnknownRelation},
+		{"merchant:42#owner@robot:r2", ErrUnknownRelation},
+		{"merchant:42#owner@group:ops#admin", ErrUnknownRelation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tuple, func(t *testing.T) {
+			tuple, err := ParseTuple(tt.tuple)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.ValidateTuple(tuple)
+			if tt.err == nil && err != nil || tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("ValidateTuple() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package rebac
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidTuple = errors.New("invalid relation tuple")
+
+var nameRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Object is a namespaced object, written "merchant:42".
+type Object struct {
+	Namespace string `json:"namespace"`
+	ID        string `json:"id"`
+}
+
+func (o Object) String() string { return o.Namespace + ":" + o.ID }
+
+// Subject is who a tuple relates to an object: a single object such as
+// "employee:johndoe", or every subject holding a relation on an object, a
+// userset such as "group:eng#member".
+type Subject struct {
+	Namespace string `json:"namespace"`
+	ID        string `json:"id"`
+	Relation  string `json:"relation,omitempty"`
+}
+
+func (s Subject) String() string {
+	if s.Relation == "" {
+		return s.Namespace + ":" + s.ID
+	}
+	return s.Namespace + ":" + s.ID + "#" + s.Relation
+}
+
+// Object returns the object part of s.
+func (s Subject) Object() Object { return Object{Namespace: s.Namespace, ID: s.ID} }
+
+// Tuple says Subject has Relation on Object, written
+// "merchant:42#manager@employee:johndoe".
+type Tuple struct {
+	Object   Object  `json:"object"`
+	Relation string  `json:"relation"`
+	Subject  Subject `json:"subject"`
+}
+
+func (t Tuple) String() string {
+	return t.Object.String() + "#" + t.Relation + "@" + t.Subject.String()
+}
+
+// ParseObject parses "namespace:id".
+func ParseObject(s string) (Object, error) {
+	ns, id, ok := strings.Cut(s, ":")
+	o := Object{Namespace: ns, ID: id}
+	if !ok {
+		return o, fmt.Errorf("%w: object %q is not namespace:id", ErrInvalidTuple, s)
+	}
+	return o, o.validate()
+}
+
+func (o Object) validate() error {
+	if !nameRe.MatchString(o.Namespace) {
+		return fmt.Errorf("%w: invalid namespace %q", ErrInvalidTuple, o.Namespace)
+	}
+	if o.ID == "" || len(o.ID) > 255 || strings.ContainsAny(o.ID, "#@ \t\n") {
+		return fmt.Errorf("%w: invalid object id %q", ErrInvalidTuple, o.ID)
+	}
+	return nil
+}
+
+// ParseSubject parses "namespace:id" or "namespace:id#relation".
+func ParseSubject(s string) (Subject, error) {
+	obj, rel, _ := strings.Cut(s, "#")
+	o, err := ParseObject(obj)
+	sub := Subject{Namespace: o.Namespace, ID: o.ID, Relation: rel}
+	if err != nil {
+		return sub, err
+	}
+	if strings.Contains(s, "#") && !nameRe.MatchString(rel) {
+		return sub, fmt.Errorf("%w: invalid relation %q", ErrInvalidTuple, rel)
+	}
+	return sub, nil
+}
+
+// ParseTuple parses "namespace:id#relation@subject".
+func ParseTuple(s string) (Tuple, error) {
+	left, subject, ok := strings.Cut(s, "@")
+	if !ok {
+		return Tuple{}, fmt.Errorf("%w: %q has no @subject", ErrInvalidTuple, s)
+	}
+	obj, rel, ok := strings.Cut(left, "#")
+	if !ok {
+		return Tuple{}, fmt.Errorf("%w: %q has no #relation", ErrInvalidTuple, s)
+	}
+
+	var t Tuple
+	var err error
+	if t.Object, err = ParseObject(obj); err != nil {
+		return t, err
+	}
+	if !nameRe.MatchString(rel) {
+		return t, fmt.Errorf("%w: invalid relation %q", ErrInvalidTuple, rel)
+	}
+	t.Relation = rel
+	if t.Subject, err = ParseSubject(subject); err != nil {
+		return t, err
+	}
+	return t, nil
+}
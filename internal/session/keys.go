@@ -0,0 +1,101 @@
+package session
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go-ldap-sso/config"
+	"log"
+	"strings"
+
+	"github.com/gorilla/securecookie"
+)
+
+// MinHashKeyLength is the shortest hash key accepted outside development.
+const MinHashKeyLength = 32
+
+// DecodeKey returns the bytes of a configured key: the text itself, or the
+// decoded remainder when it starts with "base64:".
+func DecodeKey(s string) ([]byte, error) {
+	if encoded, ok := strings.CutPrefix(s, "base64:"); ok {
+		return base64.StdEncoding.DecodeString(encoded)
+	}
+	return []byte(s), nil
+}
+
+// KeyPairs returns the session hash and encryption keys of cfg, current pair
+// first, as NewStore takes them. Outside development every hash key must be
+// at least MinHashKeyLength bytes and the current pair must have an
+// encryption key; in development missing keys are replaced by random ones,
+// ending all sessions on restart.
+func KeyPairs(cfg *config.AuthConfig, development bool) ([][]byte, error) {
+	if len(cfg.SessionPreviousEncryptionKeys) > len(cfg.SessionPreviousHashKeys) {
+		return nil, errors.New("more previous encryption keys than previous hash keys")
+	}
+
+	if cfg.SessionHashKey == "" && development {
+		log.Println("⚠️ SESSION_HASH_KEY is not set, using random session keys: sessions end on restart")
+		return [][]byte{securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32)}, nil
+	}
+
+	current, err := keyPair("SESSION_HASH_KEY", "SESSION_ENCRYPTION_KEY",
+		cfg.SessionHashKey, cfg.SessionEncryptionKey, development)
+	if err != nil {
+		return nil, err
+	}
+	if len(current[1]) == 0 && !development {
+		return nil, errors.New("SESSION_ENCRYPTION_KEY is required outside development")
+	}
+
+	pairs := current
+	for i, hash := range cfg.SessionPreviousHashKeys {
+		var encryption string
+		if i < len(cfg.SessionPreviousEncryptionKeys) {
+			encryption = cfg.SessionPreviousEncryptionKeys[i]
+		}
+		previous, err := keyPair(
+			fmt.Sprintf("SESSION_PREVIOUS_HASH_KEYS item %d", i+1),
+			fmt.Sprintf("SESSION_PREVIOUS_ENCRYPTION_KEYS item %d", i+1),
+			hash, encryption, development)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, previous...)
+	}
+	return pairs, nil
+}
+
+// keyPair decodes and checks one hash and encryption key, named hashName and
+// encryptionName in errors.
+func keyPair(hashName, encryptionName, hash, encryption string, development bool) ([][]byte, error) {
+	name := hashName
+	hashKey, err := DecodeKey(hash)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	switch {
+	case len(hashKey) == 0:
+		return nil, fmt.Errorf("%s is required", name)
+	case len(hashKey) < MinHashKeyLength && !development:
+		return nil, fmt.Errorf("%s is %d bytes, at least %d are required", name, len(hashKey), MinHashKeyLength)
+	case len(hashKey) < MinHashKeyLength:
+		log.Printf("⚠️ %s is shorter than %d bytes, this is refused outside development", name, MinHashKeyLength)
+	}
+
+	name = encryptionName
+	encryptionKey, err := DecodeKey(encryption)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	// AES-128, -192 or -256
+	switch len(encryptionKey) {
+	case 0, 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("%s is %d bytes, want 16, 24 or 32", name, len(encryptionKey))
+	}
+
+	if len(encryptionKey) == 0 {
+		encryptionKey = nil
+	}
+	return [][]byte{hashKey, encryptionKey}, nil
+}
@@ -0,0 +1,163 @@
+package session
+
+import (
+	"encoding/base64"
+	"go-ldap-sso/config"
+	"strings"
+	"testing"
+)
+
+var (
+	hashKey  = strings.Repeat("h", 32)
+	aes128   = strings.Repeat("e", 16)
+	aes256   = strings.Repeat("e", 32)
+	shortKey = strings.Repeat("h", 16)
+)
+
+func TestKeyPair(t *testing.T) {
+	tests := []struct {
+		name        string
+		hash        string
+		encryption  string
+		development bool
+		err         string
+		hashLen     int
+		encLen      int
+	}{
+		{"hash and AES-256", hashKey, aes256, false, "", 32, 32},
+		{"AES-128", hashKey, aes128, false, "", 32, 16},
+		{"AES-192", hashKey, strings.Repeat("e", 24), false, "", 32, 24},
+		{"no encryption", hashKey, "", false, "", 32, 0},
+		{"missing hash", "", aes256, false, "HASH is required", 0, 0},
+		{"missing hash in development", "", aes256, true, "HASH is required", 0, 0},
+		{"short hash", shortKey, aes256, false, "HASH is 16 bytes, at least 32 are required", 0, 0},
+		{"short hash in development", shortKey, aes256, true, "", 16, 32},
+		{"bad AES length", hashKey, strings.Repeat("e", 20), false, "ENC is 20 bytes, want 16, 24 or 32", 0, 0},
+		{"bad AES length in development", hashKey, strings.Repeat("e", 20), true, "ENC is 20 bytes", 0, 0},
+		{"base64", "base64:" + base64.StdEncoding.EncodeToString([]byte(hashKey)),
+			"base64:" + base64.StdEncoding.EncodeToString([]byte(aes128)), false, "", 32, 16},
+		// Shorter than the text it's written as
+		{"short base64 hash", "base64:" + base64.StdEncoding.EncodeToString([]byte(shortKey)), aes256, false,
+			"HASH is 16 bytes", 0, 0},
+		{"invalid base64 hash", "base64:not base64!", aes256, false, "HASH: illegal base64", 0, 0},
+		{"invalid base64 encryption", hashKey, "base64:%%%", false, "ENC: illegal base64", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pair, err := keyPair("HASH", "ENC", tt.hash, tt.encryption, tt.development)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("keyPair() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pair) != 2 || len(pair[0]) != tt.hashLen || len(pair[1]) != tt.encLen {
+				t.Fatalf("keyPair() = %d keys, want lengths %d and %d", len(pair), tt.hashLen, tt.encLen)
+			}
+			if tt.encLen == 0 && pair[1] != nil {
+				// securecookie only skips encryption for a nil key
+				t.Error("missing encryption key is not nil")
+			}
+		})
+	}
+}
+
+func TestKeyPairs(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         config.AuthConfig
+		development bool
+		err         string
+		keys        int
+	}{
+		{"current pair", config.AuthConfig{SessionHashKey: hashKey, SessionEncryptionKey: aes256}, false, "", 2},
+		{"missing hash", config.AuthConfig{SessionEncryptionKey: aes256}, false, "SESSION_HASH_KEY is required", 0},
+		{"missing hash in development", config.AuthConfig{}, true, "", 2},
+		{"short hash", config.AuthConfig{SessionHashKey: shortKey, SessionEncryptionKey: aes256}, false,
+			"SESSION_HASH_KEY is 16 bytes", 0},
+		{"short hash in development", config.AuthConfig{SessionHashKey: shortKey}, true, "", 2},
+		{"missing encryption", config.AuthConfig{SessionHashKey: hashKey}, false,
+			"SESSION_ENCRYPTION_KEY is required outside development", 0},
+		{"missing encryption in development", config.AuthConfig{SessionHashKey: hashKey}, true, "", 2},
+		{"bad AES length", config.AuthConfig{SessionHashKey: hashKey, SessionEncryptionKey: "0123456789"}, false,
+			"SESSION_ENCRYPTION_KEY is 10 bytes", 0},
+		{"previous pairs", config.AuthConfig{
+			SessionHashKey: hashKey, SessionEncryptionKey: aes256,
+			SessionPreviousHashKeys:       []string{hashKey, hashKey},
+			SessionPreviousEncryptionKeys: []string{aes128},
+		}, false, "", 6},
+		{"short previous hash", config.AuthConfig{
+			SessionHashKey: hashKey, SessionEncryptionKey: aes256,
+			SessionPreviousHashKeys: []string{hashKey, shortKey},
+		}, false, "SESSION_PREVIOUS_HASH_KEYS item 2 is 16 bytes", 0},
+		{"bad previous AES length", config.AuthConfig{
+			SessionHashKey: hashKey, SessionEncryptionKey: aes256,
+			SessionPreviousHashKeys:       []string{hashKey},
+			SessionPreviousEncryptionKeys: []string{"0123456789"},
+		}, false, "SESSION_PREVIOUS_ENCRYPTION_KEYS item 1 is 10 bytes", 0},
+		{"more previous encryption keys than hash keys", config.AuthConfig{
+			SessionHashKey: hashKey, SessionEncryptionKey: aes256,
+			SessionPreviousHashKeys:       []string{hashKey},
+			SessionPreviousEncryptionKeys: []string{aes128, aes128},
+		}, false, "more previous encryption keys than previous hash keys", 0},
+		{"more previous encryption keys in development", config.AuthConfig{
+			SessionPreviousEncryptionKeys: []string{aes128},
+		}, true, "more previous encryption keys than previous hash keys", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pairs, err := KeyPairs(&tt.cfg, tt.development)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("KeyPairs() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pairs) != tt.keys {
+				t.Fatalf("KeyPairs() = %d keys, want %d", len(pairs), tt.keys)
+			}
+		})
+	}
+}
+
+func TestKeyPairsPreviousOrder(t *testing.T) {
+	previous := strings.Repeat("p", 32)
+	pairs, err := KeyPairs(&config.AuthConfig{
+		SessionHashKey: hashKey, SessionEncryptionKey: aes256,
+		SessionPreviousHashKeys: []string{previous},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The current pair encodes, so it must come first
+	if string(pairs[0]) != hashKey || string(pairs[1]) != aes256 || string(pairs[2]) != previous || pairs[3] != nil {
+		t.Errorf("KeyPairs() = %q, want the current pair, then the previous one", pairs)
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{"plain text", "plain text", false},
+		{"base64:" + base64.StdEncoding.EncodeToString([]byte{0, 1, 2, 255}), "\x00\x01\x02\xff", false},
+		{"base64:", "", false},
+		{"base64:***", "", true},
+		// Only the prefix selects base64
+		{"BASE64:aGk=", "BASE64:aGk=", false},
+	}
+	for _, tt := range tests {
+		got, err := DecodeKey(tt.in)
+		if (err != nil) != tt.err || string(got) != tt.want {
+			t.Errorf("DecodeKey(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
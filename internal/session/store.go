@@ -0,0 +1,157 @@
+// Package session keeps login sessions in Postgres behind the gorilla
+// sessions.Store interface. The cookie only carries the signed session id;
+// values, login metadata and timeouts live in auth_sessions, so sessions can
+// be listed and ended server-side.
+package session
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"go-ldap-sso/db/authsessions"
+	"go-ldap-sso/internal/auth"
+	"go-ldap-sso/internal/helper"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// Values read into the auth_sessions columns when a session is saved.
+const (
+	// KeyMethod holds the login method, "ldap", "saml", "webauthn"
+	// or "email"
+	KeyMethod = "auth_method"
+	// KeyEmployeeID holds the employee id (int) of the login
+	KeyEmployeeID = "employee_id"
+)
+
+// Store is a sessions.Store backed by auth_sessions.
+type Store struct {
+	repo   *authsessions.Repository
+	codecs []securecookie.Codec
+	// Options is copied into every new session; MaxAge is overridden by
+	// AbsoluteTimeout.
+	Options *sessions.Options
+	// IdleTimeout ends sessions not used for this long
+	IdleTimeout time.Duration
+	// AbsoluteTimeout ends sessions this long after login, however active
+	AbsoluteTimeout time.Duration
+}
+
+// NewStore returns a Store signing and encrypting session ids with keyPairs,
+// as in securecookie.CodecsFromPairs: the first pair encodes, all decode.
+func NewStore(repo *authsessions.Repository, idle, absolute time.Duration, keyPairs ...[]byte) *Store {
+	codecs := securecookie.CodecsFromPairs(keyPairs...)
+	for _, c := range codecs {
+		// securecookie rejects cookies older than 30 days by default
+		if sc, ok := c.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(int(absolute.Seconds()))
+		}
+	}
+	return &Store{
+		repo:   repo,
+		codecs: codecs,
+		Options: &sessions.Options{
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		IdleTimeout:     idle,
+		AbsoluteTimeout: absolute,
+	}
+}
+
+// Get returns the session cached for the request or loads it.
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session named by the request's cookie, marking it seen, or
+// returns a new one if there is none or it has timed out.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	opts.MaxAge = int(s.AbsoluteTimeout.Seconds())
+	session.Options = &opts
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var id string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &id, s.codecs...); err != nil {
+		return session, err
+	}
+
+	row, err := s.repo.Touch(r.Context(), id, s.IdleTimeout)
+	if errors.Is(err, authsessions.ErrNotFound) {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(row.Data)).Decode(&session.Values); err != nil {
+		return session, fmt.Errorf("decode session %s: %w", id, err)
+	}
+	session.ID = id
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session and sets its cookie. A negative MaxAge deletes the
+// session and the cookie.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.repo.Delete(r.Context(), session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(session.Values); err != nil {
+		return fmt.Errorf("encode session: %w", err)
+	}
+	method, _ := session.Values[KeyMethod].(string)
+	var employeeID *int
+	if id, ok := session.Values[KeyEmployeeID].(int); ok {
+		employeeID = &id
+	}
+
+	err := authsessions.ErrNotFound
+	if session.ID != "" {
+		err = s.repo.Update(r.Context(), session.ID, employeeID, method, data.Bytes())
+	}
+	if errors.Is(err, authsessions.ErrNotFound) {
+		// New, or timed out since it was loaded: start a fresh row
+		session.ID, err = auth.NewSessionID()
+		if err != nil {
+			return err
+		}
+		err = s.repo.Create(r.Context(), &authsessions.Session{
+			ID:         session.ID,
+			EmployeeID: employeeID,
+			Method:     method,
+			IPAddress:  helper.ClientIP(r),
+			UserAgent:  r.UserAgent(),
+			Data:       data.Bytes(),
+		}, s.AbsoluteTimeout)
+	}
+	if err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
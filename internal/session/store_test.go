@@ -0,0 +1,161 @@
+package session
+
+import (
+	"context"
+	"go-ldap-sso/db/authsessions"
+	"go-ldap-sso/db/dbtest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const cookieName = "sso_session"
+
+// newTestStore returns a Store over the test database timing sessions out
+// after 30 minutes idle and 8 hours in all, and the pool behind it.
+func newTestStore(t *testing.T) (*Store, *pgxpool.Pool) {
+	t.Helper()
+	database := dbtest.Open(t)
+	s := NewStore(authsessions.NewRepository(database.Pool), 30*time.Minute, 8*time.Hour,
+		[]byte("0123456789abcdef0123456789abcdef"), []byte("0123456789abcdef"))
+	return s, database.Pool
+}
+
+// load returns the session named by cookie, none when nil.
+func load(t *testing.T, s *Store, cookie *http.Cookie) *sessions.Session {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	session, err := s.New(r, cookieName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+// save stores session and returns the cookie set for it.
+func save(t *testing.T, s *Store, session *sessions.Session) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := s.Save(httptest.NewRequest(http.MethodGet, "/", nil), w, session); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Save() set %d cookies, want 1", len(cookies))
+	}
+	return cookies[0]
+}
+
+// login saves a new session of alice and returns its cookie and id.
+func login(t *testing.T, s *Store) (*http.Cookie, string) {
+	t.Helper()
+	session := load(t, s, nil)
+	session.Values[KeyMethod] = "ldap"
+	session.Values["uid"] = "alice"
+	cookie := save(t, s, session)
+	return cookie, session.ID
+}
+
+func exec(t *testing.T, pool *pgxpool.Pool, sql string, args ...any) {
+	t.Helper()
+	if _, err := pool.Exec(context.Background(), sql, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	s, _ := newTestStore(t)
+	cookie, id := login(t, s)
+
+	session := load(t, s, cookie)
+	if session.IsNew || session.ID != id || session.Values["uid"] != "alice" {
+		t.Errorf("loaded session = %s %v, new %t, want %s", session.ID, session.Values, session.IsNew, id)
+	}
+}
+
+func TestStoreIdleTimeout(t *testing.T) {
+	s, pool := newTestStore(t)
+	cookie, id := login(t, s)
+
+	exec(t, pool, "UPDATE auth_sessions SET last_seen_at = now() - interval '29 minutes' WHERE id = $1", id)
+	if session := load(t, s, cookie); session.IsNew {
+		t.Fatal("session timed out before the idle timeout")
+	}
+	// Loading marked it seen, so the idle time starts over
+	exec(t, pool, "UPDATE auth_sessions SET last_seen_at = last_seen_at - interval '29 minutes' WHERE id = $1", id)
+	if session := load(t, s, cookie); session.IsNew {
+		t.Fatal("session timed out though it was used")
+	}
+
+	exec(t, pool, "UPDATE auth_sessions SET last_seen_at = now() - interval '31 minutes' WHERE id = $1", id)
+	session := load(t, s, cookie)
+	if !session.IsNew || session.ID != "" || len(session.Values) != 0 {
+		t.Fatalf("idle session loaded: %s %v", session.ID, session.Values)
+	}
+	// Logging in again starts a new row rather than reviving the idle one
+	save(t, s, session)
+	if session.ID == id || session.ID == "" {
+		t.Errorf("session saved as %q, want a fresh id", session.ID)
+	}
+}
+
+func TestStoreAbsoluteTimeout(t *testing.T) {
+	s, pool := newTestStore(t)
+	cookie, id := login(t, s)
+
+	if cookie.MaxAge != int((8 * time.Hour).Seconds()) {
+		t.Errorf("cookie MaxAge = %d, want the absolute timeout", cookie.MaxAge)
+	}
+	exec(t, pool, "UPDATE auth_sessions SET expires_at = now() - interval '1 second' WHERE id = $1", id)
+	if session := load(t, s, cookie); !session.IsNew || session.ID != "" {
+		t.Errorf("expired session loaded: %s", session.ID)
+	}
+}
+
+func TestStoreSaveTimedOutReplaced(t *testing.T) {
+	s, pool := newTestStore(t)
+	cookie, id := login(t, s)
+
+	// Times out between loading and saving
+	session := load(t, s, cookie)
+	exec(t, pool, "UPDATE auth_sessions SET expires_at = now() - interval '1 second' WHERE id = $1", id)
+	session.Values["uid"] = "bob"
+	cookie = save(t, s, session)
+
+	if session.ID == id || session.ID == "" {
+		t.Fatalf("session saved as %q, want a fresh id", session.ID)
+	}
+	fresh := load(t, s, cookie)
+	if fresh.IsNew || fresh.ID != session.ID || fresh.Values["uid"] != "bob" {
+		t.Errorf("fresh session = %s %v, new %t", fresh.ID, fresh.Values, fresh.IsNew)
+	}
+	var expired bool
+	if err := pool.QueryRow(context.Background(),
+		"SELECT expires_at <= now() FROM auth_sessions WHERE id = $1", id).Scan(&expired); err != nil {
+		t.Fatal(err)
+	}
+	if !expired {
+		t.Error("timed-out row was revived")
+	}
+}
+
+func TestStoreSaveDeletes(t *testing.T) {
+	s, _ := newTestStore(t)
+	cookie, _ := login(t, s)
+
+	session := load(t, s, cookie)
+	session.Options.MaxAge = -1
+	if cookie := save(t, s, session); cookie.MaxAge >= 0 {
+		t.Errorf("cookie MaxAge = %d, want it deleted", cookie.MaxAge)
+	}
+	if session := load(t, s, cookie); !session.IsNew {
+		t.Error("deleted session loaded")
+	}
+}
@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Event is posted as JSON to the security webhook.
+type Event struct {
+	Type string         `json:"type"`
+	Time time.Time      `json:"time"`
+	Data map[string]any `json:"data"`
+}
+
+// Notifier delivers security events. Like mail.Sender, handlers only depend
+// on this interface so development setups can just log.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// NewNotifier returns an HTTP notifier posting to url, or a LogNotifier when
+// url is empty.
+func NewNotifier(url string) Notifier {
+	if url == "" {
+		log.Println("⚠️ SECURITY_WEBHOOK_URL not set, security events will only be logged")
+		return LogNotifier{}
+	}
+	return &HTTPNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type HTTPNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *HTTPNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post webhook: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("post webhook: unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// LogNotifier writes events to the application log instead of posting them.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, event Event) error {
+	body, _ := json.Marshal(event.Data)
+	log.Printf("🚨 Security event %s: %s", event.Type, body)
+	return nil
+}
@@ -0,0 +1,154 @@
+package authz
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Problem is an RFC 7807 application/problem+json body.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Code matches the "error" field of the other API errors
+	Code           string   `json:"error"`
+	RequiredScopes []string `json:"required_scopes,omitempty"`
+	MissingScopes  []string `json:"missing_scopes,omitempty"`
+	// Step-up answers say how recent, in seconds, and with which factors
+	// the caller must have authenticated, and where to do it
+	MaxAge          int      `json:"max_age,omitempty"`
+	RequiredFactors []string `json:"required_factors,omitempty"`
+	ReauthURL       string   `json:"reauth_url,omitempty"`
+}
+
+// WriteProblem sends p with its status code.
+func WriteProblem(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// RequireScopes lets a request through only if the principal is granted every
+// one of scopes.
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return require(scopes, func(p *Principal) []string {
+		return p.Scopes.Missing(scopes...)
+	})
+}
+
+// RequireAnyScope lets a request through if the principal is granted at least
+// one of scopes.
+func RequireAnyScope(scopes ...string) func(http.Handler) http.Handler {
+	return require(scopes, func(p *Principal) []string {
+		if p.Scopes.GrantsAny(scopes...) {
+			return nil
+		}
+		return scopes
+	})
+}
+
+func require(scopes []string, missing func(*Principal) []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := FromContext(r.Context())
+			if !ok {
+				WriteProblem(w, Problem{
+					Type:   "about:blank",
+					Title:  "Unauthorized",
+					Status: http.StatusUnauthorized,
+					Detail: "authentication required",
+					Code:   "unauthenticated",
+				})
+				return
+			}
+
+			m := missing(p)
+			if len(m) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// RFC 6750 hint for bearer token clients
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+			WriteProblem(w, Problem{
+				Type:           "about:blank",
+				Title:          "Forbidden",
+				Status:         http.StatusForbidden,
+				Detail:         "missing scope " + strings.Join(m, ", "),
+				Code:           "insufficient_scope",
+				RequiredScopes: scopes,
+				MissingScopes:  m,
+			})
+		})
+	}
+}
+
+// RequireRecentAuth lets a request through only if the principal
+// authenticated within maxAge (0 for any time) using every one of factors,
+// e.g. AMRMultiFactor. Otherwise browsers asking for a page are redirected to
+// reauthURL with the request as return_to, and other requests get a 401
+// step-up challenge (RFC 9470) pointing at reauthURL, if set.
+func RequireRecentAuth(reauthURL string, maxAge time.Duration, factors ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := FromContext(r.Context())
+			if !ok {
+				WriteProblem(w, Problem{
+					Type:   "about:blank",
+					Title:  "Unauthorized",
+					Status: http.StatusUnauthorized,
+					Detail: "authentication required",
+					Code:   "unauthenticated",
+				})
+				return
+			}
+			recent := maxAge <= 0 || time.Since(p.AuthTime) <= maxAge
+			if recent && p.HasAMR(factors...) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			query := url.Values{}
+			if maxAge > 0 {
+				query.Set("max_age", strconv.Itoa(int(maxAge.Seconds())))
+			}
+			if len(factors) > 0 {
+				query.Set("factors", strings.Join(factors, ","))
+			}
+			browser := r.Method == http.MethodGet && r.Header.Get("Authorization") == "" &&
+				strings.Contains(r.Header.Get("Accept"), "text/html")
+			if browser {
+				query.Set("return_to", r.URL.RequestURI())
+			}
+			target := ""
+			if reauthURL != "" {
+				target = reauthURL + "?" + query.Encode()
+			}
+			if browser && target != "" {
+				http.Redirect(w, r, target, http.StatusFound)
+				return
+			}
+
+			challenge := `Bearer error="insufficient_user_authentication", error_description="recent authentication required"`
+			if maxAge > 0 {
+				challenge += ", max_age=" + strconv.Itoa(int(maxAge.Seconds()))
+			}
+			w.Header().Set("WWW-Authenticate", challenge)
+			WriteProblem(w, Problem{
+				Type:            "about:blank",
+				Title:           "Unauthorized",
+				Status:          http.StatusUnauthorized,
+				Detail:          "authenticate again to continue",
+				Code:            "step_up_required",
+				MaxAge:          int(maxAge.Seconds()),
+				RequiredFactors: factors,
+				ReauthURL:       target,
+			})
+		})
+	}
+}
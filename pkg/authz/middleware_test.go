@@ -0,0 +1,206 @@
+package authz
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+})
+
+// serve runs handler for a request carrying p, none when nil, and decodes
+// the problem answered, if any.
+func serve(t *testing.T, handler http.Handler, r *http.Request, p *Principal) (*httptest.ResponseRecorder, Problem) {
+	t.Helper()
+	if p != nil {
+		r = r.WithContext(WithPrincipal(r.Context(), p))
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	var problem Problem
+	if w.Code != http.StatusNoContent && w.Code != http.StatusFound {
+		if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Fatalf("Content-Type = %q, want application/problem+json", ct)
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("invalid problem %q: %v", w.Body.String(), err)
+		}
+	}
+	return w, problem
+}
+
+func TestRequireScopes(t *testing.T) {
+	handler := RequireScopes("merchant:read", "directory:read")(ok)
+
+	tests := []struct {
+		name    string
+		p       *Principal
+		status  int
+		code    string
+		missing []string
+	}{
+		{"anonymous", nil, http.StatusUnauthorized, "unauthenticated", nil},
+		{"all granted", &Principal{Scopes: Scopes{"merchant:write", "directory:read"}}, http.StatusNoContent, "", nil},
+		{"wildcard", &Principal{Scopes: Scopes{"*"}}, http.StatusNoContent, "", nil},
+		{"one missing", &Principal{Scopes: Scopes{"merchant:read"}}, http.StatusForbidden, "insufficient_scope", []string{"directory:read"}},
+		{"none", &Principal{}, http.StatusForbidden, "insufficient_scope", []string{"merchant:read", "directory:read"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, problem := serve(t, handler, httptest.NewRequest(http.MethodGet, "/", nil), tt.p)
+			if w.Code != tt.status || problem.Code != tt.code {
+				t.Fatalf("status = %d, problem %+v, want %d %q", w.Code, problem, tt.status, tt.code)
+			}
+			if tt.code != "" && (problem.Status != w.Code || problem.Type != "about:blank" || problem.Title == "") {
+				t.Errorf("problem = %+v, want type, title and status %d", problem, w.Code)
+			}
+			if tt.status != http.StatusForbidden {
+				return
+			}
+			if !reflect.DeepEqual(problem.MissingScopes, tt.missing) {
+				t.Errorf("missing_scopes = %v, want %v", problem.MissingScopes, tt.missing)
+			}
+			if want := []string{"merchant:read", "directory:read"}; !reflect.DeepEqual(problem.RequiredScopes, want) {
+				t.Errorf("required_scopes = %v, want %v", problem.RequiredScopes, want)
+			}
+			want := `Bearer error="insufficient_scope", scope="merchant:read directory:read"`
+			if got := w.Header().Get("WWW-Authenticate"); got != want {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRequireAnyScope(t *testing.T) {
+	handler := RequireAnyScope("merchant:read", "directory:read")(ok)
+
+	tests := []struct {
+		name   string
+		p      *Principal
+		status int
+		code   string
+	}{
+		{"anonymous", nil, http.StatusUnauthorized, "unauthenticated"},
+		{"first", &Principal{Scopes: Scopes{"merchant:read"}}, http.StatusNoContent, ""},
+		{"second", &Principal{Scopes: Scopes{"directory:read"}}, http.StatusNoContent, ""},
+		{"other", &Principal{Scopes: Scopes{"sessions:revoke"}}, http.StatusForbidden, "insufficient_scope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, problem := serve(t, handler, httptest.NewRequest(http.MethodGet, "/", nil), tt.p)
+			if w.Code != tt.status || problem.Code != tt.code {
+				t.Fatalf("status = %d, problem %+v, want %d %q", w.Code, problem, tt.status, tt.code)
+			}
+			if tt.status == http.StatusForbidden {
+				// Any of them would do, so all are reported missing
+				want := []string{"merchant:read", "directory:read"}
+				if !reflect.DeepEqual(problem.MissingScopes, want) || !reflect.DeepEqual(problem.RequiredScopes, want) {
+					t.Errorf("problem = %+v, want all scopes required and missing", problem)
+				}
+			}
+		})
+	}
+}
+
+func TestRequireRecentAuth(t *testing.T) {
+	handler := RequireRecentAuth("/reauth", 10*time.Minute, AMRMultiFactor)(ok)
+	recent := time.Now().Add(-time.Minute)
+	old := time.Now().Add(-time.Hour)
+	mfa := []string{AMRPassword, AMROTP, AMRMultiFactor}
+
+	page := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/approve?id=7", nil)
+		r.Header.Set("Accept", "text/html,application/xhtml+xml")
+		return r
+	}
+	api := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/approve?id=7", nil)
+		r.Header.Set("Accept", "application/json")
+		return r
+	}
+	bearerPage := func() *http.Request {
+		r := page()
+		r.Header.Set("Authorization", "Bearer x")
+		return r
+	}
+	htmlPost := func() *http.Request {
+		r := page()
+		r.Method = http.MethodPost
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		r        *http.Request
+		p        *Principal
+		status   int
+		code     string
+		location string
+	}{
+		{"anonymous", api(), nil, http.StatusUnauthorized, "unauthenticated", ""},
+		{"recent with factors", api(), &Principal{AuthTime: recent, AMR: mfa}, http.StatusNoContent, "", ""},
+		{"old login, browser", page(), &Principal{AuthTime: old, AMR: mfa}, http.StatusFound, "",
+			"/reauth?factors=mfa&max_age=600&return_to=%2Fapprove%3Fid%3D7"},
+		{"missing factor, browser", page(), &Principal{AuthTime: recent, AMR: []string{AMRPassword}}, http.StatusFound, "",
+			"/reauth?factors=mfa&max_age=600&return_to=%2Fapprove%3Fid%3D7"},
+		{"old login, api", api(), &Principal{AuthTime: old, AMR: mfa}, http.StatusUnauthorized, "step_up_required", ""},
+		{"missing factor, api", api(), &Principal{AuthTime: recent, AMR: []string{AMRPassword}}, http.StatusUnauthorized, "step_up_required", ""},
+		{"no factors", api(), &Principal{AuthTime: recent}, http.StatusUnauthorized, "step_up_required", ""},
+		// Only page loads are redirected
+		{"bearer page", bearerPage(), &Principal{AuthTime: old, AMR: mfa}, http.StatusUnauthorized, "step_up_required", ""},
+		{"html post", htmlPost(), &Principal{AuthTime: old, AMR: mfa}, http.StatusUnauthorized, "step_up_required", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, problem := serve(t, handler, tt.r, tt.p)
+			if w.Code != tt.status || problem.Code != tt.code {
+				t.Fatalf("status = %d, problem %+v, want %d %q", w.Code, problem, tt.status, tt.code)
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Errorf("Location = %q, want %q", got, tt.location)
+			}
+			if tt.code != "step_up_required" {
+				return
+			}
+			if problem.MaxAge != 600 || !reflect.DeepEqual(problem.RequiredFactors, []string{AMRMultiFactor}) ||
+				problem.ReauthURL != "/reauth?factors=mfa&max_age=600" {
+				t.Errorf("problem = %+v, want max_age, factors and reauth_url without return_to", problem)
+			}
+			want := `Bearer error="insufficient_user_authentication", error_description="recent authentication required", max_age=600`
+			if got := w.Header().Get("WWW-Authenticate"); got != want {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRequireRecentAuthOptions(t *testing.T) {
+	old := &Principal{AuthTime: time.Now().Add(-24 * time.Hour)}
+
+	// Without a maximum age any login will do, unless factors are missing
+	if w, _ := serve(t, RequireRecentAuth("/reauth", 0)(ok), httptest.NewRequest(http.MethodPost, "/", nil), old); w.Code != http.StatusNoContent {
+		t.Errorf("no max age = %d, want 204", w.Code)
+	}
+	w, problem := serve(t, RequireRecentAuth("/reauth", 0, AMRHardwareKey)(ok), httptest.NewRequest(http.MethodPost, "/", nil), old)
+	if w.Code != http.StatusUnauthorized || problem.MaxAge != 0 || problem.ReauthURL != "/reauth?factors=hwk" {
+		t.Errorf("no max age, missing factor = %d %+v", w.Code, problem)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); strings.Contains(got, "max_age") {
+		t.Errorf("WWW-Authenticate = %q, want no max_age", got)
+	}
+
+	// Without a reauth URL browsers get the problem too
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "text/html")
+	w, problem = serve(t, RequireRecentAuth("", time.Minute)(ok), r, old)
+	if w.Code != http.StatusUnauthorized || problem.Code != "step_up_required" || problem.ReauthURL != "" {
+		t.Errorf("no reauth URL = %d %+v, want a step_up_required problem", w.Code, problem)
+	}
+}
@@ -0,0 +1,173 @@
+package authz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Scope grammar
+//
+//	scope    = "*" / name *( ":" name ) [ ":*" ]
+//	name     = 1*( ALPHA / DIGIT / "-" / "_" / "." )
+//
+// Segments are compared case-sensitively. A trailing "*" segment matches one
+// or more further segments, so "merchant:*" grants "merchant:read" and
+// "merchant:voucher:write" but not "merchant" itself; a lone "*" grants
+// everything. "*" anywhere but the end is invalid.
+//
+// The last segment is the action. Some actions imply others on the same
+// resource: "merchant:write" also grants "merchant:read". Implication does
+// not reach into sub-resources, "merchant:write" does not grant
+// "merchant:voucher:read".
+//
+// A required scope may itself contain a wildcard; it is then only granted by
+// a scope at least as broad ("merchant:*" or "*" grant "merchant:*",
+// "merchant:write" does not).
+
+// Wildcard is the segment matching any remainder of a scope.
+const Wildcard = "*"
+
+// impliedActions lists, per action, the actions it grants as well.
+var impliedActions = map[string][]string{
+	"write": {"read"},
+}
+
+// ValidateScope reports whether s follows the scope grammar.
+func ValidateScope(s string) error {
+	if s == "" {
+		return fmt.Errorf("empty scope")
+	}
+	segments := strings.Split(s, ":")
+	for i, seg := range segments {
+		if seg == Wildcard {
+			if i != len(segments)-1 {
+				return fmt.Errorf("scope %q: %q is only allowed as the last segment", s, Wildcard)
+			}
+			continue
+		}
+		if seg == "" {
+			return fmt.Errorf("scope %q: empty segment", s)
+		}
+		for _, c := range seg {
+			if !isNameChar(c) {
+				return fmt.Errorf("scope %q: invalid character %q", s, c)
+			}
+		}
+	}
+	return nil
+}
+
+func isNameChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '_' || c == '.'
+}
+
+// ScopeGrants reports whether holding granted allows required. Invalid
+// scopes never grant and are never granted.
+func ScopeGrants(granted, required string) bool {
+	if ValidateScope(granted) != nil || ValidateScope(required) != nil {
+		return false
+	}
+
+	gs := strings.Split(granted, ":")
+	rs := strings.Split(required, ":")
+
+	for i, seg := range gs {
+		if seg == Wildcard {
+			// Matches one or more remaining segments, a wildcard included
+			return len(rs) > i
+		}
+		if i >= len(rs) {
+			return false
+		}
+		if seg == rs[i] {
+			continue
+		}
+		// Only the action of an otherwise identical scope may differ
+		if i == len(gs)-1 && i == len(rs)-1 {
+			return actionImplies(seg, rs[i])
+		}
+		return false
+	}
+	return len(gs) == len(rs)
+}
+
+func actionImplies(action, other string) bool {
+	for _, implied := range impliedActions[action] {
+		if implied == other || actionImplies(implied, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes is the set of scopes held by a principal.
+type Scopes []string
+
+// Grants reports whether any held scope grants required.
+func (s Scopes) Grants(required string) bool {
+	for _, granted := range s {
+		if ScopeGrants(granted, required) {
+			return true
+		}
+	}
+	return false
+}
+
+// Missing returns the required scopes not granted, in the given order.
+func (s Scopes) Missing(required ...string) []string {
+	var missing []string
+	for _, r := range required {
+		if !s.Grants(r) {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// GrantsAll reports whether every required scope is granted.
+func (s Scopes) GrantsAll(required ...string) bool {
+	return len(s.Missing(required...)) == 0
+}
+
+// GrantsAny reports whether at least one required scope is granted.
+func (s Scopes) GrantsAny(required ...string) bool {
+	for _, r := range required {
+		if s.Grants(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandScopes prepares granted scopes for a token: invalid ones are dropped
+// and returned separately, and every catalog scope granted by a wildcard or
+// an implied action is added, so services comparing plain strings see the
+// same grants as those using ScopeGrants. The result is sorted and unique.
+func ExpandScopes(granted, catalog []string) (scopes []string, invalid []string) {
+	seen := make(map[string]bool)
+	var valid Scopes
+
+	for _, g := range granted {
+		if err := ValidateScope(g); err != nil {
+			invalid = append(invalid, g)
+			continue
+		}
+		if !seen[g] {
+			seen[g] = true
+			valid = append(valid, g)
+		}
+	}
+
+	scopes = append([]string{}, valid...)
+	for _, c := range catalog {
+		if !seen[c] && ValidateScope(c) == nil && valid.Grants(c) {
+			seen[c] = true
+			scopes = append(scopes, c)
+		}
+	}
+
+	sort.Strings(scopes)
+	return scopes, invalid
+}
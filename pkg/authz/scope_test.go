@@ -0,0 +1,200 @@
+package authz
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidateScope(t *testing.T) {
+	tests := []struct {
+		scope string
+		valid bool
+	}{
+		{"merchant:read", true},
+		{"evoucher:merchant:write", true},
+		{"merchant", true},
+		{"*", true},
+		{"merchant:*", true},
+		{"Merchant.v2:read_all-x", true},
+		{"", false},
+		{":read", false},
+		{"merchant:", false},
+		{"merchant::read", false},
+		{"*:read", false},
+		{"merchant:*:read", false},
+		{"merchant:re*", false},
+		{"merchant read", false},
+		{"merchant/read", false},
+		{"merchänt:read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			if err := ValidateScope(tt.scope); (err == nil) != tt.valid {
+				t.Errorf("ValidateScope(%q) = %v, want valid %v", tt.scope, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestScopeGrants(t *testing.T) {
+	tests := []struct {
+		granted, required string
+		want              bool
+	}{
+		// exact match
+		{"merchant:read", "merchant:read", true},
+		{"merchant:read", "merchant:write", false},
+		{"merchant", "merchant", true},
+
+		// a lone wildcard grants everything, itself included
+		{"*", "merchant", true},
+		{"*", "merchant:voucher:write", true},
+		{"*", "*", true},
+		{"*", "merchant:*", true},
+
+		// a trailing wildcard needs at least one more segment
+		{"merchant:*", "merchant:read", true},
+		{"merchant:*", "merchant:voucher:write", true},
+		{"merchant:*", "merchant", false},
+		{"merchant:*", "merchants:read", false},
+		{"merchant:*", "merchant:*", true},
+		{"merchant:voucher:*", "merchant:voucher:read", true},
+		{"merchant:voucher:*", "merchant:read", false},
+		{"merchant:voucher:*", "merchant:*", false},
+
+		// a required wildcard is only granted by one at least as broad
+		{"merchant:write", "merchant:*", false},
+		{"merchant:read", "*", false},
+
+		// write implies read on the same resource only
+		{"merchant:write", "merchant:read", true},
+		{"merchant:read", "merchant:write", false},
+		{"evoucher:merchant:write", "evoucher:merchant:read", true},
+		{"merchant:write", "merchant:voucher:read", false},
+		{"merchant:write", "program:read", false},
+		{"write", "read", true},
+
+		// case-sensitive
+		{"Merchant:read", "merchant:read", false},
+		{"merchant:READ", "merchant:read", false},
+		{"merchant:WRITE", "merchant:read", false},
+
+		// invalid scopes neither grant nor are granted
+		{"*:read", "merchant:read", false},
+		{"merchant::read", "merchant::read", false},
+		{"*", "", false},
+		{"*", "merchant:*:read", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.granted+" grants "+tt.required, func(t *testing.T) {
+			if got := ScopeGrants(tt.granted, tt.required); got != tt.want {
+				t.Errorf("ScopeGrants(%q, %q) = %v, want %v", tt.granted, tt.required, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActionImplies(t *testing.T) {
+	tests := []struct {
+		action, other string
+		want          bool
+	}{
+		{"write", "read", true},
+		{"read", "write", false},
+		{"read", "read", false},
+		{"delete", "read", false},
+		{"Write", "read", false},
+		{"write", "Read", false},
+	}
+
+	for _, tt := range tests {
+		if got := actionImplies(tt.action, tt.other); got != tt.want {
+			t.Errorf("actionImplies(%q, %q) = %v, want %v", tt.action, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	held := Scopes{"merchant:write", "program:*"}
+
+	if !held.GrantsAll("merchant:read", "program:voucher:read") {
+		t.Error("GrantsAll() refused granted scopes")
+	}
+	if got := held.Missing("merchant:read", "report:read", "program", "merchant:*"); !slices.Equal(got, []string{"report:read", "program", "merchant:*"}) {
+		t.Errorf("Missing() = %v", got)
+	}
+	if !held.GrantsAny("report:read", "program:write") || held.GrantsAny("report:read") {
+		t.Error("GrantsAny() mismatch")
+	}
+	if Scopes(nil).Grants("merchant:read") {
+		t.Error("no scopes granted merchant:read")
+	}
+}
+
+func TestExpandScopes(t *testing.T) {
+	catalog := []string{
+		"merchant:read", "merchant:write", "merchant:voucher:read",
+		"program:read", "program:write", "report:read",
+		"bad::scope", "Merchant:read",
+	}
+
+	tests := []struct {
+		name    string
+		granted []string
+		scopes  []string
+		invalid []string
+	}{
+		{
+			name:    "none",
+			granted: nil,
+			scopes:  []string{},
+		},
+		{
+			name:    "write adds read",
+			granted: []string{"merchant:write"},
+			scopes:  []string{"merchant:read", "merchant:write"},
+		},
+		{
+			name:    "wildcard expanded against the catalog",
+			granted: []string{"merchant:*"},
+			scopes:  []string{"merchant:*", "merchant:read", "merchant:voucher:read", "merchant:write"},
+		},
+		{
+			name:    "lone wildcard skips invalid catalog entries",
+			granted: []string{"*"},
+			scopes: []string{"*", "Merchant:read", "merchant:read", "merchant:voucher:read", "merchant:write",
+				"program:read", "program:write", "report:read"},
+		},
+		{
+			name:    "held scope not in the catalog kept",
+			granted: []string{"audit:read", "report:read"},
+			scopes:  []string{"audit:read", "report:read"},
+		},
+		{
+			name:    "duplicates removed",
+			granted: []string{"program:write", "program:write", "program:read"},
+			scopes:  []string{"program:read", "program:write"},
+		},
+		{
+			name:    "invalid dropped",
+			granted: []string{"report:read", "*:read", "", "merchant:*:write"},
+			scopes:  []string{"report:read"},
+			invalid: []string{"*:read", "", "merchant:*:write"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scopes, invalid := ExpandScopes(tt.granted, catalog)
+			if !slices.Equal(scopes, tt.scopes) {
+				t.Errorf("ExpandScopes() scopes = %v, want %v", scopes, tt.scopes)
+			}
+			if !slices.Equal(invalid, tt.invalid) {
+				t.Errorf("ExpandScopes() invalid = %v, want %v", invalid, tt.invalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+-- Seeder: seed_directory_scope
+-- Timestamp: 2026-10-19T09:00:00+07:00
+
+INSERT INTO public.scopes ("name", description) VALUES('directory:read', 'lookup users and groups via /api/directory');
+INSERT INTO public.employee_scopes (employee_id, scope_id)
+SELECT e.id, s.id FROM public.employees e, public.scopes s WHERE e.uid = 'johndoe' AND s."name" = 'directory:read';
+
+-- Add more seed data as needed
@@ -0,0 +1,20 @@
+-- Seeder: seed_roles
+-- Timestamp: 2026-10-19T10:00:00+07:00
+
+INSERT INTO public.roles ("name", description) VALUES('merchant-viewer', 'read-only access to merchants and programs');
+INSERT INTO public.roles ("name", description) VALUES('merchant-operator', 'manage merchants and programs');
+
+INSERT INTO public.role_scopes (role_id, scope_id)
+SELECT r.id, s.id FROM public.roles r, public.scopes s
+WHERE r."name" = 'merchant-viewer' AND s."name" IN ('merchant:read', 'program:read');
+
+INSERT INTO public.role_scopes (role_id, scope_id)
+SELECT r.id, s.id FROM public.roles r, public.scopes s
+WHERE r."name" = 'merchant-operator' AND s."name" IN ('merchant:write', 'program:write');
+
+-- merchant-operator mewarisi scope read dari merchant-viewer
+INSERT INTO public.role_parents (role_id, parent_id)
+SELECT c.id, p.id FROM public.roles c, public.roles p
+WHERE c."name" = 'merchant-operator' AND p."name" = 'merchant-viewer';
+
+-- Add more seed data as needed
@@ -0,0 +1,9 @@
+-- Seeder: seed_scope_policy
+-- Timestamp: 2026-10-19T11:00:00+07:00
+
+-- program:write hanya diberikan sementara, disetujui oleh merchant-operator
+UPDATE public.scopes SET owner_role_id = r.id, max_grant_hours = 72
+FROM public.roles r
+WHERE public.scopes."name" = 'program:write' AND r."name" = 'merchant-operator';
+
+-- Add more seed data as needed
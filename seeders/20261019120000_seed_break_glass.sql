@@ -0,0 +1,14 @@
+-- Seeder: seed_break_glass
+-- Timestamp: 2026-10-19T12:00:00+07:00
+
+-- Pemegang breakglass:elevate boleh elevate ke role break-glass saat insiden
+INSERT INTO public.scopes ("name", description) VALUES('breakglass:elevate', 'self-elevate to the break-glass role via /api/break-glass');
+INSERT INTO public.employee_scopes (employee_id, scope_id)
+SELECT e.id, s.id FROM public.employees e, public.scopes s WHERE e.uid = 'johndoe' AND s."name" = 'breakglass:elevate';
+
+INSERT INTO public.roles ("name", description) VALUES('break-glass', 'emergency access during incidents');
+INSERT INTO public.role_parents (role_id, parent_id)
+SELECT c.id, p.id FROM public.roles c, public.roles p
+WHERE c."name" = 'break-glass' AND p."name" = 'merchant-operator';
+
+-- Add more seed data as needed
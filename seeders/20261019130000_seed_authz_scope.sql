@@ -0,0 +1,8 @@
+-- Seeder: seed_authz_scope
+-- Timestamp: 2026-10-19T13:00:00+07:00
+
+INSERT INTO public.scopes ("name", description) VALUES('authz:check', 'ask for policy decisions via /authz/check');
+INSERT INTO public.employee_scopes (employee_id, scope_id)
+SELECT e.id, s.id FROM public.employees e, public.scopes s WHERE e.uid = 'johndoe' AND s."name" = 'authz:check';
+
+-- Add more seed data as needed
@@ -0,0 +1,9 @@
+-- Seeder: seed_relation_scopes
+-- Timestamp: 2026-10-19T14:00:00+07:00
+
+INSERT INTO public.scopes ("name", description) VALUES('relations:read', 'check and expand relationships via /api/relations');
+INSERT INTO public.scopes ("name", description) VALUES('relations:write', 'write and delete relation tuples');
+INSERT INTO public.employee_scopes (employee_id, scope_id)
+SELECT e.id, s.id FROM public.employees e, public.scopes s WHERE e.uid = 'johndoe' AND s."name" IN ('relations:read', 'relations:write');
+
+-- Add more seed data as needed
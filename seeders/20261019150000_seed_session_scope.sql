@@ -0,0 +1,8 @@
+-- Seeder: seed_session_scope
+-- Timestamp: 2026-10-19T15:00:00+07:00
+
+INSERT INTO public.scopes ("name", description) VALUES('sessions:revoke', 'terminate all sessions of an employee');
+INSERT INTO public.employee_scopes (employee_id, scope_id)
+SELECT e.id, s.id FROM public.employees e, public.scopes s WHERE e.uid = 'johndoe' AND s."name" = 'sessions:revoke';
+
+-- Add more seed data as needed
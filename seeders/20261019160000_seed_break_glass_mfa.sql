@@ -0,0 +1,7 @@
+-- Seeder: seed_break_glass_mfa
+-- Timestamp: 2026-10-19T16:00:00+07:00
+
+-- /api/break-glass minta login ulang dengan dua faktor, jadi pemegangnya wajib punya faktor kedua
+UPDATE public.scopes SET mfa_required = TRUE WHERE "name" = 'breakglass:elevate';
+
+-- Add more seed data as needed
@@ -13,10 +13,8 @@ until docker exec $(docker ps -qf "name=openldap") ldapsearch -x -H ldap://local
 done
 echo "✅ LDAP is ready."
 
-# Step 3: Apply LDIF files
+# Step 3: Apply LDIF files (the container is fresh, so forget what was applied before)
 echo "🚀 Adding initial users and modifications..."
-ldapadd -x -D "cn=admin,dc=example,dc=org" -w admin1234 -f ldif/001_init_user.ldif
-ldapadd -x -D "cn=admin,dc=example,dc=org" -w admin1234 -f ldif/002_modify_john_email.ldif
-ldapmodify -x -H ldap://localhost:389 -D "cn=admin,dc=example,dc=org" -w admin1234 -f ldif/003_replace_john_email.ldif
+go run ./cmd ldif apply --reset
 
 echo "✅ All done."
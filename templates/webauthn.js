@@ -0,0 +1,97 @@
+// Passkey ceremonies. The server sends and expects base64url strings where
+// navigator.credentials works with ArrayBuffers.
+const passkey = (() => {
+    function toBuffer(s) {
+        const b64 = s.replace(/-/g, "+").replace(/_/g, "/");
+        const bin = atob(b64 + "===".slice((b64.length + 3) % 4));
+        return Uint8Array.from(bin, c => c.charCodeAt(0)).buffer;
+    }
+
+    function toBase64url(buf) {
+        let bin = "";
+        for (const b of new Uint8Array(buf)) {
+            bin += String.fromCharCode(b);
+        }
+        return btoa(bin).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+    }
+
+    async function post(url, body) {
+        const res = await fetch(url, {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify(body || {})
+        });
+        const data = await res.json().catch(() => ({ message: res.statusText }));
+        if (!res.ok) {
+            const err = new Error(data.message);
+            err.code = data.error;
+            err.reauthURL = data.reauth_url;
+            throw err;
+        }
+        return data;
+    }
+
+    function descriptors(list) {
+        return (list || []).map(c => ({ ...c, id: toBuffer(c.id) }));
+    }
+
+    // register adds a passkey for the logged in employee
+    async function register(name) {
+        const begin = await post("/api/webauthn/register/begin");
+        const options = begin.options.publicKey;
+        options.challenge = toBuffer(options.challenge);
+        options.user.id = toBuffer(options.user.id);
+        options.excludeCredentials = descriptors(options.excludeCredentials);
+
+        const cred = await navigator.credentials.create({ publicKey: options });
+        return post("/api/webauthn/register/finish", {
+            ceremony_token: begin.ceremony_token,
+            name,
+            credential: {
+                id: cred.id,
+                rawId: toBase64url(cred.rawId),
+                type: cred.type,
+                response: {
+                    clientDataJSON: toBase64url(cred.response.clientDataJSON),
+                    attestationObject: toBase64url(cred.response.attestationObject),
+                    transports: cred.response.getTransports ? cred.response.getTransports() : []
+                }
+            }
+        });
+    }
+
+    async function assert(beginURL, finishURL, extra) {
+        const begin = await post(beginURL, extra);
+        const options = begin.options.publicKey;
+        options.challenge = toBuffer(options.challenge);
+        options.allowCredentials = descriptors(options.allowCredentials);
+
+        const cred = await navigator.credentials.get({ publicKey: options });
+        return post(finishURL, {
+            ...extra,
+            ceremony_token: begin.ceremony_token,
+            credential: {
+                id: cred.id,
+                rawId: toBase64url(cred.rawId),
+                type: cred.type,
+                response: {
+                    clientDataJSON: toBase64url(cred.response.clientDataJSON),
+                    authenticatorData: toBase64url(cred.response.authenticatorData),
+                    signature: toBase64url(cred.response.signature),
+                    userHandle: cred.response.userHandle ? toBase64url(cred.response.userHandle) : null
+                }
+            }
+        });
+    }
+
+    return {
+        supported: !!window.PublicKeyCredential,
+        register,
+        // login signs in without a password, with any passkey of this site
+        login: () => assert("/webauthn/login/begin", "/webauthn/login/finish", {}),
+        // secondFactor finishes an LDAP login waiting for a second factor
+        secondFactor: mfaToken => assert("/ldap-login/mfa/webauthn/begin", "/ldap-login/mfa/webauthn/finish", { mfa_token: mfaToken }),
+        // reauthenticate confirms a logged in employee for /reauth
+        reauthenticate: mfaToken => assert("/api/reauth/webauthn/begin", "/api/reauth/webauthn/finish", { mfa_token: mfaToken })
+    };
+})();